@@ -0,0 +1,170 @@
+package tail
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Key of the logs that don't have the aggregated field
+	aggregateMissingKey = "<none>"
+	// Clears the previous table by moving the cursor up the lines of the table and clearing the rest of the screen
+	ansiClearLinesFormat = "\x1b[%dA\x1b[J"
+)
+
+func aggregateFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "aggregate",
+			Usage:   "Instead of printing the logs, count the logs by the field (level, event, connector or any log field like status) and redraw the counts to stderr",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_AGGREGATE"},
+		},
+		&cli.DurationFlag{
+			Name:    "aggregate-interval",
+			Usage:   "How often the --aggregate counts are redrawn",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_AGGREGATE_INTERVAL"},
+			Value:   5 * time.Second,
+		},
+	}
+}
+
+// aggregateSink counts the logs by the value of a field and periodically draws the counts as a table. On a terminal
+// the table is redrawn in place, otherwise the snapshots of the table are appended to the output.
+type aggregateSink struct {
+	field string
+	out   io.Writer
+	tty   bool
+
+	mu     sync.Mutex
+	counts map[string]uint64
+	total  uint64
+	// Lines of the table last drawn
+	drawn int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newAggregateSink creates the sink for the --aggregate mode that draws the counts to stderr.
+func newAggregateSink(c *cli.Context) (*aggregateSink, error) {
+	interval := c.Duration("aggregate-interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("--aggregate-interval must be greater than 0")
+	}
+	tty := term.IsTerminal(int(os.Stderr.Fd()))
+	return newAggregateSinkWithOutput(c.String("aggregate"), interval, os.Stderr, tty), nil
+}
+
+func newAggregateSinkWithOutput(field string, interval time.Duration, out io.Writer, tty bool) *aggregateSink {
+	s := &aggregateSink{
+		field:  field,
+		out:    out,
+		tty:    tty,
+		counts: make(map[string]uint64),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.drawLoop(interval)
+	return s
+}
+
+func (s *aggregateSink) Write(l *management.Log) error {
+	key := s.key(l)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[key]++
+	s.total++
+	return nil
+}
+
+// Close stops redrawing the table and draws the final counts.
+func (s *aggregateSink) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.draw(time.Now())
+}
+
+// key returns the value of the aggregated field of the log.
+func (s *aggregateSink) key(l *management.Log) string {
+	var key string
+	switch s.field {
+	case "level":
+		key = l.Level.String()
+	case "event":
+		key = l.Event.String()
+	case "connector":
+		key = l.ConnectorID
+	default:
+		key = field(l, s.field)
+	}
+	if key == "" {
+		return aggregateMissingKey
+	}
+	return key
+}
+
+func (s *aggregateSink) drawLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			_ = s.draw(now)
+		}
+	}
+}
+
+// draw writes the table of the counts, ordered from the most to the least frequent value.
+func (s *aggregateSink) draw(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.counts))
+	for key := range s.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if s.counts[keys[i]] != s.counts[keys[j]] {
+			return s.counts[keys[i]] > s.counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	var table bytes.Buffer
+	fmt.Fprintf(&table, "%s (%d logs)\n", now.Format(time.TimeOnly), s.total)
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tcount\t%%\n", s.field)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%d\t%.1f\n", key, s.counts[key], 100*float64(s.counts[key])/float64(s.total))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var frame bytes.Buffer
+	if s.drawn > 0 {
+		if s.tty {
+			fmt.Fprintf(&frame, ansiClearLinesFormat, s.drawn)
+		} else {
+			// Snapshots are separated by an empty line
+			frame.WriteByte('\n')
+		}
+	}
+	s.drawn = bytes.Count(table.Bytes(), []byte("\n"))
+	frame.Write(table.Bytes())
+	_, err := s.out.Write(frame.Bytes())
+	return err
+}
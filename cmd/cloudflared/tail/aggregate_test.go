@@ -0,0 +1,66 @@
+package tail
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestAggregateSink_Counts(t *testing.T) {
+	var out bytes.Buffer
+	sink := newAggregateSinkWithOutput("status", time.Hour, &out, false)
+	for _, status := range []float64{200, 404, 200, 200} {
+		require.NoError(t, sink.Write(&management.Log{Fields: map[string]any{"status": status}}))
+	}
+	require.NoError(t, sink.Write(&management.Log{}))
+	require.NoError(t, sink.Close())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 5)
+	assert.Contains(t, lines[0], "(5 logs)")
+	assert.Equal(t, []string{
+		"status  count  %",
+		"200     3      60.0",
+		"404     1      20.0",
+		"<none>  1      20.0",
+	}, lines[1:])
+}
+
+func TestAggregateSink_Key(t *testing.T) {
+	log := &management.Log{Level: management.Warn, Event: management.HTTP, ConnectorID: "connector"}
+	assert.Equal(t, "warn", (&aggregateSink{field: "level"}).key(log))
+	assert.Equal(t, "http", (&aggregateSink{field: "event"}).key(log))
+	assert.Equal(t, "connector", (&aggregateSink{field: "connector"}).key(log))
+	assert.Equal(t, aggregateMissingKey, (&aggregateSink{field: "status"}).key(log))
+}
+
+func TestAggregateSink_Redraw(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		tty       bool
+		separator string
+	}{
+		{name: "terminal", tty: true, separator: "\x1b[3A\x1b[J"},
+		{name: "snapshots", tty: false, separator: "\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			sink := newAggregateSinkWithOutput("level", time.Hour, &out, tt.tty)
+			require.NoError(t, sink.Write(&management.Log{Level: management.Info}))
+			now := time.Now()
+			require.NoError(t, sink.draw(now))
+			first := out.String()
+			out.Reset()
+			require.NoError(t, sink.draw(now))
+			assert.Equal(t, tt.separator+first, out.String())
+			out.Reset()
+			require.NoError(t, sink.Close())
+		})
+	}
+}
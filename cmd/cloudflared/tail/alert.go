@@ -0,0 +1,220 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// The error logs are counted in buckets of a second in the --rate-window
+const rateBucket = time.Second
+
+// alertingDescription documents the alerting flags together, as the flags are listed apart in the help.
+const alertingDescription = `Alerting: --alert-threshold and --alert-command are required together. The --alert-command is run once
+--alert-threshold error logs are received within the --rate-window (default 1m), at most once per --alert-cooldown
+(default 5m).`
+
+// Environment variables that the alert command inherits. The other variables, like the management token and the paths
+// of the credentials, aren't provided to the command.
+var alertEnvironment = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "TZ", "TMPDIR", "TERM",
+	// Required by the commands on windows
+	"SYSTEMROOT", "COMSPEC", "PATHEXT", "WINDIR", "TEMP", "TMP", "USERPROFILE",
+}
+
+// alertFlags are the flags of the alerting; --alert-threshold and --alert-command are required together.
+func alertFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    "alert-threshold",
+			Usage:   "Alerting: run the --alert-command once this many error logs are received within the --rate-window",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ALERT_THRESHOLD"},
+		},
+		&cli.StringFlag{
+			Name:    "alert-command",
+			Usage:   "Alerting: shell command run when the --alert-threshold is reached, with the TUNNEL_ALERT_COUNT, TUNNEL_ALERT_WINDOW and TUNNEL_ALERT_MESSAGE environment variables; only the basic variables like PATH and HOME are inherited",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ALERT_COMMAND"},
+		},
+		&cli.DurationFlag{
+			Name:    "alert-cooldown",
+			Usage:   "Alerting: minimum time between two runs of the --alert-command",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ALERT_COOLDOWN"},
+			Value:   5 * time.Minute,
+		},
+		&cli.DurationFlag{
+			Name:    "rate-window",
+			Usage:   "Alerting: sliding window that the error logs are counted over for the --alert-threshold",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_RATE_WINDOW"},
+			Value:   time.Minute,
+		},
+	}
+}
+
+// rateCount is the number of events in the bucket starting at the time (in buckets since the epoch).
+type rateCount struct {
+	bucket int64
+	count  int
+}
+
+// rateWindow counts the events over a sliding window, with a ring buffer of the counts of the buckets of the window.
+type rateWindow struct {
+	counts []rateCount
+	bucket time.Duration
+}
+
+func newRateWindow(window, bucket time.Duration) *rateWindow {
+	n := int((window + bucket - 1) / bucket)
+	return &rateWindow{counts: make([]rateCount, n), bucket: bucket}
+}
+
+// add counts an event at the time, replacing the count of the bucket that the ring buffer went around from.
+func (w *rateWindow) add(now time.Time) {
+	bucket := now.UnixNano() / int64(w.bucket)
+	c := &w.counts[bucket%int64(len(w.counts))]
+	if c.bucket != bucket {
+		*c = rateCount{bucket: bucket}
+	}
+	c.count++
+}
+
+// count returns the number of events in the window ending at the time.
+func (w *rateWindow) count(now time.Time) int {
+	bucket := now.UnixNano() / int64(w.bucket)
+	total := 0
+	for _, c := range w.counts {
+		if c.bucket <= bucket && bucket-c.bucket < int64(len(w.counts)) {
+			total += c.count
+		}
+	}
+	return total
+}
+
+// alerter runs the alert command when the error logs received within the window reach the threshold, at most once
+// per cooldown.
+type alerter struct {
+	threshold  int
+	command    string
+	cooldown   time.Duration
+	windowSize time.Duration
+	window     *rateWindow
+	log        *zerolog.Logger
+	// The alert commands are killed once the context is cancelled
+	ctx context.Context
+
+	// Only accessed by the processor
+	lastAlert time.Time
+	now       func() time.Time
+	run       func(cmd *exec.Cmd)
+}
+
+// newAlerter creates the alerter from the flags, or returns nil if alerting isn't configured. The alert commands are
+// killed once the context is cancelled.
+func newAlerter(ctx context.Context, c *cli.Context, log *zerolog.Logger) (*alerter, error) {
+	threshold := c.Int("alert-threshold")
+	command := c.String("alert-command")
+	if threshold == 0 && command == "" {
+		return nil, nil
+	}
+	if threshold <= 0 {
+		return nil, errors.New("--alert-command requires an --alert-threshold greater than 0")
+	}
+	if command == "" {
+		return nil, errors.New("--alert-threshold requires an --alert-command to run")
+	}
+	window := c.Duration("rate-window")
+	if window < rateBucket {
+		return nil, fmt.Errorf("--rate-window must be at least %s", rateBucket)
+	}
+	cooldown := c.Duration("alert-cooldown")
+	if cooldown < 0 {
+		return nil, errors.New("--alert-cooldown must not be negative")
+	}
+	return &alerter{
+		threshold:  threshold,
+		command:    command,
+		cooldown:   cooldown,
+		windowSize: window,
+		window:     newRateWindow(window, rateBucket),
+		log:        log,
+		ctx:        ctx,
+		now:        time.Now,
+		run:        runAlertCommand(log),
+	}, nil
+}
+
+// processor counts the error logs and alerts once the threshold is reached. The logs are always kept.
+func (a *alerter) processor() logProcessor {
+	return func(l *management.Log) bool {
+		if l.Level < management.Error {
+			return true
+		}
+		now := a.now()
+		a.window.add(now)
+		count := a.window.count(now)
+		if count < a.threshold || (!a.lastAlert.IsZero() && now.Sub(a.lastAlert) < a.cooldown) {
+			return true
+		}
+		a.lastAlert = now
+		a.log.Warn().Msgf("⚠ %d error logs within %s, running the --alert-command", count, a.windowSize)
+		a.run(a.alertCommand(count, l))
+		return true
+	}
+}
+
+// alertCommand returns the shell command that alerts of the count of error logs, the last of which is the log.
+func (a *alerter) alertCommand(count int, l *management.Log) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(a.ctx, "cmd", "/C", a.command)
+	} else {
+		cmd = exec.CommandContext(a.ctx, "sh", "-c", a.command)
+	}
+	cmd.Env = append(safeEnvironment(os.Environ()),
+		"TUNNEL_ALERT_COUNT="+strconv.Itoa(count),
+		"TUNNEL_ALERT_WINDOW="+a.windowSize.String(),
+		"TUNNEL_ALERT_MESSAGE="+l.Message,
+	)
+	// The output of the command is kept apart from the logs written to stdout
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// safeEnvironment returns the variables of the environment that the alert command inherits.
+func safeEnvironment(environ []string) []string {
+	var env []string
+	for _, v := range environ {
+		name, _, _ := strings.Cut(v, "=")
+		// The names are case insensitive on windows
+		allowed := slices.ContainsFunc(alertEnvironment, func(allowed string) bool {
+			return strings.EqualFold(name, allowed)
+		})
+		if allowed || strings.HasPrefix(name, "LC_") {
+			env = append(env, v)
+		}
+	}
+	return env
+}
+
+// runAlertCommand runs the commands in the background so that the stream isn't held up.
+func runAlertCommand(log *zerolog.Logger) func(cmd *exec.Cmd) {
+	return func(cmd *exec.Cmd) {
+		go func() {
+			if err := cmd.Run(); err != nil {
+				log.Err(err).Msg("unable to run the --alert-command")
+			}
+		}()
+	}
+}
@@ -0,0 +1,153 @@
+package tail
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestRateWindow(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := newRateWindow(3*time.Second, time.Second)
+	w.add(now)
+	w.add(now.Add(500 * time.Millisecond))
+	w.add(now.Add(time.Second))
+	assert.Equal(t, 3, w.count(now.Add(2*time.Second)))
+	// The events of the first bucket are out of the window
+	assert.Equal(t, 1, w.count(now.Add(3*time.Second)))
+	// The ring buffer goes around and replaces the count of the first bucket
+	w.add(now.Add(3 * time.Second))
+	assert.Equal(t, 2, w.count(now.Add(3*time.Second)))
+	assert.Equal(t, 0, w.count(now.Add(time.Minute)))
+}
+
+func TestNewAlerter(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		args      []string
+		disabled  bool
+		expectErr bool
+	}{
+		{
+			name:     "not configured",
+			disabled: true,
+		},
+		{
+			name: "threshold and command",
+			args: []string{"--alert-threshold", "10", "--alert-command", "true", "--rate-window", "30s", "--alert-cooldown", "0"},
+		},
+		{
+			name:      "threshold without command",
+			args:      []string{"--alert-threshold", "10"},
+			expectErr: true,
+		},
+		{
+			name:      "command without threshold",
+			args:      []string{"--alert-command", "true"},
+			expectErr: true,
+		},
+		{
+			name:      "negative threshold",
+			args:      []string{"--alert-threshold", "-1", "--alert-command", "true"},
+			expectErr: true,
+		},
+		{
+			name:      "window shorter than a second",
+			args:      []string{"--alert-threshold", "10", "--alert-command", "true", "--rate-window", "100ms"},
+			expectErr: true,
+		},
+		{
+			name:      "negative cooldown",
+			args:      []string{"--alert-threshold", "10", "--alert-command", "true", "--alert-cooldown", "-1s"},
+			expectErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := newAlerter(context.Background(), newTestContext(t, test.args...), &noopLogger)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.disabled, a == nil)
+		})
+	}
+}
+
+func TestAlerter(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, err := newAlerter(context.Background(), newTestContext(t, "--alert-threshold", "2", "--alert-command", "notify", "--alert-cooldown", "1m"), &noopLogger)
+	require.NoError(t, err)
+	a.now = func() time.Time { return now }
+	var alerts []*exec.Cmd
+	a.run = func(cmd *exec.Cmd) { alerts = append(alerts, cmd) }
+	process := a.processor()
+
+	// Only the error logs are counted, and all of the logs are kept
+	assert.True(t, process(&management.Log{Level: management.Warn}))
+	assert.True(t, process(&management.Log{Level: management.Error}))
+	assert.Empty(t, alerts)
+	assert.True(t, process(&management.Log{Level: management.Error, Message: "failed"}))
+	require.Len(t, alerts, 1)
+	assert.Contains(t, alerts[0].Args, "notify")
+	assert.Contains(t, alerts[0].Env, "TUNNEL_ALERT_COUNT=2")
+	assert.Contains(t, alerts[0].Env, "TUNNEL_ALERT_WINDOW=1m0s")
+	assert.Contains(t, alerts[0].Env, "TUNNEL_ALERT_MESSAGE=failed")
+
+	// No alert within the cooldown
+	now = now.Add(30 * time.Second)
+	process(&management.Log{Level: management.Error})
+	process(&management.Log{Level: management.Error})
+	assert.Len(t, alerts, 1)
+
+	now = now.Add(30 * time.Second)
+	process(&management.Log{Level: management.Error})
+	assert.Len(t, alerts, 2)
+}
+
+func TestSafeEnvironment(t *testing.T) {
+	env := safeEnvironment([]string{
+		"PATH=/usr/bin",
+		"HOME=/home/user",
+		"LC_ALL=C",
+		"TUNNEL_MANAGEMENT_TOKEN=token",
+		"TUNNEL_ORIGIN_CERT=/etc/cloudflared/cert.pem",
+		"SSL_CERT_FILE=/etc/ssl/ca.pem",
+		"SystemRoot=C:\\Windows",
+	})
+	assert.Equal(t, []string{"PATH=/usr/bin", "HOME=/home/user", "LC_ALL=C", "SystemRoot=C:\\Windows"}, env)
+}
+
+func TestAlerter_KilledOnCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command runs with sh")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, err := newAlerter(ctx, newTestContext(t, "--alert-threshold", "1", "--alert-command", "sleep 60"), &noopLogger)
+	require.NoError(t, err)
+	cmd := a.alertCommand(1, &management.Log{Level: management.Error})
+	require.NoError(t, cmd.Start())
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		// The command was killed rather than exiting by itself
+		assert.Error(t, err)
+		assert.False(t, cmd.ProcessState.Success())
+	case <-time.After(10 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("the alert command wasn't killed once the context was cancelled")
+	}
+}
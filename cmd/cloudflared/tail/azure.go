@@ -0,0 +1,217 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	azureMaxAttempts = 5
+	azureBaseBackoff = time.Second
+	azureMaxBackoff  = 30 * time.Second
+	// The Data Collector API accepts up to 30MB per request, which the batches of logs stay well below
+	azureMaxBatch      = 500
+	azureFlushInterval = time.Second
+	azureAPIVersion    = "2016-04-01"
+	azureResource      = "/api/logs"
+	// Field of the logs that Azure Monitor uses as the TimeGenerated of the records
+	azureTimeField = "TimeGenerated"
+)
+
+// The record type of the logs in Log Analytics is named after the log type, which is limited to letters, numbers and
+// underscores.
+var azureLogTypePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,100}$`)
+
+func azureMonitorFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "workspace-id",
+			Usage:   "ID of the Log Analytics workspace to send the logs to when using --output azure-monitor",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_AZURE_WORKSPACE_ID"},
+		},
+		&cli.StringFlag{
+			Name:    "workspace-key",
+			Usage:   "Primary or secondary key of the Log Analytics workspace, which signs the requests when using --output azure-monitor",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_AZURE_WORKSPACE_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "log-type",
+			Usage:   "Type of the records of the logs in Log Analytics when using --output azure-monitor, which are stored in the custom log table <log-type>_CL",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_AZURE_LOG_TYPE"},
+			Value:   "CloudflaredTunnel",
+		},
+		&cli.StringFlag{
+			Name:   "azure-monitor-endpoint",
+			Usage:  "Override the Azure Monitor Data Collector API endpoint",
+			Hidden: true,
+		},
+	}
+}
+
+// azureRecord is the record of a log in Log Analytics, along with the time of the log as the TimeGenerated.
+type azureRecord struct {
+	*management.Log
+	TimeGenerated string `json:"TimeGenerated,omitempty"`
+}
+
+// azureMonitorSink POSTs the logs to the Azure Monitor HTTP Data Collector API in batches, signing each request with
+// the workspace key.
+type azureMonitorSink struct {
+	*batchSink
+	url         string
+	workspaceID string
+	// The decoded workspace key that the requests are signed with
+	key     []byte
+	logType string
+	client  *http.Client
+	log     *zerolog.Logger
+	now     func() time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newAzureMonitorSink(c *cli.Context, log *zerolog.Logger) (*azureMonitorSink, error) {
+	workspaceID := c.String("workspace-id")
+	if workspaceID == "" {
+		return nil, errors.New("--workspace-id is required when using --output azure-monitor")
+	}
+	encodedKey := c.String("workspace-key")
+	if encodedKey == "" {
+		return nil, errors.New("--workspace-key is required when using --output azure-monitor")
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.New("invalid --workspace-key, please provide the base64 encoded key of the workspace")
+	}
+	logType := c.String("log-type")
+	if !azureLogTypePattern.MatchString(logType) {
+		return nil, fmt.Errorf("invalid --log-type %q, please use up to 100 letters, numbers and underscores", logType)
+	}
+	endpoint := c.String("azure-monitor-endpoint")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.ods.opinsights.azure.com", workspaceID)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	return newAzureMonitorSinkWithClient(endpoint, workspaceID, key, logType, client, log), nil
+}
+
+func newAzureMonitorSinkWithClient(endpoint, workspaceID string, key []byte, logType string, client *http.Client, log *zerolog.Logger) *azureMonitorSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &azureMonitorSink{
+		url:         endpoint + azureResource + "?api-version=" + azureAPIVersion,
+		workspaceID: workspaceID,
+		key:         key,
+		logType:     logType,
+		client:      client,
+		log:         log,
+		now:         time.Now,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	s.batchSink = newBatchSink(azureMaxBatch, azureFlushInterval, s.send, log)
+	return s
+}
+
+// Close sends the remaining logs.
+func (s *azureMonitorSink) Close() error {
+	defer s.cancel()
+	return s.batchSink.Close()
+}
+
+// send POSTs the logs to the Data Collector API, retrying with an exponential backoff when the request fails or Azure
+// Monitor responds with a retryable status. The logs are dropped once the attempts are exhausted.
+func (s *azureMonitorSink) send(logs []*management.Log) error {
+	records := make([]azureRecord, 0, len(logs))
+	for _, l := range logs {
+		records = append(records, azureRecord{Log: l, TimeGenerated: l.Time})
+	}
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	backoff := azureBaseBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.post(body)
+		if err == nil {
+			return nil
+		}
+		var permanent *azurePermanentError
+		if errors.As(err, &permanent) || attempt >= azureMaxAttempts {
+			return fmt.Errorf("dropped %d logs: %w", len(logs), err)
+		}
+		s.log.Debug().Err(err).Msgf("retrying azure monitor delivery in %s", backoff)
+		select {
+		case <-s.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, azureMaxBackoff)
+	}
+}
+
+// azurePermanentError is returned when Azure Monitor rejects the request and retrying won't help, e.g. an invalid
+// signature or a malformed payload.
+type azurePermanentError struct {
+	status int
+	body   []byte
+}
+
+func (e *azurePermanentError) Error() string {
+	return fmt.Sprintf("azure monitor returned http status %d: %s", e.status, e.body)
+}
+
+func (s *azureMonitorSink) post(body []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// The date is signed, so it is set again for each attempt
+	date := s.now().UTC().Format(http.TimeFormat)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Log-Type", s.logType)
+	req.Header.Set("x-ms-date", date)
+	req.Header.Set("time-generated-field", azureTimeField)
+	req.Header.Set("Authorization", azureAuthorization(s.workspaceID, s.key, len(body), date))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	// Azure Monitor asks to retry the throttled requests and the server errors
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("azure monitor returned http status %d: %s", resp.StatusCode, respBody)
+	default:
+		return &azurePermanentError{status: resp.StatusCode, body: respBody}
+	}
+}
+
+// azureAuthorization returns the SharedKey authorization of a request of the Data Collector API with the body of the
+// length, which is the HMAC-SHA256 of the method, the length, the content type, the date and the resource signed with
+// the decoded workspace key.
+func azureAuthorization(workspaceID string, key []byte, contentLength int, date string) string {
+	stringToSign := http.MethodPost + "\n" + strconv.Itoa(contentLength) + "\napplication/json\nx-ms-date:" + date + "\n" + azureResource
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	return fmt.Sprintf("SharedKey %s:%s", workspaceID, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,117 @@
+package tail
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestNewAzureMonitorSink(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		args      []string
+		expectErr bool
+	}{
+		{
+			name: "workspace",
+			args: []string{"--workspace-id", "workspace", "--workspace-key", "c2VjcmV0"},
+		},
+		{
+			name:      "missing workspace id",
+			args:      []string{"--workspace-key", "c2VjcmV0"},
+			expectErr: true,
+		},
+		{
+			name:      "missing workspace key",
+			args:      []string{"--workspace-id", "workspace"},
+			expectErr: true,
+		},
+		{
+			name:      "workspace key not base64",
+			args:      []string{"--workspace-id", "workspace", "--workspace-key", "not base64!"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid log type",
+			args:      []string{"--workspace-id", "workspace", "--workspace-key", "c2VjcmV0", "--log-type", "cloudflared-tunnel"},
+			expectErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink, err := newAzureMonitorSink(newTestContext(t, test.args...), &noopLogger)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "https://workspace.ods.opinsights.azure.com/api/logs?api-version=2016-04-01", sink.url)
+			assert.NoError(t, sink.Close())
+		})
+	}
+}
+
+func TestAzureAuthorization(t *testing.T) {
+	// Signed independently with the key "secret"
+	assert.Equal(t,
+		"SharedKey workspace:kaWD2pY3O7IBIP15AksCmclzI2Zb/wpQxD3KxMuQRWA=",
+		azureAuthorization("workspace", []byte("secret"), 2, "Mon, 02 Jan 2023 15:04:05 GMT"),
+	)
+}
+
+func TestAzureMonitorSink_Send(t *testing.T) {
+	now := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	var requests atomic.Int32
+	var records []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request is throttled to validate the retry
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		assert.Equal(t, "/api/logs", r.URL.Path)
+		assert.Equal(t, "CloudflaredTunnel", r.Header.Get("Log-Type"))
+		assert.Equal(t, "Mon, 02 Jan 2023 15:04:05 GMT", r.Header.Get("x-ms-date"))
+		assert.Equal(t, "TimeGenerated", r.Header.Get("time-generated-field"))
+		assert.Equal(t, azureAuthorization("workspace", []byte("secret"), int(r.ContentLength), "Mon, 02 Jan 2023 15:04:05 GMT"), r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&records))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := newAzureMonitorSinkWithClient(server.URL, "workspace", []byte("secret"), "CloudflaredTunnel", server.Client(), &noopLogger)
+	sink.now = func() time.Time { return now }
+	err := sink.send([]*management.Log{{Time: "2023-01-02T15:04:00Z", Level: management.Warn, Message: "test"}})
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, int32(2), requests.Load())
+	require.Len(t, records, 1)
+	assert.Equal(t, "2023-01-02T15:04:00Z", records[0]["TimeGenerated"])
+	assert.Equal(t, "2023-01-02T15:04:00Z", records[0]["time"])
+	assert.Equal(t, "warn", records[0]["level"])
+	assert.Equal(t, "test", records[0]["message"])
+}
+
+func TestAzureMonitorSink_PermanentError(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	sink := newAzureMonitorSinkWithClient(server.URL, "workspace", []byte("secret"), "CloudflaredTunnel", server.Client(), &noopLogger)
+	defer sink.Close()
+	err := sink.send([]*management.Log{{Message: "test"}})
+	assert.ErrorContains(t, err, "http status 403")
+	// The rejected requests aren't retried
+	assert.Equal(t, int32(1), requests.Load())
+}
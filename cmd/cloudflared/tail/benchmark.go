@@ -0,0 +1,106 @@
+package tail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+var fastJSON = jsoniter.ConfigFastest
+
+// benchmarkEvent is a minimal view of a management.EventLog that skips decoding the individual logs.
+type benchmarkEvent struct {
+	Type management.ServerEventType `json:"type"`
+	Logs []jsoniter.RawMessage      `json:"logs"`
+}
+
+// benchmarkStats captures the throughput of a management connection.
+type benchmarkStats struct {
+	elapsed  time.Duration
+	messages int
+	events   int
+	bytes    int
+	// Time between each message received from the server
+	gaps []time.Duration
+}
+
+// runBenchmark will read events from the management connection for the provided duration, bypassing the normal
+// output of the logs, and report the throughput of the connection.
+func runBenchmark(ctx context.Context, conn managementConn, duration time.Duration) (*benchmarkStats, error) {
+	// The connection is closed once the benchmark is complete to interrupt the pending read
+	var expired atomic.Bool
+	timer := time.AfterFunc(duration, func() {
+		expired.Store(true)
+		conn.Close(websocket.StatusNormalClosure, "")
+	})
+	defer timer.Stop()
+	stats := &benchmarkStats{}
+	start := time.Now()
+	last := start
+	for {
+		messageType, message, err := conn.Read(ctx)
+		if err != nil {
+			// The duration of the benchmark expired or the connection was closed
+			if expired.Load() || management.AsClosed(err) != nil {
+				break
+			}
+			return nil, err
+		}
+		now := time.Now()
+		stats.gaps = append(stats.gaps, now.Sub(last))
+		last = now
+		stats.messages++
+		stats.bytes += len(message)
+		if messageType != websocket.MessageText {
+			continue
+		}
+		var event benchmarkEvent
+		if err := fastJSON.Unmarshal(message, &event); err != nil {
+			continue
+		}
+		if event.Type == management.Logs {
+			stats.events += len(event.Logs)
+		}
+	}
+	stats.elapsed = time.Since(start)
+	return stats, nil
+}
+
+// percentile returns the p-th percentile (0..100) of the message gaps.
+func (s *benchmarkStats) percentile(p float64) time.Duration {
+	if len(s.gaps) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(s.gaps))
+	copy(sorted, s.gaps)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(float64(len(sorted)-1) * p / 100)
+	return sorted[index]
+}
+
+// printSummary writes the throughput summary of the benchmark.
+func (s *benchmarkStats) printSummary(w io.Writer) {
+	seconds := s.elapsed.Seconds()
+	var eventsPerSecond, megabytesPerSecond, avgEventSize float64
+	if seconds > 0 {
+		eventsPerSecond = float64(s.events) / seconds
+		megabytesPerSecond = float64(s.bytes) / 1e6 / seconds
+	}
+	if s.events > 0 {
+		avgEventSize = float64(s.bytes) / float64(s.events)
+	}
+	fmt.Fprintf(w, "benchmark duration: %s\n", s.elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "messages received:  %d\n", s.messages)
+	fmt.Fprintf(w, "events decoded:     %d (%.2f events/sec)\n", s.events, eventsPerSecond)
+	fmt.Fprintf(w, "bytes received:     %d (%.3f MB/sec)\n", s.bytes, megabytesPerSecond)
+	fmt.Fprintf(w, "avg event size:     %.1f bytes\n", avgEventSize)
+	fmt.Fprintf(w, "message gap:        p50=%s p95=%s p99=%s\n", s.percentile(50), s.percentile(95), s.percentile(99))
+}
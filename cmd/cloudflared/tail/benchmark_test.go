@@ -0,0 +1,56 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/internal/test"
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestRunBenchmark(t *testing.T) {
+	client, server := test.WSPipe(nil, nil)
+	server.CloseRead(context.Background())
+	defer server.Close(websocket.StatusInternalError, "")
+	go func() {
+		for i := 0; i < 10; i++ {
+			err := management.WriteEvent(server, context.Background(), &management.EventLog{
+				ServerEvent: management.ServerEvent{Type: management.Logs},
+				Logs: []*management.Log{
+					{Message: "test1"},
+					{Message: "test2"},
+				},
+			})
+			require.NoError(t, err)
+		}
+	}()
+	stats, err := runBenchmark(context.Background(), client, 200*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 10, stats.messages)
+	assert.Equal(t, 20, stats.events)
+	assert.Greater(t, stats.bytes, 0)
+	assert.Len(t, stats.gaps, 10)
+	assert.GreaterOrEqual(t, stats.elapsed, 200*time.Millisecond)
+
+	var out bytes.Buffer
+	stats.printSummary(&out)
+	assert.Contains(t, out.String(), "events decoded:     20")
+}
+
+func TestBenchmarkStats_Percentile(t *testing.T) {
+	stats := benchmarkStats{}
+	assert.Equal(t, time.Duration(0), stats.percentile(50))
+	for i := 100; i > 0; i-- {
+		stats.gaps = append(stats.gaps, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 50*time.Millisecond, stats.percentile(50))
+	assert.Equal(t, 95*time.Millisecond, stats.percentile(95))
+	assert.Equal(t, 99*time.Millisecond, stats.percentile(99))
+	assert.Equal(t, 100*time.Millisecond, stats.percentile(100))
+}
@@ -0,0 +1,248 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// PutLogEvents accepts up to 10,000 events and 1MB per request, counting 26 bytes for each event on top of its
+	// message
+	cloudwatchMaxBatchEvents = 10000
+	cloudwatchMaxBatchBytes  = 1024 * 1024
+	cloudwatchEventOverhead  = 26
+	cloudwatchFlushInterval  = time.Second
+	cloudwatchMaxAttempts    = 3
+	cloudwatchRequestTimeout = 30 * time.Second
+)
+
+func cloudwatchFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "cw-group",
+			Usage:   "Name of the AWS CloudWatch Logs log group to put the logs into when using --output cloudwatch",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_CW_GROUP"},
+		},
+		&cli.StringFlag{
+			Name:    "cw-stream",
+			Usage:   "Name of the log stream of the --cw-group, created if it doesn't exist (default: the --connector-id, or else the tunnel ID)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_CW_STREAM"},
+		},
+		&cli.StringFlag{
+			Name:    "cw-region",
+			Usage:   "AWS region of the CloudWatch Logs log group when using --output cloudwatch",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_CW_REGION", "AWS_REGION", "AWS_DEFAULT_REGION"},
+		},
+		&cli.StringFlag{
+			Name:   "cw-endpoint",
+			Usage:  "Override the AWS CloudWatch Logs endpoint",
+			Hidden: true,
+		},
+	}
+}
+
+// cloudwatchLogsAPI is the subset of the CloudWatch Logs client used by the cloudwatchSink.
+type cloudwatchLogsAPI interface {
+	PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error)
+	DescribeLogStreams(ctx context.Context, params *cloudwatchlogs.DescribeLogStreamsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogStreamsOutput, error)
+	CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error)
+}
+
+// cloudwatchSink puts the logs into a log stream of AWS CloudWatch Logs in batches. The sequence token of the stream
+// is fetched before the first batch and kept from the responses. The requests are retried by the retryer of the
+// client.
+type cloudwatchSink struct {
+	*batchSink
+	group  string
+	stream string
+	client cloudwatchLogsAPI
+	log    *zerolog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Only accessed by send, which the batchSink doesn't call concurrently
+	described     bool
+	sequenceToken *string
+}
+
+func newCloudwatchSink(c *cli.Context, log *zerolog.Logger) (*cloudwatchSink, error) {
+	group := expandedString(c, "cw-group")
+	if group == "" {
+		return nil, errors.New("--cw-group is required when using --output cloudwatch")
+	}
+	region := c.String("cw-region")
+	if region == "" {
+		return nil, errors.New("--cw-region is required when using --output cloudwatch")
+	}
+	stream := expandedString(c, "cw-stream")
+	if stream == "" {
+		stream = c.String("connector-id")
+	}
+	if stream == "" {
+		stream = tunnelKey(c.Args().First(), &management.Log{})
+	}
+	// The credentials are resolved by the default credential chain of the SDK
+	cfg, err := config.LoadDefaultConfig(c.Context, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the AWS configuration: %w", err)
+	}
+	client := cloudwatchlogs.NewFromConfig(cfg, func(o *cloudwatchlogs.Options) {
+		if endpoint := c.String("cw-endpoint"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return newCloudwatchSinkWithClient(group, stream, client, log), nil
+}
+
+func newCloudwatchSinkWithClient(group, stream string, client cloudwatchLogsAPI, log *zerolog.Logger) *cloudwatchSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &cloudwatchSink{
+		group:  group,
+		stream: stream,
+		client: client,
+		log:    log,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	s.batchSink = newBatchSink(cloudwatchMaxBatchEvents, cloudwatchFlushInterval, s.send, log)
+	return s
+}
+
+// Close puts the remaining logs.
+func (s *cloudwatchSink) Close() error {
+	defer s.cancel()
+	return s.batchSink.Close()
+}
+
+func (s *cloudwatchSink) send(logs []*management.Log) error {
+	events := make([]types.InputLogEvent, 0, len(logs))
+	for _, l := range logs {
+		data, err := json.Marshal(l)
+		if err != nil {
+			s.log.Debug().Msgf("unable to parse event to json %+v", l)
+			continue
+		}
+		timestamp := time.Now()
+		if t, err := time.Parse(time.RFC3339Nano, l.Time); err == nil {
+			timestamp = t
+		}
+		events = append(events, types.InputLogEvent{Timestamp: aws.Int64(timestamp.UnixMilli()), Message: aws.String(string(data))})
+	}
+	// The events of a request must be in chronological order
+	sort.SliceStable(events, func(i, j int) bool { return *events[i].Timestamp < *events[j].Timestamp })
+
+	start, size := 0, 0
+	for i, e := range events {
+		eventSize := len(*e.Message) + cloudwatchEventOverhead
+		if (size+eventSize > cloudwatchMaxBatchBytes || i-start >= cloudwatchMaxBatchEvents) && i > start {
+			if err := s.putLogEvents(events[start:i]); err != nil {
+				return err
+			}
+			start, size = i, 0
+		}
+		size += eventSize
+	}
+	if start == len(events) {
+		return nil
+	}
+	return s.putLogEvents(events[start:])
+}
+
+// putLogEvents puts the events into the log stream, creating the stream if it doesn't exist and putting the events
+// again with the expected sequence token if the token is out of date.
+func (s *cloudwatchSink) putLogEvents(events []types.InputLogEvent) error {
+	if !s.described {
+		if err := s.describeLogStream(); err != nil {
+			return err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(s.ctx, cloudwatchRequestTimeout)
+		resp, err := s.client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(s.group),
+			LogStreamName: aws.String(s.stream),
+			LogEvents:     events,
+			SequenceToken: s.sequenceToken,
+		})
+		cancel()
+		if err == nil {
+			s.sequenceToken = resp.NextSequenceToken
+			if resp.RejectedLogEventsInfo != nil {
+				s.log.Warn().Msgf("cloudwatch logs rejected some of the logs as too old or too new for the log group %s", s.group)
+			}
+			return nil
+		}
+		if attempt >= cloudwatchMaxAttempts {
+			return err
+		}
+		var (
+			alreadyAccepted *types.DataAlreadyAcceptedException
+			invalidToken    *types.InvalidSequenceTokenException
+			notFound        *types.ResourceNotFoundException
+		)
+		switch {
+		case errors.As(err, &alreadyAccepted):
+			// The batch was put by a previous attempt whose response was lost
+			s.sequenceToken = alreadyAccepted.ExpectedSequenceToken
+			return nil
+		case errors.As(err, &invalidToken):
+			s.sequenceToken = invalidToken.ExpectedSequenceToken
+		case errors.As(err, &notFound):
+			if err := s.createLogStream(); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// describeLogStream fetches the sequence token of the log stream, creating the stream if it doesn't exist.
+func (s *cloudwatchSink) describeLogStream() error {
+	ctx, cancel := context.WithTimeout(s.ctx, cloudwatchRequestTimeout)
+	defer cancel()
+	resp, err := s.client.DescribeLogStreams(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(s.group),
+		LogStreamNamePrefix: aws.String(s.stream),
+	})
+	if err != nil {
+		return err
+	}
+	for _, stream := range resp.LogStreams {
+		if aws.ToString(stream.LogStreamName) == s.stream {
+			s.described, s.sequenceToken = true, stream.UploadSequenceToken
+			return nil
+		}
+	}
+	return s.createLogStream()
+}
+
+func (s *cloudwatchSink) createLogStream() error {
+	ctx, cancel := context.WithTimeout(s.ctx, cloudwatchRequestTimeout)
+	defer cancel()
+	_, err := s.client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(s.group),
+		LogStreamName: aws.String(s.stream),
+	})
+	var exists *types.ResourceAlreadyExistsException
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("unable to create log stream %s of log group %s: %w", s.stream, s.group, err)
+	}
+	// A new log stream doesn't have a sequence token
+	s.described, s.sequenceToken = true, nil
+	return nil
+}
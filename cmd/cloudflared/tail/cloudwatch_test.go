@@ -0,0 +1,130 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// fakeCloudwatchLogs records the calls to the CloudWatch Logs API, failing the puts with the errors provided.
+type fakeCloudwatchLogs struct {
+	mu        sync.Mutex
+	actions   []string
+	puts      []*cloudwatchlogs.PutLogEventsInput
+	streams   []types.LogStream
+	putErrors []error
+}
+
+func (f *fakeCloudwatchLogs) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actions = append(f.actions, "PutLogEvents")
+	f.puts = append(f.puts, params)
+	if len(f.putErrors) > 0 {
+		err := f.putErrors[0]
+		f.putErrors = f.putErrors[1:]
+		return nil, err
+	}
+	return &cloudwatchlogs.PutLogEventsOutput{NextSequenceToken: aws.String("next")}, nil
+}
+
+func (f *fakeCloudwatchLogs) DescribeLogStreams(ctx context.Context, params *cloudwatchlogs.DescribeLogStreamsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogStreamsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actions = append(f.actions, "DescribeLogStreams")
+	return &cloudwatchlogs.DescribeLogStreamsOutput{LogStreams: f.streams}, nil
+}
+
+func (f *fakeCloudwatchLogs) CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actions = append(f.actions, "CreateLogStream")
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func TestCloudwatchSink_PutLogEvents(t *testing.T) {
+	// The log stream doesn't exist yet, and the first put is rejected to validate the retry with the expected
+	// sequence token
+	client := &fakeCloudwatchLogs{
+		putErrors: []error{&types.InvalidSequenceTokenException{ExpectedSequenceToken: aws.String("expected")}},
+	}
+	sink := newCloudwatchSinkWithClient("/cloudflared/tunnel", "connector", client, &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Time: "2023-01-01T00:00:01Z", Message: "second"}))
+	require.NoError(t, sink.Write(&management.Log{Time: "2023-01-01T00:00:00Z", Message: "first"}))
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, []string{"DescribeLogStreams", "CreateLogStream", "PutLogEvents", "PutLogEvents"}, client.actions)
+	require.Len(t, client.puts, 2)
+	assert.Nil(t, client.puts[0].SequenceToken)
+	assert.Equal(t, "expected", aws.ToString(client.puts[1].SequenceToken))
+	assert.Equal(t, "/cloudflared/tunnel", aws.ToString(client.puts[1].LogGroupName))
+	assert.Equal(t, "connector", aws.ToString(client.puts[1].LogStreamName))
+	// The events are put in chronological order
+	require.Len(t, client.puts[1].LogEvents, 2)
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(), aws.ToInt64(client.puts[1].LogEvents[0].Timestamp))
+	var l management.Log
+	require.NoError(t, json.Unmarshal([]byte(aws.ToString(client.puts[1].LogEvents[0].Message)), &l))
+	assert.Equal(t, "first", l.Message)
+	assert.Equal(t, "next", aws.ToString(sink.sequenceToken))
+}
+
+func TestCloudwatchSink_DataAlreadyAccepted(t *testing.T) {
+	client := &fakeCloudwatchLogs{
+		streams:   []types.LogStream{{LogStreamName: aws.String("connector"), UploadSequenceToken: aws.String("token")}},
+		putErrors: []error{&types.DataAlreadyAcceptedException{ExpectedSequenceToken: aws.String("expected")}},
+	}
+	sink := newCloudwatchSinkWithClient("group", "connector", client, &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test"}))
+	require.NoError(t, sink.Close())
+
+	// The batch isn't put again once it was already accepted
+	assert.Equal(t, []string{"DescribeLogStreams", "PutLogEvents"}, client.actions)
+	assert.Equal(t, "token", aws.ToString(client.puts[0].SequenceToken))
+	assert.Equal(t, "expected", aws.ToString(sink.sequenceToken))
+}
+
+func TestCloudwatchSink_BatchSize(t *testing.T) {
+	client := &fakeCloudwatchLogs{
+		streams: []types.LogStream{{LogStreamName: aws.String("connector"), UploadSequenceToken: aws.String("token")}},
+	}
+	sink := newCloudwatchSinkWithClient("group", "connector", client, &noopLogger)
+	defer sink.Close()
+	// The logs are split into requests of at most 1MB
+	message := strings.Repeat("a", 300*1024)
+	logs := make([]*management.Log, 5)
+	for i := range logs {
+		logs[i] = &management.Log{Message: message}
+	}
+	require.NoError(t, sink.send(logs))
+	var batches []int
+	for _, put := range client.puts {
+		batches = append(batches, len(put.LogEvents))
+	}
+	assert.Equal(t, []int{3, 2}, batches)
+}
+
+func TestNewCloudwatchSink(t *testing.T) {
+	_, err := newCloudwatchSink(newTestContext(t, "--cw-region", "us-east-1"), &noopLogger)
+	assert.ErrorContains(t, err, "--cw-group is required")
+	_, err = newCloudwatchSink(newTestContext(t, "--cw-group", "group"), &noopLogger)
+	assert.ErrorContains(t, err, "--cw-region is required")
+
+	sink, err := newCloudwatchSink(newTestContext(t, "--cw-group", "group", "--cw-region", "eu-west-1", "--connector-id", "connector", "--cw-endpoint", "http://localhost:4566"), &noopLogger)
+	require.NoError(t, err)
+	defer sink.Close()
+	assert.Equal(t, "connector", sink.stream)
+	options := sink.client.(*cloudwatchlogs.Client).Options()
+	assert.Equal(t, "eu-west-1", options.Region)
+	assert.Equal(t, "http://localhost:4566", aws.ToString(options.BaseEndpoint))
+}
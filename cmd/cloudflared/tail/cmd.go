@@ -1,13 +1,23 @@
 package tail
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -15,6 +25,7 @@ import (
 	"github.com/mattn/go-colorable"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
 	"nhooyr.io/websocket"
 
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
@@ -23,6 +34,15 @@ import (
 	"github.com/cloudflare/cloudflared/management"
 )
 
+const (
+	// Indentation of the fields in the --pretty output
+	prettyIndent = "  "
+
+	// Headers of the Access service token, for when the management endpoint is protected by Access
+	cfAccessClientIDHeader     = "Cf-Access-Client-Id"
+	cfAccessClientSecretHeader = "Cf-Access-Client-Secret"
+)
+
 var (
 	buildInfo *cliutil.BuildInfo
 )
@@ -31,6 +51,14 @@ func Init(bi *cliutil.BuildInfo) {
 	buildInfo = bi
 }
 
+// clientVersion returns the version of cloudflared that the management service is informed of when streaming starts.
+func clientVersion() string {
+	if buildInfo == nil {
+		return ""
+	}
+	return buildInfo.Version()
+}
+
 func Command() *cli.Command {
 	subcommands := []*cli.Command{
 		buildTailManagementTokenSubcommand(),
@@ -65,167 +93,491 @@ func managementTokenCommand(c *cli.Context) error {
 
 func buildTailCommand(subcommands []*cli.Command) *cli.Command {
 	return &cli.Command{
-		Name:      "tail",
-		Action:    Run,
-		Usage:     "Stream logs from a remote cloudflared",
-		UsageText: "cloudflared tail [tail command options] [TUNNEL-ID]",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:    "connector-id",
-				Usage:   "Access a specific cloudflared instance by connector id (for when a tunnel has multiple cloudflared's)",
-				Value:   "",
-				EnvVars: []string{"TUNNEL_MANAGEMENT_CONNECTOR"},
-			},
-			&cli.StringSliceFlag{
-				Name:    "event",
-				Usage:   "Filter by specific Events (cloudflared, http, tcp, udp) otherwise, defaults to send all events",
-				EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_EVENTS"},
-			},
-			&cli.StringFlag{
-				Name:    "level",
-				Usage:   "Filter by specific log levels (debug, info, warn, error). Filters by debug log level by default.",
-				EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_LEVEL"},
-				Value:   "debug",
-			},
-			&cli.Float64Flag{
-				Name:    "sample",
-				Usage:   "Sample log events by percentage (0.0 .. 1.0). No sampling by default.",
-				EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_SAMPLE"},
-				Value:   1.0,
-			},
-			&cli.StringFlag{
-				Name:    "token",
-				Usage:   "Access token for a specific tunnel",
-				Value:   "",
-				EnvVars: []string{"TUNNEL_MANAGEMENT_TOKEN"},
-			},
-			&cli.StringFlag{
-				Name:    "output",
-				Usage:   "Output format for the logs (default, json)",
-				Value:   "default",
-				EnvVars: []string{"TUNNEL_MANAGEMENT_OUTPUT"},
-			},
-			&cli.StringFlag{
-				Name:    "management-hostname",
-				Usage:   "Management hostname to signify incoming management requests",
-				EnvVars: []string{"TUNNEL_MANAGEMENT_HOSTNAME"},
-				Hidden:  true,
-				Value:   "management.argotunnel.com",
-			},
-			&cli.StringFlag{
-				Name:   "trace",
-				Usage:  "Set a cf-trace-id for the request",
-				Hidden: true,
-				Value:  "",
-			},
-			&cli.StringFlag{
-				Name:    logger.LogLevelFlag,
-				Value:   "info",
-				Usage:   "Application logging level {debug, info, warn, error, fatal}",
-				EnvVars: []string{"TUNNEL_LOGLEVEL"},
-			},
-			&cli.StringFlag{
-				Name:    credentials.OriginCertFlag,
-				Usage:   "Path to the certificate generated for your origin when you run cloudflared login.",
-				EnvVars: []string{"TUNNEL_ORIGIN_CERT"},
-				Value:   credentials.FindDefaultOriginCertPath(),
-			},
-		},
+		Name:        "tail",
+		Action:      Run,
+		Usage:       "Stream logs from a remote cloudflared",
+		UsageText:   "cloudflared tail [tail command options] [TUNNEL-ID]",
+		Description: fmt.Sprintf("Environment variables ($VAR or ${VAR}) are expanded in the values of --%s\n\n%s", strings.Join(expandEnvFlags, ", --"), alertingDescription),
+		Flags:       slices.Concat(buildTailFlags(), tokenFlags(), sshFlags(), replayFlags(), pollFlags(), latencyFlags(), alertFlags(), eventCountsFlags(), configFlags(), profileFlags(), sinkFlags()),
 		Subcommands: subcommands,
 	}
 }
 
-// Middleware validation error struct for returning to the eyeball
-type managementError struct {
-	Code    int    `json:"code,omitempty"`
-	Message string `json:"message,omitempty"`
-}
-
-// Middleware validation error HTTP response JSON for returning to the eyeball
-type managementErrorResponse struct {
-	Success bool              `json:"success,omitempty"`
-	Errors  []managementError `json:"errors,omitempty"`
-}
-
-func handleValidationError(resp *http.Response, log *zerolog.Logger) {
-	if resp.StatusCode == 530 {
-		log.Error().Msgf("no cloudflared connector available or reachable via management request (a recent version of cloudflared is required to use streaming logs)")
-	}
-	var managementErr managementErrorResponse
-	err := json.NewDecoder(resp.Body).Decode(&managementErr)
-	if err != nil {
-		log.Error().Msgf("unable to start management log streaming session: http response code returned %d", resp.StatusCode)
-		return
-	}
-	if managementErr.Success || len(managementErr.Errors) == 0 {
-		log.Error().Msgf("management tunnel validation returned success with invalid HTTP response code to convert to a WebSocket request")
-		return
-	}
-	for _, e := range managementErr.Errors {
-		log.Error().Msgf("management request failed validation: (%d) %s", e.Code, e.Message)
+func buildTailFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "connector-id",
+			Usage:   "Access a specific cloudflared instance by connector id (for when a tunnel has multiple cloudflared's)",
+			Value:   "",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_CONNECTOR"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "only-connector",
+			Usage:   "Only output logs from specific connector ids (for when streaming logs from multiple connectors)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ONLY_CONNECTOR"},
+		},
+		&cli.BoolFlag{
+			Name:    "show-connector",
+			Usage:   "Include the connector id of the cloudflared instance that emitted each log in the output",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SHOW_CONNECTOR"},
+		},
+		&cli.BoolFlag{
+			Name:    "pretty",
+			Usage:   "Print the fields of each log indented on multiple lines in the default output",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_PRETTY"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-fields",
+			Usage:   "Omit the fields of each log from the default output",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NO_FIELDS"},
+		},
+		&cli.StringFlag{
+			Name:    "format-time",
+			Usage:   "Format of the time of the logs in the default output (absolute, relative, unix)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FORMAT_TIME"},
+			Value:   timeFormatAbsolute,
+		},
+		&cli.BoolFlag{
+			Name:    "smart",
+			Usage:   "Summarize the logs with well-known fields (connections, requests, flows and sessions) with the default output",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SMART"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "event",
+			Usage:   "Filter by specific Events (cloudflared, http, tcp, udp, internal) otherwise, defaults to send all events",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_EVENTS"},
+		},
+		&cli.StringFlag{
+			Name:    "method",
+			Usage:   "Filter the http events by the method of the request (e.g. GET)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_METHOD"},
+		},
+		&cli.StringFlag{
+			Name:    "path-pattern",
+			Usage:   "Filter the http events by the path of the request matching the pattern, where * matches a path segment and ** any number of segments (e.g. /api/*/users or /api/**)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_PATH_PATTERN"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "tag",
+			Usage:   "Filter by the tags of the logs, keeping the logs with a tag containing one of the values (repeatable)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_TAGS"},
+		},
+		&cli.StringFlag{
+			Name:    "conn-id",
+			Usage:   "Filter by the ID of the connection of the tunnel that the logs are about, e.g. to follow the requests proxied over one connection",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_CONN_ID"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-health-checks",
+			Usage:   "Filter out the http events of the health check requests of Cloudflare, e.g. of the load balancer monitors",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_NO_HEALTH_CHECKS"},
+		},
+		&cli.BoolFlag{
+			Name:    "include-internal",
+			Usage:   "Include the internal events with the diagnostics of cloudflared, e.g. its memory stats and goroutine count, which aren't sent otherwise",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_INCLUDE_INTERNAL"},
+		},
+		&cli.DurationFlag{
+			Name:    "since",
+			Usage:   "Start with the recent logs kept by cloudflared from up to this long ago (e.g. 2m), before streaming the live logs",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SINCE"},
+		},
+		&cli.UintFlag{
+			Name:    "tail-last",
+			Usage:   "Start with the last N of the recent logs kept by cloudflared that match the filters, before streaming the live logs",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_TAIL_LAST"},
+		},
+		&cli.StringFlag{
+			Name:    "path-prefix",
+			Usage:   "Only output the http events of requests with a path starting with the prefix (e.g. /api/)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_PATH_PREFIX"},
+		},
+		&cli.StringFlag{
+			Name:    "level",
+			Usage:   "Filter by specific log levels (debug, info, warn, error). Filters by debug log level by default.",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_LEVEL"},
+			Value:   "debug",
+		},
+		&cli.BoolFlag{
+			Name:    "normalize-levels",
+			Usage:   "Normalize the nonstandard levels of the logs (e.g. warning, err, fatal or trace) to the levels before filtering and printing the logs",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NORMALIZE_LEVELS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "level-synonym",
+			Usage:   "Additional level names normalized with --normalize-levels, as name=level (e.g. notice=info)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_LEVEL_SYNONYM"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "sample",
+			Usage:   "Sample log events by percentage (0.0 .. 1.0), or sample the log events of a level on the client (e.g. debug=10%). No sampling by default.",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_SAMPLE"},
+		},
+		&cli.Int64Flag{
+			Name:    "sample-seed",
+			Usage:   "Seed for the per-level sampling to make it reproducible",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FILTER_SAMPLE_SEED"},
+		},
+		&cli.StringFlag{
+			Name:    "token",
+			Usage:   "Access token for a specific tunnel",
+			Value:   "",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_TOKEN"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "output",
+			Usage:   "Output format for the logs (default, text, json, ndjson, raw, file:PATH, file-rotate, kinesis, pubsub, kafka, splunk, datadog, nats, redis, vector, journald, cloudwatch, azure-monitor, fluentd, newrelic, mock), repeat to write the logs to several outputs at once (default: default)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_OUTPUT"},
+		},
+		&cli.StringFlag{
+			Name:    "split-by-level",
+			Usage:   "Write the logs of each level to a separate file, with %s in the path replaced by the level (e.g. /var/log/cloudflared-%s.log)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SPLIT_BY_LEVEL"},
+		},
+		&cli.BoolFlag{
+			Name:    "split-by-event",
+			Usage:   "Write the logs of each event type to a separate file named after the --output-file prefix (e.g. prefix.http.log)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SPLIT_BY_EVENT"},
+		},
+		&cli.StringFlag{
+			Name:    "output-file",
+			Usage:   "Append the logs to the file instead of writing them to stdout, or the prefix of the files with --split-by-event",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_OUTPUT_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    "output-mode",
+			Usage:   "How the --output-file and --split-by-level files are opened: append to the logs, or overwrite the logs of the previous runs each time tail connects (and the outputs are recreated by --watch-config)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_OUTPUT_MODE"},
+			Value:   outputModeAppend,
+		},
+		&cli.StringFlag{
+			Name:    "timestamp-field",
+			Usage:   "Use the value of the named log field as the timestamp of each log (falls back to the log time if absent)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_TIMESTAMP_FIELD"},
+		},
+		&cli.BoolFlag{
+			Name:    "fold-fields",
+			Usage:   "Flatten the nested objects and arrays of the log fields into dotted keys, e.g. http.request.host and a.0, which the other options can name",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FOLD_FIELDS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "mask-fields",
+			Usage:   "Replace the string values of the log fields with a key matching the regular expression before they are output, as pattern=replacement (e.g. email=****@****.***)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_MASK_FIELDS"},
+		},
+		&cli.StringFlag{
+			Name:    "management-hostname",
+			Usage:   "Management hostname to signify incoming management requests",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_HOSTNAME"},
+			Hidden:  true,
+			Value:   "management.argotunnel.com",
+		},
+		&cli.UintFlag{
+			Name:    "management-port",
+			Usage:   "Connect to the port of the management hostname instead of the default port of the scheme (443)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_PORT"},
+		},
+		&cli.BoolFlag{
+			Name:    "management-srv",
+			Usage:   "Discover the management host:port from the SRV record of the --management-hostname (e.g. _cloudflared-mgmt._tcp.example.com) on each connection, falling back to the name as a hostname",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SRV"},
+		},
+		&cli.StringFlag{
+			Name:    "management-addr",
+			Usage:   "Connect to the address (host:port) instead of resolving the management hostname, which is still used for TLS",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ADDR"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-resolve",
+			Usage:   "Never resolve the management hostname, connecting to the --management-addr ip:port instead",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NO_RESOLVE"},
+		},
+		&cli.StringFlag{
+			Name:    "access-client-id",
+			Usage:   "The Client ID of a Cloudflare Access service token, for when the management endpoint is protected by Access",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ACCESS_CLIENT_ID"},
+		},
+		&cli.StringFlag{
+			Name:    "access-client-secret",
+			Usage:   "The Client Secret of the Cloudflare Access service token of --access-client-id",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ACCESS_CLIENT_SECRET"},
+		},
+		&cli.StringFlag{
+			Name:   "subprotocol",
+			Usage:  "Request a specific WebSocket subprotocol (Sec-WebSocket-Protocol) from the management server",
+			Hidden: true,
+			Value:  "",
+		},
+		&cli.BoolFlag{
+			Name:    "interactive",
+			Usage:   "Read commands from stdin to change the filters of the session (" + interactiveUsage + ")",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_INTERACTIVE"},
+		},
+		&cli.DurationFlag{
+			Name:    "stats-interval",
+			Usage:   "Log the number of logs received and the events dropped by the server at the interval",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_STATS_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:    "print-close-reason",
+			Usage:   "Always print how and why the session ended, including normal closures, regardless of the log level",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_PRINT_CLOSE_REASON"},
+		},
+		&cli.StringFlag{
+			Name:    "summary",
+			Usage:   "Write a JSON summary of the session, including how and why it ended, to the file when the session ends",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SUMMARY"},
+		},
+		&cli.IntFlag{
+			Name:    "resume-on-error",
+			Usage:   "Skip up to the number of consecutive events that can't be read from the server instead of ending the session",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_RESUME_ON_ERROR"},
+		},
+		&cli.DurationFlag{
+			Name:    "drain-timeout",
+			Usage:   "Maximum time to wait for the logs already received to be written to the output when shutting down",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_DRAIN_TIMEOUT"},
+			Value:   5 * time.Second,
+		},
+		&cli.BoolFlag{
+			Name:    "structured-errors",
+			Usage:   "Write the errors to stderr as JSON objects with the error, its code and whether it is recoverable",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_STRUCTURED_ERRORS"},
+		},
+		&cli.BoolFlag{
+			Name:    "diag",
+			Usage:   "Measure the round-trip time and loss of pings to the management service and print the statistics to stderr before streaming the logs",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_DIAG"},
+		},
+		&cli.BoolFlag{
+			Name:    "diag-only",
+			Usage:   "Print the --diag statistics and exit without streaming the logs",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_DIAG_ONLY"},
+		},
+		&cli.DurationFlag{
+			Name:   "benchmark",
+			Usage:  "Stream all logs for the provided duration without output and report the throughput of the management connection",
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name:   "trace",
+			Usage:  "Set a cf-trace-id for the request",
+			Hidden: true,
+			Value:  "",
+		},
+		&cli.StringFlag{
+			Name:    logger.LogLevelFlag,
+			Value:   "info",
+			Usage:   "Application logging level {debug, info, warn, error, fatal}",
+			EnvVars: []string{"TUNNEL_LOGLEVEL"},
+		},
+		&cli.StringFlag{
+			Name:    "log-format",
+			Value:   logFormatText,
+			Usage:   "Format of the application logs written to stderr {text, json}",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_LOG_FORMAT"},
+		},
+		&cli.StringFlag{
+			Name:    credentials.OriginCertFlag,
+			Usage:   "Path to the certificate generated for your origin when you run cloudflared login.",
+			EnvVars: []string{"TUNNEL_ORIGIN_CERT"},
+			Value:   credentials.FindDefaultOriginCertPath(),
+		},
 	}
 }
 
+// Formats of the application logs
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
 // logger will be created to emit only against the os.Stderr as to not obstruct with normal output from
-// management requests
+// management requests. The logs are written as human-readable text, or as JSON objects with --log-format json.
 func createLogger(c *cli.Context) *zerolog.Logger {
 	level, levelErr := zerolog.ParseLevel(c.String(logger.LogLevelFlag))
 	if levelErr != nil {
 		level = zerolog.InfoLevel
 	}
-	log := zerolog.New(zerolog.ConsoleWriter{
+	format := c.String("log-format")
+	var out io.Writer = zerolog.ConsoleWriter{
 		Out:        colorable.NewColorable(os.Stderr),
 		TimeFormat: time.RFC3339,
-	}).With().Timestamp().Logger().Level(level)
+	}
+	if format == logFormatJSON {
+		out = os.Stderr
+	}
+	log := zerolog.New(out).With().Timestamp().Logger().Level(level)
+	if format != logFormatText && format != logFormatJSON {
+		log.Warn().Msgf("unknown --log-format %q, using the text format", format)
+	}
 	return &log
 }
 
+// expandEnvFlags are the flags of file paths and sink targets that have the environment variables in their values
+// expanded. Other flags, like tokens and expressions, are used as provided.
+var expandEnvFlags = []string{
+	credentials.OriginCertFlag,
+	"split-by-level",
+	"output-file",
+	"summary",
+	"sink",
+	"replay-file",
+	"kinesis-stream-name",
+	"pubsub-topic",
+	"kafka-brokers",
+	"kafka-topic",
+	"splunk-url",
+	"nats-url",
+	"nats-subject",
+	"redis-addr",
+	"redis-key",
+	"cw-group",
+	"cw-stream",
+}
+
+// expandedString returns the value of the flag with the environment variables expanded.
+func expandedString(c *cli.Context, name string) string {
+	return os.ExpandEnv(c.String(name))
+}
+
+// expandedStringSlice returns the values of the flag with the environment variables expanded.
+func expandedStringSlice(c *cli.Context, name string) []string {
+	values := c.StringSlice(name)
+	expanded := make([]string, 0, len(values))
+	for _, v := range values {
+		expanded = append(expanded, os.ExpandEnv(v))
+	}
+	return expanded
+}
+
 // parseFilters will attempt to parse provided filters to send to with the EventStartStreaming
 func parseFilters(c *cli.Context) (*management.StreamingFilters, error) {
-	var level *management.LogLevel
-	var events []management.LogEventType
-	var sample float64
+	var opts []management.FilterOption
 
 	argLevel := c.String("level")
 	argEvents := c.StringSlice("event")
-	argSample := c.Float64("sample")
+	argSample, _, err := parseSample(c)
+	if err != nil {
+		return nil, err
+	}
 
 	if argLevel != "" {
 		l, ok := management.ParseLogLevel(argLevel)
 		if !ok {
 			return nil, fmt.Errorf("invalid --level filter provided, please use one of the following Log Levels: debug, info, warn, error")
 		}
-		level = &l
+		opts = append(opts, management.WithLevel(l))
 	}
 
+	var events []management.LogEventType
 	for _, v := range argEvents {
 		t, ok := management.ParseLogEventType(v)
 		if !ok {
-			return nil, fmt.Errorf("invalid --event filter provided, please use one of the following EventTypes: cloudflared, http, tcp, udp")
+			return nil, fmt.Errorf("invalid --event filter provided, please use one of the following EventTypes: cloudflared, http, tcp, udp, internal")
 		}
 		events = append(events, t)
 	}
+	if len(events) > 0 {
+		opts = append(opts, management.WithEvents(events...))
+	}
+
+	opts = append(opts, management.WithSampling(argSample))
+
+	argMethod := c.String("method")
+	if argMethod != "" {
+		opts = append(opts, management.WithMethod(argMethod))
+	}
+	argPathPattern := c.String("path-pattern")
+	if argPathPattern != "" {
+		opts = append(opts, management.WithPathPattern(argPathPattern))
+	}
+
+	argTags := c.StringSlice("tag")
+	if len(argTags) > 0 {
+		opts = append(opts, management.WithTags(argTags...))
+	}
+
+	argConnID := c.String("conn-id")
+	if argConnID != "" {
+		opts = append(opts, management.WithConnID(argConnID))
+	}
+
+	argNoHealthChecks := c.Bool("no-health-checks")
+	if argNoHealthChecks {
+		opts = append(opts, management.WithoutHealthChecks())
+	}
+
+	argIncludeInternal := c.Bool("include-internal")
+	if argIncludeInternal {
+		opts = append(opts, management.WithInternalEvents())
+	}
+
+	argSince := c.Duration("since")
+	if argSince < 0 {
+		return nil, fmt.Errorf("invalid --since %s provided, please make sure it isn't negative", argSince)
+	}
+	if argSince > 0 {
+		opts = append(opts, management.WithSince(time.Now().Add(-argSince)))
+	}
 
-	if argSample <= 0.0 || argSample > 1.0 {
-		return nil, fmt.Errorf("invalid --sample value provided, please make sure it is in the range (0.0 .. 1.0)")
+	argTailLast := c.Uint("tail-last")
+	if argTailLast > 0 {
+		opts = append(opts, management.WithLastN(argTailLast))
 	}
-	sample = argSample
 
-	if level == nil && len(events) == 0 && argSample != 1.0 {
+	if argLevel == "" && len(events) == 0 && argSample != 1.0 && argMethod == "" && argPathPattern == "" && len(argTags) == 0 && argConnID == "" && !argNoHealthChecks && !argIncludeInternal && argSince == 0 && argTailLast == 0 {
 		// When no filters are provided, do not return a StreamingFilters struct
 		return nil, nil
 	}
 
-	return &management.StreamingFilters{
-		Level:    level,
-		Events:   events,
-		Sampling: sample,
-	}, nil
+	filters := management.NewStreamingFilters(opts...)
+	if err := management.ValidateFilters(filters); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
+// parseSample will parse the provided --sample values into the sampling of all log events (applied by the server)
+// and the sampling of the log events of specific levels (applied by the client).
+func parseSample(c *cli.Context) (float64, map[management.LogLevel]float64, error) {
+	sample := 1.0
+	levels := make(map[management.LogLevel]float64)
+	for _, v := range c.StringSlice("sample") {
+		levelArg, rateArg, perLevel := strings.Cut(v, "=")
+		if !perLevel {
+			rate, err := strconv.ParseFloat(v, 64)
+			if err != nil || rate <= 0.0 || rate > 1.0 {
+				return 0, nil, fmt.Errorf("invalid --sample value provided, please make sure it is in the range (0.0 .. 1.0)")
+			}
+			sample = rate
+			continue
+		}
+		level, ok := management.ParseLogLevel(levelArg)
+		if !ok {
+			return 0, nil, fmt.Errorf("invalid --sample level %q provided, please use one of the following Log Levels: debug, info, warn, error", levelArg)
+		}
+		rate, err := parseRate(rateArg)
+		if err != nil || rate < 0.0 || rate > 1.0 {
+			return 0, nil, fmt.Errorf("invalid --sample rate %q provided, please make sure it is a percentage (0%% .. 100%%) or in the range (0.0 .. 1.0)", rateArg)
+		}
+		levels[level] = rate
+	}
+	return sample, levels, nil
+}
+
+// parseRate parses either a percentage (10%) or a fraction (0.1).
+func parseRate(v string) (float64, error) {
+	if percentage, ok := strings.CutSuffix(v, "%"); ok {
+		rate, err := strconv.ParseFloat(percentage, 64)
+		return rate / 100, err
+	}
+	return strconv.ParseFloat(v, 64)
 }
 
 // getManagementToken will make a call to the Cloudflare API to acquire a management token for the requested tunnel.
 func getManagementToken(c *cli.Context, log *zerolog.Logger) (string, error) {
-	userCreds, err := credentials.Read(c.String(credentials.OriginCertFlag), log)
+	userCreds, err := credentials.Read(expandedString(c, credentials.OriginCertFlag), log)
 	if err != nil {
 		return "", err
 	}
@@ -273,56 +625,467 @@ func buildURL(c *cli.Context, log *zerolog.Logger) (url.URL, error) {
 		}
 		query.Add("connector_id", connectorID.String())
 	}
-	return url.URL{Scheme: "wss", Host: managementHostname, Path: "/logs", RawQuery: query.Encode()}, nil
+	u := url.URL{Scheme: "wss", Host: managementHostname, Path: "/logs", RawQuery: query.Encode()}
+	// The port is validated with validateManagementAddr
+	if port := c.Uint("management-port"); port != 0 {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.FormatUint(uint64(port), 10))
+	}
+	return u, nil
+}
+
+// checkSubprotocol will compare the requested subprotocol against the one the server selected during the handshake
+// and warn if they differ. The negotiated subprotocol is returned.
+func checkSubprotocol(conn managementConn, requested string, log *zerolog.Logger) string {
+	negotiated := conn.Subprotocol()
+	if requested != "" && negotiated != requested {
+		log.Warn().Msgf("management server selected subprotocol %q instead of the requested %q", negotiated, requested)
+	}
+	return negotiated
+}
+
+// parseConnectors will parse the provided connector ids used to filter the logs received
+func parseConnectors(c *cli.Context) (map[string]bool, error) {
+	connectors := make(map[string]bool)
+	for _, v := range c.StringSlice("only-connector") {
+		connectorID, err := uuid.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse 'only-connector' flag into a valid UUID: %w", err)
+		}
+		connectors[connectorID.String()] = true
+	}
+	return connectors, nil
+}
+
+// matchesConnector returns true if the log was emitted by one of the requested connectors. All logs are matched
+// when no connectors are requested.
+func matchesConnector(log *management.Log, connectors map[string]bool) bool {
+	if len(connectors) == 0 {
+		return true
+	}
+	return connectors[log.ConnectorID]
+}
+
+// Formats of the time of the logs in the text output
+const (
+	timeFormatAbsolute = "absolute"
+	timeFormatRelative = "relative"
+	timeFormatUnix     = "unix"
+)
+
+// lineFormat are the options of the text output of the logs.
+type lineFormat struct {
+	showConnector bool
+	// Print the fields of the logs with more than one field indented on multiple lines
+	pretty bool
+	// How the time of the logs is printed, as provided by default
+	timeFormat string
+	// Omit the fields of the logs
+	noFields bool
+	// Render the URLs in the messages as terminal hyperlinks
+	hyperlinks bool
+	// When provided, the relative times are corrected by the clock skew with the server
+	skew *clockSkew
+}
+
+func newLineFormat(c *cli.Context) (lineFormat, error) {
+	timeFormat := c.String("format-time")
+	switch timeFormat {
+	case timeFormatAbsolute, timeFormatRelative, timeFormatUnix:
+	default:
+		return lineFormat{}, fmt.Errorf("invalid --format-time %q, please use one of: absolute, relative, unix", timeFormat)
+	}
+	return lineFormat{
+		showConnector: c.Bool("show-connector"),
+		pretty:        c.Bool("pretty"),
+		timeFormat:    timeFormat,
+		noFields:      c.Bool("no-fields"),
+	}, nil
 }
 
-func printLine(log *management.Log, logger *zerolog.Logger) {
-	fields, err := json.Marshal(log.Fields)
+// formatTime returns the time of the log in the format, relative to now with the relative format. The time is
+// returned as provided if it can't be parsed.
+func (f lineFormat) formatTime(log *management.Log, now time.Time) string {
+	if f.timeFormat == "" || f.timeFormat == timeFormatAbsolute {
+		return log.Time
+	}
+	t, err := time.Parse(time.RFC3339Nano, log.Time)
 	if err != nil {
-		fields = []byte("unable to parse fields")
-		logger.Debug().Msgf("unable to parse fields from event %+v", log)
+		return log.Time
+	}
+	if f.timeFormat == timeFormatUnix {
+		return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64)
+	}
+	// The time of the log is from the clock of the server
+	delta := now.Add(-f.skew.offset()).Sub(t)
+	if delta < 0 {
+		// Logs ahead of the local clock because of clock skew
+		return "in " + relativeDuration(-delta)
 	}
-	fmt.Printf("%s %s %s %s %s\n", log.Time, log.Level, log.Event, log.Message, fields)
+	return relativeDuration(delta) + " ago"
 }
 
-func printJSON(log *management.Log, logger *zerolog.Logger) {
-	output, err := json.Marshal(log)
+// relativeDuration returns the duration truncated to its largest unit, e.g. 2s, 5m, 3h or 2d.
+func relativeDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", d/time.Second)
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+}
+
+// lineBuffers are reused to assemble the lines of printLine, which runs for every log of the default output.
+var lineBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func printLine(w io.Writer, log *management.Log, format lineFormat, logger *zerolog.Logger) {
+	b := lineBuffers.Get().(*bytes.Buffer)
+	defer lineBuffers.Put(b)
+	b.Reset()
+	b.WriteString(format.formatTime(log, time.Now()))
+	b.WriteByte(' ')
+	if format.showConnector {
+		b.WriteString(log.ConnectorID)
+		b.WriteByte(' ')
+	}
+	b.WriteString(log.Level.String())
+	b.WriteByte(' ')
+	b.WriteString(log.Event.String())
+	b.WriteByte(' ')
+	if len(log.Tags) > 0 {
+		b.WriteByte('[')
+		b.WriteString(strings.Join(log.Tags, ","))
+		b.WriteString("] ")
+	}
+	if log.ConnID != "" {
+		b.WriteString("[conn ")
+		b.WriteString(log.ConnID)
+		b.WriteString("] ")
+	}
+	if log.Method != "" && log.Path != "" {
+		b.WriteString(log.Method)
+		b.WriteByte(' ')
+		b.WriteString(log.Path)
+		b.WriteByte(' ')
+	}
+	if format.hyperlinks {
+		b.WriteString(linkURLs(log.Message))
+	} else {
+		b.WriteString(log.Message)
+	}
+	if log.Event == management.Internal {
+		fmt.Fprintf(b, " goroutines=%d heap_bytes=%d open_conns=%d sessions=%d", log.GoroutineCount, log.HeapBytes, log.OpenConns, log.SessionCount)
+	}
+	if !format.noFields {
+		writeFields(b, log, format, logger)
+	}
+	b.WriteByte('\n')
+	_, _ = w.Write(b.Bytes())
+}
+
+// writeFields writes the fields of the log to the line. The logs without fields aren't marshalled.
+func writeFields(b *bytes.Buffer, log *management.Log, format lineFormat, logger *zerolog.Logger) {
+	switch {
+	case log.Fields == nil:
+		b.WriteString(" null")
+		return
+	case len(log.Fields) == 0:
+		b.WriteString(" {}")
+		return
+	}
+	start := b.Len()
+	var err error
+	if format.pretty && len(log.Fields) > 1 {
+		b.WriteString("\n" + prettyIndent)
+		enc := json.NewEncoder(b)
+		enc.SetIndent(prettyIndent, prettyIndent)
+		err = enc.Encode(log.Fields)
+	} else {
+		b.WriteByte(' ')
+		err = json.NewEncoder(b).Encode(log.TypedFields())
+	}
 	if err != nil {
+		b.Truncate(start)
+		b.WriteString(" unable to parse fields")
+		logger.Debug().Msgf("unable to parse fields from event %+v", log)
+		return
+	}
+	// The encoder terminates the fields with a newline
+	b.Truncate(b.Len() - 1)
+}
+
+// printJSON encodes the log directly to the writer, which avoids copying the encoded log of large field maps
+// out of the buffers of the encoder for each log.
+func printJSON(w io.Writer, log *management.Log, logger *zerolog.Logger) {
+	if err := json.NewEncoder(w).Encode(log); err != nil {
 		logger.Debug().Msgf("unable to parse event to json %+v", log)
-	} else {
-		fmt.Println(string(output))
 	}
 }
 
+// managementConn is the connection to the management service, implemented by *websocket.Conn.
+type managementConn interface {
+	management.MessageReader
+	management.MessageWriter
+	Close(code websocket.StatusCode, reason string) error
+	Subprotocol() string
+}
+
+// dialFunc opens the connection to the management service.
+type dialFunc func(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (managementConn, error)
+
+// managementDialer returns the dialFunc that opens the websocket connection to the management service, to the
+// address instead of the resolved management hostname if provided, and through the tunnel if provided. A
+// *validationError is returned if the management service refuses the request.
+func managementDialer(addr string, tunnel netDialFunc) dialFunc {
+	return func(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (managementConn, error) {
+		return dialManagement(ctx, u, header, subprotocols, addr, tunnel)
+	}
+}
+
+func dialManagement(ctx context.Context, u url.URL, header http.Header, subprotocols []string, addr string, tunnel netDialFunc) (managementConn, error) {
+	stats := &compressionStats{}
+	conn, resp, err := websocket.Dial(ctx, u.String(), &websocket.DialOptions{
+		HTTPClient:   managementClient(addr, &stats.compressed, tunnel),
+		HTTPHeader:   header,
+		Subprotocols: subprotocols,
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			return nil, newValidationError(resp)
+		}
+		return nil, err
+	}
+	return &meteredConn{Conn: conn, stats: stats}, nil
+}
+
+// managementClient returns the client for the requests to the management service that dials the address, if provided,
+// instead of the management hostname, and counts the bytes read on the wire to read if provided. The connections are
+// opened through the tunnel if provided, e.g. forwarded by the --ssh-bastion. The hostname is still used for the TLS
+// server name and the Host header.
+func managementClient(addr string, read *atomic.Int64, tunnel netDialFunc) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dial := tunnel
+	if dial == nil {
+		dial = dialer.DialContext
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, hostport string) (net.Conn, error) {
+		if addr != "" {
+			hostport = addr
+		}
+		conn, err := dial(ctx, network, hostport)
+		if err != nil {
+			return nil, err
+		}
+		if read != nil {
+			conn = &countingConn{Conn: conn, read: read}
+		}
+		return conn, nil
+	}
+	return &http.Client{Transport: transport}
+}
+
+// validateAccessServiceToken validates that the Client ID and Client Secret of the Access service token are
+// provided together.
+func validateAccessServiceToken(c *cli.Context) error {
+	if (c.String("access-client-id") == "") != (c.String("access-client-secret") == "") {
+		return errors.New("--access-client-id and --access-client-secret must be provided together")
+	}
+	return nil
+}
+
+// validateManagementAddr validates the --management-port and the --management-addr, which must be an ip:port with
+// --no-resolve so that the management hostname is never resolved.
+func validateManagementAddr(c *cli.Context) error {
+	if port := c.Uint("management-port"); port > math.MaxUint16 {
+		return fmt.Errorf("invalid --management-port %d, please provide a port up to %d", port, math.MaxUint16)
+	}
+	addr := c.String("management-addr")
+	if addr == "" {
+		if c.Bool("no-resolve") {
+			return errors.New("--no-resolve requires the --management-addr to connect to")
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid --management-addr %q, please provide a host:port: %w", addr, err)
+	}
+	if c.Bool("no-resolve") && net.ParseIP(host) == nil {
+		return fmt.Errorf("invalid --management-addr %q, an ip:port is required with --no-resolve", addr)
+	}
+	return nil
+}
+
+// reportDialError reports the reasons a refused management request failed validation, or otherwise the error.
+func reportDialError(errs *errorReporter, err error, msg string) {
+	var verr *validationError
+	if errors.As(err, &verr) {
+		for _, e := range verr.errors {
+			errs.emit(e)
+		}
+		return
+	}
+	errs.report(err, msg, codeConnection, true)
+}
+
 // Run implements a foreground runner
 func Run(c *cli.Context) error {
-	log := createLogger(c)
-
 	signals := make(chan os.Signal, 10)
 	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
 	defer signal.Stop(signals)
 
-	output := "default"
-	switch c.String("output") {
-	case "default", "":
-		output = "default"
-	case "json":
-		output = "json"
-	default:
-		log.Err(errors.New("invalid --output value provided, please make sure it is one of: default, json")).Send()
+	return run(c, managementDialer(c.String("management-addr"), nil), os.Stdout, signals)
+}
+
+// run streams the logs from the connection opened with dial and writes the output to stdout. The errors are reported
+// rather than returned, except for the exit code of the logs that don't match the --mock-file.
+func run(c *cli.Context, dial dialFunc, stdout io.Writer, signals <-chan os.Signal) (exitErr error) {
+	base := c
+	if path := c.String("config"); path != "" {
+		loaded, err := loadConfig(c, path)
+		if err != nil {
+			log := createLogger(c)
+			errs := &errorReporter{structured: c.Bool("structured-errors"), out: os.Stderr, log: log}
+			errs.report(err, "invalid config file provided", codeInvalidArguments, false)
+			return nil
+		}
+		c = loaded
+	}
+	log := createLogger(c)
+	errs := &errorReporter{structured: c.Bool("structured-errors"), out: os.Stderr, log: log}
+	if err := validateWatchConfig(c); err != nil {
+		errs.report(err, "invalid config file provided", codeInvalidArguments, false)
+		return nil
+	}
+	writeProfile, err := startProfile(c)
+	if err != nil {
+		errs.report(err, "invalid profiling options provided", codeInvalidArguments, false)
+		return nil
 	}
+	defer func() {
+		if err := writeProfile(); err != nil {
+			log.Err(err).Msg("unable to write the profile")
+		}
+	}()
 
 	filters, err := parseFilters(c)
 	if err != nil {
-		log.Error().Err(err).Msgf("invalid filters provided")
+		errs.report(err, "invalid filters provided", codeInvalidArguments, false)
+		return nil
+	}
+	benchmark := c.Duration("benchmark")
+	if benchmark > 0 {
+		// Benchmarks measure the throughput of all of the logs
+		filters = nil
+	}
+
+	processors, err := buildProcessors(c)
+	if err != nil {
+		errs.report(err, "invalid output options provided", codeInvalidArguments, false)
+		return nil
+	}
+	levels, err := newLevelNormalizer(c)
+	if err != nil {
+		errs.report(err, "invalid output options provided", codeInvalidArguments, false)
+		return nil
+	}
+	var interactive *interactiveFilters
+	if c.Bool("interactive") {
+		interactive = newInteractiveFilters(filters)
+		processors = append(processors, interactive.processor())
+	}
+	var latency *latencyStats
+	latencyInterval := c.Duration("latency-stats-interval")
+	if c.Bool("latency-stats") {
+		if latencyInterval <= 0 {
+			errs.report(errors.New("--latency-stats-interval must be greater than 0"), "invalid output options provided", codeInvalidArguments, false)
+			return nil
+		}
+		// The latency is measured once the timestamp of the log is known
+		latency = &latencyStats{}
+		processors = append(processors, latency.processor())
+	}
+
+	// The alert commands are killed along with the stream once run returns
+	ctx, cancel := context.WithCancel(c.Context)
+	defer cancel()
+	if duration := c.Duration("mock-duration"); duration > 0 && mockRequested(c) {
+		// The logs are compared to the --mock-file once the stream is cancelled
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+
+	alerts, err := newAlerter(ctx, c, log)
+	if err != nil {
+		errs.report(err, "invalid alerting options provided", codeInvalidArguments, false)
 		return nil
 	}
+	if alerts != nil {
+		processors = append(processors, alerts.processor())
+	}
+
+	var counts *eventCounts
+	countsInterval := c.Duration("event-counts-interval")
+	if c.Bool("event-counts-only") {
+		if countsInterval <= 0 {
+			errs.report(errors.New("--event-counts-interval must be greater than 0"), "invalid output options provided", codeInvalidArguments, false)
+			return nil
+		}
+		// The logs are counted once all of the other processors kept them, and then dropped
+		counts = &eventCounts{}
+		processors = append(processors, counts.processor())
+	}
+
+	var u url.URL
+	replayFile := expandedString(c, "replay-file")
+	if replayFile != "" {
+		// The events are replayed from the file without connecting to the management service
+		dial = replayDialer(replayFile, c.Float64("replay-speed"))
+	} else {
+		if err := validateManagementAddr(c); err != nil {
+			errs.report(err, "invalid management connection options provided", codeInvalidArguments, false)
+			return nil
+		}
+		if err := validateAccessServiceToken(c); err != nil {
+			errs.report(err, "invalid management connection options provided", codeInvalidArguments, false)
+			return nil
+		}
+		u, err = buildURL(c, log)
+		if err != nil {
+			errs.report(err, "unable to construct management request URL", codeAuthentication, false)
+			return nil
+		}
+	}
 
-	u, err := buildURL(c, log)
+	skew := newClockSkew(log)
+	sink, err := newLogSink(c, stdout, skew, log)
 	if err != nil {
-		log.Err(err).Msg("unable to construct management request URL")
+		errs.report(err, "unable to create output for logs", codeOutput, false)
 		return nil
 	}
+	var reloader *configReloader
+	if c.Bool("watch-config") {
+		reloadable := &reloadableSink{sink: sink}
+		sink = reloadable
+		reloader = newConfigReloader(base, c, c.String("config"), reloadable, stdout, skew, filters, log)
+	}
+	defer func() {
+		err := sink.Close()
+		var mismatch *mockMismatchError
+		if errors.As(err, &mismatch) {
+			// The command fails so that it can assert the logs, e.g. in CI
+			errs.report(err, "the logs received don't match the --mock-file", codeMockMismatch, false)
+			exitErr = cli.Exit("", codeMockMismatch)
+		} else if err != nil {
+			errs.report(err, "unable to flush logs to output", codeOutput, false)
+		}
+	}()
 
 	header := make(http.Header)
 	header.Add("User-Agent", buildInfo.UserAgent())
@@ -330,27 +1093,109 @@ func Run(c *cli.Context) error {
 	if trace != "" {
 		header["cf-trace-id"] = []string{trace}
 	}
-	ctx := c.Context
-	conn, resp, err := websocket.Dial(ctx, u.String(), &websocket.DialOptions{
-		HTTPHeader: header,
-	})
-	if err != nil {
-		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
-			handleValidationError(resp, log)
+	if clientID := c.String("access-client-id"); clientID != "" {
+		header.Set(cfAccessClientIDHeader, clientID)
+		header.Set(cfAccessClientSecretHeader, c.String("access-client-secret"))
+	}
+	var subprotocols []string
+	subprotocol := c.String("subprotocol")
+	if subprotocol != "" {
+		subprotocols = []string{subprotocol}
+	}
+	// The connections to the management service are forwarded by the SSH bastion if provided
+	var tunnel netDialFunc
+	if replayFile == "" {
+		bastion, err := dialSSHBastion(ctx, c, log)
+		if err != nil {
+			errs.report(err, "unable to connect to the SSH bastion", codeConnection, true)
+			return nil
+		}
+		if bastion != nil {
+			defer bastion.Close()
+			tunnel = bastion.DialContext
+			dial = managementDialer(c.String("management-addr"), tunnel)
+		}
+	}
+	if c.Bool("management-srv") && replayFile == "" {
+		dial = srvDialer(dial, net.DefaultResolver.LookupSRV, log)
+	}
+
+	if c.Bool("diag") || c.Bool("diag-only") {
+		// The diagnostics use a separate connection that is closed once they complete
+		conn, err := dial(ctx, u, header, subprotocols)
+		if err != nil {
+			reportDialError(errs, err, "unable to start management diagnostics session")
+			return nil
+		}
+		stats, err := runDiagnostics(ctx, conn, diagPings, diagPingTimeout)
+		if err != nil {
+			errs.report(err, "unable to complete management connection diagnostics", codeConnection, true)
+			return nil
+		}
+		stats.printSummary(os.Stderr)
+		if c.Bool("diag-only") {
 			return nil
 		}
-		log.Error().Err(err).Msgf("unable to start management log streaming session")
+	}
+
+	// connect opens the management connection, polling for the logs instead if the websocket connection can't be
+	// established
+	connect := func(ctx context.Context, u url.URL) (managementConn, error) {
+		conn, err := dial(ctx, u, header, subprotocols)
+		if err != nil && c.Bool("poll-fallback") {
+			log.Warn().Err(err).Msg("unable to establish the management websocket connection, polling for the logs instead")
+			conn, err = newPollConn(u, header, c.Duration("poll-interval"), managementClient(c.String("management-addr"), nil, tunnel)), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		checkSubprotocol(conn, subprotocol, log)
+		return conn, nil
+	}
+	startStreaming := func(ctx context.Context, conn managementConn, filters *management.StreamingFilters) error {
+		return management.WriteEventWithRetry(conn, ctx, &management.EventStartStreaming{
+			ClientEvent:   management.ClientEvent{Type: management.StartStreaming},
+			Filters:       filters,
+			ClientVersion: clientVersion(),
+		}, writeAttempts, writeRetryDelay)
+	}
+	// The sessions renewed with a refreshed token stream the logs with the filters as updated interactively
+	refresher, err := newTokenRefresher(c, func(ctx context.Context, token string) (managementConn, error) {
+		renewed := u
+		query := renewed.Query()
+		query.Set("access_token", token)
+		renewed.RawQuery = query.Encode()
+		conn, err := connect(ctx, renewed)
+		if err != nil {
+			return nil, err
+		}
+		renewedFilters := filters
+		if interactive != nil {
+			renewedFilters = interactive.serverFilters()
+		} else if reloader != nil {
+			renewedFilters = reloader.serverFilters()
+		}
+		if err := startStreaming(ctx, conn, renewedFilters); err != nil {
+			conn.Close(websocket.StatusInternalError, "")
+			return nil, err
+		}
+		return conn, nil
+	}, log)
+	if err != nil {
+		errs.report(err, "invalid management token options provided", codeInvalidArguments, false)
+		return nil
+	}
+
+	conn, err := connect(ctx, u)
+	if err != nil {
+		reportDialError(errs, err, "unable to start management log streaming session")
 		return nil
 	}
 	defer conn.Close(websocket.StatusInternalError, "management connection was closed abruptly")
 
 	// Once connection is established, send start_streaming event to begin receiving logs
-	err = management.WriteEvent(conn, ctx, &management.EventStartStreaming{
-		ClientEvent: management.ClientEvent{Type: management.StartStreaming},
-		Filters:     filters,
-	})
-	if err != nil {
-		log.Error().Err(err).Msg("unable to request logs from management tunnel")
+	if err := startStreaming(ctx, conn, filters); err != nil {
+		errs.report(err, "unable to request logs from management tunnel", codeStream, true)
 		return nil
 	}
 	log.Debug().
@@ -358,71 +1203,92 @@ func Run(c *cli.Context) error {
 		Str("connector-id", c.String("connector-id")).
 		Interface("filters", filters).
 		Msg("connected")
+	if hyperlinksEnabled(c, os.Stderr) {
+		printStatus(os.Stderr, c.String("management-hostname"))
+	}
 
-	readerDone := make(chan struct{})
-
-	go func() {
-		defer close(readerDone)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				event, err := management.ReadServerEvent(conn, ctx)
-				if err != nil {
-					if closeErr := management.AsClosed(err); closeErr != nil {
-						// If the client (or the server) already closed the connection, don't continue to
-						// attempt to read from the client.
-						if closeErr.Code == websocket.StatusNormalClosure {
-							return
-						}
-						// Only log abnormal closures
-						log.Error().Msgf("received remote closure: (%d) %s", closeErr.Code, closeErr.Reason)
-						return
-					}
-					log.Err(err).Msg("unable to read event from server")
-					return
-				}
-				switch event.Type {
-				case management.Logs:
-					logs, ok := management.IntoServerEvent(event, management.Logs)
-					if !ok {
-						log.Error().Msgf("invalid logs event")
-						continue
-					}
-					// Output all the logs received to stdout
-					for _, l := range logs.Logs {
-						if output == "json" {
-							printJSON(l, log)
-						} else {
-							printLine(l, log)
-						}
-					}
-				case management.UnknownServerEventType:
-					fallthrough
-				default:
-					log.Debug().Msgf("unexpected log event type: %s", event.Type)
-				}
-			}
+	if benchmark > 0 {
+		stats, err := runBenchmark(ctx, conn, benchmark)
+		if err != nil {
+			errs.report(err, "unable to complete management connection benchmark", codeConnection, true)
+			return nil
 		}
-	}()
+		stats.printSummary(os.Stderr)
+		return nil
+	}
 
-	for {
+	streamer := &logStreamer{
+		conn:          conn,
+		sink:          sink,
+		processors:    processors,
+		drainTimeout:  c.Duration("drain-timeout"),
+		statsInterval: c.Duration("stats-interval"),
+		maxReadErrors: c.Int("resume-on-error"),
+		levels:        levels,
+		skew:          skew,
+		log:           log,
+	}
+	if slices.Contains(outputs(c), "raw") {
+		streamer.raw = stdout
+	}
+	if reloader != nil {
+		reloads := make(chan os.Signal, 1)
+		signal.Notify(reloads, syscall.SIGHUP)
+		defer signal.Stop(reloads)
+		streamer.reloads = reloads
+		streamer.reloader = reloader
+	}
+	if interactive != nil {
+		streamer.commands = readCommands(ctx, os.Stdin)
+		streamer.interactive = interactive
+		streamer.console = os.Stderr
+	}
+	// The reports outlive the sessions, they are stopped once the stream and the serving of the replayed logs end
+	reportCtx, stopReports := context.WithCancel(ctx)
+	defer stopReports()
+	var reports sync.WaitGroup
+	if latency != nil {
+		reports.Add(1)
+		go func() {
+			defer reports.Done()
+			latency.reportLoop(reportCtx, os.Stderr, latencyInterval)
+		}()
+	}
+	if counts != nil {
+		reports.Add(1)
+		go func() {
+			defer reports.Done()
+			counts.drawLoop(reportCtx, os.Stderr, term.IsTerminal(int(os.Stderr.Fd())), countsInterval)
+		}()
+	}
+	summary := &sessionSummary{}
+	if refresher != nil {
+		summary.Close, err = refresher.stream(ctx, streamer, u.Query().Get("access_token"), signals)
+		if err != nil {
+			errs.report(err, "unable to renew the management log streaming session", codeConnection, true)
+		}
+	} else {
+		summary.Close = streamer.run(ctx, signals)
+	}
+	if replayFile != "" && c.String("serve") != "" && summary.Close.ClosedBy == closedByServer {
+		// The replayed logs are still served to scrub through them
+		log.Info().Msg("replay complete, serving the replayed logs until interrupted")
 		select {
 		case <-ctx.Done():
-			return nil
-		case <-readerDone:
-			return nil
 		case <-signals:
-			log.Debug().Msg("closing management connection")
-			// Cleanly close the connection by sending a close message and then
-			// waiting (with timeout) for the server to close the connection.
-			conn.Close(websocket.StatusNormalClosure, "")
-			select {
-			case <-readerDone:
-			case <-time.After(time.Second):
-			}
-			return nil
 		}
 	}
+	stopReports()
+	reports.Wait()
+	if latency != nil {
+		summary.Latency = latency.summary()
+		summary.Latency.printSummary(os.Stderr)
+	}
+	reportSessionEnd(os.Stderr, summary.Close, c.Bool("print-close-reason"), errs)
+	if path := expandedString(c, "summary"); path != "" {
+		if err := writeSessionSummary(path, summary); err != nil {
+			errs.report(err, "unable to write session summary", codeOutput, false)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,625 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/internal/test"
+	"github.com/cloudflare/cloudflared/management"
+)
+
+var (
+	noopLogger = zerolog.New(io.Discard)
+)
+
+// newTestContext creates a cli.Context with all of the tail flags parsed from the provided arguments
+func newTestContext(t *testing.T, args ...string) *cli.Context {
+	flagSet := flag.NewFlagSet(t.Name(), flag.PanicOnError)
+	for _, f := range buildTailCommand(nil).Flags {
+		require.NoError(t, f.Apply(flagSet))
+	}
+	require.NoError(t, flagSet.Parse(args))
+	return cli.NewContext(cli.NewApp(), flagSet, nil)
+}
+
+func TestCheckSubprotocol(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		requested string
+		supported []string
+		expected  string
+	}{
+		{
+			name:     "none requested",
+			expected: "",
+		},
+		{
+			name:      "negotiated",
+			requested: "v2",
+			supported: []string{"v1", "v2"},
+			expected:  "v2",
+		},
+		{
+			name:      "unsupported by server",
+			requested: "v3",
+			supported: []string{"v1", "v2"},
+			expected:  "",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var subprotocols []string
+			if test.requested != "" {
+				subprotocols = []string{test.requested}
+			}
+			client, server := wsPipe(subprotocols, test.supported)
+			server.CloseRead(context.Background())
+			defer server.Close(websocket.StatusInternalError, "")
+			require.Equal(t, test.expected, checkSubprotocol(client, test.requested, &noopLogger))
+			require.Equal(t, test.expected, server.Subprotocol())
+			client.Close(websocket.StatusNormalClosure, "")
+		})
+	}
+}
+
+func wsPipe(requested []string, supported []string) (*websocket.Conn, *websocket.Conn) {
+	return test.WSPipe(
+		&websocket.DialOptions{Subprotocols: requested},
+		&websocket.AcceptOptions{Subprotocols: supported},
+	)
+}
+
+func TestMatchesConnector(t *testing.T) {
+	connector1 := uuid.New().String()
+	connector2 := uuid.New().String()
+	log := &management.Log{ConnectorID: connector1}
+	require.True(t, matchesConnector(log, map[string]bool{}))
+	require.True(t, matchesConnector(log, map[string]bool{connector1: true}))
+	require.True(t, matchesConnector(log, map[string]bool{connector1: true, connector2: true}))
+	require.False(t, matchesConnector(log, map[string]bool{connector2: true}))
+	require.False(t, matchesConnector(&management.Log{}, map[string]bool{connector2: true}))
+}
+
+func TestPrintLine(t *testing.T) {
+	var out bytes.Buffer
+	printLine(&out, &management.Log{
+		Time:    "2023-01-01T00:00:00Z",
+		Level:   management.Info,
+		Event:   management.HTTP,
+		Message: "response",
+		Fields:  map[string]interface{}{"content-length": float64(1234000), "cached": false},
+	}, lineFormat{}, &noopLogger)
+	printLine(&out, &management.Log{Time: "2023-01-01T00:00:00Z", Message: "no fields"}, lineFormat{}, &noopLogger)
+	assert.Equal(t, "2023-01-01T00:00:00Z info http response {\"cached\":\"false\",\"content-length\":\"1234000\"}\n"+
+		"2023-01-01T00:00:00Z debug cloudflared no fields null\n", out.String())
+}
+
+func TestPrintLine_HTTPRequest(t *testing.T) {
+	var out bytes.Buffer
+	printLine(&out, &management.Log{
+		Time:    "2023-01-01T00:00:00Z",
+		Level:   management.Info,
+		Event:   management.HTTP,
+		Method:  "GET",
+		Path:    "/api",
+		Message: "200 OK",
+	}, lineFormat{noFields: true}, &noopLogger)
+	// The request is only printed with both the method and the path
+	printLine(&out, &management.Log{Time: "2023-01-01T00:00:00Z", Event: management.HTTP, Path: "/api", Message: "request"},
+		lineFormat{noFields: true}, &noopLogger)
+	assert.Equal(t, "2023-01-01T00:00:00Z info http GET /api 200 OK\n"+
+		"2023-01-01T00:00:00Z debug http request\n", out.String())
+}
+
+func TestPrintLine_Tags(t *testing.T) {
+	var out bytes.Buffer
+	printLine(&out, &management.Log{
+		Time:    "2023-01-01T00:00:00Z",
+		Level:   management.Info,
+		Event:   management.HTTP,
+		Method:  "GET",
+		Path:    "/api",
+		Tags:    []string{"customer-a", "eu"},
+		Message: "200 OK",
+	}, lineFormat{noFields: true}, &noopLogger)
+	assert.Equal(t, "2023-01-01T00:00:00Z info http [customer-a,eu] GET /api 200 OK\n", out.String())
+}
+
+func TestPrintLine_ConnID(t *testing.T) {
+	var out bytes.Buffer
+	l := &management.Log{
+		Time:    "2023-01-01T00:00:00Z",
+		Level:   management.Info,
+		Event:   management.HTTP,
+		Method:  "GET",
+		Path:    "/api",
+		ConnID:  "1",
+		Message: "200 OK",
+	}
+	printLine(&out, l, lineFormat{noFields: true}, &noopLogger)
+	// The connection is omitted when the log isn't about a connection
+	l.ConnID = ""
+	printLine(&out, l, lineFormat{noFields: true}, &noopLogger)
+	assert.Equal(t, "2023-01-01T00:00:00Z info http [conn 1] GET /api 200 OK\n"+
+		"2023-01-01T00:00:00Z info http GET /api 200 OK\n", out.String())
+}
+
+func TestPrintLine_Internal(t *testing.T) {
+	var out bytes.Buffer
+	l := &management.Log{
+		Time:           "2023-01-01T00:00:00Z",
+		Level:          management.Info,
+		Event:          management.Internal,
+		Message:        "runtime stats",
+		GoroutineCount: 120,
+		HeapBytes:      4096,
+		OpenConns:      4,
+		SessionCount:   1,
+	}
+	printLine(&out, l, lineFormat{noFields: true}, &noopLogger)
+	assert.Equal(t, "2023-01-01T00:00:00Z info internal runtime stats goroutines=120 heap_bytes=4096 open_conns=4 sessions=1\n", out.String())
+}
+
+func TestPrintLine_NoFields(t *testing.T) {
+	var out bytes.Buffer
+	l := &management.Log{
+		Time:    "2023-01-01T00:00:00Z",
+		Level:   management.Info,
+		Event:   management.HTTP,
+		Message: "response",
+		Fields:  map[string]interface{}{"status": float64(200)},
+	}
+	printLine(&out, l, lineFormat{noFields: true}, &noopLogger)
+	printLine(&out, &management.Log{Time: "2023-01-01T00:00:00Z", Message: "empty", Fields: map[string]interface{}{}}, lineFormat{}, &noopLogger)
+	assert.Equal(t, "2023-01-01T00:00:00Z info http response\n"+
+		"2023-01-01T00:00:00Z debug cloudflared empty {}\n", out.String())
+}
+
+func BenchmarkPrintLine(b *testing.B) {
+	l := &management.Log{
+		Time:    "2023-01-01T00:00:00Z",
+		Level:   management.Info,
+		Event:   management.HTTP,
+		Message: "response",
+		Fields: map[string]interface{}{
+			"cfRay":          "7f2e5f6b8c1d2e3f-SJC",
+			"content-length": float64(1234),
+			"originService":  "http://localhost:8080",
+			"status":         float64(200),
+		},
+	}
+	b.Run("fprintf", func(b *testing.B) {
+		// The lines as they were assembled before the buffers were reused
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			fields, err := json.Marshal(l.TypedFields())
+			if err != nil {
+				b.Fatal(err)
+			}
+			fields = append([]byte(" "), fields...)
+			fmt.Fprintf(io.Discard, "%s %s %s %s%s\n", l.Time, l.Level, l.Event, l.Message, fields)
+		}
+	})
+	b.Run("buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			printLine(io.Discard, l, lineFormat{}, &noopLogger)
+		}
+	})
+	b.Run("no fields", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			printLine(io.Discard, l, lineFormat{noFields: true}, &noopLogger)
+		}
+	})
+}
+
+func TestLineFormat_FormatTime(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		format   string
+		time     string
+		expected string
+	}{
+		{format: timeFormatAbsolute, time: "2023-01-01T11:59:58Z", expected: "2023-01-01T11:59:58Z"},
+		{format: timeFormatUnix, time: "2023-01-01T11:59:58.25Z", expected: "1672574398.250"},
+		{format: timeFormatRelative, time: "2023-01-01T12:00:00Z", expected: "0s ago"},
+		{format: timeFormatRelative, time: "2023-01-01T11:59:58.5Z", expected: "1s ago"},
+		{format: timeFormatRelative, time: "2023-01-01T11:55:00Z", expected: "5m ago"},
+		{format: timeFormatRelative, time: "2023-01-01T09:00:00Z", expected: "3h ago"},
+		{format: timeFormatRelative, time: "2022-12-30T12:00:00Z", expected: "2d ago"},
+		{format: timeFormatRelative, time: "2023-01-01T12:00:03Z", expected: "in 3s"},
+		{format: timeFormatRelative, time: "yesterday", expected: "yesterday"},
+	} {
+		t.Run(tt.format+" "+tt.time, func(t *testing.T) {
+			format := lineFormat{timeFormat: tt.format}
+			assert.Equal(t, tt.expected, format.formatTime(&management.Log{Time: tt.time}, now))
+		})
+	}
+}
+
+func TestNewLineFormat_InvalidTimeFormat(t *testing.T) {
+	_, err := newLineFormat(newTestContext(t, "--format-time", "local"))
+	assert.ErrorContains(t, err, "invalid --format-time")
+}
+
+func TestPrintLine_Pretty(t *testing.T) {
+	var out bytes.Buffer
+	format := lineFormat{pretty: true}
+	printLine(&out, &management.Log{
+		Time:    "2023-01-01T00:00:00Z",
+		Level:   management.Info,
+		Event:   management.HTTP,
+		Message: "response",
+		Fields:  map[string]interface{}{"status": float64(200), "headers": map[string]interface{}{"Server": "nginx"}},
+	}, format, &noopLogger)
+	// Logs with a single field are printed on a single line
+	printLine(&out, &management.Log{Time: "2023-01-01T00:00:00Z", Message: "single", Fields: map[string]interface{}{"a": "b"}}, format, &noopLogger)
+	assert.Equal(t, `2023-01-01T00:00:00Z info http response
+  {
+    "headers": {
+      "Server": "nginx"
+    },
+    "status": 200
+  }
+2023-01-01T00:00:00Z debug cloudflared single {"a":"b"}
+`, out.String())
+}
+
+func TestParseFilters(t *testing.T) {
+	filters, err := parseFilters(newTestContext(t, "--level", "warn", "--event", "http", "--event", "tcp", "--sample", "0.5"))
+	require.NoError(t, err)
+	assert.Equal(t, management.NewStreamingFilters(
+		management.WithLevel(management.Warn),
+		management.WithEvents(management.HTTP, management.TCP),
+		management.WithSampling(0.5),
+	), filters)
+
+	filters, err = parseFilters(newTestContext(t, "--method", "GET", "--path-pattern", "/api/*"))
+	require.NoError(t, err)
+	assert.Equal(t, "GET", filters.Method)
+	assert.Equal(t, "/api/*", filters.PathPattern)
+
+	filters, err = parseFilters(newTestContext(t, "--tag", "customer-a", "--tag", "eu"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"customer-a", "eu"}, filters.TagFilters)
+
+	filters, err = parseFilters(newTestContext(t, "--conn-id", "1"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", filters.ConnID)
+
+	filters, err = parseFilters(newTestContext(t, "--no-health-checks"))
+	require.NoError(t, err)
+	assert.True(t, filters.ExcludeHealthChecks)
+
+	filters, err = parseFilters(newTestContext(t, "--include-internal", "--event", "internal"))
+	require.NoError(t, err)
+	assert.True(t, filters.IncludeInternalEvents)
+	assert.Equal(t, []management.LogEventType{management.Internal}, filters.Events)
+
+	before := time.Now()
+	filters, err = parseFilters(newTestContext(t, "--since", "2m", "--tail-last", "50"))
+	require.NoError(t, err)
+	require.NotNil(t, filters.Since)
+	assert.WithinDuration(t, before.Add(-2*time.Minute), *filters.Since, time.Second)
+	assert.Equal(t, uint(50), filters.LastN)
+
+	_, err = parseFilters(newTestContext(t, "--level", "trace"))
+	assert.Error(t, err)
+	_, err = parseFilters(newTestContext(t, "--event", "dns"))
+	assert.Error(t, err)
+	_, err = parseFilters(newTestContext(t, "--sample", "0"))
+	assert.Error(t, err)
+	_, err = parseFilters(newTestContext(t, "--event", "http", "--event", "http"))
+	assert.ErrorContains(t, err, "duplicate event filter")
+	_, err = parseFilters(newTestContext(t, "--path-pattern", "/api/["))
+	assert.ErrorContains(t, err, "invalid path pattern filter")
+	_, err = parseFilters(newTestContext(t, "--tag", ""))
+	assert.ErrorContains(t, err, "empty tag filter")
+}
+
+func TestParseSample(t *testing.T) {
+	sample, levels, err := parseSample(newTestContext(t))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, sample)
+	assert.Empty(t, levels)
+
+	sample, levels, err = parseSample(newTestContext(t, "--sample", "0.5", "--sample", "debug=10%", "--sample", "info=0.25"))
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, sample)
+	assert.Equal(t, map[management.LogLevel]float64{management.Debug: 0.1, management.Info: 0.25}, levels)
+
+	for _, v := range []string{"2", "trace=10%", "debug=110%", "debug=ten"} {
+		_, _, err = parseSample(newTestContext(t, "--sample", v))
+		assert.Error(t, err, v)
+	}
+}
+
+func TestExpandEnvFlags(t *testing.T) {
+	t.Setenv("TAIL_TEST_HOSTNAME", "host1")
+	c := newTestContext(t,
+		"--split-by-level", "/var/log/${TAIL_TEST_HOSTNAME}-%s.log",
+		"--sink", "webhook:https://example.com/$TAIL_TEST_HOSTNAME",
+		"--webhook-match", "^$",
+	)
+	assert.Equal(t, "/var/log/host1-%s.log", expandedString(c, "split-by-level"))
+	assert.Equal(t, []string{"webhook:https://example.com/host1"}, expandedStringSlice(c, "sink"))
+	// Only the documented flags are expanded
+	assert.Equal(t, []string{"^$"}, c.StringSlice("webhook-match"))
+
+	flags := make(map[string]bool)
+	for _, f := range buildTailCommand(nil).Flags {
+		flags[f.Names()[0]] = true
+	}
+	for _, name := range expandEnvFlags {
+		assert.True(t, flags[name], name)
+	}
+}
+
+// mockConn replays the management events from the reader and records the events written by the client
+type mockConn struct {
+	management.MessageReader
+	management.MessageWriter
+	closed chan websocket.StatusCode
+}
+
+func (c *mockConn) Close(code websocket.StatusCode, reason string) error {
+	select {
+	case c.closed <- code:
+	default:
+	}
+	return nil
+}
+
+func (c *mockConn) Subprotocol() string {
+	return ""
+}
+
+// captureStderr returns what fn writes to os.Stderr.
+func captureStderr(t *testing.T, fn func()) string {
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	require.NoError(t, err)
+	defer f.Close()
+	stderr := os.Stderr
+	os.Stderr = f
+	defer func() { os.Stderr = stderr }()
+	fn()
+	data, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestCreateLogger_LogFormat(t *testing.T) {
+	output := captureStderr(t, func() {
+		createLogger(newTestContext(t, "--log-format", "json")).Info().Str("key", "value").Msg("test")
+	})
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(output), &entry))
+	assert.Equal(t, "test", entry["message"])
+	assert.Equal(t, "value", entry["key"])
+	assert.Equal(t, "info", entry["level"])
+
+	output = captureStderr(t, func() {
+		createLogger(newTestContext(t)).Info().Str("key", "value").Msg("test")
+	})
+	// The text is not JSON
+	assert.Error(t, json.Unmarshal([]byte(output), &entry))
+	assert.Contains(t, output, "test")
+
+	output = captureStderr(t, func() {
+		createLogger(newTestContext(t, "--log-format", "xml"))
+	})
+	assert.Contains(t, output, `unknown --log-format "xml", using the text format`)
+}
+
+func TestRun(t *testing.T) {
+	events := []byte(`{"type":"logs","logs":[{"time":"2024-01-01T00:00:00Z","level":"info","message":"test1","event":"http"}]}
+{"type":"logs","logs":[{"time":"2024-01-01T00:00:01Z","level":"warn","message":"test2","event":"http"}]}
+`)
+	var written bytes.Buffer
+	conn := &mockConn{
+		MessageReader: management.NewReaderFromBytes(events),
+		MessageWriter: management.NewWriterToBuffer(&written),
+		closed:        make(chan websocket.StatusCode, 1),
+	}
+	var dialed url.URL
+	dial := func(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (managementConn, error) {
+		dialed = u
+		return conn, nil
+	}
+
+	Init(cliutil.GetBuildInfo("", "test"))
+	var stdout bytes.Buffer
+	c := newTestContext(t, "--token", "test", "--level", "info", "--event", "http", "--output", "json")
+	require.NoError(t, run(c, dial, &stdout, make(chan os.Signal)))
+
+	assert.Equal(t, "test", dialed.Query().Get("access_token"))
+	assert.Equal(t, websocket.StatusNormalClosure, <-conn.closed)
+
+	// The stream is started with the requested filters
+	event, err := management.ReadClientEvent(management.NewReaderFromBytes(written.Bytes()), context.Background())
+	require.NoError(t, err)
+	start, ok := management.IntoClientEvent[management.EventStartStreaming](event, management.StartStreaming)
+	require.True(t, ok)
+	assert.Equal(t, management.NewStreamingFilters(
+		management.WithLevel(management.Info),
+		management.WithEvents(management.HTTP),
+		management.WithSampling(1),
+	), start.Filters)
+
+	var messages []string
+	decoder := json.NewDecoder(&stdout)
+	for decoder.More() {
+		var l management.Log
+		require.NoError(t, decoder.Decode(&l))
+		messages = append(messages, l.Message)
+	}
+	assert.Equal(t, []string{"test1", "test2"}, messages)
+}
+
+func TestNewOutputSink_OutputFileSplitByLevel(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestContext(t, "--output-file", filepath.Join(dir, "tail.log"), "--split-by-level", filepath.Join(dir, "tail-%s.log"))
+	_, err := newOutputSink(c, "default", &bytes.Buffer{}, nil, &noopLogger)
+	assert.EqualError(t, err, "--output-file and --split-by-level are mutually exclusive")
+}
+
+// largeFieldsLog returns a log with many fields, as logged for the requests with many headers
+func largeFieldsLog() *management.Log {
+	fields := make(map[string]interface{}, 200)
+	for i := 0; i < 200; i++ {
+		fields[fmt.Sprintf("field-%d", i)] = strings.Repeat("value", 20)
+	}
+	return &management.Log{Time: "2023-01-01T00:00:00Z", Level: management.Info, Event: management.HTTP, Message: "request", Fields: fields}
+}
+
+func TestPrintJSON(t *testing.T) {
+	l := largeFieldsLog()
+	var out bytes.Buffer
+	printJSON(&out, l, &noopLogger)
+	expected, err := json.Marshal(l)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected)+"\n", out.String())
+}
+
+func BenchmarkPrintJSON(b *testing.B) {
+	l := largeFieldsLog()
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			output, err := json.Marshal(l)
+			if err != nil {
+				b.Fatal(err)
+			}
+			fmt.Fprintln(io.Discard, string(output))
+		}
+	})
+	b.Run("encoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			printJSON(io.Discard, l, &noopLogger)
+		}
+	})
+}
+
+func TestValidateManagementAddr(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "none"},
+		{name: "hostname", args: []string{"--management-addr", "proxy.internal:443"}},
+		{name: "ip without resolving", args: []string{"--management-addr", "192.0.2.1:443", "--no-resolve"}},
+		{name: "hostname without resolving", args: []string{"--management-addr", "proxy.internal:443", "--no-resolve"}, err: "an ip:port is required with --no-resolve"},
+		{name: "missing port", args: []string{"--management-addr", "192.0.2.1"}, err: "please provide a host:port"},
+		{name: "missing address", args: []string{"--no-resolve"}, err: "--no-resolve requires the --management-addr"},
+		{name: "port", args: []string{"--management-port", "8443"}},
+		{name: "invalid port", args: []string{"--management-port", "65536"}, err: "invalid --management-port 65536"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateManagementAddr(newTestContext(t, tt.args...))
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestBuildURL_ManagementPort(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []string
+		host string
+	}{
+		{name: "default", host: "management.argotunnel.com"},
+		{name: "port", args: []string{"--management-port", "8443"}, host: "management.argotunnel.com:8443"},
+		{name: "hostname with port", args: []string{"--management-hostname", "localhost:443", "--management-port", "8443"}, host: "localhost:8443"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := buildURL(newTestContext(t, append([]string{"--token", "test"}, tt.args...)...), &noopLogger)
+			require.NoError(t, err)
+			assert.Equal(t, tt.host, u.Host)
+		})
+	}
+}
+
+func TestValidateAccessServiceToken(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []string
+		err  bool
+	}{
+		{name: "none"},
+		{name: "both", args: []string{"--access-client-id", "id.access", "--access-client-secret", "secret"}},
+		{name: "missing secret", args: []string{"--access-client-id", "id.access"}, err: true},
+		{name: "missing id", args: []string{"--access-client-secret", "secret"}, err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAccessServiceToken(newTestContext(t, tt.args...))
+			if tt.err {
+				assert.ErrorContains(t, err, "must be provided together")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRun_AccessServiceToken(t *testing.T) {
+	conn := &mockConn{
+		MessageReader: management.NewReaderFromBytes(nil),
+		MessageWriter: management.NewWriterToBuffer(&bytes.Buffer{}),
+		closed:        make(chan websocket.StatusCode, 1),
+	}
+	var dialed http.Header
+	dial := func(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (managementConn, error) {
+		dialed = header
+		return conn, nil
+	}
+
+	Init(cliutil.GetBuildInfo("", "test"))
+	c := newTestContext(t, "--token", "test", "--access-client-id", "id.access", "--access-client-secret", "secret")
+	require.NoError(t, run(c, dial, io.Discard, make(chan os.Signal)))
+	assert.Equal(t, "id.access", dialed.Get("Cf-Access-Client-Id"))
+	assert.Equal(t, "secret", dialed.Get("Cf-Access-Client-Secret"))
+}
+
+func TestManagementDialer_Addr(t *testing.T) {
+	hosts := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		conn, err := websocket.Accept(w, r, nil)
+		require.NoError(t, err)
+		conn.Close(websocket.StatusNormalClosure, "")
+	}))
+	defer server.Close()
+
+	// The hostname can't be resolved, so the connection must go to the address
+	u := url.URL{Scheme: "ws", Host: "management.invalid:8080", Path: "/logs"}
+	conn, err := managementDialer(server.Listener.Addr().String(), nil)(context.Background(), u, http.Header{}, nil)
+	require.NoError(t, err)
+	conn.Close(websocket.StatusNormalClosure, "")
+	assert.Equal(t, "management.invalid:8080", <-hosts)
+}
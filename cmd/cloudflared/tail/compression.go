@@ -0,0 +1,54 @@
+package tail
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// compressionStats are the bytes of the management connection received on the wire, where the messages are compressed
+// once the permessage-deflate extension is negotiated, and the bytes of the messages once decompressed.
+type compressionStats struct {
+	compressed   atomic.Int64
+	uncompressed atomic.Int64
+}
+
+// CompressionRatio returns the ratio of the uncompressed to the compressed bytes received, or 0 before any bytes are
+// received.
+func (s *compressionStats) CompressionRatio() float64 {
+	compressed := s.compressed.Load()
+	if compressed == 0 {
+		return 0
+	}
+	return float64(s.uncompressed.Load()) / float64(compressed)
+}
+
+// countingConn counts the bytes read from the connection.
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// meteredConn is the management connection with the compressed and uncompressed bytes received counted. The client
+// events written to it are numbered so that the server acknowledges them.
+type meteredConn struct {
+	*websocket.Conn
+	management.Sequence
+	stats *compressionStats
+}
+
+func (c *meteredConn) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	messageType, data, err := c.Conn.Read(ctx)
+	c.stats.uncompressed.Add(int64(len(data)))
+	return messageType, data, err
+}
@@ -0,0 +1,56 @@
+package tail
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestCompressionStats_CompressionRatio(t *testing.T) {
+	stats := &compressionStats{}
+	assert.Equal(t, float64(0), stats.CompressionRatio())
+	stats.compressed.Store(100)
+	stats.uncompressed.Store(450)
+	assert.Equal(t, 4.5, stats.CompressionRatio())
+}
+
+func TestDialManagement_Metered(t *testing.T) {
+	message := strings.Repeat("connection registered ", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close(websocket.StatusNormalClosure, "")
+		conn.CloseRead(r.Context())
+		assert.NoError(t, management.WriteEvent(conn, r.Context(), &management.EventLog{
+			ServerEvent: management.ServerEvent{Type: management.Logs},
+			Logs:        []*management.Log{{Time: testLogTime, Message: message}},
+		}))
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	u.Scheme = "ws"
+
+	conn, err := dialManagement(context.Background(), *u, http.Header{}, nil, "", nil)
+	require.NoError(t, err)
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	event, err := management.ReadServerEvent(conn, context.Background())
+	require.NoError(t, err)
+	logs, ok := management.IntoServerEvent(event, management.Logs)
+	require.True(t, ok)
+	assert.Equal(t, message, logs.Logs[0].Message)
+
+	// The repetitive message is compressed on the wire
+	stats := conn.(*meteredConn).stats
+	assert.Greater(t, stats.uncompressed.Load(), int64(len(message)))
+	assert.Greater(t, stats.CompressionRatio(), float64(2))
+}
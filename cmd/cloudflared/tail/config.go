@@ -0,0 +1,264 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+var (
+	// Options of the filters of the server that are updated when the config is reloaded
+	reloadableFilterFlags = []string{"level", "event", "sample", "method", "path-pattern", "tag", "conn-id", "no-health-checks", "include-internal"}
+	// Options of the outputs that are recreated when the config is reloaded, along with the options of sinkFlags
+	reloadableOutputFlags = []string{"output", "output-file", "output-mode", "split-by-level", "split-by-event", "show-connector", "pretty", "no-fields", "format-time", "smart"}
+)
+
+func configFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "YAML file of the options of the command, by the names of the flags (e.g. level: info, or event: [http, tcp]), overridden by the command line and the environment",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_CONFIG"},
+		},
+		&cli.BoolFlag{
+			Name:    "watch-config",
+			Usage:   "Reload the --config file on SIGHUP, updating the filters and recreating the outputs. The other options aren't changed until the command is restarted.",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_WATCH_CONFIG"},
+		},
+	}
+}
+
+// loadConfig returns the options of the base context with the options of the config file applied. The options set
+// on the command line or with environment variables in the base context take precedence over the config file.
+func loadConfig(base *cli.Context, path string) (*cli.Context, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	// The flags hold the values that they are applied with, so that each context needs its own flags
+	flags := buildTailCommand(nil).Flags
+	set := flag.NewFlagSet("tail", flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+	for _, f := range flags {
+		if err := f.Apply(set); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range values {
+		if set.Lookup(name) == nil || name == "config" {
+			return nil, fmt.Errorf("unknown option %q in config file %s", name, path)
+		}
+		if base.IsSet(name) {
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		for _, v := range list {
+			if err := set.Set(name, fmt.Sprint(v)); err != nil {
+				return nil, fmt.Errorf("invalid value of option %q in config file %s: %w", name, path, err)
+			}
+		}
+	}
+	for _, name := range base.LocalFlagNames() {
+		value := fmt.Sprint(base.Value(name))
+		if slice, ok := base.Value(name).(cli.StringSlice); ok {
+			// The serialized slice replaces the value rather than being appended to it
+			value = slice.Serialize()
+		}
+		if err := set.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	// The positional arguments are kept as-is
+	if err := set.Parse(append([]string{"--"}, base.Args().Slice()...)); err != nil {
+		return nil, err
+	}
+
+	var parent *cli.Context
+	if lineage := base.Lineage(); len(lineage) > 1 {
+		parent = lineage[1]
+	}
+	c := cli.NewContext(base.App, set, parent)
+	command := *base.Command
+	command.Flags = flags
+	c.Command = &command
+	return c, nil
+}
+
+// reloadableSink writes the logs to the sink, which is replaced when the config is reloaded.
+type reloadableSink struct {
+	mu   sync.RWMutex
+	sink logSink
+}
+
+func (s *reloadableSink) Write(l *management.Log) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sink.Write(l)
+}
+
+// swap replaces the sink, returning the previous sink once it is no longer written to.
+func (s *reloadableSink) swap(sink logSink) logSink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.sink
+	s.sink = sink
+	return previous
+}
+
+func (s *reloadableSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sink.Close()
+}
+
+// configReloader reloads the config file, updating the filters of the server and recreating the outputs. The
+// options that can't be changed without reconnecting are ignored with a warning.
+type configReloader struct {
+	// The options from the command line and the environment, which take precedence over the config file
+	base *cli.Context
+	path string
+	sink *reloadableSink
+	// Written to by the outputs to stdout
+	stdout io.Writer
+	skew   *clockSkew
+	log    *zerolog.Logger
+
+	mu sync.Mutex
+	// The options as last loaded, and the filters of the server from them
+	current *cli.Context
+	filters *management.StreamingFilters
+}
+
+func newConfigReloader(base, current *cli.Context, path string, sink *reloadableSink, stdout io.Writer, skew *clockSkew, filters *management.StreamingFilters, log *zerolog.Logger) *configReloader {
+	return &configReloader{
+		base:    base,
+		current: current,
+		path:    path,
+		sink:    sink,
+		stdout:  stdout,
+		skew:    skew,
+		filters: filters,
+		log:     log,
+	}
+}
+
+// serverFilters returns the filters of the server as last reloaded.
+func (r *configReloader) serverFilters() *management.StreamingFilters {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.filters
+}
+
+// reload loads the config file again and applies the options that changed, sending the updated filters on the
+// connection. The current options are kept if the config file or any of the reloaded options are invalid.
+func (r *configReloader) reload(ctx context.Context, conn managementConn) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next, err := loadConfig(r.base, r.path)
+	if err != nil {
+		return err
+	}
+	var filtersChanged, outputsChanged bool
+	for _, name := range changedFlags(r.current, next) {
+		switch {
+		case slices.Contains(reloadableFilterFlags, name):
+			filtersChanged = true
+		case slices.Contains(reloadableOutputFlags, name) || isSinkFlag(name):
+			outputsChanged = true
+		default:
+			r.log.Warn().Msgf("ignoring the change of --%s in the config file, it can't be changed without reconnecting", name)
+		}
+	}
+
+	// The options are validated before any are applied
+	filters := r.filters
+	if filtersChanged {
+		if filters, err = parseFilters(next); err != nil {
+			return err
+		}
+	}
+	var sink logSink
+	if outputsChanged {
+		if sink, err = newLogSink(next, r.stdout, r.skew, r.log); err != nil {
+			return err
+		}
+	}
+
+	if filtersChanged {
+		err := management.WriteEventWithRetry(conn, ctx, &management.EventUpdateFilters{
+			ClientEvent: management.ClientEvent{Type: management.UpdateFilters},
+			Filters:     filters,
+		}, writeAttempts, writeRetryDelay)
+		if err != nil {
+			if sink != nil {
+				_ = sink.Close()
+			}
+			return fmt.Errorf("unable to update the filters of the server: %w", err)
+		}
+		r.filters = filters
+	}
+	if sink != nil {
+		if err := r.sink.swap(sink).Close(); err != nil {
+			r.log.Err(err).Msg("unable to flush logs to the previous output")
+		}
+	}
+	r.current = next
+	r.log.Info().Msgf("reloaded config file %s", r.path)
+	return nil
+}
+
+// changedFlags returns the names of the options with a different value in the contexts.
+func changedFlags(previous, next *cli.Context) []string {
+	var changed []string
+	for _, f := range next.Command.Flags {
+		name := f.Names()[0]
+		if flagValue(previous, name) != flagValue(next, name) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// flagValue formats the value of the option to compare it.
+func flagValue(c *cli.Context, name string) string {
+	if slice, ok := c.Value(name).(cli.StringSlice); ok {
+		return fmt.Sprint(slice.Value())
+	}
+	return fmt.Sprint(c.Value(name))
+}
+
+func isSinkFlag(name string) bool {
+	for _, f := range sinkFlags() {
+		if slices.Contains(f.Names(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWatchConfig checks that there is a config file to watch.
+func validateWatchConfig(c *cli.Context) error {
+	if c.Bool("watch-config") && c.String("config") == "" {
+		return errors.New("--watch-config requires the --config file to reload")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func writeConfig(t *testing.T, path, config string) {
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.yaml")
+	writeConfig(t, path, "level: info\nevent: [http, tcp]\noutput: json\ndrain-timeout: 10s\n")
+	c, err := loadConfig(newTestContext(t, "--level", "warn", "--sink", "webhook:https://example.com", "TUNNEL"), path)
+	require.NoError(t, err)
+	// The command line takes precedence over the config file
+	assert.Equal(t, "warn", c.String("level"))
+	assert.Equal(t, []string{"http", "tcp"}, c.StringSlice("event"))
+	assert.Equal(t, []string{"json"}, c.StringSlice("output"))
+	assert.Equal(t, "10s", c.Duration("drain-timeout").String())
+	assert.Equal(t, []string{"webhook:https://example.com"}, c.StringSlice("sink"))
+	assert.Equal(t, "TUNNEL", c.Args().First())
+	assert.True(t, c.IsSet("event"))
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "unknown option",
+			config: "unknown: true\n",
+		},
+		{
+			name:   "invalid value",
+			config: "drain-timeout: soon\n",
+		},
+		{
+			name:   "invalid yaml",
+			config: "level: [info\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tail.yaml")
+			writeConfig(t, path, test.config)
+			_, err := loadConfig(newTestContext(t), path)
+			assert.Error(t, err)
+		})
+	}
+	_, err := loadConfig(newTestContext(t), filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestConfigReloader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tail.yaml")
+	first, second := filepath.Join(dir, "first.log"), filepath.Join(dir, "second.log")
+	writeConfig(t, path, "level: info\noutput: file:"+first+"\n")
+	base := newTestContext(t, "--config", path, "--watch-config")
+	current, err := loadConfig(base, path)
+	require.NoError(t, err)
+	filters, err := parseFilters(current)
+	require.NoError(t, err)
+	output, err := newLogSink(current, &bytes.Buffer{}, nil, &noopLogger)
+	require.NoError(t, err)
+	sink := &reloadableSink{sink: output}
+	reloader := newConfigReloader(base, current, path, sink, &bytes.Buffer{}, nil, filters, &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Time: testLogTime, Message: "first"}))
+
+	// The filters are updated and the output is recreated, while the options that need a reconnect are ignored
+	writeConfig(t, path, "level: error\noutput: file:"+second+"\ntoken: changed\n")
+	var written bytes.Buffer
+	conn := &mockConn{MessageWriter: management.NewWriterToBuffer(&written)}
+	require.NoError(t, reloader.reload(context.Background(), conn))
+	require.NoError(t, sink.Write(&management.Log{Time: testLogTime, Message: "second"}))
+	require.NoError(t, sink.Close())
+
+	var update management.EventUpdateFilters
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(written.Bytes()), &update))
+	assert.Equal(t, management.UpdateFilters, update.Type)
+	require.NotNil(t, update.Filters.Level)
+	assert.Equal(t, management.Error, *update.Filters.Level)
+	assert.Equal(t, update.Filters, reloader.serverFilters())
+
+	data, err := os.ReadFile(first)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "first")
+	assert.NotContains(t, string(data), "second")
+	data, err = os.ReadFile(second)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "second")
+
+	// The current options are kept when the config file is invalid
+	writeConfig(t, path, "level: verbose\n")
+	assert.Error(t, reloader.reload(context.Background(), conn))
+	assert.Equal(t, management.Error, *reloader.serverFilters().Level)
+	assert.Equal(t, 1, strings.Count(written.String(), "update_filters"))
+}
+
+func TestValidateWatchConfig(t *testing.T) {
+	assert.NoError(t, validateWatchConfig(newTestContext(t, "--config", "tail.yaml", "--watch-config")))
+	assert.Error(t, validateWatchConfig(newTestContext(t, "--watch-config")))
+}
@@ -0,0 +1,85 @@
+package tail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// Clears the current line to redraw the counts in place
+const ansiClearLine = "\r\x1b[K"
+
+// Event types in the order of the counts
+var countedEvents = []management.LogEventType{management.HTTP, management.TCP, management.UDP, management.Cloudflared}
+
+func eventCountsFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "event-counts-only",
+			Usage:   "Instead of printing the logs, count the logs of each event type and redraw the counts on one line to stderr",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_EVENT_COUNTS_ONLY"},
+		},
+		&cli.DurationFlag{
+			Name:    "event-counts-interval",
+			Usage:   "How often the --event-counts-only counts are redrawn",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_EVENT_COUNTS_INTERVAL"},
+			Value:   time.Second,
+		},
+	}
+}
+
+// eventCounts counts the logs of each event type. The logs are counted by the reader as they are received and
+// dropped, so none of them are written to the sink.
+type eventCounts struct {
+	counts [management.UDP + 1]atomic.Uint64
+}
+
+// processor counts the log and drops it.
+func (e *eventCounts) processor() logProcessor {
+	return func(l *management.Log) bool {
+		if l.Event >= 0 && int(l.Event) < len(e.counts) {
+			e.counts[l.Event].Add(1)
+		}
+		return false
+	}
+}
+
+// String returns the counts of each event type, e.g. http:1200 tcp:34 udp:5 cloudflared:9
+func (e *eventCounts) String() string {
+	counts := make([]string, 0, len(countedEvents))
+	for _, event := range countedEvents {
+		counts = append(counts, fmt.Sprintf("%s:%d", event, e.counts[event].Load()))
+	}
+	return strings.Join(counts, " ")
+}
+
+// drawLoop redraws the counts periodically until the context is cancelled, in place on a terminal or one line per
+// snapshot otherwise, and then draws the final tally.
+func (e *eventCounts) drawLoop(ctx context.Context, w io.Writer, tty bool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if tty {
+				fmt.Fprintf(w, "%s%s\n", ansiClearLine, e)
+			} else {
+				fmt.Fprintln(w, e)
+			}
+			return
+		case <-ticker.C:
+			if tty {
+				fmt.Fprintf(w, "%s%s", ansiClearLine, e)
+			} else {
+				fmt.Fprintln(w, e)
+			}
+		}
+	}
+}
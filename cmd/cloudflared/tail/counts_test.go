@@ -0,0 +1,44 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestEventCounts(t *testing.T) {
+	counts := &eventCounts{}
+	process := counts.processor()
+	for _, event := range []management.LogEventType{management.HTTP, management.HTTP, management.TCP, management.Cloudflared, -1} {
+		// None of the logs are written to the sink
+		assert.False(t, process(&management.Log{Event: event}))
+	}
+	assert.Equal(t, "http:2 tcp:1 udp:0 cloudflared:1", counts.String())
+}
+
+func TestEventCounts_DrawLoop(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		tty      bool
+		expected string
+	}{
+		{name: "tty", tty: true, expected: ansiClearLine + "http:1 tcp:0 udp:0 cloudflared:0\n"},
+		{name: "not a tty", expected: "http:1 tcp:0 udp:0 cloudflared:0\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := &eventCounts{}
+			counts.processor()(&management.Log{Event: management.HTTP})
+			var out bytes.Buffer
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			// Only the final tally is drawn once cancelled
+			counts.drawLoop(ctx, &out, tt.tty, time.Hour)
+			assert.Equal(t, tt.expected, out.String())
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	datadogMaxAttempts = 5
+	datadogBaseBackoff = time.Second
+	datadogMaxBackoff  = 30 * time.Second
+	// Maximum number of logs in each request to the Datadog Logs API
+	datadogMaxBatch = 1000
+)
+
+func datadogFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "datadog-api-key",
+			Usage:   "Datadog API key when using --output datadog",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_DATADOG_API_KEY", "DD_API_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "datadog-site",
+			Usage:   "Datadog site that the logs are sent to when using --output datadog, e.g. datadoghq.eu",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_DATADOG_SITE", "DD_SITE"},
+			Value:   "datadoghq.com",
+		},
+		&cli.StringFlag{
+			Name:    "datadog-service",
+			Usage:   "Datadog service of the logs when using --output datadog",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_DATADOG_SERVICE"},
+			Value:   "cloudflared",
+		},
+		&cli.StringSliceFlag{
+			Name:    "datadog-tags",
+			Usage:   "Additional Datadog tags of the logs as key:value (e.g. env:prod), on top of the connector:ID tag",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_DATADOG_TAGS"},
+		},
+		&cli.IntFlag{
+			Name:    "datadog-batch-size",
+			Usage:   fmt.Sprintf("Maximum number of logs sent to Datadog in each request (up to %d)", datadogMaxBatch),
+			EnvVars: []string{"TUNNEL_MANAGEMENT_DATADOG_BATCH_SIZE"},
+			Value:   100,
+		},
+		&cli.DurationFlag{
+			Name:    "datadog-flush-interval",
+			Usage:   "Send the logs to Datadog after this much time has passed, even if the batch isn't full",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_DATADOG_FLUSH_INTERVAL"},
+			Value:   time.Second,
+		},
+	}
+}
+
+// datadogEntry is a log in the JSON format of the Datadog Logs API.
+type datadogEntry struct {
+	DDSource string                 `json:"ddsource"`
+	DDTags   string                 `json:"ddtags,omitempty"`
+	Hostname string                 `json:"hostname,omitempty"`
+	Service  string                 `json:"service,omitempty"`
+	Message  string                 `json:"message"`
+	Date     string                 `json:"date,omitempty"`
+	Status   string                 `json:"status,omitempty"`
+	Event    string                 `json:"event,omitempty"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+}
+
+// datadogSink POSTs the logs to the Datadog Logs API in batches.
+type datadogSink struct {
+	*batchSink
+	url      string
+	apiKey   string
+	service  string
+	hostname string
+	// The tags of every log, joined with commas
+	tags   string
+	client *http.Client
+	log    *zerolog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newDatadogSink(c *cli.Context, log *zerolog.Logger) (*datadogSink, error) {
+	apiKey := c.String("datadog-api-key")
+	if apiKey == "" {
+		return nil, errors.New("--datadog-api-key is required when using --output datadog")
+	}
+	site := c.String("datadog-site")
+	if site == "" || strings.Contains(site, "/") {
+		return nil, fmt.Errorf("invalid --datadog-site %q, please provide the site without a scheme, e.g. datadoghq.com", site)
+	}
+	tags, err := parseDatadogTags(c.StringSlice("datadog-tags"))
+	if err != nil {
+		return nil, err
+	}
+	size := c.Int("datadog-batch-size")
+	if size <= 0 || size > datadogMaxBatch {
+		return nil, fmt.Errorf("--datadog-batch-size must be between 1 and %d", datadogMaxBatch)
+	}
+	interval := c.Duration("datadog-flush-interval")
+	if interval <= 0 {
+		return nil, errors.New("--datadog-flush-interval must be greater than 0")
+	}
+	hostname, _ := os.Hostname()
+	url := fmt.Sprintf("https://http-intake.logs.%s/v1/input", site)
+	client := &http.Client{Timeout: 30 * time.Second}
+	return newDatadogSinkWithClient(url, apiKey, c.String("datadog-service"), hostname, tags, size, interval, client, log), nil
+}
+
+// parseDatadogTags checks that each of the tags is a key:value pair.
+func parseDatadogTags(values []string) ([]string, error) {
+	tags := make([]string, 0, len(values))
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, ":")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid --datadog-tags value %q, expected key:value", v)
+		}
+		tags = append(tags, v)
+	}
+	return tags, nil
+}
+
+func newDatadogSinkWithClient(
+	url, apiKey, service, hostname string,
+	tags []string,
+	size int,
+	interval time.Duration,
+	client *http.Client,
+	log *zerolog.Logger,
+) *datadogSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &datadogSink{
+		url:      url,
+		apiKey:   apiKey,
+		service:  service,
+		hostname: hostname,
+		tags:     strings.Join(tags, ","),
+		client:   client,
+		log:      log,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	s.batchSink = newBatchSink(size, interval, s.send, log)
+	return s
+}
+
+// Close sends the remaining logs.
+func (s *datadogSink) Close() error {
+	defer s.cancel()
+	return s.batchSink.Close()
+}
+
+func (s *datadogSink) entry(l *management.Log) datadogEntry {
+	tags := s.tags
+	if l.ConnectorID != "" {
+		connector := "connector:" + l.ConnectorID
+		if tags == "" {
+			tags = connector
+		} else {
+			tags += "," + connector
+		}
+	}
+	return datadogEntry{
+		DDSource: "cloudflared",
+		DDTags:   tags,
+		Hostname: s.hostname,
+		Service:  s.service,
+		Message:  l.Message,
+		Date:     l.Time,
+		Status:   l.Level.String(),
+		Event:    l.Event.String(),
+		Fields:   l.Fields,
+	}
+}
+
+// send POSTs the logs to the Datadog Logs API, retrying with an exponential backoff when the request fails or Datadog
+// responds with a retryable status. The logs are dropped once the attempts are exhausted.
+func (s *datadogSink) send(logs []*management.Log) error {
+	entries := make([]datadogEntry, 0, len(logs))
+	for _, l := range logs {
+		entries = append(entries, s.entry(l))
+	}
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	backoff := datadogBaseBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.post(body)
+		if err == nil {
+			return nil
+		}
+		var permanent *datadogPermanentError
+		if errors.As(err, &permanent) || attempt >= datadogMaxAttempts {
+			return fmt.Errorf("dropped %d logs: %w", len(logs), err)
+		}
+		s.log.Debug().Err(err).Msgf("retrying datadog delivery in %s", backoff)
+		select {
+		case <-s.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, datadogMaxBackoff)
+	}
+}
+
+// datadogPermanentError is returned when Datadog rejects the request and retrying won't help, e.g. an invalid API key
+// or a payload that is too large.
+type datadogPermanentError struct {
+	status int
+	body   []byte
+}
+
+func (e *datadogPermanentError) Error() string {
+	return fmt.Sprintf("datadog returned http status %d: %s", e.status, e.body)
+}
+
+func (s *datadogSink) post(body []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("DD-API-KEY", s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	// Datadog recommends retrying the timeouts, the rate limited requests and the server errors
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("datadog returned http status %d: %s", resp.StatusCode, respBody)
+	default:
+		return &datadogPermanentError{status: resp.StatusCode, body: respBody}
+	}
+}
@@ -0,0 +1,127 @@
+package tail
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestNewDatadogSink(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		args      []string
+		expectErr bool
+	}{
+		{
+			name: "api key",
+			args: []string{"--datadog-api-key", "key"},
+		},
+		{
+			name: "site and tags",
+			args: []string{"--datadog-api-key", "key", "--datadog-site", "datadoghq.eu", "--datadog-tags", "env:prod", "--datadog-tags", "team:edge"},
+		},
+		{
+			name:      "missing api key",
+			args:      []string{"--datadog-site", "datadoghq.eu"},
+			expectErr: true,
+		},
+		{
+			name:      "site with scheme",
+			args:      []string{"--datadog-api-key", "key", "--datadog-site", "https://datadoghq.eu"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid tag",
+			args:      []string{"--datadog-api-key", "key", "--datadog-tags", "prod"},
+			expectErr: true,
+		},
+		{
+			name:      "batch too large",
+			args:      []string{"--datadog-api-key", "key", "--datadog-batch-size", "1001"},
+			expectErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink, err := newDatadogSink(newTestContext(t, test.args...), &noopLogger)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, sink.Close())
+		})
+	}
+}
+
+func TestDatadogSink_Entries(t *testing.T) {
+	entries := make(chan []datadogEntry, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("DD-API-KEY"))
+		var batch []datadogEntry
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		entries <- batch
+	}))
+	defer server.Close()
+
+	sink := newDatadogSinkWithClient(server.URL, "key", "cloudflared", "host", []string{"env:prod"}, 2, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{
+		Time:        "2023-03-01T10:00:00Z",
+		Level:       management.Warn,
+		Event:       management.HTTP,
+		Message:     "first",
+		ConnectorID: "4e2bb1a8",
+	}))
+	require.NoError(t, sink.Write(&management.Log{Message: "second"}))
+
+	batch := <-entries
+	require.Len(t, batch, 2)
+	assert.Equal(t, datadogEntry{
+		DDSource: "cloudflared",
+		DDTags:   "env:prod,connector:4e2bb1a8",
+		Hostname: "host",
+		Service:  "cloudflared",
+		Message:  "first",
+		Date:     "2023-03-01T10:00:00Z",
+		Status:   "warn",
+		Event:    "http",
+	}, batch[0])
+	assert.Equal(t, "env:prod", batch[1].DDTags)
+	require.NoError(t, sink.Close())
+}
+
+func TestDatadogSink_Retry(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	sink := newDatadogSinkWithClient(server.URL, "key", "cloudflared", "host", nil, 100, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test"}))
+	require.NoError(t, sink.Close())
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestDatadogSink_NoRetryOnClientError(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	sink := newDatadogSinkWithClient(server.URL, "key", "cloudflared", "host", nil, 100, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test"}))
+	assert.ErrorContains(t, sink.Close(), "dropped 1 logs")
+	assert.Equal(t, int32(1), attempts.Load())
+}
@@ -0,0 +1,80 @@
+package tail
+
+import (
+	"time"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Logs remembered to recognize the logs that are received again
+	dedupSize = 10000
+	// Time after a reconnect that the logs received again are skipped, and that the logs are remembered for
+	dedupTTL = 30 * time.Second
+)
+
+// dedupEntry is the time that the log with the key was seen.
+type dedupEntry struct {
+	key  string
+	seen time.Time
+}
+
+// deduplicator recognizes the logs that are received again after a reconnect, e.g. the recent logs that the server
+// replays or that are received from both of the connections while the connection is renewed. The logs are only
+// compared within the TTL after a reconnect, since separate logs may be identical otherwise.
+type deduplicator struct {
+	size int
+	ttl  time.Duration
+	// The time that each key was last seen, bounded by the size and the TTL
+	seen map[string]time.Time
+	// The keys in the order they were seen, to expire the oldest
+	order []dedupEntry
+	// The logs are compared until then
+	checkUntil time.Time
+	now        func() time.Time
+}
+
+func newDeduplicator(size int, ttl time.Duration) *deduplicator {
+	return &deduplicator{
+		size: size,
+		ttl:  ttl,
+		seen: make(map[string]time.Time, size),
+		now:  time.Now,
+	}
+}
+
+// reconnected starts skipping the logs that were already seen, until the TTL has passed.
+func (d *deduplicator) reconnected() {
+	d.checkUntil = d.now().Add(d.ttl)
+}
+
+// duplicate returns true if the log was already seen shortly before a reconnect, otherwise the log is remembered.
+func (d *deduplicator) duplicate(l *management.Log) bool {
+	now := d.now()
+	d.expire(now)
+	key := l.DeduplicationKey()
+	if _, ok := d.seen[key]; ok && now.Before(d.checkUntil) {
+		return true
+	}
+	d.seen[key] = now
+	d.order = append(d.order, dedupEntry{key: key, seen: now})
+	return false
+}
+
+// expire forgets the keys that were seen before the TTL, and the oldest keys to make room for another key within
+// the size.
+func (d *deduplicator) expire(now time.Time) {
+	expired := 0
+	for _, e := range d.order {
+		if len(d.order)-expired < d.size && now.Sub(e.seen) < d.ttl {
+			break
+		}
+		// The key is kept if it was seen again since
+		if d.seen[e.key] == e.seen {
+			delete(d.seen, e.key)
+		}
+		expired++
+	}
+	// The expired entries are released once the slice is reallocated
+	d.order = d.order[expired:]
+}
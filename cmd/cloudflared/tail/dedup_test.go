@@ -0,0 +1,77 @@
+package tail
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func newTestDeduplicator(size int, ttl time.Duration) (*deduplicator, *time.Time) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := newDeduplicator(size, ttl)
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+func TestDeduplicator(t *testing.T) {
+	d, now := newTestDeduplicator(10, time.Minute)
+	first := &management.Log{Time: "2023-01-01T00:00:00Z", Message: "first"}
+	second := &management.Log{Time: "2023-01-01T00:00:00Z", Message: "second"}
+	// Identical logs aren't skipped until a reconnect
+	assert.False(t, d.duplicate(first))
+	assert.False(t, d.duplicate(first))
+	assert.False(t, d.duplicate(second))
+
+	d.reconnected()
+	assert.True(t, d.duplicate(first))
+	assert.True(t, d.duplicate(second))
+	assert.False(t, d.duplicate(&management.Log{Time: "2023-01-01T00:00:01Z", Message: "first"}))
+
+	// The logs aren't skipped once the TTL after the reconnect has passed
+	*now = now.Add(time.Minute)
+	assert.False(t, d.duplicate(first))
+}
+
+func TestDeduplicator_Expire(t *testing.T) {
+	d, now := newTestDeduplicator(2, time.Minute)
+	logs := []*management.Log{{Message: "1"}, {Message: "2"}, {Message: "3"}}
+	for _, l := range logs {
+		assert.False(t, d.duplicate(l))
+	}
+	d.reconnected()
+	// The oldest log is forgotten beyond the size
+	assert.False(t, d.duplicate(logs[0]))
+	assert.Len(t, d.seen, 2)
+
+	*now = now.Add(30 * time.Second)
+	d.reconnected()
+	assert.True(t, d.duplicate(logs[0]))
+	// The logs are forgotten after the TTL
+	*now = now.Add(time.Minute)
+	d.reconnected()
+	assert.False(t, d.duplicate(logs[0]))
+	assert.Len(t, d.seen, 1)
+	assert.Len(t, d.order, 1)
+}
+
+func TestLogStreamer_Dedup(t *testing.T) {
+	dedup, _ := newTestDeduplicator(dedupSize, dedupTTL)
+	assert.False(t, dedup.duplicate(&management.Log{Time: "2023-01-01T00:00:00Z", Message: "test1"}))
+	dedup.reconnected()
+	// The log received before the reconnect is skipped
+	data := []byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1"},{"time":"2023-01-01T00:00:00Z","message":"test2"}]}
+`)
+	streamer := &logStreamer{dedup: dedup, log: &noopLogger}
+	logs := make(chan *management.Log, 10)
+	streamer.readEvents(context.Background(), management.NewReaderFromBytes(data), logs)
+	close(logs)
+	var messages []string
+	for l := range logs {
+		messages = append(messages, l.Message)
+	}
+	assert.Equal(t, []string{"test2"}, messages)
+}
@@ -0,0 +1,177 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Number of pings sent to the management service by --diag
+	diagPings = 10
+	// Time to wait for the response to a ping before it is considered lost
+	diagPingTimeout = 2 * time.Second
+)
+
+// pong is the response to a ping received by the diagnostics
+type pong struct {
+	id       uint64
+	received time.Time
+}
+
+// diagStats are the round-trip times of the pings sent to the management service.
+type diagStats struct {
+	sent int
+	rtts []time.Duration
+}
+
+// runDiagnostics sends the pings to the management service one after the other, measuring the round-trip time of
+// each. Pings that aren't answered within the timeout are counted as lost. The connection is closed once the
+// diagnostics complete, so a new connection is required to stream the logs.
+func runDiagnostics(ctx context.Context, conn managementConn, pings int, timeout time.Duration) (*diagStats, error) {
+	pongs := make(chan pong, pings)
+	readErr := make(chan error, 1)
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		readErr <- readPongs(ctx, conn, pongs)
+	}()
+	defer func() {
+		// Closing the connection interrupts the reader
+		conn.Close(websocket.StatusNormalClosure, "")
+		select {
+		case <-readerDone:
+		case <-time.After(closeTimeout):
+		}
+	}()
+
+	stats := &diagStats{}
+	for id := uint64(0); id < uint64(pings); id++ {
+		sent := time.Now()
+		err := management.WriteEvent(conn, ctx, &management.EventPing{
+			ClientEvent: management.ClientEvent{Type: management.Ping},
+			ID:          id,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to send ping: %w", err)
+		}
+		stats.sent++
+		rtt, ok, err := waitForPong(ctx, id, sent, timeout, pongs, readErr)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			stats.rtts = append(stats.rtts, rtt)
+		}
+	}
+	return stats, nil
+}
+
+// waitForPong waits for the response to the ping with the id; false is returned if the ping is lost.
+func waitForPong(ctx context.Context, id uint64, sent time.Time, timeout time.Duration, pongs <-chan pong, readErr <-chan error) (time.Duration, bool, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, false, ctx.Err()
+		case err := <-readErr:
+			if err == nil {
+				err = errors.New("management connection closed during diagnostics")
+			}
+			return 0, false, err
+		case <-timer.C:
+			return 0, false, nil
+		case p := <-pongs:
+			// Responses to the pings that were already considered lost are ignored
+			if p.id != id {
+				continue
+			}
+			return p.received.Sub(sent), true, nil
+		}
+	}
+}
+
+// readPongs reads the responses to the pings until the connection is closed.
+func readPongs(ctx context.Context, reader management.MessageReader, pongs chan<- pong) error {
+	// Pending reads are interrupted by closing the connection, as with the streamer
+	readCtx := context.WithoutCancel(ctx)
+	for {
+		event, err := management.ReadServerEvent(reader, readCtx)
+		received := time.Now()
+		if err != nil {
+			if closeErr := management.AsClosed(err); closeErr != nil {
+				if closeErr.Code == websocket.StatusNormalClosure {
+					return nil
+				}
+				return fmt.Errorf("management connection closed during diagnostics, the server may not support them: (%d) %s", closeErr.Code, closeErr.Reason)
+			}
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			// Only the pongs are used, so the logs received meanwhile don't need to be valid
+			var malformed *management.MalformedEventError
+			if errors.As(err, &malformed) {
+				continue
+			}
+			return fmt.Errorf("unable to read event from server: %w", err)
+		}
+		pongEvent, ok := management.IntoServerControlEvent[management.EventPong](event, management.Pong)
+		if !ok {
+			continue
+		}
+		select {
+		case pongs <- pong{id: pongEvent.ID, received: received}:
+		default:
+			// Only the responses that are waited for are kept
+		}
+	}
+}
+
+// loss returns the fraction of the pings that were lost.
+func (s *diagStats) loss() float64 {
+	if s.sent == 0 {
+		return 0
+	}
+	return float64(s.sent-len(s.rtts)) / float64(s.sent)
+}
+
+// summary returns the min, average, max and standard deviation of the round-trip times.
+func (s *diagStats) summary() (fastest, avg, slowest, stddev time.Duration) {
+	if len(s.rtts) == 0 {
+		return 0, 0, 0, 0
+	}
+	fastest, slowest = s.rtts[0], s.rtts[0]
+	var sum float64
+	for _, rtt := range s.rtts {
+		if rtt < fastest {
+			fastest = rtt
+		}
+		if rtt > slowest {
+			slowest = rtt
+		}
+		sum += float64(rtt)
+	}
+	mean := sum / float64(len(s.rtts))
+	var variance float64
+	for _, rtt := range s.rtts {
+		variance += math.Pow(float64(rtt)-mean, 2)
+	}
+	variance /= float64(len(s.rtts))
+	return fastest, time.Duration(mean), slowest, time.Duration(math.Sqrt(variance))
+}
+
+// printSummary writes the round-trip time and loss statistics of the diagnostics.
+func (s *diagStats) printSummary(w io.Writer) {
+	fastest, avg, slowest, stddev := s.summary()
+	fmt.Fprintf(w, "management diagnostics: %d pings sent, %d received, %.1f%% loss\n", s.sent, len(s.rtts), 100*s.loss())
+	fmt.Fprintf(w, "round-trip min/avg/max/stddev = %s/%s/%s/%s\n",
+		fastest.Round(time.Microsecond), avg.Round(time.Microsecond), slowest.Round(time.Microsecond), stddev.Round(time.Microsecond))
+}
@@ -0,0 +1,82 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/internal/test"
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// pongServer answers the pings from the client, except for the ping with the lost id
+func pongServer(t *testing.T, server *websocket.Conn, lost uint64) {
+	for {
+		event, err := management.ReadClientEvent(server, context.Background())
+		if err != nil {
+			// The client closes the connection once the diagnostics complete
+			server.Close(websocket.StatusNormalClosure, "")
+			return
+		}
+		ping, ok := management.IntoClientEvent[management.EventPing](event, management.Ping)
+		require.True(t, ok)
+		if ping.ID == lost {
+			continue
+		}
+		assert.NoError(t, management.WriteEvent(server, context.Background(), &management.EventPong{
+			ServerEvent: management.ServerEvent{Type: management.Pong},
+			ID:          ping.ID,
+		}))
+	}
+}
+
+func TestRunDiagnostics(t *testing.T) {
+	defer leaktest.Check(t)()
+	client, server := test.WSPipe(nil, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pongServer(t, server, 3)
+	}()
+	stats, err := runDiagnostics(context.Background(), client, 5, 50*time.Millisecond)
+	require.NoError(t, err)
+	<-done
+	assert.Equal(t, 5, stats.sent)
+	assert.Len(t, stats.rtts, 4)
+	assert.InDelta(t, 0.2, stats.loss(), 0.001)
+}
+
+func TestRunDiagnostics_Unsupported(t *testing.T) {
+	defer leaktest.Check(t)()
+	client, server := test.WSPipe(nil, nil)
+	go func() {
+		// Servers without diagnostics close the connection on unknown events
+		_, _ = management.ReadClientEvent(server, context.Background())
+		server.Close(websocket.StatusUnsupportedData, "unexpected event")
+	}()
+	_, err := runDiagnostics(context.Background(), client, 5, time.Second)
+	assert.ErrorContains(t, err, "may not support them: (1003) unexpected event")
+}
+
+func TestDiagStats_Summary(t *testing.T) {
+	stats := &diagStats{
+		sent: 4,
+		rtts: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond},
+	}
+	fastest, avg, slowest, stddev := stats.summary()
+	assert.Equal(t, 10*time.Millisecond, fastest)
+	assert.Equal(t, 20*time.Millisecond, avg)
+	assert.Equal(t, 30*time.Millisecond, slowest)
+	assert.Equal(t, 8165*time.Microsecond, stddev.Round(time.Microsecond))
+
+	var out bytes.Buffer
+	stats.printSummary(&out)
+	assert.Equal(t, "management diagnostics: 4 pings sent, 3 received, 25.0% loss\n"+
+		"round-trip min/avg/max/stddev = 10ms/20ms/30ms/8.165ms\n", out.String())
+}
@@ -0,0 +1,123 @@
+package tail
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// Codes of the errors reported by the tail command; the validation errors of the management request use the codes
+// returned by the management service instead.
+const (
+	codeInvalidArguments = 1
+	codeAuthentication   = 2
+	codeConnection       = 3
+	codeOutput           = 4
+	codeStream           = 5
+	codeMockMismatch     = 6
+)
+
+// cliError is the JSON object written to stderr for each error with --structured-errors.
+type cliError struct {
+	Message string `json:"error"`
+	Code    int    `json:"code"`
+	// Whether running the command again may succeed without changing its arguments
+	Recoverable bool `json:"recoverable"`
+	err         error
+}
+
+// errorReporter reports the errors of the command either to the logger or, with --structured-errors, as JSON
+// objects to stderr.
+type errorReporter struct {
+	structured bool
+	log        *zerolog.Logger
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// report reports the error with the message describing the operation that failed.
+func (r *errorReporter) report(err error, msg string, code int, recoverable bool) {
+	r.emit(cliError{Message: msg, Code: code, Recoverable: recoverable, err: err})
+}
+
+func (r *errorReporter) emit(e cliError) {
+	if !r.structured {
+		r.log.Error().Err(e.err).Msg(e.Message)
+		return
+	}
+	if e.err != nil {
+		e.Message = fmt.Sprintf("%s: %s", e.Message, e.err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		r.log.Err(err).Msg("unable to marshal error")
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = r.out.Write(append(data, '\n'))
+}
+
+// validationError is returned when the management service refuses the request, with each of the reasons provided.
+// It unwraps to the management.ValidationError of each of the reasons.
+type validationError struct {
+	errors []cliError
+	// The reasons provided by the management service
+	reasons []*management.ValidationError
+}
+
+func (e *validationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.reasons))
+	for _, reason := range e.reasons {
+		errs = append(errs, reason)
+	}
+	return errs
+}
+
+func (e *validationError) Error() string {
+	messages := make([]string, 0, len(e.errors))
+	for _, err := range e.errors {
+		messages = append(messages, err.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// newValidationError parses the reasons the management request was refused from the response.
+func newValidationError(resp *http.Response) *validationError {
+	verr := &validationError{}
+	if resp.StatusCode == 530 {
+		verr.errors = append(verr.errors, cliError{
+			Message:     "no cloudflared connector available or reachable via management request (a recent version of cloudflared is required to use streaming logs)",
+			Code:        resp.StatusCode,
+			Recoverable: true,
+		})
+	}
+	reasons, err := management.ReadErrorResponse(resp.Body)
+	if err != nil {
+		verr.errors = append(verr.errors, cliError{
+			Message: fmt.Sprintf("unable to start management log streaming session: http response code returned %d", resp.StatusCode),
+			Code:    resp.StatusCode,
+		})
+		return verr
+	}
+	if len(reasons) == 0 {
+		verr.errors = append(verr.errors, cliError{
+			Message: "management tunnel validation returned success with invalid HTTP response code to convert to a WebSocket request",
+			Code:    resp.StatusCode,
+		})
+		return verr
+	}
+	for _, e := range reasons {
+		verr.errors = append(verr.errors, cliError{Message: e.Error(), Code: e.Code})
+	}
+	verr.reasons = reasons
+	return verr
+}
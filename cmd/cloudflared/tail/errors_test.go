@@ -0,0 +1,83 @@
+package tail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestErrorReporter(t *testing.T) {
+	var out, logs bytes.Buffer
+	log := zerolog.New(&logs)
+	errs := &errorReporter{log: &log, out: &out}
+	errs.report(errors.New("invalid level"), "invalid filters provided", codeInvalidArguments, false)
+	assert.Equal(t, `{"level":"error","error":"invalid level","message":"invalid filters provided"}`+"\n", logs.String())
+	assert.Empty(t, out.String())
+
+	logs.Reset()
+	errs.structured = true
+	errs.report(errors.New("invalid level"), "invalid filters provided", codeInvalidArguments, false)
+	errs.emit(cliError{Message: "connection lost", Code: codeStream, Recoverable: true})
+	assert.Equal(t, `{"error":"invalid filters provided: invalid level","code":1,"recoverable":false}`+"\n"+
+		`{"error":"connection lost","code":5,"recoverable":true}`+"\n", out.String())
+	assert.Empty(t, logs.String())
+}
+
+func TestNewValidationError(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		statusCode int
+		body       string
+		expected   []cliError
+	}{
+		{
+			name:       "management errors",
+			statusCode: http.StatusBadRequest,
+			body:       `{"success":false,"errors":[{"code":1001,"message":"missing access_token"}]}`,
+			expected:   []cliError{{Message: "management request failed validation: (1001) missing access_token", Code: 1001}},
+		},
+		{
+			name:       "invalid body",
+			statusCode: http.StatusBadGateway,
+			body:       "bad gateway",
+			expected:   []cliError{{Message: "unable to start management log streaming session: http response code returned 502", Code: 502}},
+		},
+		{
+			name:       "no connector",
+			statusCode: 530,
+			body:       `{"success":false,"errors":[{"code":1002,"message":"origin unreachable"}]}`,
+			expected: []cliError{
+				{
+					Message:     "no cloudflared connector available or reachable via management request (a recent version of cloudflared is required to use streaming logs)",
+					Code:        530,
+					Recoverable: true,
+				},
+				{Message: "management request failed validation: (1002) origin unreachable", Code: 1002},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.statusCode, Body: io.NopCloser(strings.NewReader(tt.body))}
+			assert.Equal(t, tt.expected, newValidationError(resp).errors)
+		})
+	}
+}
+
+func TestValidationError_Unwrap(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Body:       io.NopCloser(strings.NewReader(`{"success":false,"errors":[{"code":1001,"message":"missing access_token"}]}`)),
+	}
+	var err error = newValidationError(resp)
+	var reason *management.ValidationError
+	assert.True(t, errors.As(err, &reason))
+	assert.Equal(t, &management.ValidationError{Code: 1001, Message: "missing access_token"}, reason)
+}
@@ -0,0 +1,137 @@
+package tail
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	levelPlaceholder = "%s"
+	eventFileSuffix  = ".log"
+
+	// Modes of the --output-mode
+	outputModeAppend    = "append"
+	outputModeOverwrite = "overwrite"
+)
+
+// fileSink writes the logs to files, with the file of each log chosen by path. The files are opened lazily once a
+// log for the file is observed.
+type fileSink struct {
+	path   func(l *management.Log) string
+	json   bool
+	format lineFormat
+	// Replace the content of the files when they are opened, rather than appending to it
+	overwrite bool
+	log       *zerolog.Logger
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+func newFileSink(flag string, path func(l *management.Log) string, output string, format lineFormat, log *zerolog.Logger) (*fileSink, error) {
+	s := &fileSink{
+		path:   path,
+		format: format,
+		log:    log,
+		files:  make(map[string]*os.File),
+	}
+	switch output {
+	case "default", "":
+	case "json":
+		s.json = true
+	default:
+		return nil, fmt.Errorf("--%s can't be used with --output %s", flag, output)
+	}
+	return s, nil
+}
+
+// overwriteFiles returns true if the files are overwritten according to the --output-mode.
+func overwriteFiles(c *cli.Context) (bool, error) {
+	switch mode := c.String("output-mode"); mode {
+	case outputModeAppend:
+		return false, nil
+	case outputModeOverwrite:
+		if !c.IsSet("output-file") && !c.IsSet("split-by-level") {
+			return false, errors.New("--output-mode overwrite requires the --output-file or --split-by-level files to overwrite")
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid --output-mode %q, please use one of: append, overwrite", mode)
+	}
+}
+
+// newLevelFileSink writes the logs of each level to a separate file, with the level replacing the placeholder of the
+// path template.
+func newLevelFileSink(pathTemplate string, output string, format lineFormat, log *zerolog.Logger) (*fileSink, error) {
+	if strings.Count(pathTemplate, levelPlaceholder) != 1 {
+		return nil, errors.New("--split-by-level requires a path with exactly one %s to be replaced by the level")
+	}
+	path := func(l *management.Log) string {
+		return strings.Replace(pathTemplate, levelPlaceholder, l.Level.String(), 1)
+	}
+	return newFileSink("split-by-level", path, output, format, log)
+}
+
+// newEventFileSink writes the logs of each event type to a separate file named prefix.<event>.log.
+func newEventFileSink(prefix string, output string, format lineFormat, log *zerolog.Logger) (*fileSink, error) {
+	if prefix == "" {
+		return nil, errors.New("--split-by-event requires the --output-file prefix of the files")
+	}
+	path := func(l *management.Log) string {
+		return prefix + "." + l.Event.String() + eventFileSuffix
+	}
+	return newFileSink("split-by-event", path, output, format, log)
+}
+
+func (s *fileSink) file(path string) (*os.File, error) {
+	if f, ok := s.files[path]; ok {
+		return f, nil
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if s.overwrite {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	s.files[path] = f
+	return f, nil
+}
+
+func (s *fileSink) Write(l *management.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.file(s.path(l))
+	if err != nil {
+		return err
+	}
+	if s.json {
+		printJSON(f, l, s.log)
+	} else {
+		printLine(f, l, s.format, s.log)
+	}
+	return nil
+}
+
+// Close closes all of the files that were opened.
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for path, f := range s.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(s.files, path)
+	}
+	return errors.Join(errs...)
+}
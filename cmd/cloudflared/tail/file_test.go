@@ -0,0 +1,101 @@
+package tail
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// readJSONMessages reads the messages of the logs written to the file as JSON
+func readJSONMessages(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var l management.Log
+		require.NoError(t, json.Unmarshal([]byte(line), &l))
+		messages = append(messages, l.Message)
+	}
+	return messages
+}
+
+func TestLevelFileSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := newLevelFileSink(filepath.Join(dir, "cloudflared-%s.log"), "json", lineFormat{}, &noopLogger)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(&management.Log{Message: "err1", Level: management.Error}))
+	require.NoError(t, sink.Write(&management.Log{Message: "info1", Level: management.Info}))
+	require.NoError(t, sink.Write(&management.Log{Message: "err2", Level: management.Error}))
+	require.NoError(t, sink.Close())
+
+	readMessages := func(level string) []string {
+		return readJSONMessages(t, filepath.Join(dir, "cloudflared-"+level+".log"))
+	}
+	assert.Equal(t, []string{"err1", "err2"}, readMessages("error"))
+	assert.Equal(t, []string{"info1"}, readMessages("info"))
+	// Files are only created for the levels observed
+	assert.NoFileExists(t, filepath.Join(dir, "cloudflared-debug.log"))
+}
+
+func TestNewLevelFileSink_Invalid(t *testing.T) {
+	_, err := newLevelFileSink("/var/log/cloudflared.log", "default", lineFormat{}, &noopLogger)
+	assert.Error(t, err)
+	_, err = newLevelFileSink("/var/log/%s/cloudflared-%s.log", "default", lineFormat{}, &noopLogger)
+	assert.Error(t, err)
+	_, err = newLevelFileSink("/var/log/cloudflared-%s.log", "kinesis", lineFormat{}, &noopLogger)
+	assert.Error(t, err)
+}
+
+func TestEventFileSink(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "cloudflared")
+	sink, err := newOutputSink(newTestContext(t, "--split-by-event", "--output-file", prefix, "--output", "json"), "json", nil, nil, &noopLogger)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(&management.Log{Message: "http1", Event: management.HTTP}))
+	require.NoError(t, sink.Write(&management.Log{Message: "tcp1", Event: management.TCP}))
+	require.NoError(t, sink.Write(&management.Log{Message: "http2", Event: management.HTTP}))
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, []string{"http1", "http2"}, readJSONMessages(t, prefix+".http.log"))
+	assert.Equal(t, []string{"tcp1"}, readJSONMessages(t, prefix+".tcp.log"))
+	assert.NoFileExists(t, prefix+".cloudflared.log")
+
+	_, err = newOutputSink(newTestContext(t, "--split-by-event"), "default", nil, nil, &noopLogger)
+	assert.ErrorContains(t, err, "--output-file")
+}
+
+func TestOutputFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloudflared.log")
+	for _, message := range []string{"test1", "test2"} {
+		// The logs are appended to the file across sessions
+		sink, err := newOutputSink(newTestContext(t, "--output-file", path, "--output", "json"), "json", nil, nil, &noopLogger)
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(&management.Log{Message: message}))
+		require.NoError(t, sink.Close())
+	}
+	assert.Equal(t, []string{"test1", "test2"}, readJSONMessages(t, path))
+}
+
+func TestOutputFileSink_Overwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloudflared.log")
+	for _, message := range []string{"test1", "test2"} {
+		// Only the logs of the last session are kept
+		sink, err := newOutputSink(newTestContext(t, "--output-file", path, "--output", "json", "--output-mode", "overwrite"), "json", nil, nil, &noopLogger)
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(&management.Log{Message: message}))
+		require.NoError(t, sink.Write(&management.Log{Message: message}))
+		require.NoError(t, sink.Close())
+	}
+	assert.Equal(t, []string{"test2", "test2"}, readJSONMessages(t, path))
+
+	_, err := newOutputSink(newTestContext(t, "--output-mode", "overwrite"), "default", nil, nil, &noopLogger)
+	assert.ErrorContains(t, err, "--output-mode overwrite requires")
+	_, err = newOutputSink(newTestContext(t, "--output-file", path, "--output-mode", "truncate"), "default", nil, nil, &noopLogger)
+	assert.ErrorContains(t, err, "invalid --output-mode")
+}
@@ -0,0 +1,307 @@
+package tail
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	fluentdDialTimeout  = 10 * time.Second
+	fluentdWriteTimeout = 10 * time.Second
+	fluentdBaseBackoff  = 500 * time.Millisecond
+	fluentdMaxBackoff   = 30 * time.Second
+	// Type of the MessagePack extension of the EventTime of the forward protocol
+	fluentdEventTimeExt = 0x00
+)
+
+func fluentdFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "fluentd-addr",
+			Usage:   "Address (host:port) of the Fluentd (or Fluent Bit) forward input to send the logs to when using --output fluentd",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FLUENTD_ADDR"},
+		},
+		&cli.StringFlag{
+			Name:    "fluentd-tag",
+			Usage:   "Tag of the events sent to Fluentd, which its match directives route the logs by",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_FLUENTD_TAG"},
+			Value:   "cloudflared.tunnel",
+		},
+	}
+}
+
+// fluentdSink sends the logs to a Fluentd forward input over TCP, each in the Message mode of the forward protocol
+// ([tag, time, record] encoded with MessagePack) without requesting an ack. The connection is dialed again once it is
+// lost, waiting with an exponential backoff between each of the failed attempts; the logs are buffered meanwhile by
+// the resilientSink of the network outputs.
+type fluentdSink struct {
+	addr string
+	tag  string
+	dial func(addr string) (net.Conn, error)
+	log  *zerolog.Logger
+
+	mu   sync.Mutex
+	conn net.Conn
+	// The connection isn't dialed again until then, after the failed attempts
+	retryAt time.Time
+	backoff time.Duration
+	now     func() time.Time
+	closed  bool
+}
+
+func newFluentdSink(c *cli.Context, log *zerolog.Logger) (*fluentdSink, error) {
+	addr := expandedString(c, "fluentd-addr")
+	if addr == "" {
+		return nil, errors.New("--fluentd-addr is required when using --output fluentd")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid --fluentd-addr %q, please provide the host:port of the Fluentd forward input", addr)
+	}
+	tag := expandedString(c, "fluentd-tag")
+	if tag == "" {
+		return nil, errors.New("--fluentd-tag must not be empty")
+	}
+	dial := func(addr string) (net.Conn, error) {
+		return net.DialTimeout("tcp", addr, fluentdDialTimeout)
+	}
+	// The connection is dialed when the first log is sent
+	return newFluentdSinkWithDialer(addr, tag, dial, log), nil
+}
+
+func newFluentdSinkWithDialer(addr, tag string, dial func(addr string) (net.Conn, error), log *zerolog.Logger) *fluentdSink {
+	return &fluentdSink{addr: addr, tag: tag, dial: dial, log: log, now: time.Now}
+}
+
+// encodeFluentdMessage encodes the log as a forward protocol message of the tag, with the time of the log as its
+// EventTime and the fields of the log as its record.
+func encodeFluentdMessage(tag string, l *management.Log, now time.Time) []byte {
+	at := now
+	if t, err := time.Parse(time.RFC3339Nano, l.Time); err == nil {
+		at = t
+	}
+	b := appendMsgpackArrayHeader(nil, 3)
+	b = appendMsgpackString(b, tag)
+	b = appendFluentdEventTime(b, at)
+
+	record := []struct {
+		key   string
+		value interface{}
+	}{
+		{"message", l.Message},
+		{"time", l.Time},
+		{"level", l.Level.String()},
+		{"event", l.Event.String()},
+		{"connector_id", l.ConnectorID},
+		{"method", l.Method},
+		{"path", l.Path},
+		{"conn_id", l.ConnID},
+	}
+	// The optional fields are left out of the record when empty
+	n := 0
+	for _, field := range record {
+		if field.value != "" {
+			record[n] = field
+			n++
+		}
+	}
+	record = record[:n]
+	size := len(record)
+	if len(l.Tags) > 0 {
+		size++
+	}
+	if len(l.Fields) > 0 {
+		size++
+	}
+	b = appendMsgpackMapHeader(b, size)
+	for _, field := range record {
+		b = appendMsgpackString(b, field.key)
+		b = appendMsgpackValue(b, field.value)
+	}
+	if len(l.Tags) > 0 {
+		b = appendMsgpackString(b, "tags")
+		b = appendMsgpackValue(b, l.Tags)
+	}
+	if len(l.Fields) > 0 {
+		b = appendMsgpackString(b, "fields")
+		b = appendMsgpackValue(b, l.Fields)
+	}
+	return b
+}
+
+// appendFluentdEventTime appends the time as the EventTime of the forward protocol, the fixext8 of the seconds and
+// nanoseconds since the epoch as 4 bytes each in big endian.
+func appendFluentdEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, fluentdEventTimeExt)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	if i >= 0 && i < 128 {
+		return append(b, byte(i))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+}
+
+// appendMsgpackValue appends the value of the fields of a log, as decoded from JSON. The values of other types are
+// appended as their string representation.
+func appendMsgpackValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case string:
+		return appendMsgpackString(b, v)
+	case float64:
+		// The whole numbers are kept as integers, as JSON doesn't distinguish them
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return appendMsgpackInt(b, int64(v))
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+	case int:
+		return appendMsgpackInt(b, int64(v))
+	case int64:
+		return appendMsgpackInt(b, v)
+	case []string:
+		b = appendMsgpackArrayHeader(b, len(v))
+		for _, s := range v {
+			b = appendMsgpackString(b, s)
+		}
+		return b
+	case []interface{}:
+		b = appendMsgpackArrayHeader(b, len(v))
+		for _, e := range v {
+			b = appendMsgpackValue(b, e)
+		}
+		return b
+	case map[string]interface{}:
+		// The keys are sorted so that the records are encoded the same each time
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendMsgpackMapHeader(b, len(keys))
+		for _, k := range keys {
+			b = appendMsgpackString(b, k)
+			b = appendMsgpackValue(b, v[k])
+		}
+		return b
+	default:
+		return appendMsgpackString(b, fmt.Sprint(v))
+	}
+}
+
+func (s *fluentdSink) Write(l *management.Log) error {
+	message := encodeFluentdMessage(s.tag, l, s.now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSinkClosed
+	}
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(fluentdWriteTimeout))
+	if _, err := conn.Write(message); err != nil {
+		// A partially written message can't be resumed, so the connection is dialed again for the next log
+		s.disconnect()
+		return fmt.Errorf("unable to send log to fluentd: %w", err)
+	}
+	return nil
+}
+
+// connect returns the connection, dialing it if it was lost and the backoff has passed.
+func (s *fluentdSink) connect() (net.Conn, error) {
+	if s.conn != nil {
+		return s.conn, nil
+	}
+	now := s.now()
+	if now.Before(s.retryAt) {
+		return nil, fmt.Errorf("unable to connect to fluentd at %s, retrying in %s", s.addr, s.retryAt.Sub(now).Round(time.Millisecond))
+	}
+	conn, err := s.dial(s.addr)
+	if err != nil {
+		if s.backoff == 0 {
+			s.backoff = fluentdBaseBackoff
+		} else {
+			s.backoff = min(s.backoff*2, fluentdMaxBackoff)
+		}
+		s.retryAt = now.Add(s.backoff)
+		return nil, fmt.Errorf("unable to connect to fluentd at %s: %w", s.addr, err)
+	}
+	if s.backoff > 0 {
+		s.log.Info().Msgf("reconnected to fluentd at %s", s.addr)
+	}
+	s.conn, s.backoff, s.retryAt = conn, 0, time.Time{}
+	return conn, nil
+}
+
+func (s *fluentdSink) disconnect() {
+	_ = s.conn.Close()
+	s.conn = nil
+}
+
+func (s *fluentdSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,265 @@
+package tail
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// fluentdEventTime is the decoded EventTime of a forward protocol message.
+type fluentdEventTime struct {
+	sec, nsec uint32
+}
+
+// decodeMsgpack decodes the subset of MessagePack that the fluentd sink encodes.
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	readN := func(n int) ([]byte, error) {
+		data := make([]byte, n)
+		_, err := io.ReadFull(r, data)
+		return data, err
+	}
+	readLen := func(size int) (int, error) {
+		data, err := readN(size)
+		if err != nil {
+			return 0, err
+		}
+		switch size {
+		case 1:
+			return int(data[0]), nil
+		case 2:
+			return int(binary.BigEndian.Uint16(data)), nil
+		default:
+			return int(binary.BigEndian.Uint32(data)), nil
+		}
+	}
+	readString := func(n int, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		data, err := readN(n)
+		return string(data), err
+	}
+	readArray := func(n int, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		array := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := decodeMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, v)
+		}
+		return array, nil
+	}
+	readMap := func(n int, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := decodeMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			m[k.(string)] = v
+		}
+		return m, nil
+	}
+	switch {
+	case b < 0x80:
+		return int64(b), nil
+	case b&0xf0 == 0x80:
+		return readMap(int(b&0x0f), nil)
+	case b&0xf0 == 0x90:
+		return readArray(int(b&0x0f), nil)
+	case b&0xe0 == 0xa0:
+		return readString(int(b&0x1f), nil)
+	}
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcb:
+		data, err := readN(8)
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), err
+	case 0xd3:
+		data, err := readN(8)
+		return int64(binary.BigEndian.Uint64(data)), err
+	case 0xd7:
+		data, err := readN(9)
+		if err != nil || data[0] != fluentdEventTimeExt {
+			return nil, fmt.Errorf("unexpected extension %v", data)
+		}
+		return fluentdEventTime{sec: binary.BigEndian.Uint32(data[1:5]), nsec: binary.BigEndian.Uint32(data[5:])}, nil
+	case 0xd9:
+		return readString(readLen(1))
+	case 0xda:
+		return readString(readLen(2))
+	case 0xdb:
+		return readString(readLen(4))
+	case 0xdc:
+		return readArray(readLen(2))
+	case 0xdd:
+		return readArray(readLen(4))
+	case 0xde:
+		return readMap(readLen(2))
+	case 0xdf:
+		return readMap(readLen(4))
+	}
+	return nil, fmt.Errorf("unexpected type %#x", b)
+}
+
+func TestNewFluentdSink(t *testing.T) {
+	sink, err := newFluentdSink(newTestContext(t, "--fluentd-addr", "localhost:24224"), &noopLogger)
+	require.NoError(t, err)
+	assert.Equal(t, "cloudflared.tunnel", sink.tag)
+	_, err = newFluentdSink(newTestContext(t), &noopLogger)
+	assert.ErrorContains(t, err, "--fluentd-addr is required")
+	_, err = newFluentdSink(newTestContext(t, "--fluentd-addr", "localhost"), &noopLogger)
+	assert.ErrorContains(t, err, "invalid --fluentd-addr")
+	_, err = newFluentdSink(newTestContext(t, "--fluentd-addr", "localhost:24224", "--fluentd-tag", ""), &noopLogger)
+	assert.ErrorContains(t, err, "--fluentd-tag must not be empty")
+}
+
+func TestEncodeMsgpackValue(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	for _, test := range []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{value: nil, expected: nil},
+		{value: true, expected: true},
+		{value: "short", expected: "short"},
+		{value: strings.Repeat("a", 40), expected: strings.Repeat("a", 40)},
+		{value: long, expected: long},
+		{value: float64(502), expected: int64(502)},
+		{value: float64(-1), expected: int64(-1)},
+		{value: 0.5, expected: 0.5},
+		{value: make([]interface{}, 20), expected: make([]interface{}, 20)},
+		{value: map[string]interface{}{"nested": []interface{}{"a", float64(1)}}, expected: map[string]interface{}{"nested": []interface{}{"a", int64(1)}}},
+		{value: time.Second, expected: "1s"},
+	} {
+		v, err := decodeMsgpack(bufio.NewReader(strings.NewReader(string(appendMsgpackValue(nil, test.value)))))
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, v)
+	}
+}
+
+func TestFluentdSink(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	sink := newFluentdSinkWithDialer("fluentd:24224", "cloudflared.tunnel", func(addr string) (net.Conn, error) {
+		assert.Equal(t, "fluentd:24224", addr)
+		return client, nil
+	}, &noopLogger)
+	defer sink.Close()
+
+	l := &management.Log{
+		Time:        "2023-01-01T00:00:00.5Z",
+		Level:       management.Error,
+		Event:       management.HTTP,
+		Message:     "request failed",
+		ConnectorID: "connector",
+		Method:      "GET",
+		Path:        "/api",
+		Tags:        []string{"origin"},
+		Fields:      map[string]interface{}{"status": float64(502)},
+	}
+	go func() {
+		assert.NoError(t, sink.Write(l))
+	}()
+	message, err := decodeMsgpack(bufio.NewReader(server))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		"cloudflared.tunnel",
+		fluentdEventTime{sec: 1672531200, nsec: 500000000},
+		map[string]interface{}{
+			"message":      "request failed",
+			"time":         "2023-01-01T00:00:00.5Z",
+			"level":        "error",
+			"event":        "http",
+			"connector_id": "connector",
+			"method":       "GET",
+			"path":         "/api",
+			"tags":         []interface{}{"origin"},
+			"fields":       map[string]interface{}{"status": int64(502)},
+		},
+	}, message)
+}
+
+func TestFluentdSink_Reconnect(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	dials := 0
+	var dialErr error
+	conns := make(chan net.Conn, 1)
+	sink := newFluentdSinkWithDialer("fluentd:24224", "cloudflared", func(string) (net.Conn, error) {
+		dials++
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		client, server := net.Pipe()
+		conns <- server
+		return client, nil
+	}, &noopLogger)
+	sink.now = func() time.Time { return now }
+	defer sink.Close()
+	l := &management.Log{Time: "2023-01-01T00:00:00Z", Message: "test"}
+	readMessage := func(conn net.Conn) string {
+		message, err := decodeMsgpack(bufio.NewReader(conn))
+		require.NoError(t, err)
+		return message.([]interface{})[2].(map[string]interface{})["message"].(string)
+	}
+
+	// The connection isn't dialed again until the backoff has passed, which doubles after each failed attempt
+	dialErr = errors.New("connection refused")
+	assert.ErrorContains(t, sink.Write(l), "connection refused")
+	assert.ErrorContains(t, sink.Write(l), "retrying in 500ms")
+	now = now.Add(fluentdBaseBackoff)
+	assert.ErrorContains(t, sink.Write(l), "connection refused")
+	assert.ErrorContains(t, sink.Write(l), "retrying in 1s")
+	assert.Equal(t, 2, dials)
+
+	dialErr = nil
+	now = now.Add(2 * fluentdBaseBackoff)
+	go func() {
+		assert.NoError(t, sink.Write(l))
+	}()
+	server := <-conns
+	assert.Equal(t, "test", readMessage(server))
+
+	// The connection is dialed again once it is lost
+	server.Close()
+	assert.Error(t, sink.Write(l))
+	go func() {
+		assert.NoError(t, sink.Write(l))
+	}()
+	server = <-conns
+	defer server.Close()
+	assert.Equal(t, "test", readMessage(server))
+	assert.Equal(t, 4, dials)
+}
@@ -0,0 +1,128 @@
+package tail
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Prefix of the highlighted lines when the output isn't colored
+	highlightPrefix = ">>> "
+	ansiReset       = "\x1b[0m"
+)
+
+// SGR parameters of the background colors that can be used in the --highlight-palette
+var highlightColors = map[string]string{
+	"black":   "40",
+	"red":     "41",
+	"green":   "42",
+	"yellow":  "43",
+	"blue":    "44",
+	"magenta": "45",
+	"cyan":    "46",
+	"white":   "47",
+	"bold":    "1",
+}
+
+func highlightFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "highlight",
+			Usage:   "Highlight the logs matching the regular expression without filtering the other logs; can be repeated to highlight with a different color per expression",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_HIGHLIGHT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "highlight-palette",
+			Usage:   "Colors used for each of the --highlight expressions in order (black, red, green, yellow, blue, magenta, cyan, white, bold, or SGR parameters like 1;41)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_HIGHLIGHT_PALETTE"},
+			Value:   cli.NewStringSlice("red", "green", "yellow", "blue", "magenta", "cyan"),
+		},
+	}
+}
+
+// highlighter marks the logs that match one of the patterns.
+type highlighter struct {
+	patterns []*regexp.Regexp
+	// SGR parameters of the color for each pattern, cycling through the palette
+	palette []string
+	color   bool
+}
+
+// newHighlighter compiles the --highlight patterns; nil is returned if no patterns are provided. The highlighted logs
+// are colored if the output is a terminal.
+func newHighlighter(c *cli.Context, isTTY bool) (*highlighter, error) {
+	values := c.StringSlice("highlight")
+	if len(values) == 0 {
+		return nil, nil
+	}
+	h := &highlighter{
+		color: isTTY && !noColor(c),
+	}
+	for _, v := range values {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --highlight expression %q: %w", v, err)
+		}
+		h.patterns = append(h.patterns, re)
+	}
+	for _, v := range c.StringSlice("highlight-palette") {
+		color, err := parseHighlightColor(v)
+		if err != nil {
+			return nil, err
+		}
+		h.palette = append(h.palette, color)
+	}
+	if len(h.palette) == 0 {
+		return nil, fmt.Errorf("--highlight-palette requires at least one color")
+	}
+	return h, nil
+}
+
+func parseHighlightColor(v string) (string, error) {
+	if color, ok := highlightColors[strings.ToLower(v)]; ok {
+		return color, nil
+	}
+	for _, param := range strings.Split(v, ";") {
+		if _, err := strconv.ParseUint(param, 10, 8); err != nil {
+			return "", fmt.Errorf("invalid --highlight-palette color %q", v)
+		}
+	}
+	return v, nil
+}
+
+// match returns the index of the first pattern that matches the line, or -1 if none match.
+func (h *highlighter) match(line []byte) int {
+	for i, re := range h.patterns {
+		if re.Match(line) {
+			return i
+		}
+	}
+	return -1
+}
+
+// highlight marks the line (including its trailing newline) if it matches one of the patterns.
+func (h *highlighter) highlight(line []byte) []byte {
+	i := h.match(line)
+	if i < 0 {
+		return line
+	}
+	if !h.color {
+		return append([]byte(highlightPrefix), line...)
+	}
+	content := bytes.TrimSuffix(line, []byte("\n"))
+	color := h.palette[i%len(h.palette)]
+	return []byte("\x1b[" + color + "m" + string(content) + ansiReset + "\n")
+}
+
+// highlightedLog is the JSON output of a log that matched one of the patterns.
+type highlightedLog struct {
+	*management.Log
+	Highlighted bool `json:"highlighted"`
+}
@@ -0,0 +1,72 @@
+package tail
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestHighlighter(t *testing.T) {
+	h := &highlighter{
+		patterns: []*regexp.Regexp{regexp.MustCompile("error"), regexp.MustCompile("timeout")},
+		palette:  []string{"41"},
+	}
+	assert.Equal(t, "no match\n", string(h.highlight([]byte("no match\n"))))
+	assert.Equal(t, ">>> an error\n", string(h.highlight([]byte("an error\n"))))
+
+	h.color = true
+	assert.Equal(t, "\x1b[41man error\x1b[0m\n", string(h.highlight([]byte("an error\n"))))
+	// The palette is cycled through for each pattern
+	h.palette = []string{"41", "1;42"}
+	assert.Equal(t, "\x1b[1;42ma timeout\x1b[0m\n", string(h.highlight([]byte("a timeout\n"))))
+}
+
+func TestNewHighlighter(t *testing.T) {
+	h, err := newHighlighter(newTestContext(t), true)
+	require.NoError(t, err)
+	assert.Nil(t, h)
+
+	h, err = newHighlighter(newTestContext(t, "--highlight", "error", "--highlight-palette", "yellow", "--highlight-palette", "1;44"), true)
+	require.NoError(t, err)
+	assert.Len(t, h.patterns, 1)
+	assert.Equal(t, []string{"43", "1;44"}, h.palette)
+	assert.True(t, h.color)
+
+	// The logs aren't colored when the output isn't a terminal, or colors are disabled
+	h, err = newHighlighter(newTestContext(t, "--highlight", "error"), false)
+	require.NoError(t, err)
+	assert.False(t, h.color)
+	h, err = newHighlighter(newTestContext(t, "--highlight", "error", "--no-color"), true)
+	require.NoError(t, err)
+	assert.False(t, h.color)
+
+	_, err = newHighlighter(newTestContext(t, "--highlight", "("), false)
+	assert.Error(t, err)
+	_, err = newHighlighter(newTestContext(t, "--highlight", "error", "--highlight-palette", "orange"), false)
+	assert.Error(t, err)
+}
+
+func TestStdoutSink_Highlight(t *testing.T) {
+	h := &highlighter{patterns: []*regexp.Regexp{regexp.MustCompile("fail")}, palette: []string{"41"}}
+	var out bytes.Buffer
+	sink := &stdoutSink{out: &out, json: true, highlighter: h, log: &noopLogger}
+	require.NoError(t, sink.Write(&management.Log{Message: "ok"}))
+	require.NoError(t, sink.Write(&management.Log{Message: "failed"}))
+	assert.Equal(t, "{\"message\":\"ok\"}\n{\"message\":\"failed\",\"highlighted\":true}\n", out.String())
+}
+
+func TestNewOutputSink_HighlightNotTerminal(t *testing.T) {
+	var out bytes.Buffer
+	sink, err := newOutputSink(newTestContext(t, "--highlight", "fail", "--no-fields"), "default", &out, nil, &noopLogger)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(&management.Log{Time: "2023-01-01T00:00:00Z", Message: "failed"}))
+	// The output isn't a terminal, so the highlighted log is prefixed rather than colored
+	assert.True(t, strings.HasPrefix(out.String(), highlightPrefix), out.String())
+	assert.NotContains(t, out.String(), "\x1b[")
+}
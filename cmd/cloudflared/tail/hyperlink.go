@@ -0,0 +1,66 @@
+package tail
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+const (
+	// OSC 8 sequences that start a hyperlink to the URL and end it
+	hyperlinkStart = "\x1b]8;;"
+	hyperlinkEnd   = "\x1b\\"
+)
+
+// URLs in the messages of the logs, without the control characters that would end the hyperlink early
+var messageURL = regexp.MustCompile(`https?://[^\s"'<>\x00-\x1f\x7f]+`)
+
+func hyperlinkFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "ansi-hyperlinks",
+			Usage:   "Render the management hostname and the URLs in the messages of the logs as clickable terminal hyperlinks (OSC 8) when writing to a terminal",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ANSI_HYPERLINKS"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-color",
+			Usage:   "Disable the colors and the hyperlinks of the output, as with the NO_COLOR environment variable",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NO_COLOR"},
+		},
+	}
+}
+
+// noColor returns true if the output mustn't contain escape sequences.
+func noColor(c *cli.Context) bool {
+	return c.Bool("no-color") || os.Getenv("NO_COLOR") != ""
+}
+
+// hyperlinksEnabled returns true if the hyperlinks are rendered to the file, which must be a terminal.
+func hyperlinksEnabled(c *cli.Context, f *os.File) bool {
+	return c.Bool("ansi-hyperlinks") && !noColor(c) && term.IsTerminal(int(f.Fd()))
+}
+
+// hyperlink returns the text as a hyperlink to the URL.
+func hyperlink(url, text string) string {
+	return hyperlinkStart + url + hyperlinkEnd + text + hyperlinkStart + hyperlinkEnd
+}
+
+// linkURLs returns the message with each of its URLs as a hyperlink to itself.
+func linkURLs(message string) string {
+	if !strings.Contains(message, "://") {
+		return message
+	}
+	return messageURL.ReplaceAllStringFunc(message, func(url string) string {
+		return hyperlink(url, url)
+	})
+}
+
+// printStatus writes the management hostname that the logs are streamed from as a hyperlink.
+func printStatus(w io.Writer, hostname string) {
+	fmt.Fprintf(w, "Streaming logs from %s\n", hyperlink("https://"+hostname, hostname))
+}
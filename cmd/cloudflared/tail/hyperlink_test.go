@@ -0,0 +1,77 @@
+package tail
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestLinkURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{
+			name:     "no url",
+			message:  "connection registered",
+			expected: "connection registered",
+		},
+		{
+			name:     "url",
+			message:  "request to https://example.com/path?q=1 failed",
+			expected: "request to \x1b]8;;https://example.com/path?q=1\x1b\\https://example.com/path?q=1\x1b]8;;\x1b\\ failed",
+		},
+		{
+			name:     "quoted urls",
+			message:  `origin "http://localhost:8080" and 'https://a.example.com'`,
+			expected: "origin \"\x1b]8;;http://localhost:8080\x1b\\http://localhost:8080\x1b]8;;\x1b\\\" and '\x1b]8;;https://a.example.com\x1b\\https://a.example.com\x1b]8;;\x1b\\'",
+		},
+		{
+			name:     "control characters end the url",
+			message:  "https://example.com\x1b]8;;",
+			expected: "\x1b]8;;https://example.com\x1b\\https://example.com\x1b]8;;\x1b\\\x1b]8;;",
+		},
+		{
+			name:     "other scheme",
+			message:  "ftp://example.com",
+			expected: "ftp://example.com",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, linkURLs(test.message))
+		})
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	var buf bytes.Buffer
+	printStatus(&buf, "management.example.com")
+	assert.Equal(t, "Streaming logs from \x1b]8;;https://management.example.com\x1b\\management.example.com\x1b]8;;\x1b\\\n", buf.String())
+}
+
+func TestPrintLine_Hyperlinks(t *testing.T) {
+	l := &management.Log{Time: "2023-01-01T00:00:00Z", Level: management.Info, Message: "see https://example.com"}
+	var buf bytes.Buffer
+	printLine(&buf, l, lineFormat{hyperlinks: true, noFields: true}, &noopLogger)
+	assert.Equal(t, "2023-01-01T00:00:00Z info cloudflared see \x1b]8;;https://example.com\x1b\\https://example.com\x1b]8;;\x1b\\\n", buf.String())
+}
+
+func TestHyperlinksEnabled(t *testing.T) {
+	// The output of the tests isn't a terminal
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	require.NoError(t, err)
+	defer f.Close()
+	assert.False(t, hyperlinksEnabled(newTestContext(t, "--ansi-hyperlinks"), f))
+	assert.False(t, hyperlinksEnabled(newTestContext(t), f))
+
+	assert.True(t, noColor(newTestContext(t, "--no-color")))
+	t.Setenv("NO_COLOR", "1")
+	assert.True(t, noColor(newTestContext(t)))
+}
@@ -0,0 +1,148 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const interactiveUsage = "commands: level <debug|info|warn|error>, events <cloudflared,http,tcp,udp>, grep [term], clear, quit"
+
+// interactiveFilters are the filters changed by the commands read from stdin with --interactive. The level and
+// events are also updated on the server so that the logs are filtered at the source, while they are applied to the
+// logs already received to take effect immediately.
+type interactiveFilters struct {
+	// Filters the session started with, that the commands are applied to
+	base management.StreamingFilters
+
+	mu     sync.RWMutex
+	level  *management.LogLevel
+	events []management.LogEventType
+	grep   string
+}
+
+func newInteractiveFilters(base *management.StreamingFilters) *interactiveFilters {
+	f := &interactiveFilters{}
+	if base != nil {
+		f.base = *base
+	}
+	f.level = f.base.Level
+	f.events = f.base.Events
+	return f
+}
+
+// processor drops the logs that don't match the filters.
+func (f *interactiveFilters) processor() logProcessor {
+	return func(l *management.Log) bool {
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+		if f.level != nil && l.Level < *f.level {
+			return false
+		}
+		if len(f.events) > 0 && !slices.Contains(f.events, l.Event) {
+			return false
+		}
+		return f.grep == "" || strings.Contains(l.Message, f.grep)
+	}
+}
+
+// apply runs the command line, returning the filters to send to the server if they changed. quit is returned once
+// the session should end.
+func (f *interactiveFilters) apply(line string) (update *management.StreamingFilters, quit bool, err error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch name {
+	case "level":
+		level, ok := management.ParseLogLevel(arg)
+		if !ok {
+			return nil, false, fmt.Errorf("invalid level %q, please use one of: debug, info, warn, error", arg)
+		}
+		f.level = &level
+	case "events":
+		var events []management.LogEventType
+		for _, v := range strings.Split(arg, ",") {
+			event, ok := management.ParseLogEventType(strings.TrimSpace(v))
+			if !ok {
+				return nil, false, fmt.Errorf("invalid event %q, please use one of: cloudflared, http, tcp, udp, internal", v)
+			}
+			events = append(events, event)
+		}
+		f.events = events
+	case "grep":
+		// The search term is only applied to the logs received, so the server isn't updated
+		f.grep = arg
+		return nil, false, nil
+	case "clear":
+		f.level = f.base.Level
+		f.events = f.base.Events
+		f.grep = ""
+	case "quit":
+		return nil, true, nil
+	default:
+		return nil, false, fmt.Errorf("unknown command %q, %s", name, interactiveUsage)
+	}
+	return f.serverFiltersLocked(), false, nil
+}
+
+// serverFilters returns the filters of the server, as updated by the commands.
+func (f *interactiveFilters) serverFilters() *management.StreamingFilters {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.serverFiltersLocked()
+}
+
+func (f *interactiveFilters) serverFiltersLocked() *management.StreamingFilters {
+	filters := f.base
+	filters.Level = f.level
+	filters.Events = f.events
+	return &filters
+}
+
+// String describes the current filters for the acknowledgment of the commands.
+func (f *interactiveFilters) String() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	level := "debug"
+	if f.level != nil {
+		level = f.level.String()
+	}
+	events := "all"
+	if len(f.events) > 0 {
+		names := make([]string, 0, len(f.events))
+		for _, e := range f.events {
+			names = append(names, e.String())
+		}
+		events = strings.Join(names, ",")
+	}
+	return fmt.Sprintf("filters: level=%s events=%s grep=%q", level, events, f.grep)
+}
+
+// readCommands sends the lines read from the reader until it is exhausted or the context is cancelled. Reading from
+// stdin can't be interrupted, so the goroutine only exits cancelled once its pending read returns.
+func readCommands(ctx context.Context, r io.Reader) <-chan string {
+	commands := make(chan string)
+	go func() {
+		defer close(commands)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			select {
+			case commands <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return commands
+}
@@ -0,0 +1,130 @@
+package tail
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestInteractiveFilters_Apply(t *testing.T) {
+	warn := management.Warn
+	debug := management.Debug
+	base := management.NewStreamingFilters(management.WithLevel(management.Debug), management.WithSampling(0.5))
+	for _, tt := range []struct {
+		name     string
+		commands []string
+		update   *management.StreamingFilters
+		describe string
+		err      string
+	}{
+		{
+			name:     "level",
+			commands: []string{"level warn"},
+			update:   &management.StreamingFilters{Level: &warn, Sampling: 0.5},
+			describe: `filters: level=warn events=all grep=""`,
+		},
+		{
+			name:     "events",
+			commands: []string{"events http, tcp"},
+			update:   &management.StreamingFilters{Level: &debug, Events: []management.LogEventType{management.HTTP, management.TCP}, Sampling: 0.5},
+			describe: `filters: level=debug events=http,tcp grep=""`,
+		},
+		{
+			name:     "grep",
+			commands: []string{"grep origin error"},
+			describe: `filters: level=debug events=all grep="origin error"`,
+		},
+		{
+			name:     "clear",
+			commands: []string{"level error", "events udp", "grep foo", "clear"},
+			update:   &management.StreamingFilters{Level: &debug, Sampling: 0.5},
+			describe: `filters: level=debug events=all grep=""`,
+		},
+		{
+			name:     "invalid level",
+			commands: []string{"level trace"},
+			describe: `filters: level=debug events=all grep=""`,
+			err:      `invalid level "trace"`,
+		},
+		{
+			name:     "invalid event",
+			commands: []string{"events http,dns"},
+			describe: `filters: level=debug events=all grep=""`,
+			err:      `invalid event "dns"`,
+		},
+		{
+			name:     "unknown command",
+			commands: []string{"follow"},
+			describe: `filters: level=debug events=all grep=""`,
+			err:      `unknown command "follow"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := newInteractiveFilters(base)
+			var (
+				update *management.StreamingFilters
+				err    error
+			)
+			for _, command := range tt.commands {
+				update, _, err = filters.apply(command)
+			}
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.update, update)
+			assert.Equal(t, tt.describe, filters.String())
+		})
+	}
+}
+
+func TestInteractiveFilters_Quit(t *testing.T) {
+	_, quit, err := newInteractiveFilters(nil).apply("quit")
+	require.NoError(t, err)
+	assert.True(t, quit)
+}
+
+func TestInteractiveFilters_Processor(t *testing.T) {
+	filters := newInteractiveFilters(nil)
+	process := filters.processor()
+	logs := []*management.Log{
+		{Message: "request failed", Level: management.Error, Event: management.HTTP},
+		{Message: "request served", Level: management.Info, Event: management.HTTP},
+		{Message: "connection failed", Level: management.Warn, Event: management.TCP},
+	}
+	matching := func() []string {
+		var messages []string
+		for _, l := range logs {
+			if process(l) {
+				messages = append(messages, l.Message)
+			}
+		}
+		return messages
+	}
+	assert.Len(t, matching(), 3)
+	_, _, err := filters.apply("level warn")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"request failed", "connection failed"}, matching())
+	_, _, err = filters.apply("events http")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"request failed"}, matching())
+	_, _, err = filters.apply("clear")
+	require.NoError(t, err)
+	_, _, err = filters.apply("grep failed")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"request failed", "connection failed"}, matching())
+}
+
+func TestReadCommands(t *testing.T) {
+	var commands []string
+	for command := range readCommands(context.Background(), strings.NewReader("level warn\n\n  grep foo  \nquit\n")) {
+		commands = append(commands, command)
+	}
+	assert.Equal(t, []string{"level warn", "grep foo", "quit"}, commands)
+}
@@ -0,0 +1,94 @@
+package tail
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/journal"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Prefix of the journal fields of the logs
+	journalFieldPrefix = "CLOUDFLARED_"
+	// Identifier of the journal entries, to query them with journalctl -t cloudflared-tail
+	journalIdentifier = "cloudflared-tail"
+)
+
+// journaldSink writes the logs to the systemd journal as structured entries, with the fields of each log as journal
+// fields and the level as the syslog priority of the entry.
+type journaldSink struct {
+	send func(message string, priority journal.Priority, vars map[string]string) error
+}
+
+func newJournaldSink() (*journaldSink, error) {
+	if !journal.Enabled() {
+		return nil, errors.New("--output journald requires the systemd journal, which isn't available")
+	}
+	return &journaldSink{send: journal.Send}, nil
+}
+
+// journalPriority returns the syslog priority of the level.
+func journalPriority(level management.LogLevel) journal.Priority {
+	switch level {
+	case management.Debug:
+		return journal.PriDebug
+	case management.Warn:
+		return journal.PriWarning
+	case management.Error:
+		return journal.PriErr
+	default:
+		return journal.PriInfo
+	}
+}
+
+// journalFieldName returns the name of the journal field of the key, which may only contain uppercase letters, digits
+// and underscores.
+func journalFieldName(key string) string {
+	return journalFieldPrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, key)
+}
+
+// journalFields returns the journal fields of the log. The fields of the log are prefixed with FIELD_ so that they
+// don't conflict with the other fields.
+func journalFields(l *management.Log) map[string]string {
+	vars := map[string]string{
+		"SYSLOG_IDENTIFIER":       journalIdentifier,
+		journalFieldName("time"):  l.Time,
+		journalFieldName("level"): l.Level.String(),
+		journalFieldName("event"): l.Event.String(),
+	}
+	optional := map[string]string{
+		"connector_id": l.ConnectorID,
+		"conn_id":      l.ConnID,
+		"method":       l.Method,
+		"path":         l.Path,
+		"tags":         strings.Join(l.Tags, ","),
+	}
+	for key, value := range optional {
+		if value != "" {
+			vars[journalFieldName(key)] = value
+		}
+	}
+	for key, value := range l.Fields {
+		vars[journalFieldName("field_"+key)] = management.FormatField(value)
+	}
+	return vars
+}
+
+func (s *journaldSink) Write(l *management.Log) error {
+	return s.send(l.Message, journalPriority(l.Level), journalFields(l))
+}
+
+func (s *journaldSink) Close() error {
+	return nil
+}
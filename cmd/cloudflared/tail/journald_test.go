@@ -0,0 +1,55 @@
+package tail
+
+import (
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/journal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestJournalPriority(t *testing.T) {
+	assert.Equal(t, journal.PriDebug, journalPriority(management.Debug))
+	assert.Equal(t, journal.PriInfo, journalPriority(management.Info))
+	assert.Equal(t, journal.PriWarning, journalPriority(management.Warn))
+	assert.Equal(t, journal.PriErr, journalPriority(management.Error))
+}
+
+func TestJournaldSink(t *testing.T) {
+	var (
+		message  string
+		priority journal.Priority
+		vars     map[string]string
+	)
+	sink := &journaldSink{send: func(m string, p journal.Priority, v map[string]string) error {
+		message, priority, vars = m, p, v
+		return nil
+	}}
+	require.NoError(t, sink.Write(&management.Log{
+		Time:        "2023-01-01T00:00:00Z",
+		Level:       management.Error,
+		Event:       management.HTTP,
+		Message:     "request failed",
+		ConnectorID: "connector",
+		Method:      "GET",
+		Path:        "/api",
+		Tags:        []string{"customer-a", "eu"},
+		Fields:      map[string]interface{}{"status": float64(502), "origin-service": "http://localhost"},
+	}))
+	assert.Equal(t, "request failed", message)
+	assert.Equal(t, journal.PriErr, priority)
+	assert.Equal(t, map[string]string{
+		"SYSLOG_IDENTIFIER":                "cloudflared-tail",
+		"CLOUDFLARED_TIME":                 "2023-01-01T00:00:00Z",
+		"CLOUDFLARED_LEVEL":                "error",
+		"CLOUDFLARED_EVENT":                "http",
+		"CLOUDFLARED_CONNECTOR_ID":         "connector",
+		"CLOUDFLARED_METHOD":               "GET",
+		"CLOUDFLARED_PATH":                 "/api",
+		"CLOUDFLARED_TAGS":                 "customer-a,eu",
+		"CLOUDFLARED_FIELD_STATUS":         "502",
+		"CLOUDFLARED_FIELD_ORIGIN_SERVICE": "http://localhost",
+	}, vars)
+}
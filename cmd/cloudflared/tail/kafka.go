@@ -0,0 +1,145 @@
+package tail
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	kafkaBatchTimeout = 100 * time.Millisecond
+)
+
+func kafkaFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "kafka-brokers",
+			Usage:   "Kafka brokers (host:port) to write the logs to when using --output kafka",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_KAFKA_BROKERS"},
+		},
+		&cli.StringFlag{
+			Name:    "kafka-topic",
+			Usage:   "Kafka topic to write the logs to when using --output kafka",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_KAFKA_TOPIC"},
+		},
+		&cli.BoolFlag{
+			Name:    "kafka-tls",
+			Usage:   "Connect to the Kafka brokers with TLS",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_KAFKA_TLS"},
+		},
+		&cli.StringFlag{
+			Name:    "kafka-sasl-user",
+			Usage:   "Username to authenticate with the Kafka brokers using SASL/PLAIN",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_KAFKA_SASL_USER"},
+		},
+		&cli.StringFlag{
+			Name:    "kafka-sasl-password",
+			Usage:   "Password to authenticate with the Kafka brokers using SASL/PLAIN",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_KAFKA_SASL_PASSWORD"},
+		},
+		&cli.DurationFlag{
+			Name:    "kafka-flush-timeout",
+			Usage:   "Maximum time to wait for undelivered logs to be written to Kafka when shutting down",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_KAFKA_FLUSH_TIMEOUT"},
+			Value:   10 * time.Second,
+		},
+	}
+}
+
+// kafkaSink writes the logs to a Kafka topic. The messages are keyed by tunnel so that all of the logs for a tunnel
+// are written to the same partition.
+type kafkaSink struct {
+	writer       *kafka.Writer
+	tunnelID     string
+	flushTimeout time.Duration
+	log          *zerolog.Logger
+}
+
+func newKafkaSink(c *cli.Context, log *zerolog.Logger) (*kafkaSink, error) {
+	brokers := expandedStringSlice(c, "kafka-brokers")
+	if len(brokers) == 0 {
+		return nil, errors.New("--kafka-brokers is required when using --output kafka")
+	}
+	topic := expandedString(c, "kafka-topic")
+	if topic == "" {
+		return nil, errors.New("--kafka-topic is required when using --output kafka")
+	}
+	transport := &kafka.Transport{}
+	if c.Bool("kafka-tls") {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	user := c.String("kafka-sasl-user")
+	password := c.String("kafka-sasl-password")
+	if (user == "") != (password == "") {
+		return nil, errors.New("--kafka-sasl-user and --kafka-sasl-password must be provided together")
+	}
+	if user != "" {
+		transport.SASL = plain.Mechanism{Username: user, Password: password}
+	}
+	s := &kafkaSink{
+		tunnelID:     c.Args().First(),
+		flushTimeout: c.Duration("kafka-flush-timeout"),
+		log:          log,
+	}
+	s.writer = &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: kafkaBatchTimeout,
+		RequiredAcks: kafka.RequireOne,
+		Async:        true,
+		Transport:    transport,
+		Completion:   s.completion,
+	}
+	return s, nil
+}
+
+func (s *kafkaSink) message(l *management.Log) (kafka.Message, error) {
+	value, err := json.Marshal(l)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{
+		Key:   []byte(tunnelKey(s.tunnelID, l)),
+		Value: value,
+	}, nil
+}
+
+func (s *kafkaSink) Write(l *management.Log) error {
+	message, err := s.message(l)
+	if err != nil {
+		return err
+	}
+	// The writer is asynchronous; delivery errors are reported by the completion
+	return s.writer.WriteMessages(context.Background(), message)
+}
+
+func (s *kafkaSink) completion(messages []kafka.Message, err error) {
+	if err != nil {
+		s.log.Err(err).Msgf("unable to write %d logs to kafka", len(messages))
+	}
+}
+
+// Close flushes the undelivered logs, waiting up to the flush timeout.
+func (s *kafkaSink) Close() error {
+	done := make(chan error, 1)
+	go func() {
+		done <- s.writer.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(s.flushTimeout):
+		return fmt.Errorf("timed out after %s flushing logs to kafka", s.flushTimeout)
+	}
+}
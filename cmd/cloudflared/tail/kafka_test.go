@@ -0,0 +1,64 @@
+package tail
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestNewKafkaSink(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		args      []string
+		expectErr bool
+	}{
+		{
+			name: "brokers and topic",
+			args: []string{"--kafka-brokers", "broker1:9092,broker2:9092", "--kafka-topic", "logs"},
+		},
+		{
+			name: "sasl",
+			args: []string{"--kafka-brokers", "broker1:9092", "--kafka-topic", "logs", "--kafka-tls",
+				"--kafka-sasl-user", "user", "--kafka-sasl-password", "password"},
+		},
+		{
+			name:      "missing brokers",
+			args:      []string{"--kafka-topic", "logs"},
+			expectErr: true,
+		},
+		{
+			name:      "missing topic",
+			args:      []string{"--kafka-brokers", "broker1:9092"},
+			expectErr: true,
+		},
+		{
+			name:      "missing sasl password",
+			args:      []string{"--kafka-brokers", "broker1:9092", "--kafka-topic", "logs", "--kafka-sasl-user", "user"},
+			expectErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink, err := newKafkaSink(newTestContext(t, test.args...), &noopLogger)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, sink.Close())
+		})
+	}
+}
+
+func TestKafkaSink_Message(t *testing.T) {
+	sink := &kafkaSink{tunnelID: "tunnel"}
+	message, err := sink.message(&management.Log{Message: "test", ConnectorID: "connector"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tunnel"), message.Key)
+	var l management.Log
+	require.NoError(t, json.Unmarshal(message.Value, &l))
+	assert.Equal(t, "test", l.Message)
+}
@@ -0,0 +1,178 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// PutRecords accepts up to 500 records and 5MB per request
+	kinesisMaxBatchRecords = 500
+	kinesisMaxBatchBytes   = 5 * 1024 * 1024
+	kinesisFlushInterval   = time.Second
+	kinesisMaxAttempts     = 3
+	kinesisMaxBackoff      = 5 * time.Second
+	kinesisRequestTimeout  = 30 * time.Second
+)
+
+func kinesisFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "kinesis-stream-name",
+			Usage:   "Name of the AWS Kinesis Data Stream to put the logs into when using --output kinesis",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_KINESIS_STREAM_NAME"},
+		},
+		&cli.StringFlag{
+			Name:    "kinesis-region",
+			Usage:   "AWS region of the Kinesis Data Stream when using --output kinesis",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_KINESIS_REGION", "AWS_REGION", "AWS_DEFAULT_REGION"},
+		},
+		&cli.StringFlag{
+			Name:   "kinesis-endpoint",
+			Usage:  "Override the AWS Kinesis endpoint",
+			Hidden: true,
+		},
+	}
+}
+
+// kinesisAPI is the subset of the Kinesis client used by the kinesisSink.
+type kinesisAPI interface {
+	PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error)
+}
+
+// kinesisSink puts the logs into an AWS Kinesis Data Stream in batches. The requests are retried by the retryer of
+// the client, and the records that failed to be put into the stream are put again.
+type kinesisSink struct {
+	*batchSink
+	streamName string
+	tunnelID   string
+	client     kinesisAPI
+	backoff    *retry.ExponentialJitterBackoff
+	log        *zerolog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newKinesisSink(c *cli.Context, log *zerolog.Logger) (*kinesisSink, error) {
+	streamName := expandedString(c, "kinesis-stream-name")
+	if streamName == "" {
+		return nil, errors.New("--kinesis-stream-name is required when using --output kinesis")
+	}
+	region := c.String("kinesis-region")
+	if region == "" {
+		return nil, errors.New("--kinesis-region is required when using --output kinesis")
+	}
+	// The credentials are resolved by the default credential chain of the SDK
+	cfg, err := config.LoadDefaultConfig(c.Context, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the AWS configuration: %w", err)
+	}
+	client := kinesis.NewFromConfig(cfg, func(o *kinesis.Options) {
+		if endpoint := c.String("kinesis-endpoint"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return newKinesisSinkWithClient(streamName, c.Args().First(), client, log), nil
+}
+
+func newKinesisSinkWithClient(streamName, tunnelID string, client kinesisAPI, log *zerolog.Logger) *kinesisSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &kinesisSink{
+		streamName: streamName,
+		tunnelID:   tunnelID,
+		client:     client,
+		backoff:    retry.NewExponentialJitterBackoff(kinesisMaxBackoff),
+		log:        log,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	s.batchSink = newBatchSink(kinesisMaxBatchRecords, kinesisFlushInterval, s.send, log)
+	return s
+}
+
+// Close puts the remaining logs.
+func (s *kinesisSink) Close() error {
+	defer s.cancel()
+	return s.batchSink.Close()
+}
+
+func (s *kinesisSink) send(logs []*management.Log) error {
+	records := make([]types.PutRecordsRequestEntry, 0, len(logs))
+	size := 0
+	for _, l := range logs {
+		data, err := json.Marshal(l)
+		if err != nil {
+			s.log.Debug().Msgf("unable to parse event to json %+v", l)
+			continue
+		}
+		// Partitioning by tunnel keeps all of the logs of a tunnel in order on the same shard
+		partitionKey := tunnelKey(s.tunnelID, l)
+		recordSize := len(data) + len(partitionKey)
+		if size+recordSize > kinesisMaxBatchBytes && len(records) > 0 {
+			if err := s.putRecords(records); err != nil {
+				return err
+			}
+			records = records[:0]
+			size = 0
+		}
+		records = append(records, types.PutRecordsRequestEntry{Data: data, PartitionKey: aws.String(partitionKey)})
+		size += recordSize
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return s.putRecords(records)
+}
+
+// putRecords sends the records to Kinesis, putting the records that failed to be put into the stream again after the
+// backoff of the SDK, unless the sink is closed in the meantime.
+func (s *kinesisSink) putRecords(records []types.PutRecordsRequestEntry) error {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(s.ctx, kinesisRequestTimeout)
+		resp, err := s.client.PutRecords(ctx, &kinesis.PutRecordsInput{
+			StreamName: aws.String(s.streamName),
+			Records:    records,
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+		if aws.ToInt32(resp.FailedRecordCount) == 0 {
+			return nil
+		}
+		var failed []types.PutRecordsRequestEntry
+		for i, r := range resp.Records {
+			if r.ErrorCode != nil && i < len(records) {
+				failed = append(failed, records[i])
+			}
+		}
+		err = fmt.Errorf("unable to put %d records into kinesis stream %s", len(failed), s.streamName)
+		if attempt >= kinesisMaxAttempts {
+			return err
+		}
+		delay, err := s.backoff.BackoffDelay(attempt, err)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-time.After(delay):
+		}
+		records = failed
+	}
+}
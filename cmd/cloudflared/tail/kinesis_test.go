@@ -0,0 +1,91 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// fakeKinesis records the calls to PutRecords, failing the records for which fail returns true.
+type fakeKinesis struct {
+	mu       sync.Mutex
+	requests []*kinesis.PutRecordsInput
+	fail     func(request, record int) bool
+}
+
+func (f *fakeKinesis) PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, params)
+	var resp kinesis.PutRecordsOutput
+	var failed int32
+	for i := range params.Records {
+		var record types.PutRecordsResultEntry
+		if f.fail != nil && f.fail(len(f.requests), i) {
+			record.ErrorCode = aws.String("ProvisionedThroughputExceededException")
+			failed++
+		}
+		resp.Records = append(resp.Records, record)
+	}
+	resp.FailedRecordCount = aws.Int32(failed)
+	return &resp, nil
+}
+
+func TestKinesisSink_PutRecords(t *testing.T) {
+	// Fail the second record of the first request to validate the retry
+	client := &fakeKinesis{fail: func(request, record int) bool { return request == 1 && record == 1 }}
+	sink := newKinesisSinkWithClient("stream", "tunnel", client, &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test1"}))
+	require.NoError(t, sink.Write(&management.Log{Message: "test2"}))
+	require.NoError(t, sink.Close())
+
+	require.Len(t, client.requests, 2)
+	assert.Equal(t, "stream", aws.ToString(client.requests[0].StreamName))
+	require.Len(t, client.requests[0].Records, 2)
+	assert.Equal(t, "tunnel", aws.ToString(client.requests[0].Records[0].PartitionKey))
+	var l management.Log
+	require.NoError(t, json.Unmarshal(client.requests[0].Records[0].Data, &l))
+	assert.Equal(t, "test1", l.Message)
+	// Only the failed record is retried
+	require.Len(t, client.requests[1].Records, 1)
+	require.NoError(t, json.Unmarshal(client.requests[1].Records[0].Data, &l))
+	assert.Equal(t, "test2", l.Message)
+}
+
+func TestKinesisSink_Cancelled(t *testing.T) {
+	client := &fakeKinesis{fail: func(int, int) bool { return true }}
+	sink := newKinesisSinkWithClient("stream", "tunnel", client, &noopLogger)
+	sink.cancel()
+	defer sink.batchSink.Close()
+
+	// The failed records aren't retried once the sink is closed
+	start := time.Now()
+	err := sink.send([]*management.Log{{Message: "test"}})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Len(t, client.requests, 1)
+}
+
+func TestNewKinesisSink(t *testing.T) {
+	_, err := newKinesisSink(newTestContext(t, "--kinesis-region", "us-east-1"), &noopLogger)
+	assert.ErrorContains(t, err, "--kinesis-stream-name is required")
+	_, err = newKinesisSink(newTestContext(t, "--kinesis-stream-name", "stream"), &noopLogger)
+	assert.ErrorContains(t, err, "--kinesis-region is required")
+
+	sink, err := newKinesisSink(newTestContext(t, "--kinesis-stream-name", "stream", "--kinesis-region", "eu-west-1", "--kinesis-endpoint", "http://localhost:4566"), &noopLogger)
+	require.NoError(t, err)
+	defer sink.Close()
+	options := sink.client.(*kinesis.Client).Options()
+	assert.Equal(t, "eu-west-1", options.Region)
+	assert.Equal(t, "http://localhost:4566", aws.ToString(options.BaseEndpoint))
+}
@@ -0,0 +1,165 @@
+package tail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Buckets of the latency histogram per doubling of the latency, for a precision of about 9%
+	latencyBucketsPerDoubling = 8
+	// Latencies are bucketed in microseconds
+	latencyUnit = time.Microsecond
+)
+
+func latencyFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "latency-stats",
+			Usage:   "Report the percentiles of the delay between the time of each log and the time it was received to stderr periodically and when the session ends",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_LATENCY_STATS"},
+		},
+		&cli.DurationFlag{
+			Name:    "latency-stats-interval",
+			Usage:   "How often the --latency-stats are reported",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_LATENCY_STATS_INTERVAL"},
+			Value:   30 * time.Second,
+		},
+	}
+}
+
+// latencyStats keeps a histogram of the delay between the time of the logs and the time they were received.
+// Logs timestamped ahead of the local clock indicate a clock skew between the connector and this host; their
+// latency is counted as zero and the skew is reported since the other latencies are understated by as much.
+type latencyStats struct {
+	mu      sync.Mutex
+	buckets []uint64
+	count   uint64
+	max     time.Duration
+	skewed  uint64
+	maxSkew time.Duration
+}
+
+// latencySummary is the summary of the latencies reported, and included in the --summary.
+type latencySummary struct {
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+	// Logs timestamped ahead of the local clock
+	Skewed  uint64  `json:"skewed"`
+	MaxSkew float64 `json:"max_skew_ms,omitempty"`
+}
+
+// processor records the latency of each log at the time it is received; the logs are never dropped.
+func (s *latencyStats) processor() logProcessor {
+	return func(l *management.Log) bool {
+		s.observe(l, time.Now())
+		return true
+	}
+}
+
+func (s *latencyStats) observe(l *management.Log, received time.Time) {
+	emitted, err := time.Parse(time.RFC3339Nano, l.Time)
+	if err != nil {
+		return
+	}
+	latency := received.Sub(emitted)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if latency < 0 {
+		s.skewed++
+		if -latency > s.maxSkew {
+			s.maxSkew = -latency
+		}
+		latency = 0
+	}
+	index := latencyBucket(latency)
+	for len(s.buckets) <= index {
+		s.buckets = append(s.buckets, 0)
+	}
+	s.buckets[index]++
+	s.count++
+	if latency > s.max {
+		s.max = latency
+	}
+}
+
+// latencyBucket returns the index of the bucket of the latency.
+func latencyBucket(latency time.Duration) int {
+	units := float64(latency) / float64(latencyUnit)
+	if units <= 1 {
+		return 0
+	}
+	return int(math.Ceil(latencyBucketsPerDoubling * math.Log2(units)))
+}
+
+// latencyBucketBound returns the upper bound of the latencies of the bucket.
+func latencyBucketBound(index int) time.Duration {
+	return time.Duration(math.Pow(2, float64(index)/latencyBucketsPerDoubling) * float64(latencyUnit))
+}
+
+// percentile returns the upper bound of the bucket of the latency at the percentile (0 .. 100), capped by the
+// maximum latency observed.
+func (s *latencyStats) percentile(p float64) time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(s.count)))
+	var seen uint64
+	for i, n := range s.buckets {
+		seen += n
+		if seen >= rank {
+			return min(latencyBucketBound(i), s.max)
+		}
+	}
+	return s.max
+}
+
+func (s *latencyStats) summary() *latencySummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ms := func(d time.Duration) float64 {
+		return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+	}
+	return &latencySummary{
+		Count:   s.count,
+		P50:     ms(s.percentile(50)),
+		P90:     ms(s.percentile(90)),
+		P99:     ms(s.percentile(99)),
+		Max:     ms(s.max),
+		Skewed:  s.skewed,
+		MaxSkew: ms(s.maxSkew),
+	}
+}
+
+// printSummary writes the percentiles of the latencies.
+func (s *latencySummary) printSummary(w io.Writer) {
+	fmt.Fprintf(w, "log latency: %d logs, p50=%gms p90=%gms p99=%gms max=%gms\n", s.Count, s.P50, s.P90, s.P99, s.Max)
+	if s.Skewed > 0 {
+		fmt.Fprintf(w, "clock skew detected: %d logs timestamped up to %gms ahead of the local clock, the latencies are understated\n", s.Skewed, s.MaxSkew)
+	}
+}
+
+// reportLoop prints the summary of the latencies periodically until the context is cancelled.
+func (s *latencyStats) reportLoop(ctx context.Context, w io.Writer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.summary().printSummary(w)
+		}
+	}
+}
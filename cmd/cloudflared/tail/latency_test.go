@@ -0,0 +1,55 @@
+package tail
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestLatencyStats(t *testing.T) {
+	stats := &latencyStats{}
+	received := time.Date(2023, 1, 1, 0, 0, 10, 0, time.UTC)
+	for i := 1; i <= 100; i++ {
+		emitted := received.Add(-time.Duration(i) * time.Millisecond)
+		stats.observe(&management.Log{Time: emitted.Format(time.RFC3339Nano)}, received)
+	}
+	// Logs without a valid time aren't observed
+	stats.observe(&management.Log{Time: "yesterday"}, received)
+
+	summary := stats.summary()
+	assert.Equal(t, uint64(100), summary.Count)
+	assert.InEpsilon(t, 50, summary.P50, 0.1)
+	assert.InEpsilon(t, 90, summary.P90, 0.1)
+	assert.InEpsilon(t, 99, summary.P99, 0.1)
+	assert.Equal(t, float64(100), summary.Max)
+	assert.Zero(t, summary.Skewed)
+}
+
+func TestLatencyStats_ClockSkew(t *testing.T) {
+	stats := &latencyStats{}
+	received := time.Date(2023, 1, 1, 0, 0, 10, 0, time.UTC)
+	stats.observe(&management.Log{Time: received.Add(250 * time.Millisecond).Format(time.RFC3339Nano)}, received)
+	stats.observe(&management.Log{Time: received.Add(-10 * time.Millisecond).Format(time.RFC3339Nano)}, received)
+
+	summary := stats.summary()
+	assert.Equal(t, uint64(2), summary.Count)
+	assert.Equal(t, uint64(1), summary.Skewed)
+	assert.Equal(t, float64(250), summary.MaxSkew)
+	assert.Equal(t, float64(10), summary.Max)
+
+	var out bytes.Buffer
+	summary.printSummary(&out)
+	assert.Contains(t, out.String(), "clock skew detected: 1 logs timestamped up to 250ms ahead")
+}
+
+func TestLatencyBucket(t *testing.T) {
+	for _, latency := range []time.Duration{time.Microsecond, 3 * time.Millisecond, 2 * time.Second, time.Hour} {
+		bound := latencyBucketBound(latencyBucket(latency))
+		assert.GreaterOrEqual(t, bound, latency)
+		assert.Less(t, float64(bound), 1.1*float64(latency))
+	}
+}
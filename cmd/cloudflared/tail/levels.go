@@ -0,0 +1,69 @@
+package tail
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// levelNormalizer decodes the logs events with the nonstandard level names of the logs (e.g. warning or fatal)
+// normalized to the levels, which would otherwise fail to decode. The levels that can't be normalized are unknown
+// rather than failing the whole event.
+type levelNormalizer struct {
+	synonyms map[string]management.LogLevel
+}
+
+// normalizedLog decodes the level of the log as provided, shadowing the level of the embedded log.
+type normalizedLog struct {
+	management.Log
+	Level string `json:"level,omitempty"`
+}
+
+// newLevelNormalizer creates the normalizer with --normalize-levels, with the default synonyms extended by the
+// --level-synonym mappings. nil is returned if the levels aren't normalized.
+func newLevelNormalizer(c *cli.Context) (*levelNormalizer, error) {
+	if !c.Bool("normalize-levels") {
+		return nil, nil
+	}
+	synonyms := make(map[string]management.LogLevel, len(management.LevelSynonyms))
+	for name, level := range management.LevelSynonyms {
+		synonyms[name] = level
+	}
+	for _, v := range c.StringSlice("level-synonym") {
+		name, levelName, ok := strings.Cut(v, "=")
+		level, valid := management.ParseLogLevel(strings.TrimSpace(levelName))
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" || !valid {
+			return nil, fmt.Errorf("invalid --level-synonym %q, please use name=level with one of the levels: debug, info, warn, error", v)
+		}
+		synonyms[name] = level
+	}
+	return &levelNormalizer{synonyms: synonyms}, nil
+}
+
+// decode decodes the logs event with the levels of the logs normalized.
+func (n *levelNormalizer) decode(raw []byte) (*management.EventLog, error) {
+	var event struct {
+		management.EventLog
+		Logs []*normalizedLog `json:"logs"`
+	}
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, err
+	}
+	logs := make([]*management.Log, 0, len(event.Logs))
+	for _, l := range event.Logs {
+		log := l.Log
+		log.Level, _ = management.NormalizeLogLevel(l.Level, n.synonyms)
+		// The level is optional and defaults to debug as with the levels that aren't normalized
+		if l.Level == "" {
+			log.Level = management.Debug
+		}
+		logs = append(logs, &log)
+	}
+	event.EventLog.Logs = logs
+	return &event.EventLog, nil
+}
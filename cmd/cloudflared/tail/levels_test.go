@@ -0,0 +1,78 @@
+package tail
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestLevelNormalizer_Decode(t *testing.T) {
+	normalizer, err := newLevelNormalizer(newTestContext(t, "--normalize-levels", "--level-synonym", "Notice=info"))
+	require.NoError(t, err)
+	for _, tt := range []struct {
+		level    string
+		expected management.LogLevel
+	}{
+		{"error", management.Error},
+		{"warning", management.Warn},
+		{"err", management.Error},
+		{"critical", management.Error},
+		{"fatal", management.Error},
+		{"trace", management.Debug},
+		{"notice", management.Info},
+		{"verbose", management.UnknownLogLevel},
+		{"", management.Debug},
+	} {
+		t.Run(tt.level, func(t *testing.T) {
+			raw := []byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","level":"` + tt.level + `","message":"test","event":"http","fields":{"a":"b"}}],"dropped_count":2}`)
+			event, err := normalizer.decode(raw)
+			require.NoError(t, err)
+			assert.Equal(t, management.Logs, event.Type)
+			assert.Equal(t, uint64(2), event.DroppedCount)
+			require.Len(t, event.Logs, 1)
+			assert.Equal(t, &management.Log{
+				Time:    "2023-01-01T00:00:00Z",
+				Level:   tt.expected,
+				Message: "test",
+				Event:   management.HTTP,
+				Fields:  map[string]interface{}{"a": "b"},
+			}, event.Logs[0])
+		})
+	}
+}
+
+func TestNewLevelNormalizer(t *testing.T) {
+	normalizer, err := newLevelNormalizer(newTestContext(t))
+	require.NoError(t, err)
+	assert.Nil(t, normalizer)
+	_, err = newLevelNormalizer(newTestContext(t, "--normalize-levels", "--level-synonym", "notice=verbose"))
+	assert.ErrorContains(t, err, "invalid --level-synonym")
+	// The synonyms of the flags don't change the default synonyms
+	normalizer, err = newLevelNormalizer(newTestContext(t, "--normalize-levels", "--level-synonym", "fatal=warn"))
+	require.NoError(t, err)
+	assert.Equal(t, management.Warn, normalizer.synonyms["fatal"])
+	assert.Equal(t, management.Error, management.LevelSynonyms["fatal"])
+}
+
+func TestLogStreamer_NormalizeLevels(t *testing.T) {
+	data := []byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1","level":"warning"},{"time":"2023-01-01T00:00:00Z","message":"test2","level":"trace"}]}
+`)
+	// The logs are filtered by their normalized level
+	streamer := &logStreamer{
+		processors: []logProcessor{func(l *management.Log) bool { return l.Level >= management.Warn }},
+		levels:     &levelNormalizer{synonyms: management.LevelSynonyms},
+		log:        &noopLogger,
+	}
+	logs := make(chan *management.Log, 10)
+	streamer.readEvents(context.Background(), management.NewReaderFromBytes(data), logs)
+	close(logs)
+	var messages []string
+	for l := range logs {
+		messages = append(messages, l.Message)
+	}
+	assert.Equal(t, []string{"test1"}, messages)
+}
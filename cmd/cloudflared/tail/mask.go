@@ -0,0 +1,93 @@
+package tail
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// fieldMask replaces the string values of the fields with a key matching the pattern.
+type fieldMask struct {
+	key         *regexp.Regexp
+	replacement string
+}
+
+// parseFieldMasks parses the --mask-fields pattern=replacement values.
+func parseFieldMasks(c *cli.Context) ([]fieldMask, error) {
+	var masks []fieldMask
+	for _, v := range c.StringSlice("mask-fields") {
+		pattern, replacement, ok := strings.Cut(v, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid --mask-fields %q, please use pattern=replacement", v)
+		}
+		key, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --mask-fields pattern %q: %w", pattern, err)
+		}
+		masks = append(masks, fieldMask{key: key, replacement: replacement})
+	}
+	return masks, nil
+}
+
+// fieldMasker masks the fields of the logs before they are output, e.g. to keep the personal data of the requests
+// from leaving the process.
+func fieldMasker(masks []fieldMask) logProcessor {
+	return func(l *management.Log) bool {
+		maskFields(l.Fields, masks)
+		return true
+	}
+}
+
+// maskFields masks the fields in place, including the fields of the nested objects.
+func maskFields(fields map[string]interface{}, masks []fieldMask) {
+	for k, v := range fields {
+		if replacement, ok := maskFor(k, masks); ok {
+			fields[k] = maskValue(v, replacement)
+			continue
+		}
+		maskNested(v, masks)
+	}
+}
+
+// maskFor returns the replacement of the first mask matching the key.
+func maskFor(key string, masks []fieldMask) (string, bool) {
+	for _, m := range masks {
+		if m.key.MatchString(key) {
+			return m.replacement, true
+		}
+	}
+	return "", false
+}
+
+// maskValue replaces the strings of the value of a masked key, and the strings nested in its objects and arrays.
+func maskValue(v interface{}, replacement string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return replacement
+	case map[string]interface{}:
+		for k, nested := range v {
+			v[k] = maskValue(nested, replacement)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = maskValue(nested, replacement)
+		}
+	}
+	return v
+}
+
+// maskNested masks the fields of the objects nested in the value of a key that isn't masked.
+func maskNested(v interface{}, masks []fieldMask) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		maskFields(v, masks)
+	case []interface{}:
+		for _, nested := range v {
+			maskNested(nested, masks)
+		}
+	}
+}
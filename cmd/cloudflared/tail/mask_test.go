@@ -0,0 +1,88 @@
+package tail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestParseFieldMasks(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		args      []string
+		expected  int
+		expectErr bool
+	}{
+		{
+			name: "no masks",
+		},
+		{
+			name:     "masks",
+			args:     []string{"--mask-fields", "email=****@****.***", "--mask-fields", "^(client_)?ip$="},
+			expected: 2,
+		},
+		{
+			name:      "missing replacement",
+			args:      []string{"--mask-fields", "email"},
+			expectErr: true,
+		},
+		{
+			name:      "missing pattern",
+			args:      []string{"--mask-fields", "=****"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid pattern",
+			args:      []string{"--mask-fields", "(email=****"},
+			expectErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			masks, err := parseFieldMasks(newTestContext(t, test.args...))
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, masks, test.expected)
+		})
+	}
+}
+
+func TestBuildProcessors_MaskFields(t *testing.T) {
+	processors, err := buildProcessors(newTestContext(t, "--mask-fields", "email=****@****.***", "--mask-fields", "^ip$=x.x.x.x"))
+	require.NoError(t, err)
+	l := &management.Log{
+		Time:    "2023-01-01T00:00:00Z",
+		Message: "user signed in",
+		Fields: map[string]interface{}{
+			"user_email": "user@example.com",
+			"ip":         "192.0.2.1",
+			"client_ip":  "192.0.2.2",
+			"status":     float64(200),
+			"user": map[string]interface{}{
+				"email":   "user@example.com",
+				"emails":  []interface{}{"a@example.com", "b@example.com"},
+				"country": "PT",
+			},
+		},
+	}
+	key := l.DeduplicationKey()
+	assert.True(t, process(processors, l))
+	assert.Equal(t, map[string]interface{}{
+		"user_email": "****@****.***",
+		"ip":         "x.x.x.x",
+		"client_ip":  "192.0.2.2",
+		"status":     float64(200),
+		"user": map[string]interface{}{
+			"email":   "****@****.***",
+			"emails":  []interface{}{"****@****.***", "****@****.***"},
+			"country": "PT",
+		},
+	}, l.Fields)
+	// The log is still recognized when received again
+	assert.Equal(t, key, l.DeduplicationKey())
+}
@@ -0,0 +1,221 @@
+package tail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Value of the expected logs that matches any actual value of the field
+	mockWildcard = "*"
+	// Most of the missing expected logs described by the mismatch error
+	maxMockMismatchDetails = 5
+)
+
+func mockFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "mock-file",
+			Usage:   "Newline delimited JSON file of the logs expected in order when using --output mock, in the format of --output ndjson. Only the fields of each expected log are compared, \"*\" matching any value, and the other logs received in between are ignored",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_MOCK_FILE"},
+		},
+		&cli.IntFlag{
+			Name:    "mock-tolerance",
+			Usage:   "Number of the expected logs of the --mock-file that may be missing from the logs received",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_MOCK_TOLERANCE"},
+		},
+		&cli.DurationFlag{
+			Name:    "mock-duration",
+			Usage:   "Stop streaming after the duration (e.g. 30s) to compare the logs received to the --mock-file, only once interrupted when 0",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_MOCK_DURATION"},
+		},
+	}
+}
+
+// mockRequested returns if the logs are compared to the --mock-file.
+func mockRequested(c *cli.Context) bool {
+	return slices.Contains(outputs(c), "mock")
+}
+
+// mockExpectation is a log of the --mock-file, along with its line for the mismatch error.
+type mockExpectation struct {
+	line   int
+	fields map[string]interface{}
+}
+
+// mockSink compares the logs received to the logs expected by the --mock-file, so that the command fails if the
+// expected logs weren't received in order. Each expected log matches the next log received with the same values of
+// its fields, so that the logs that vary (e.g. their time) only need the fields that are asserted.
+//
+// Up to tolerance of the expected logs may be missing: each log received is compared to the next expected logs within
+// the tolerance left, skipping the expected logs before the one that it matches.
+type mockSink struct {
+	expected  []mockExpectation
+	tolerance int
+	log       *zerolog.Logger
+
+	mu      sync.Mutex
+	next    int
+	missing []mockExpectation
+}
+
+func newMockSink(c *cli.Context, log *zerolog.Logger) (*mockSink, error) {
+	path := expandedString(c, "mock-file")
+	if path == "" {
+		return nil, errors.New("--mock-file is required when using --output mock")
+	}
+	tolerance := c.Int("mock-tolerance")
+	if tolerance < 0 {
+		return nil, errors.New("--mock-tolerance can't be negative")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open --mock-file: %w", err)
+	}
+	defer f.Close()
+	expected, err := readMockExpectations(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --mock-file %s: %w", path, err)
+	}
+	return &mockSink{expected: expected, tolerance: tolerance, log: log}, nil
+}
+
+// readMockExpectations reads the expected logs of the newline delimited JSON, skipping the blank lines.
+func readMockExpectations(r io.Reader) ([]mockExpectation, error) {
+	var expected []mockExpectation
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		expected = append(expected, mockExpectation{line: line, fields: fields})
+	}
+	return expected, scanner.Err()
+}
+
+func (s *mockSink) Write(l *management.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= len(s.expected) {
+		return nil
+	}
+	actual, err := mockFields(l)
+	if err != nil {
+		return err
+	}
+	// The expected logs before the one matched are missing, of which the tolerance left may be skipped
+	last := min(s.next+s.tolerance-len(s.missing), len(s.expected)-1)
+	for i := s.next; i <= last; i++ {
+		if !matchesMock(s.expected[i].fields, actual) {
+			continue
+		}
+		if i > s.next {
+			s.log.Debug().Msgf("skipped %d of the expected logs of the --mock-file", i-s.next)
+		}
+		s.missing = append(s.missing, s.expected[s.next:i]...)
+		s.next = i + 1
+		return nil
+	}
+	return nil
+}
+
+// Close returns a *mockMismatchError if more of the expected logs are missing than the tolerance.
+func (s *mockSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	missing := append(slices.Clone(s.missing), s.expected[s.next:]...)
+	if len(missing) > s.tolerance {
+		return &mockMismatchError{missing: missing, expected: len(s.expected), tolerance: s.tolerance}
+	}
+	s.log.Info().Msgf("received %d of the %d expected logs of the --mock-file", len(s.expected)-len(missing), len(s.expected))
+	return nil
+}
+
+// mockFields returns the fields of the log in the format of the --mock-file.
+func mockFields(l *management.Log) (map[string]interface{}, error) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// matchesMock returns true if the actual value matches the expected value. The objects match if each of the expected
+// fields matches the actual field, and the wildcard matches any actual value that is provided.
+func matchesMock(expected, actual interface{}) bool {
+	if expected == mockWildcard {
+		return true
+	}
+	switch expected := expected.(type) {
+	case map[string]interface{}:
+		actual, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range expected {
+			field, ok := actual[key]
+			if !ok || !matchesMock(value, field) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		actual, ok := actual.([]interface{})
+		if !ok || len(actual) != len(expected) {
+			return false
+		}
+		for i := range expected {
+			if !matchesMock(expected[i], actual[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(expected, actual)
+	}
+}
+
+// mockMismatchError is returned once the expected logs of the --mock-file weren't received.
+type mockMismatchError struct {
+	missing   []mockExpectation
+	expected  int
+	tolerance int
+}
+
+func (e *mockMismatchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of the %d expected logs weren't received in order (tolerance of %d)", len(e.missing), e.expected, e.tolerance)
+	for i, missing := range e.missing {
+		if i == maxMockMismatchDetails {
+			fmt.Fprintf(&b, "; and %d more", len(e.missing)-i)
+			break
+		}
+		data, _ := json.Marshal(missing.fields)
+		fmt.Fprintf(&b, "; line %d: %s", missing.line, data)
+	}
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func writeMockFile(t *testing.T, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "expected.ndjson")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+	return path
+}
+
+func TestMatchesMock(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		expected string
+		matches  bool
+	}{
+		{name: "equal fields", expected: `{"message":"test","level":"info"}`, matches: true},
+		{name: "different field", expected: `{"message":"other"}`, matches: false},
+		{name: "missing field", expected: `{"conn_id":"1"}`, matches: false},
+		{name: "wildcard", expected: `{"message":"*","time":"*"}`, matches: true},
+		{name: "wildcard of missing field", expected: `{"path":"*"}`, matches: false},
+		{name: "nested fields", expected: `{"fields":{"status":200}}`, matches: true},
+		{name: "nested wildcard", expected: `{"fields":{"status":"*","cf-ray":"*"}}`, matches: true},
+		{name: "different nested field", expected: `{"fields":{"status":404}}`, matches: false},
+		{name: "tags", expected: `{"tags":["a","*"]}`, matches: true},
+		{name: "fewer tags", expected: `{"tags":["a"]}`, matches: false},
+		{name: "empty", expected: `{}`, matches: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			expected, err := readMockExpectations(strings.NewReader(test.expected))
+			require.NoError(t, err)
+			actual, err := mockFields(&management.Log{
+				Time:    "2024-01-01T00:00:00Z",
+				Level:   management.Info,
+				Message: "test",
+				Event:   management.HTTP,
+				Tags:    []string{"a", "b"},
+				Fields:  map[string]interface{}{"status": 200, "cf-ray": "abc"},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.matches, matchesMock(expected[0].fields, actual))
+		})
+	}
+}
+
+func TestReadMockExpectations(t *testing.T) {
+	expected, err := readMockExpectations(strings.NewReader("{\"message\":\"a\"}\n\n{\"message\":\"b\"}\n"))
+	require.NoError(t, err)
+	require.Len(t, expected, 2)
+	assert.Equal(t, 1, expected[0].line)
+	assert.Equal(t, 3, expected[1].line)
+
+	_, err = readMockExpectations(strings.NewReader("{\"message\":\"a\"}\nnot json\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestNewMockSink_Invalid(t *testing.T) {
+	_, err := newMockSink(newTestContext(t), &noopLogger)
+	assert.ErrorContains(t, err, "--mock-file is required")
+	_, err = newMockSink(newTestContext(t, "--mock-file", filepath.Join(t.TempDir(), "missing.ndjson")), &noopLogger)
+	assert.ErrorContains(t, err, "unable to open --mock-file")
+	path := writeMockFile(t, `{"message":"a"}`)
+	_, err = newMockSink(newTestContext(t, "--mock-file", path, "--mock-tolerance", "-1"), &noopLogger)
+	assert.ErrorContains(t, err, "--mock-tolerance")
+}
+
+func TestMockSink(t *testing.T) {
+	path := writeMockFile(t, `{"message":"a"}`, `{"message":"b","level":"*"}`, `{"message":"c"}`)
+	for _, test := range []struct {
+		name      string
+		messages  []string
+		tolerance string
+		missing   int
+	}{
+		{name: "in order", messages: []string{"a", "b", "c"}},
+		{name: "other logs in between", messages: []string{"x", "a", "y", "b", "z", "c"}},
+		{name: "out of order", messages: []string{"b", "a", "c"}, missing: 2},
+		{name: "missing", messages: []string{"a", "c"}, missing: 2},
+		{name: "missing within tolerance", messages: []string{"a", "c"}, tolerance: "1"},
+		{name: "out of order within tolerance", messages: []string{"b", "a", "c"}, tolerance: "1"},
+		{name: "missing beyond tolerance", messages: []string{"c"}, tolerance: "1", missing: 3},
+		{name: "none", missing: 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			args := []string{"--mock-file", path}
+			if test.tolerance != "" {
+				args = append(args, "--mock-tolerance", test.tolerance)
+			}
+			sink, err := newMockSink(newTestContext(t, args...), &noopLogger)
+			require.NoError(t, err)
+			for _, message := range test.messages {
+				require.NoError(t, sink.Write(&management.Log{Message: message, Level: management.Info}))
+			}
+			err = sink.Close()
+			if test.missing == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var mismatch *mockMismatchError
+			require.ErrorAs(t, err, &mismatch)
+			assert.Len(t, mismatch.missing, test.missing)
+		})
+	}
+}
+
+func TestMockMismatchError(t *testing.T) {
+	err := &mockMismatchError{expected: 7, tolerance: 0}
+	for i := 1; i <= 7; i++ {
+		err.missing = append(err.missing, mockExpectation{line: i, fields: map[string]interface{}{"message": "a"}})
+	}
+	assert.Equal(t, `7 of the 7 expected logs weren't received in order (tolerance of 0); line 1: {"message":"a"}; line 2: {"message":"a"}; line 3: {"message":"a"}; line 4: {"message":"a"}; line 5: {"message":"a"}; and 2 more`, err.Error())
+}
+
+func TestRun_Mock(t *testing.T) {
+	events := []byte(`{"type":"logs","logs":[{"time":"2024-01-01T00:00:00Z","level":"info","message":"test1","event":"http"}]}
+{"type":"logs","logs":[{"time":"2024-01-01T00:00:01Z","level":"warn","message":"test2","event":"http"}]}
+`)
+	Init(cliutil.GetBuildInfo("", "test"))
+	for _, test := range []struct {
+		name     string
+		expected []string
+		fails    bool
+	}{
+		{name: "match", expected: []string{`{"message":"test1","time":"*"}`, `{"message":"test2","level":"warn"}`}},
+		{name: "mismatch", expected: []string{`{"message":"test2"}`, `{"message":"test1"}`}, fails: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &mockConn{
+				MessageReader: management.NewReaderFromBytes(events),
+				MessageWriter: management.NewWriterToBuffer(&bytes.Buffer{}),
+				closed:        make(chan websocket.StatusCode, 1),
+			}
+			dial := func(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (managementConn, error) {
+				return conn, nil
+			}
+			c := newTestContext(t, "--token", "test", "--output", "mock", "--mock-file", writeMockFile(t, test.expected...))
+			err := run(c, dial, &bytes.Buffer{}, make(chan os.Signal))
+			if !test.fails {
+				assert.NoError(t, err)
+				return
+			}
+			var exit cli.ExitCoder
+			require.True(t, errors.As(err, &exit))
+			assert.Equal(t, codeMockMismatch, exit.ExitCode())
+		})
+	}
+}
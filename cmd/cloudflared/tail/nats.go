@@ -0,0 +1,152 @@
+package tail
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func natsFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "nats-url",
+			Usage:   "URL of the NATS servers (comma separated) to publish the logs to when using --output nats, e.g. nats://localhost:4222",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NATS_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "nats-subject",
+			Usage:   "NATS subject to publish the logs to when using --output nats",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NATS_SUBJECT"},
+		},
+		&cli.BoolFlag{
+			Name:    "nats-jetstream",
+			Usage:   "Publish the logs to the JetStream stream of the --nats-subject so that they are persisted",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NATS_JETSTREAM"},
+		},
+		&cli.BoolFlag{
+			Name:    "nats-tls",
+			Usage:   "Require TLS to connect to the NATS servers",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NATS_TLS"},
+		},
+		&cli.StringFlag{
+			Name:    "nats-creds-file",
+			Usage:   "NATS credentials file to authenticate with when using --output nats",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NATS_CREDS_FILE"},
+		},
+		&cli.DurationFlag{
+			Name:    "nats-flush-timeout",
+			Usage:   "Maximum time to wait for the published logs to be delivered to NATS when shutting down",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NATS_FLUSH_TIMEOUT"},
+			Value:   10 * time.Second,
+		},
+	}
+}
+
+// natsPublisher publishes the messages without waiting for them to be delivered.
+type natsPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// jetStreamPublisher publishes the messages to JetStream, which acknowledges the messages asynchronously.
+type jetStreamPublisher struct {
+	js nats.JetStreamContext
+}
+
+func (p jetStreamPublisher) Publish(subject string, data []byte) error {
+	_, err := p.js.PublishAsync(subject, data)
+	return err
+}
+
+// natsSink publishes each log as a JSON encoded NATS message.
+type natsSink struct {
+	conn      *nats.Conn
+	publisher natsPublisher
+	// Only set when publishing to JetStream
+	js           nats.JetStreamContext
+	subject      string
+	flushTimeout time.Duration
+	log          *zerolog.Logger
+}
+
+func newNatsSink(c *cli.Context, log *zerolog.Logger) (*natsSink, error) {
+	servers := expandedString(c, "nats-url")
+	if servers == "" {
+		return nil, errors.New("--nats-url is required when using --output nats")
+	}
+	subject := expandedString(c, "nats-subject")
+	if subject == "" {
+		return nil, errors.New("--nats-subject is required when using --output nats")
+	}
+	options := []nats.Option{
+		nats.Name("cloudflared tail"),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			log.Err(err).Msg("nats connection error")
+		}),
+	}
+	if c.Bool("nats-tls") {
+		options = append(options, nats.Secure(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	if creds := c.String("nats-creds-file"); creds != "" {
+		if _, err := os.Stat(creds); err != nil {
+			return nil, fmt.Errorf("unable to read the --nats-creds-file: %w", err)
+		}
+		options = append(options, nats.UserCredentials(creds))
+	}
+	conn, err := nats.Connect(servers, options...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to nats: %w", err)
+	}
+	s := &natsSink{
+		conn:         conn,
+		publisher:    conn,
+		subject:      subject,
+		flushTimeout: c.Duration("nats-flush-timeout"),
+		log:          log,
+	}
+	if c.Bool("nats-jetstream") {
+		s.js, err = conn.JetStream(nats.PublishAsyncErrHandler(func(_ nats.JetStream, msg *nats.Msg, err error) {
+			log.Err(err).Msg("unable to publish log to nats jetstream")
+		}))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to use nats jetstream: %w", err)
+		}
+		s.publisher = jetStreamPublisher{js: s.js}
+	}
+	return s, nil
+}
+
+func (s *natsSink) Write(l *management.Log) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	// The messages are buffered by the connection; delivery errors are reported by the error handlers
+	return s.publisher.Publish(s.subject, data)
+}
+
+// Close waits up to the flush timeout for the published logs to be delivered (and acknowledged by JetStream).
+func (s *natsSink) Close() error {
+	defer s.conn.Close()
+	deadline := time.Now().Add(s.flushTimeout)
+	if s.js != nil {
+		select {
+		case <-s.js.PublishAsyncComplete():
+		case <-time.After(s.flushTimeout):
+			return fmt.Errorf("timed out after %s waiting for nats jetstream to acknowledge the logs", s.flushTimeout)
+		}
+	}
+	if err := s.conn.FlushTimeout(time.Until(deadline)); err != nil {
+		return fmt.Errorf("unable to flush logs to nats: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package tail
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+type recordingPublisher struct {
+	subjects []string
+	messages [][]byte
+}
+
+func (p *recordingPublisher) Publish(subject string, data []byte) error {
+	p.subjects = append(p.subjects, subject)
+	p.messages = append(p.messages, data)
+	return nil
+}
+
+func TestNewNatsSink(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "missing url",
+			args: []string{"--nats-subject", "cloudflared.logs"},
+			err:  "--nats-url is required",
+		},
+		{
+			name: "missing subject",
+			args: []string{"--nats-url", "nats://localhost:4222"},
+			err:  "--nats-subject is required",
+		},
+		{
+			name: "missing creds file",
+			args: []string{"--nats-url", "nats://localhost:4222", "--nats-subject", "cloudflared.logs",
+				"--nats-creds-file", filepath.Join(t.TempDir(), "missing.creds")},
+			err: "unable to read the --nats-creds-file",
+		},
+		{
+			name: "unreachable server",
+			args: []string{"--nats-url", "nats://127.0.0.1:1", "--nats-subject", "cloudflared.logs"},
+			err:  "unable to connect to nats",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newNatsSink(newTestContext(t, test.args...), &noopLogger)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func TestNatsSink_Write(t *testing.T) {
+	publisher := &recordingPublisher{}
+	sink := &natsSink{publisher: publisher, subject: "cloudflared.logs"}
+	require.NoError(t, sink.Write(&management.Log{Message: "test", ConnectorID: "connector"}))
+
+	require.Equal(t, []string{"cloudflared.logs"}, publisher.subjects)
+	var l management.Log
+	require.NoError(t, json.Unmarshal(publisher.messages[0], &l))
+	assert.Equal(t, management.Log{Message: "test", ConnectorID: "connector"}, l)
+}
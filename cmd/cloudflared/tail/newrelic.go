@@ -0,0 +1,235 @@
+package tail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	newRelicMaxAttempts = 5
+	newRelicBaseBackoff = time.Second
+	newRelicMaxBackoff  = 30 * time.Second
+	// The Log API accepts up to 1MB of compressed logs per request, which the batches of logs stay well below
+	newRelicMaxBatch      = 1000
+	newRelicFlushInterval = time.Second
+	// The logtype attribute of the logs, which New Relic uses to parse them
+	newRelicLogType = "cloudflared"
+)
+
+// Endpoints of the Log API of the New Relic regions
+var newRelicEndpoints = map[string]string{
+	"us": "https://log-api.newrelic.com/log/v1",
+	"eu": "https://log-api.eu.newrelic.com/log/v1",
+}
+
+func newRelicFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "nr-license-key",
+			Usage:   "New Relic license key of the account that the logs are sent to when using --output newrelic",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NR_LICENSE_KEY", "NEW_RELIC_LICENSE_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "nr-region",
+			Usage:   "Data center region of the New Relic account when using --output newrelic: us or eu",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_NR_REGION"},
+			Value:   "us",
+		},
+		&cli.StringFlag{
+			Name:   "nr-endpoint",
+			Usage:  "Override the New Relic Log API endpoint",
+			Hidden: true,
+		},
+	}
+}
+
+// newRelicEntry is a log in the detailed JSON format of the Log API.
+type newRelicEntry struct {
+	// Milliseconds since the epoch
+	Timestamp  int64                  `json:"timestamp,omitempty"`
+	Message    string                 `json:"message"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// newRelicPayload is a batch of logs that share the common attributes.
+type newRelicPayload struct {
+	Common struct {
+		Attributes map[string]string `json:"attributes"`
+	} `json:"common"`
+	Logs []newRelicEntry `json:"logs"`
+}
+
+func newNewRelicEntry(l *management.Log) newRelicEntry {
+	entry := newRelicEntry{
+		Message: l.Message,
+		Attributes: map[string]interface{}{
+			management.LevelKey:     l.Level.String(),
+			management.EventTypeKey: l.Event.String(),
+		},
+	}
+	if t, err := time.Parse(time.RFC3339Nano, l.Time); err == nil {
+		entry.Timestamp = t.UnixMilli()
+	}
+	optional := map[string]string{
+		"connector_id":       l.ConnectorID,
+		management.MethodKey: l.Method,
+		management.PathKey:   l.Path,
+		management.ConnIDKey: l.ConnID,
+	}
+	for key, value := range optional {
+		if value != "" {
+			entry.Attributes[key] = value
+		}
+	}
+	if len(l.Tags) > 0 {
+		entry.Attributes[management.TagsKey] = l.Tags
+	}
+	// The fields are nested, which New Relic flattens into attributes such as fields.status
+	if len(l.Fields) > 0 {
+		entry.Attributes[management.FieldsKey] = l.Fields
+	}
+	return entry
+}
+
+// newRelicSink POSTs the logs to the New Relic Log API in gzip compressed batches, with the logtype of the logs as a
+// common attribute of each batch.
+type newRelicSink struct {
+	*batchSink
+	url        string
+	licenseKey string
+	client     *http.Client
+	log        *zerolog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newNewRelicSink(c *cli.Context, log *zerolog.Logger) (*newRelicSink, error) {
+	licenseKey := c.String("nr-license-key")
+	if licenseKey == "" {
+		return nil, errors.New("--nr-license-key is required when using --output newrelic")
+	}
+	region := c.String("nr-region")
+	endpoint, ok := newRelicEndpoints[region]
+	if !ok {
+		return nil, fmt.Errorf("invalid --nr-region %q, please use one of: us, eu", region)
+	}
+	if override := c.String("nr-endpoint"); override != "" {
+		endpoint = override
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	return newNewRelicSinkWithClient(endpoint, licenseKey, client, log), nil
+}
+
+func newNewRelicSinkWithClient(url, licenseKey string, client *http.Client, log *zerolog.Logger) *newRelicSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &newRelicSink{
+		url:        url,
+		licenseKey: licenseKey,
+		client:     client,
+		log:        log,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	s.batchSink = newBatchSink(newRelicMaxBatch, newRelicFlushInterval, s.send, log)
+	return s
+}
+
+// Close sends the remaining logs.
+func (s *newRelicSink) Close() error {
+	defer s.cancel()
+	return s.batchSink.Close()
+}
+
+// encodeNewRelicBatch encodes the logs as a gzip compressed payload of the Log API.
+func encodeNewRelicBatch(logs []*management.Log) ([]byte, error) {
+	payload := newRelicPayload{Logs: make([]newRelicEntry, 0, len(logs))}
+	payload.Common.Attributes = map[string]string{"logtype": newRelicLogType}
+	for _, l := range logs {
+		payload.Logs = append(payload.Logs, newNewRelicEntry(l))
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode([]newRelicPayload{payload}); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// send POSTs the logs to the Log API. Following the retry policy of New Relic, the requests are retried with an
+// exponential backoff when they fail, are throttled or a server error is returned, and the other client errors
+// aren't retried. The logs are dropped once the attempts are exhausted.
+func (s *newRelicSink) send(logs []*management.Log) error {
+	body, err := encodeNewRelicBatch(logs)
+	if err != nil {
+		return err
+	}
+	backoff := newRelicBaseBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.post(body)
+		if err == nil {
+			return nil
+		}
+		var permanent *newRelicPermanentError
+		if errors.As(err, &permanent) || attempt >= newRelicMaxAttempts {
+			return fmt.Errorf("dropped %d logs: %w", len(logs), err)
+		}
+		s.log.Debug().Err(err).Msgf("retrying new relic delivery in %s", backoff)
+		select {
+		case <-s.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, newRelicMaxBackoff)
+	}
+}
+
+// newRelicPermanentError is returned when New Relic rejects the request and retrying won't help, e.g. an invalid
+// license key or a malformed payload.
+type newRelicPermanentError struct {
+	status int
+	body   []byte
+}
+
+func (e *newRelicPermanentError) Error() string {
+	return fmt.Sprintf("new relic returned http status %d: %s", e.status, e.body)
+}
+
+func (s *newRelicSink) post(body []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("X-License-Key", s.licenseKey)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("new relic returned http status %d: %s", resp.StatusCode, respBody)
+	default:
+		return &newRelicPermanentError{status: resp.StatusCode, body: respBody}
+	}
+}
@@ -0,0 +1,118 @@
+package tail
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestNewNewRelicSink(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		args      []string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "us region",
+			args:     []string{"--nr-license-key", "key"},
+			expected: "https://log-api.newrelic.com/log/v1",
+		},
+		{
+			name:     "eu region",
+			args:     []string{"--nr-license-key", "key", "--nr-region", "eu"},
+			expected: "https://log-api.eu.newrelic.com/log/v1",
+		},
+		{
+			name:      "missing license key",
+			expectErr: true,
+		},
+		{
+			name:      "invalid region",
+			args:      []string{"--nr-license-key", "key", "--nr-region", "ap"},
+			expectErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink, err := newNewRelicSink(newTestContext(t, test.args...), &noopLogger)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, sink.url)
+			assert.NoError(t, sink.Close())
+		})
+	}
+}
+
+func TestNewRelicSink_Send(t *testing.T) {
+	var requests atomic.Int32
+	var payloads []newRelicPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request fails with a server error to validate the retry
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "key", r.Header.Get("X-License-Key"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.NewDecoder(gz).Decode(&payloads))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := newNewRelicSinkWithClient(server.URL, "key", server.Client(), &noopLogger)
+	err := sink.send([]*management.Log{{
+		Time:    "2023-01-02T15:04:05Z",
+		Level:   management.Warn,
+		Event:   management.HTTP,
+		Message: "test",
+		Method:  "GET",
+		Tags:    []string{"origin"},
+		Fields:  map[string]interface{}{"status": float64(502)},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, int32(2), requests.Load())
+	require.Len(t, payloads, 1)
+	assert.Equal(t, map[string]string{"logtype": "cloudflared"}, payloads[0].Common.Attributes)
+	require.Len(t, payloads[0].Logs, 1)
+	entry := payloads[0].Logs[0]
+	assert.Equal(t, int64(1672671845000), entry.Timestamp)
+	assert.Equal(t, "test", entry.Message)
+	assert.Equal(t, map[string]interface{}{
+		"level":  "warn",
+		"event":  "http",
+		"method": "GET",
+		"tags":   []interface{}{"origin"},
+		"fields": map[string]interface{}{"status": float64(502)},
+	}, entry.Attributes)
+}
+
+func TestNewRelicSink_ClientError(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	sink := newNewRelicSinkWithClient(server.URL, "key", server.Client(), &noopLogger)
+	defer sink.Close()
+	err := sink.send([]*management.Log{{Message: "test"}})
+	assert.ErrorContains(t, err, "http status 403")
+	// The client errors aren't retried
+	assert.Equal(t, int32(1), requests.Load())
+}
@@ -0,0 +1,377 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Defaults of the batch log record processor of the OpenTelemetry SDKs
+	otlpMaxBatch      = 512
+	otlpFlushInterval = time.Second
+	otlpExportTimeout = 10 * time.Second
+
+	otlpProtocolGRPC = "grpc"
+	otlpProtocolHTTP = "http/protobuf"
+	// Path of the logs on the OTLP/HTTP endpoint
+	otlpLogsPath  = "/v1/logs"
+	otlpScopeName = "github.com/cloudflare/cloudflared/cmd/cloudflared/tail"
+	// Service name of the logs unless OTEL_SERVICE_NAME is set
+	otlpDefaultServiceName = "cloudflared"
+)
+
+func otlpFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "otlp-protocol",
+			Usage:   "Protocol of the otlp sink (grpc or http/protobuf)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"},
+			Value:   otlpProtocolHTTP,
+		},
+		&cli.StringFlag{
+			Name:    "otlp-headers",
+			Usage:   "Headers of the requests of the otlp sink as comma separated key=value pairs",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_LOGS_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS"},
+		},
+		&cli.BoolFlag{
+			Name:    "otlp-insecure",
+			Usage:   "Connect to the grpc endpoint of the otlp sink without TLS",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_OTLP_INSECURE", "OTEL_EXPORTER_OTLP_LOGS_INSECURE", "OTEL_EXPORTER_OTLP_INSECURE"},
+		},
+	}
+}
+
+// otlpExporter sends the logs to an OpenTelemetry collector.
+type otlpExporter interface {
+	export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error
+	close() error
+}
+
+// otlpSink exports the logs as OpenTelemetry log records in batches. The level of the logs is mapped to the severity,
+// the message to the body and the fields to the attributes of the records.
+type otlpSink struct {
+	*batchSink
+	exporter otlpExporter
+	resource *resourcepb.Resource
+	log      *zerolog.Logger
+}
+
+// newOTLPSink creates the sink for the endpoint of a --sink otlp:endpoint, which falls back to the standard
+// OTEL_EXPORTER_OTLP_* environment variables.
+func newOTLPSink(c *cli.Context, endpoint string, log *zerolog.Logger) (*otlpSink, error) {
+	protocol := c.String("otlp-protocol")
+	headers, err := parseOTLPHeaders(c.String("otlp-headers"))
+	if err != nil {
+		return nil, err
+	}
+	var exporter otlpExporter
+	switch protocol {
+	case otlpProtocolHTTP:
+		u, err := otlpHTTPEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		exporter = &otlpHTTPExporter{url: u, headers: headers, client: &http.Client{Timeout: otlpExportTimeout}}
+	case otlpProtocolGRPC:
+		exporter, err = newOTLPGRPCExporter(endpoint, headers, c.Bool("otlp-insecure"))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid --otlp-protocol %q, please use one of: grpc, http/protobuf", protocol)
+	}
+	return newOTLPSinkWithExporter(exporter, otlpResource(), log), nil
+}
+
+func newOTLPSinkWithExporter(exporter otlpExporter, resource *resourcepb.Resource, log *zerolog.Logger) *otlpSink {
+	s := &otlpSink{
+		exporter: exporter,
+		resource: resource,
+		log:      log,
+	}
+	s.batchSink = newBatchSink(otlpMaxBatch, otlpFlushInterval, s.send, log)
+	return s
+}
+
+// Close exports the remaining logs before closing the exporter.
+func (s *otlpSink) Close() error {
+	return errors.Join(s.batchSink.Close(), s.exporter.close())
+}
+
+func (s *otlpSink) send(logs []*management.Log) error {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpExportTimeout)
+	defer cancel()
+	return s.exporter.export(ctx, s.request(logs, time.Now()))
+}
+
+// request returns the export request of the logs observed at the time.
+func (s *otlpSink) request(logs []*management.Log, observed time.Time) *collogspb.ExportLogsServiceRequest {
+	records := make([]*logspb.LogRecord, 0, len(logs))
+	for _, l := range logs {
+		records = append(records, otlpLogRecord(l, observed))
+	}
+	return &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: s.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: otlpScopeName},
+				LogRecords: records,
+			}},
+		}},
+	}
+}
+
+// otlpSeverity maps the level of the log to the severity of the log record.
+func otlpSeverity(level management.LogLevel) logspb.SeverityNumber {
+	switch level {
+	case management.Debug:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case management.Info:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case management.Warn:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case management.Error:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+	}
+}
+
+func otlpLogRecord(l *management.Log, observed time.Time) *logspb.LogRecord {
+	record := &logspb.LogRecord{
+		ObservedTimeUnixNano: uint64(observed.UnixNano()),
+		SeverityNumber:       otlpSeverity(l.Level),
+		SeverityText:         l.Level.String(),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: l.Message}},
+		Attributes:           otlpAttributes(l.Fields),
+	}
+	if t, err := time.Parse(time.RFC3339Nano, l.Time); err == nil {
+		record.TimeUnixNano = uint64(t.UnixNano())
+	}
+	record.Attributes = append(record.Attributes, otlpStringAttribute("cloudflared.event", l.Event.String()))
+	if l.ConnectorID != "" {
+		record.Attributes = append(record.Attributes, otlpStringAttribute("cloudflared.connector_id", l.ConnectorID))
+	}
+	return record
+}
+
+// otlpAttributes converts the fields to attributes ordered by key.
+func otlpAttributes(fields map[string]interface{}) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attributes := make([]*commonpb.KeyValue, 0, len(keys)+2)
+	for _, k := range keys {
+		attributes = append(attributes, &commonpb.KeyValue{Key: k, Value: otlpValue(fields[k])})
+	}
+	return attributes
+}
+
+func otlpStringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// otlpValue converts a field decoded from JSON to an attribute value; numbers without a fractional part are integers.
+func otlpValue(v interface{}) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case nil:
+		return &commonpb.AnyValue{}
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case []interface{}:
+		values := make([]*commonpb.AnyValue, 0, len(v))
+		for _, e := range v {
+			values = append(values, otlpValue(e))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]interface{}:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: otlpAttributes(v)}}}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+	}
+}
+
+// otlpResource returns the resource of the logs from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES.
+func otlpResource() *resourcepb.Resource {
+	attributes, err := parseOTLPHeaders(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		attributes = make(map[string]string)
+	}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = attributes["service.name"]
+	}
+	if serviceName == "" {
+		serviceName = otlpDefaultServiceName
+	}
+	attributes["service.name"] = serviceName
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	resource := &resourcepb.Resource{}
+	for _, k := range keys {
+		resource.Attributes = append(resource.Attributes, otlpStringAttribute(k, attributes[k]))
+	}
+	return resource
+}
+
+// parseOTLPHeaders parses the comma separated key=value pairs of the OTEL_EXPORTER_OTLP_HEADERS format, with the values
+// url encoded.
+func parseOTLPHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid otlp header %q, please use key=value", pair)
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid otlp header %q: %w", pair, err)
+		}
+		headers[k] = decoded
+	}
+	return headers, nil
+}
+
+// otlpHTTPEndpoint returns the url to export the logs to. The endpoint of the sink and OTEL_EXPORTER_OTLP_LOGS_ENDPOINT
+// are used as provided if they have a path, while the logs path is appended to OTEL_EXPORTER_OTLP_ENDPOINT.
+func otlpHTTPEndpoint(endpoint string) (string, error) {
+	appendPath := false
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT")
+	}
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		appendPath = true
+	}
+	if endpoint == "" {
+		return "", errors.New("an endpoint is required for the otlp sink, please use otlp:URL or set OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid otlp endpoint %q, please provide an http(s) url", endpoint)
+	}
+	if appendPath || u.Path == "" || u.Path == "/" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + otlpLogsPath
+	}
+	return u.String(), nil
+}
+
+// otlpHTTPExporter exports the logs with OTLP/HTTP in the binary protobuf encoding.
+type otlpHTTPExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (e *otlpHTTPExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("otlp endpoint returned http status %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+func (e *otlpHTTPExporter) close() error {
+	return nil
+}
+
+// otlpGRPCExporter exports the logs with the OTLP/gRPC logs service.
+type otlpGRPCExporter struct {
+	conn    *grpc.ClientConn
+	client  collogspb.LogsServiceClient
+	headers metadata.MD
+}
+
+// newOTLPGRPCExporter connects to the endpoint, provided as host:port or as a url where the http scheme disables TLS.
+func newOTLPGRPCExporter(endpoint string, headers map[string]string, plaintext bool) (*otlpGRPCExporter, error) {
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT")
+	}
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		return nil, errors.New("an endpoint is required for the otlp sink, please use otlp:host:port or set OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	target := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https") {
+		target = u.Host
+		plaintext = plaintext || u.Scheme == "http"
+	}
+	creds := credentials.NewTLS(&tls.Config{})
+	if plaintext {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("invalid otlp endpoint %q: %w", endpoint, err)
+	}
+	return &otlpGRPCExporter{conn: conn, client: collogspb.NewLogsServiceClient(conn), headers: metadata.New(headers)}, nil
+}
+
+func (e *otlpGRPCExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	_, err := e.client.Export(metadata.NewOutgoingContext(ctx, e.headers), req)
+	return err
+}
+
+func (e *otlpGRPCExporter) close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,189 @@
+package tail
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestOTLPLogRecord(t *testing.T) {
+	observed := time.Date(2023, 1, 1, 0, 0, 1, 0, time.UTC)
+	record := otlpLogRecord(&management.Log{
+		Time:        "2023-01-01T00:00:00.5Z",
+		Level:       management.Warn,
+		Event:       management.HTTP,
+		Message:     "origin unreachable",
+		ConnectorID: "connector",
+		Fields: map[string]interface{}{
+			"status":   float64(502),
+			"duration": 1.5,
+			"cached":   false,
+			"path":     "/",
+			"tags":     []interface{}{"a"},
+			"origin":   map[string]interface{}{"host": "localhost"},
+		},
+	}, observed)
+	assert.Equal(t, uint64(time.Date(2023, 1, 1, 0, 0, 0, 500000000, time.UTC).UnixNano()), record.TimeUnixNano)
+	assert.Equal(t, uint64(observed.UnixNano()), record.ObservedTimeUnixNano)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, record.SeverityNumber)
+	assert.Equal(t, "warn", record.SeverityText)
+	assert.Equal(t, "origin unreachable", record.Body.GetStringValue())
+
+	attributes := make(map[string]*commonpb.AnyValue)
+	var keys []string
+	for _, kv := range record.Attributes {
+		attributes[kv.Key] = kv.Value
+		keys = append(keys, kv.Key)
+	}
+	// The fields are ordered by key, followed by the attributes of the log
+	assert.Equal(t, []string{"cached", "duration", "origin", "path", "status", "tags", "cloudflared.event", "cloudflared.connector_id"}, keys)
+	assert.Equal(t, int64(502), attributes["status"].GetIntValue())
+	assert.Equal(t, 1.5, attributes["duration"].GetDoubleValue())
+	assert.False(t, attributes["cached"].GetBoolValue())
+	assert.Equal(t, "/", attributes["path"].GetStringValue())
+	assert.Equal(t, "a", attributes["tags"].GetArrayValue().Values[0].GetStringValue())
+	assert.Equal(t, "host", attributes["origin"].GetKvlistValue().Values[0].Key)
+	assert.Equal(t, "http", attributes["cloudflared.event"].GetStringValue())
+	assert.Equal(t, "connector", attributes["cloudflared.connector_id"].GetStringValue())
+}
+
+func TestParseOTLPHeaders(t *testing.T) {
+	headers, err := parseOTLPHeaders("api-key=secret, x-scope = a%20b,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"api-key": "secret", "x-scope": "a b"}, headers)
+	_, err = parseOTLPHeaders("api-key")
+	assert.ErrorContains(t, err, "invalid otlp header")
+}
+
+func TestOTLPHTTPEndpoint(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		endpoint        string
+		logsEndpoint    string
+		genericEndpoint string
+		expected        string
+		err             string
+	}{
+		{name: "sink endpoint", endpoint: "https://collector:4318", expected: "https://collector:4318/v1/logs"},
+		{name: "sink endpoint with path", endpoint: "https://collector:4318/custom", expected: "https://collector:4318/custom"},
+		{name: "logs endpoint", logsEndpoint: "http://collector:4318/v1/logs", expected: "http://collector:4318/v1/logs"},
+		{name: "generic endpoint", genericEndpoint: "http://collector:4318/otlp/", expected: "http://collector:4318/otlp/v1/logs"},
+		{name: "missing", err: "an endpoint is required"},
+		{name: "invalid", endpoint: "collector:4318", err: "invalid otlp endpoint"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", tt.logsEndpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.genericEndpoint)
+			u, err := otlpHTTPEndpoint(tt.endpoint)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, u)
+		})
+	}
+}
+
+func TestOTLPResource(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "edge-tunnel")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=production")
+	resource := otlpResource()
+	require.Len(t, resource.Attributes, 2)
+	assert.Equal(t, "deployment.environment", resource.Attributes[0].Key)
+	assert.Equal(t, "service.name", resource.Attributes[1].Key)
+	assert.Equal(t, "edge-tunnel", resource.Attributes[1].Value.GetStringValue())
+}
+
+func TestOTLPSink_HTTP(t *testing.T) {
+	requests := make(chan *collogspb.ExportLogsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, otlpLogsPath, r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("Api-Key"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req collogspb.ExportLogsServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &req))
+		requests <- &req
+	}))
+	defer server.Close()
+
+	exporter := &otlpHTTPExporter{url: server.URL + otlpLogsPath, headers: map[string]string{"api-key": "secret"}, client: server.Client()}
+	sink := newOTLPSinkWithExporter(exporter, otlpResource(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test1"}))
+	require.NoError(t, sink.Write(&management.Log{Message: "test2"}))
+	// The batch is exported on close
+	require.NoError(t, sink.Close())
+
+	req := <-requests
+	require.Len(t, req.ResourceLogs, 1)
+	records := req.ResourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(t, records, 2)
+	assert.Equal(t, "test1", records[0].Body.GetStringValue())
+	assert.Equal(t, "test2", records[1].Body.GetStringValue())
+}
+
+func TestOTLPSink_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	exporter := &otlpHTTPExporter{url: server.URL, client: server.Client()}
+	err := exporter.export(context.Background(), &collogspb.ExportLogsServiceRequest{})
+	assert.ErrorContains(t, err, "otlp endpoint returned http status 503")
+}
+
+// logsService records the export requests of the OTLP/gRPC logs service
+type logsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	requests chan *collogspb.ExportLogsServiceRequest
+	headers  chan metadata.MD
+}
+
+func (s *logsService) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.headers <- md
+	s.requests <- req
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func TestOTLPSink_GRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	service := &logsService{requests: make(chan *collogspb.ExportLogsServiceRequest, 1), headers: make(chan metadata.MD, 1)}
+	server := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(server, service)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	// The http scheme connects without TLS
+	exporter, err := newOTLPGRPCExporter("http://"+listener.Addr().String(), map[string]string{"api-key": "secret"}, false)
+	require.NoError(t, err)
+	sink := newOTLPSinkWithExporter(exporter, otlpResource(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Level: management.Error, Message: "test"}))
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, []string{"secret"}, (<-service.headers).Get("api-key"))
+	records := (<-service.requests).ResourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(t, records, 1)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, records[0].SeverityNumber)
+	assert.Equal(t, "test", records[0].Body.GetStringValue())
+}
@@ -0,0 +1,216 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	pollPath = "/logs/poll"
+	// The management service holds a poll request for up to 10s while waiting for logs
+	pollRequestTimeout = 30 * time.Second
+)
+
+func pollFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "poll-fallback",
+			Usage:   "Poll the management service for the logs over HTTP if the websocket connection can't be established",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_POLL_FALLBACK"},
+		},
+		&cli.DurationFlag{
+			Name:    "poll-interval",
+			Usage:   "Time to wait between the poll requests when polling for the logs",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_POLL_INTERVAL"},
+			Value:   time.Second,
+		},
+	}
+}
+
+// pollConn polls the management service for the logs over HTTP for networks where websockets are blocked. The
+// start_streaming event written to the connection is provided in each poll request, and the events of each poll
+// response are read from the connection as if they were received over a websocket.
+type pollConn struct {
+	client   *http.Client
+	url      string
+	header   http.Header
+	interval time.Duration
+
+	// Cancelled once the connection is closed to interrupt the pending poll
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Guards the start_streaming event, which can be updated while a poll is pending
+	startMu sync.Mutex
+	// The start_streaming event provided in the poll requests
+	start []byte
+
+	mu     sync.Mutex
+	events management.MessageReader
+	polled bool
+}
+
+// newPollConn creates the connection for the polling endpoint of the management service at the websocket url.
+func newPollConn(u url.URL, header http.Header, interval time.Duration, client *http.Client) *pollConn {
+	if u.Scheme == "wss" {
+		u.Scheme = "https"
+	} else if u.Scheme == "ws" {
+		u.Scheme = "http"
+	}
+	u.Path = pollPath
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pollConn{
+		client:   client,
+		url:      u.String(),
+		header:   header,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Write captures the start_streaming event to request the logs with, and replaces its filters with those of the
+// update_filters events for the following polls; other events aren't supported while polling.
+func (p *pollConn) Write(ctx context.Context, messageType websocket.MessageType, data []byte) error {
+	event, err := management.ReadClientEvent(management.NewReaderFromBytes(data), ctx)
+	if err != nil {
+		return err
+	}
+	switch event.Type {
+	case management.StartStreaming:
+		p.setStart(data)
+		return nil
+	case management.UpdateFilters:
+		update, ok := management.IntoClientEvent[management.EventUpdateFilters](event, management.UpdateFilters)
+		if !ok {
+			return errors.New("invalid update_filters event")
+		}
+		start, err := json.Marshal(&management.EventStartStreaming{
+			ClientEvent:   management.ClientEvent{Type: management.StartStreaming},
+			Filters:       update.Filters,
+			ClientVersion: clientVersion(),
+		})
+		if err != nil {
+			return err
+		}
+		p.setStart(start)
+		return nil
+	default:
+		return fmt.Errorf("%s events are not supported while polling", event.Type)
+	}
+}
+
+func (p *pollConn) setStart(start []byte) {
+	p.startMu.Lock()
+	defer p.startMu.Unlock()
+	p.start = start
+}
+
+func (p *pollConn) startEvent() []byte {
+	p.startMu.Lock()
+	defer p.startMu.Unlock()
+	return p.start
+}
+
+// Read returns the next event of the last poll response, polling again once all of them have been read.
+func (p *pollConn) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.startEvent() == nil {
+		return 0, nil, errors.New("start_streaming is required before polling")
+	}
+	for {
+		if p.ctx.Err() != nil {
+			return 0, nil, websocket.CloseError{Code: websocket.StatusNormalClosure}
+		}
+		if p.events != nil {
+			messageType, data, err := p.events.Read(ctx)
+			if err == nil {
+				return messageType, data, nil
+			}
+			if !errors.Is(err, io.EOF) {
+				return 0, nil, err
+			}
+			p.events = nil
+		}
+		if p.polled {
+			if err := p.wait(ctx); err != nil {
+				return 0, nil, err
+			}
+		}
+		body, err := p.poll(ctx)
+		if err != nil {
+			if p.ctx.Err() != nil {
+				continue
+			}
+			return 0, nil, err
+		}
+		p.polled = true
+		p.events = management.NewReaderFromBytes(body)
+	}
+}
+
+// wait waits for the poll interval unless the connection is closed.
+func (p *pollConn) wait(ctx context.Context) error {
+	timer := time.NewTimer(p.interval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-p.ctx.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *pollConn) poll(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, pollRequestTimeout)
+	defer cancel()
+	// The pending poll is interrupted once the connection is closed
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(p.startEvent()))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range p.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errors.New("management service does not support polling for logs")
+		}
+		return nil, newValidationError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Close interrupts the pending poll; the following reads report a normal closure.
+func (p *pollConn) Close(code websocket.StatusCode, reason string) error {
+	p.cancel()
+	return nil
+}
+
+func (p *pollConn) Subprotocol() string {
+	return ""
+}
@@ -0,0 +1,107 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// pollServer provides one log per poll request with the message of the log being the poll number
+func pollServer(t *testing.T, polls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, pollPath, r.URL.Path)
+		assert.Equal(t, "test", r.URL.Query().Get("access_token"))
+		var start management.EventStartStreaming
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&start))
+		assert.Equal(t, management.StartStreaming, start.Type)
+		assert.Equal(t, management.NewStreamingFilters(management.WithEvents(management.HTTP)), start.Filters)
+		n := polls.Add(1)
+		assert.NoError(t, json.NewEncoder(w).Encode(&management.EventLog{
+			ServerEvent: management.ServerEvent{Type: management.Logs},
+			Logs:        []*management.Log{{Time: testLogTime, Message: fmt.Sprintf("poll%d", n)}},
+		}))
+	}))
+}
+
+func startPolling(t *testing.T, server *httptest.Server) *pollConn {
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	u.Scheme = "ws"
+	u.RawQuery = url.Values{"access_token": {"test"}}.Encode()
+	conn := newPollConn(*u, http.Header{}, time.Millisecond, server.Client())
+	require.NoError(t, management.WriteEvent(conn, context.Background(), &management.EventStartStreaming{
+		ClientEvent: management.ClientEvent{Type: management.StartStreaming},
+		Filters:     management.NewStreamingFilters(management.WithEvents(management.HTTP)),
+	}))
+	return conn
+}
+
+func TestPollConn_Stream(t *testing.T) {
+	defer leaktest.Check(t)()
+	var polls atomic.Int32
+	server := pollServer(t, &polls)
+	defer server.Close()
+	conn := startPolling(t, server)
+
+	sink := &recordingSink{}
+	streamer := &logStreamer{conn: conn, sink: sink, drainTimeout: time.Second, log: &noopLogger}
+	signals := make(chan os.Signal, 1)
+	go func() {
+		assert.Eventually(t, func() bool { return len(sink.messages()) >= 3 }, time.Second, time.Millisecond)
+		signals <- syscall.SIGINT
+	}()
+	end := streamer.run(context.Background(), signals)
+	assert.Equal(t, closedByClient, end.ClosedBy)
+	assert.Equal(t, []string{"poll1", "poll2", "poll3"}, sink.messages()[:3])
+	server.CloseClientConnections()
+}
+
+func TestPollConn_Unsupported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	conn := startPolling(t, server)
+	_, _, err := conn.Read(context.Background())
+	assert.ErrorContains(t, err, "does not support polling")
+}
+
+func TestPollConn_Write(t *testing.T) {
+	conn := newPollConn(url.URL{Scheme: "wss", Host: "management.argotunnel.com", Path: "/logs"}, nil, time.Second, http.DefaultClient)
+	assert.Equal(t, "https://management.argotunnel.com/logs/poll", conn.url)
+	_, _, err := conn.Read(context.Background())
+	assert.ErrorContains(t, err, "start_streaming is required")
+	err = management.WriteEvent(conn, context.Background(), &management.EventStopStreaming{
+		ClientEvent: management.ClientEvent{Type: management.StopStreaming},
+	})
+	assert.ErrorContains(t, err, "not supported while polling")
+}
+
+func TestPollConn_UpdateFilters(t *testing.T) {
+	conn := newPollConn(url.URL{Scheme: "wss", Host: "management.argotunnel.com", Path: "/logs"}, nil, time.Second, http.DefaultClient)
+	require.NoError(t, management.WriteEvent(conn, context.Background(), &management.EventStartStreaming{
+		ClientEvent: management.ClientEvent{Type: management.StartStreaming},
+	}))
+	filters := management.NewStreamingFilters(management.WithLevel(management.Warn))
+	require.NoError(t, management.WriteEvent(conn, context.Background(), &management.EventUpdateFilters{
+		ClientEvent: management.ClientEvent{Type: management.UpdateFilters},
+		Filters:     filters,
+	}))
+	// The following polls request the logs with the updated filters
+	var start management.EventStartStreaming
+	require.NoError(t, json.Unmarshal(conn.startEvent(), &start))
+	assert.Equal(t, management.StartStreaming, start.Type)
+	assert.Equal(t, filters, start.Filters)
+}
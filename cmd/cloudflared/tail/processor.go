@@ -0,0 +1,156 @@
+package tail
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// logProcessor is a stage that runs on every log received before it is written to the sink. The processor can
+// modify the log in place and returns false if the log should be dropped.
+type logProcessor func(l *management.Log) bool
+
+// buildProcessors creates the ordered list of processors from the provided flags.
+func buildProcessors(c *cli.Context) ([]logProcessor, error) {
+	var processors []logProcessor
+	connectors, err := parseConnectors(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(connectors) > 0 {
+		processors = append(processors, connectorFilter(connectors))
+	}
+	if prefix := c.String("path-prefix"); prefix != "" {
+		processors = append(processors, pathPrefixFilter(prefix))
+	}
+	_, levels, err := parseSample(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(levels) > 0 {
+		seed := time.Now().UnixNano()
+		if c.IsSet("sample-seed") {
+			seed = c.Int64("sample-seed")
+		}
+		processors = append(processors, levelSampler(levels, rand.New(rand.NewSource(seed))))
+	}
+	// The fields are folded before the other processors use them, so that the nested fields are named by their keys
+	if c.Bool("fold-fields") {
+		processors = append(processors, fieldFolder())
+	}
+	if field := c.String("timestamp-field"); field != "" {
+		processors = append(processors, timestampFromField(field))
+	}
+	masks, err := parseFieldMasks(c)
+	if err != nil {
+		return nil, err
+	}
+	// The fields are masked once the other processors used them, and the deduplication key doesn't include them
+	if len(masks) > 0 {
+		processors = append(processors, fieldMasker(masks))
+	}
+	return processors, nil
+}
+
+// process runs the log through all of the processors and returns false if the log was dropped.
+func process(processors []logProcessor, l *management.Log) bool {
+	for _, p := range processors {
+		if !p(l) {
+			return false
+		}
+	}
+	return true
+}
+
+// connectorFilter drops the logs that weren't emitted by one of the connectors.
+func connectorFilter(connectors map[string]bool) logProcessor {
+	return func(l *management.Log) bool {
+		return matchesConnector(l, connectors)
+	}
+}
+
+// pathPrefixFilter drops the http logs that aren't of a request with a path starting with the prefix. The other logs
+// are kept.
+func pathPrefixFilter(prefix string) logProcessor {
+	return func(l *management.Log) bool {
+		return l.Event != management.HTTP || strings.HasPrefix(l.Path, prefix)
+	}
+}
+
+// levelSampler keeps approximately the rate (0.0 .. 1.0) of the logs of each level. The logs of the levels without a
+// rate are all kept. Processors run on the reader goroutine, so the source of randomness isn't shared.
+func levelSampler(rates map[management.LogLevel]float64, rng *rand.Rand) logProcessor {
+	return func(l *management.Log) bool {
+		rate, ok := rates[l.Level]
+		if !ok {
+			return true
+		}
+		return rng.Float64() < rate
+	}
+}
+
+// timestampFromField uses the value of the field as the time of the log. The time of the log is left as-is if the
+// field is absent or can't be parsed as a timestamp.
+func timestampFromField(field string) logProcessor {
+	return func(l *management.Log) bool {
+		switch v := l.Fields[field].(type) {
+		case string:
+			if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				l.Time = v
+			}
+		case float64:
+			// Numeric values are unix timestamps in seconds
+			sec := int64(v)
+			nsec := int64((v - float64(sec)) * float64(time.Second))
+			l.Time = time.Unix(sec, nsec).UTC().Format(time.RFC3339Nano)
+		}
+		return true
+	}
+}
+
+// fieldFolder replaces the fields of the log with the folded fields.
+func fieldFolder() logProcessor {
+	return func(l *management.Log) bool {
+		if l.Fields != nil {
+			l.Fields = foldFields(l.Fields)
+		}
+		return true
+	}
+}
+
+// foldFields flattens the nested objects of the fields into dotted keys, e.g. {"http":{"host":"example.com"}} is
+// folded into {"http.host":"example.com"}. The elements of arrays are keyed by their index, e.g. a.0 and a.1. Empty
+// objects and arrays are kept as-is.
+func foldFields(fields map[string]interface{}) map[string]interface{} {
+	folded := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		foldValue(folded, k, v)
+	}
+	return folded
+}
+
+func foldValue(folded map[string]interface{}, key string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			folded[key] = v
+		}
+		for k, nested := range v {
+			foldValue(folded, key+"."+k, nested)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			folded[key] = v
+		}
+		for i, nested := range v {
+			foldValue(folded, key+"."+strconv.Itoa(i), nested)
+		}
+	default:
+		folded[key] = v
+	}
+}
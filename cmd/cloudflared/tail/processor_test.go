@@ -0,0 +1,140 @@
+package tail
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestProcess(t *testing.T) {
+	var calls []string
+	processors := []logProcessor{
+		func(l *management.Log) bool {
+			calls = append(calls, "first")
+			return l.Message != "drop"
+		},
+		func(l *management.Log) bool {
+			calls = append(calls, "second")
+			return true
+		},
+	}
+	assert.True(t, process(processors, &management.Log{Message: "keep"}))
+	assert.Equal(t, []string{"first", "second"}, calls)
+	calls = nil
+	assert.False(t, process(processors, &management.Log{Message: "drop"}))
+	assert.Equal(t, []string{"first"}, calls)
+	assert.True(t, process(nil, &management.Log{}))
+}
+
+func TestTimestampFromField(t *testing.T) {
+	logTime := "2023-04-01T10:00:00Z"
+	for _, test := range []struct {
+		name     string
+		fields   map[string]interface{}
+		expected string
+	}{
+		{
+			name:     "missing field",
+			expected: logTime,
+		},
+		{
+			name:     "rfc3339 field",
+			fields:   map[string]interface{}{"ts": "2023-04-01T09:59:58.5Z"},
+			expected: "2023-04-01T09:59:58.5Z",
+		},
+		{
+			name:     "unix timestamp field",
+			fields:   map[string]interface{}{"ts": float64(1680343198)},
+			expected: "2023-04-01T09:59:58Z",
+		},
+		{
+			name:     "unparseable field",
+			fields:   map[string]interface{}{"ts": "yesterday"},
+			expected: logTime,
+		},
+		{
+			name:     "unsupported type",
+			fields:   map[string]interface{}{"ts": true},
+			expected: logTime,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			l := &management.Log{Time: logTime, Fields: test.fields}
+			assert.True(t, timestampFromField("ts")(l))
+			assert.Equal(t, test.expected, l.Time)
+		})
+	}
+}
+
+func TestLevelSampler(t *testing.T) {
+	rates := map[management.LogLevel]float64{management.Debug: 0.1, management.Info: 0}
+	sample := func(seed int64) []bool {
+		sampler := levelSampler(rates, rand.New(rand.NewSource(seed)))
+		var kept []bool
+		for i := 0; i < 1000; i++ {
+			kept = append(kept, sampler(&management.Log{Level: management.Debug}))
+			assert.False(t, sampler(&management.Log{Level: management.Info}))
+			assert.True(t, sampler(&management.Log{Level: management.Error}))
+		}
+		return kept
+	}
+	kept := sample(1)
+	count := 0
+	for _, k := range kept {
+		if k {
+			count++
+		}
+	}
+	assert.InDelta(t, 100, count, 40)
+	// The same seed samples the same logs
+	assert.Equal(t, kept, sample(1))
+}
+
+func TestFoldFields(t *testing.T) {
+	fields := map[string]interface{}{
+		"http": map[string]interface{}{
+			"request": map[string]interface{}{
+				"headers": map[string]interface{}{"host": "example.com"},
+				"method":  "GET",
+			},
+		},
+		"a":      []interface{}{"x", map[string]interface{}{"b": float64(1)}},
+		"empty":  map[string]interface{}{},
+		"none":   []interface{}{},
+		"status": float64(200),
+	}
+	assert.Equal(t, map[string]interface{}{
+		"http.request.headers.host": "example.com",
+		"http.request.method":       "GET",
+		"a.0":                       "x",
+		"a.1.b":                     float64(1),
+		"empty":                     map[string]interface{}{},
+		"none":                      []interface{}{},
+		"status":                    float64(200),
+	}, foldFields(fields))
+}
+
+func TestBuildProcessors_FoldFields(t *testing.T) {
+	processors, err := buildProcessors(newTestContext(t, "--fold-fields", "--timestamp-field", "meta.ts"))
+	assert.NoError(t, err)
+	// The nested field is named by its folded key
+	l := &management.Log{Time: "2023-04-01T10:00:00Z", Fields: map[string]interface{}{
+		"meta": map[string]interface{}{"ts": "2023-04-01T09:59:58Z"},
+	}}
+	assert.True(t, process(processors, l))
+	assert.Equal(t, "2023-04-01T09:59:58Z", l.Time)
+	assert.Equal(t, map[string]interface{}{"meta.ts": "2023-04-01T09:59:58Z"}, l.Fields)
+}
+
+func TestBuildProcessors_PathPrefix(t *testing.T) {
+	processors, err := buildProcessors(newTestContext(t, "--path-prefix", "/api/"))
+	assert.NoError(t, err)
+	assert.True(t, process(processors, &management.Log{Event: management.HTTP, Path: "/api/users"}))
+	assert.False(t, process(processors, &management.Log{Event: management.HTTP, Path: "/static/app.js"}))
+	assert.False(t, process(processors, &management.Log{Event: management.HTTP, Message: "200 OK"}))
+	// The logs that aren't of requests are kept
+	assert.True(t, process(processors, &management.Log{Event: management.Cloudflared, Message: "not a request"}))
+}
@@ -0,0 +1,83 @@
+package tail
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	profileCPU   = "cpu"
+	profileMem   = "mem"
+	profileBlock = "block"
+)
+
+// profileFlags profile the tail command itself, for the development of cloudflared.
+func profileFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:   "profile",
+			Usage:  "Profile the command (cpu, mem, block) and write the pprof profile to the --profile-output on exit",
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name:   "profile-output",
+			Usage:  "File to write the --profile to",
+			Value:  "tail.pprof",
+			Hidden: true,
+		},
+	}
+}
+
+// startProfile starts the --profile, returning the function that writes the profile once the command exits. The
+// function does nothing if no profile was requested.
+func startProfile(c *cli.Context) (func() error, error) {
+	kind := c.String("profile")
+	if kind == "" {
+		return func() error { return nil }, nil
+	}
+	switch kind {
+	case profileCPU, profileMem, profileBlock:
+	default:
+		return nil, fmt.Errorf("invalid --profile %q, please use one of: cpu, mem, block", kind)
+	}
+	// The file is created up front so that an invalid path is reported before streaming
+	f, err := os.Create(c.String("profile-output"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the --profile-output: %w", err)
+	}
+	var write func() error
+	switch kind {
+	case profileCPU:
+		if err := pprof.StartCPUProfile(f); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("unable to start the cpu profile: %w", err)
+		}
+		write = func() error {
+			pprof.StopCPUProfile()
+			return nil
+		}
+	case profileMem:
+		write = func() error {
+			// The heap profile is of the allocations up to the last garbage collection
+			runtime.GC()
+			return pprof.WriteHeapProfile(f)
+		}
+	case profileBlock:
+		runtime.SetBlockProfileRate(1)
+		write = func() error {
+			defer runtime.SetBlockProfileRate(0)
+			return pprof.Lookup("block").WriteTo(f, 0)
+		}
+	}
+	return func() error {
+		err := write()
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
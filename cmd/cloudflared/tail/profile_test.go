@@ -0,0 +1,35 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartProfile(t *testing.T) {
+	for _, kind := range []string{profileCPU, profileMem, profileBlock} {
+		t.Run(kind, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tail.pprof")
+			write, err := startProfile(newTestContext(t, "--profile", kind, "--profile-output", path))
+			require.NoError(t, err)
+			require.NoError(t, write())
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.NotZero(t, info.Size())
+		})
+	}
+}
+
+func TestStartProfile_Invalid(t *testing.T) {
+	write, err := startProfile(newTestContext(t))
+	require.NoError(t, err)
+	assert.NoError(t, write())
+
+	_, err = startProfile(newTestContext(t, "--profile", "goroutine"))
+	assert.ErrorContains(t, err, "invalid --profile")
+	_, err = startProfile(newTestContext(t, "--profile", "cpu", "--profile-output", filepath.Join(t.TempDir(), "missing", "tail.pprof")))
+	assert.ErrorContains(t, err, "unable to create the --profile-output")
+}
@@ -0,0 +1,142 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"google.golang.org/api/option"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+var (
+	pubsubTopicRegexp = regexp.MustCompile(`^projects/([^/]+)/topics/([^/]+)$`)
+)
+
+func pubsubFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "pubsub-topic",
+			Usage:   "Google Cloud Pub/Sub topic (projects/PROJECT/topics/TOPIC) to publish the logs to when using --output pubsub",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_PUBSUB_TOPIC"},
+		},
+		&cli.IntFlag{
+			Name:    "pubsub-count-threshold",
+			Usage:   "Publish a batch of logs to Pub/Sub once it has this many messages",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_PUBSUB_COUNT_THRESHOLD"},
+			Value:   100,
+		},
+		&cli.DurationFlag{
+			Name:    "pubsub-delay-threshold",
+			Usage:   "Publish a batch of logs to Pub/Sub after this much time has passed",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_PUBSUB_DELAY_THRESHOLD"},
+			Value:   10 * time.Millisecond,
+		},
+		&cli.StringFlag{
+			Name:   "pubsub-endpoint",
+			Usage:  "Override the Google Cloud Pub/Sub endpoint",
+			Hidden: true,
+		},
+	}
+}
+
+// pubsubSink publishes the logs to a Google Cloud Pub/Sub topic, which the client batches according to the
+// PublishSettings of the topic. The credentials are resolved by the client from the Application Default Credentials,
+// unless the PUBSUB_EMULATOR_HOST is set.
+type pubsubSink struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+	log    *zerolog.Logger
+
+	// The results of the messages published, which are reported by the following Write or the Close
+	results sync.WaitGroup
+	mu      sync.Mutex
+	failed  int
+	err     error
+}
+
+func newPubSubSink(c *cli.Context, log *zerolog.Logger) (*pubsubSink, error) {
+	topic := expandedString(c, "pubsub-topic")
+	match := pubsubTopicRegexp.FindStringSubmatch(topic)
+	if match == nil {
+		return nil, errors.New("--pubsub-topic is required in the form projects/PROJECT/topics/TOPIC when using --output pubsub")
+	}
+	settings := pubsub.DefaultPublishSettings
+	settings.CountThreshold = c.Int("pubsub-count-threshold")
+	settings.DelayThreshold = c.Duration("pubsub-delay-threshold")
+	if settings.CountThreshold <= 0 || settings.CountThreshold > pubsub.MaxPublishRequestCount {
+		return nil, fmt.Errorf("--pubsub-count-threshold must be in the range (1 .. %d)", pubsub.MaxPublishRequestCount)
+	}
+	if settings.DelayThreshold <= 0 {
+		return nil, errors.New("--pubsub-delay-threshold must be greater than 0")
+	}
+	var opts []option.ClientOption
+	if endpoint := c.String("pubsub-endpoint"); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	client, err := pubsub.NewClient(c.Context, match[1], opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the pubsub client: %w", err)
+	}
+	return newPubSubSinkWithClient(client, match[2], settings, log), nil
+}
+
+func newPubSubSinkWithClient(client *pubsub.Client, topicID string, settings pubsub.PublishSettings, log *zerolog.Logger) *pubsubSink {
+	topic := client.Topic(topicID)
+	topic.PublishSettings = settings
+	return &pubsubSink{client: client, topic: topic, log: log}
+}
+
+// Write publishes the log, returning the error of the logs that failed to be published since the previous Write.
+func (s *pubsubSink) Write(l *management.Log) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		s.log.Debug().Msgf("unable to parse event to json %+v", l)
+		return s.takeErr()
+	}
+	result := s.topic.Publish(context.Background(), &pubsub.Message{
+		Data: data,
+		// Attributes allow for subscription filters on the level and event type
+		Attributes: map[string]string{
+			"level": l.Level.String(),
+			"event": l.Event.String(),
+		},
+	})
+	s.results.Add(1)
+	go func() {
+		defer s.results.Done()
+		if _, err := result.Get(context.Background()); err != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.failed++
+			s.err = err
+		}
+	}()
+	return s.takeErr()
+}
+
+// Close publishes the remaining logs, returning the error of the logs that failed to be published.
+func (s *pubsubSink) Close() error {
+	s.topic.Stop()
+	s.results.Wait()
+	return errors.Join(s.takeErr(), s.client.Close())
+}
+
+func (s *pubsubSink) takeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed == 0 {
+		return nil
+	}
+	err := fmt.Errorf("unable to publish %d logs to pubsub topic %s: %w", s.failed, s.topic, s.err)
+	s.failed, s.err = 0, nil
+	return err
+}
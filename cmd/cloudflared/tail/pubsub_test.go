@@ -0,0 +1,88 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// newTestPubSubClient returns a client of the fake Pub/Sub server.
+func newTestPubSubClient(t *testing.T, srv *pstest.Server) *pubsub.Client {
+	client, err := pubsub.NewClient(context.Background(), "proj",
+		option.WithEndpoint(srv.Addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	require.NoError(t, err)
+	return client
+}
+
+func TestPubSubSink_Publish(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+	client := newTestPubSubClient(t, srv)
+	_, err := client.CreateTopic(context.Background(), "logs")
+	require.NoError(t, err)
+
+	settings := pubsub.DefaultPublishSettings
+	settings.CountThreshold = 2
+	settings.DelayThreshold = time.Hour
+	sink := newPubSubSinkWithClient(client, "logs", settings, &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test1", Level: management.Warn, Event: management.HTTP}))
+	require.NoError(t, sink.Write(&management.Log{Message: "test2", Level: management.Error, Event: management.TCP}))
+	// The count threshold is met by the first two messages
+	require.Eventually(t, func() bool { return len(srv.Messages()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, sink.Write(&management.Log{Message: "test3"}))
+	// The remaining message is published on close
+	require.NoError(t, sink.Close())
+
+	messages := srv.Messages()
+	require.Len(t, messages, 3)
+	assert.Equal(t, map[string]string{"level": "warn", "event": "http"}, messages[0].Attributes)
+	assert.Equal(t, map[string]string{"level": "error", "event": "tcp"}, messages[1].Attributes)
+	assert.Equal(t, map[string]string{"level": "debug", "event": "cloudflared"}, messages[2].Attributes)
+	var l management.Log
+	require.NoError(t, json.Unmarshal(messages[0].Data, &l))
+	assert.Equal(t, "test1", l.Message)
+}
+
+func TestPubSubSink_PublishError(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+
+	// The topic doesn't exist
+	settings := pubsub.DefaultPublishSettings
+	settings.CountThreshold = 1
+	sink := newPubSubSinkWithClient(newTestPubSubClient(t, srv), "logs", settings, &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test1"}))
+	assert.ErrorContains(t, sink.Close(), "unable to publish 1 logs to pubsub topic projects/proj/topics/logs")
+}
+
+func TestNewPubSubSink(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "missing topic", err: "--pubsub-topic is required"},
+		{name: "invalid topic", args: []string{"--pubsub-topic", "logs"}, err: "--pubsub-topic is required"},
+		{name: "count threshold", args: []string{"--pubsub-topic", "projects/proj/topics/logs", "--pubsub-count-threshold", "1001"}, err: "--pubsub-count-threshold"},
+		{name: "delay threshold", args: []string{"--pubsub-topic", "projects/proj/topics/logs", "--pubsub-delay-threshold", "0s"}, err: "--pubsub-delay-threshold"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newPubSubSink(newTestContext(t, test.args...), &noopLogger)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
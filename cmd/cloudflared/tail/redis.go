@@ -0,0 +1,131 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func redisFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "redis-addr",
+			Usage:   "Redis server (host:port) to publish the logs to when using --output redis",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_REDIS_ADDR"},
+		},
+		&cli.StringFlag{
+			Name:    "redis-key",
+			Usage:   "Redis channel (or stream with --redis-stream) to publish the logs to when using --output redis",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_REDIS_KEY"},
+		},
+		&cli.BoolFlag{
+			Name:    "redis-stream",
+			Usage:   "Add the logs to the --redis-key stream with XADD instead of publishing them to the channel",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_REDIS_STREAM"},
+		},
+		&cli.StringFlag{
+			Name:    "redis-password",
+			Usage:   "Password to authenticate with the Redis server",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_REDIS_PASSWORD"},
+		},
+		&cli.IntFlag{
+			Name:    "redis-db",
+			Usage:   "Redis database to select after connecting",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_REDIS_DB"},
+		},
+	}
+}
+
+// redisClient is the subset of the commands of the Redis client used by the sink.
+type redisClient interface {
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	Close() error
+}
+
+// redisSink publishes the logs to a Redis channel as JSON, or adds them to a Redis stream with a stream field for each
+// of the fields of the log.
+type redisSink struct {
+	client redisClient
+	key    string
+	stream bool
+}
+
+func newRedisSink(c *cli.Context) (*redisSink, error) {
+	addr := expandedString(c, "redis-addr")
+	if addr == "" {
+		return nil, errors.New("--redis-addr is required when using --output redis")
+	}
+	key := expandedString(c, "redis-key")
+	if key == "" {
+		return nil, errors.New("--redis-key is required when using --output redis")
+	}
+	db := c.Int("redis-db")
+	if db < 0 {
+		return nil, errors.New("--redis-db must not be negative")
+	}
+	// The client connects when the first log is published
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: c.String("redis-password"),
+		DB:       db,
+	})
+	return &redisSink{client: client, key: key, stream: c.Bool("redis-stream")}, nil
+}
+
+// streamValues returns the fields of the stream entry of the log. The fields of the log are JSON encoded into a
+// single field.
+func streamValues(l *management.Log) (map[string]interface{}, error) {
+	values := map[string]interface{}{
+		management.TimeKey:      l.Time,
+		management.LevelKey:     l.Level.String(),
+		management.EventTypeKey: l.Event.String(),
+		management.MessageKey:   l.Message,
+	}
+	if l.ConnectorID != "" {
+		values["connector_id"] = l.ConnectorID
+	}
+	if l.Method != "" {
+		values[management.MethodKey] = l.Method
+	}
+	if l.Path != "" {
+		values[management.PathKey] = l.Path
+	}
+	if l.ConnID != "" {
+		values[management.ConnIDKey] = l.ConnID
+	}
+	if len(l.Fields) > 0 {
+		fields, err := json.Marshal(l.Fields)
+		if err != nil {
+			return nil, err
+		}
+		values[management.FieldsKey] = string(fields)
+	}
+	return values, nil
+}
+
+func (s *redisSink) Write(l *management.Log) error {
+	ctx := context.Background()
+	if s.stream {
+		values, err := streamValues(l)
+		if err != nil {
+			return err
+		}
+		// The ID of the entry is generated by Redis
+		return s.client.XAdd(ctx, &redis.XAddArgs{Stream: s.key, Values: values}).Err()
+	}
+	message, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.client.Publish(ctx, s.key, message).Err()
+}
+
+func (s *redisSink) Close() error {
+	return s.client.Close()
+}
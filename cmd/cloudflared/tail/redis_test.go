@@ -0,0 +1,128 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+type recordingRedisClient struct {
+	published map[string][]interface{}
+	added     []*redis.XAddArgs
+}
+
+func (c *recordingRedisClient) Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd {
+	if c.published == nil {
+		c.published = make(map[string][]interface{})
+	}
+	c.published[channel] = append(c.published[channel], message)
+	return redis.NewIntResult(1, nil)
+}
+
+func (c *recordingRedisClient) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	c.added = append(c.added, a)
+	return redis.NewStringResult("1-0", nil)
+}
+
+func (c *recordingRedisClient) Close() error {
+	return nil
+}
+
+func TestNewRedisSink(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		args      []string
+		expectErr bool
+	}{
+		{
+			name: "addr and key",
+			args: []string{"--redis-addr", "localhost:6379", "--redis-key", "cloudflared:logs"},
+		},
+		{
+			name: "stream with authentication",
+			args: []string{"--redis-addr", "localhost:6379", "--redis-key", "cloudflared:logs", "--redis-stream",
+				"--redis-password", "password", "--redis-db", "2"},
+		},
+		{
+			name:      "missing addr",
+			args:      []string{"--redis-key", "cloudflared:logs"},
+			expectErr: true,
+		},
+		{
+			name:      "missing key",
+			args:      []string{"--redis-addr", "localhost:6379"},
+			expectErr: true,
+		},
+		{
+			name:      "negative db",
+			args:      []string{"--redis-addr", "localhost:6379", "--redis-key", "cloudflared:logs", "--redis-db", "-1"},
+			expectErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink, err := newRedisSink(newTestContext(t, test.args...))
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, sink.Close())
+		})
+	}
+}
+
+func TestRedisSink_Publish(t *testing.T) {
+	client := &recordingRedisClient{}
+	sink := &redisSink{client: client, key: "cloudflared:logs"}
+	require.NoError(t, sink.Write(&management.Log{Message: "test", ConnectorID: "connector"}))
+
+	require.Len(t, client.published["cloudflared:logs"], 1)
+	var l management.Log
+	require.NoError(t, json.Unmarshal(client.published["cloudflared:logs"][0].([]byte), &l))
+	assert.Equal(t, management.Log{Message: "test", ConnectorID: "connector"}, l)
+	assert.Empty(t, client.added)
+}
+
+func TestRedisSink_Stream(t *testing.T) {
+	client := &recordingRedisClient{}
+	sink := &redisSink{client: client, key: "cloudflared:logs", stream: true}
+	require.NoError(t, sink.Write(&management.Log{
+		Time:        "2023-01-01T00:00:00Z",
+		Level:       management.Info,
+		Event:       management.HTTP,
+		Message:     "200 OK",
+		Method:      "GET",
+		Path:        "/api",
+		ConnectorID: "connector",
+		Fields:      map[string]interface{}{"status": float64(200)},
+	}))
+	require.NoError(t, sink.Write(&management.Log{Message: "connected"}))
+
+	require.Len(t, client.added, 2)
+	assert.Equal(t, "cloudflared:logs", client.added[0].Stream)
+	// The ID is generated by Redis
+	assert.Empty(t, client.added[0].ID)
+	assert.Equal(t, map[string]interface{}{
+		"time":         "2023-01-01T00:00:00Z",
+		"level":        "info",
+		"event":        "http",
+		"message":      "200 OK",
+		"method":       "GET",
+		"path":         "/api",
+		"connector_id": "connector",
+		"fields":       `{"status":200}`,
+	}, client.added[0].Values)
+	assert.Equal(t, map[string]interface{}{
+		"time":    "",
+		"level":   "debug",
+		"event":   "cloudflared",
+		"message": "connected",
+	}, client.added[1].Values)
+	assert.Empty(t, client.published)
+}
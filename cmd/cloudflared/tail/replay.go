@@ -0,0 +1,116 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func replayFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "replay-file",
+			Usage:   "Replay the events captured with --output raw from the file instead of connecting to the management service",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_REPLAY_FILE"},
+		},
+		&cli.Float64Flag{
+			Name:    "replay-speed",
+			Usage:   "Pace the --replay-file by the time between the logs, sped up by the factor (e.g. 2 for twice as fast); 0 replays the logs as fast as possible",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_REPLAY_SPEED"},
+			Value:   1,
+		},
+	}
+}
+
+// replayDialer returns the dialFunc that replays the events of the file, read when dialed.
+func replayDialer(path string, speed float64) dialFunc {
+	return func(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (managementConn, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the replay file: %w", err)
+		}
+		return newReplayConn(management.NewReaderFromBytes(data), speed), nil
+	}
+}
+
+// replayConn is a read-only managementConn that replays the events of the reader. The events are delayed by the
+// time between their logs divided by the speed, unless the speed is 0. The client events written are discarded.
+type replayConn struct {
+	reader management.MessageReader
+	speed  float64
+
+	// The time of the logs of the previous event, only accessed by the reader
+	last time.Time
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newReplayConn(reader management.MessageReader, speed float64) *replayConn {
+	return &replayConn{reader: reader, speed: speed, closed: make(chan struct{})}
+}
+
+func (c *replayConn) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	select {
+	case <-c.closed:
+		return 0, nil, websocket.CloseError{Code: websocket.StatusNormalClosure}
+	default:
+	}
+	messageType, data, err := c.reader.Read(ctx)
+	if err != nil || c.speed <= 0 {
+		return messageType, data, err
+	}
+	if t, ok := eventTime(data); ok {
+		if !c.last.IsZero() && t.After(c.last) {
+			delay := time.NewTimer(time.Duration(float64(t.Sub(c.last)) / c.speed))
+			defer delay.Stop()
+			select {
+			case <-delay.C:
+			case <-c.closed:
+				return 0, nil, websocket.CloseError{Code: websocket.StatusNormalClosure}
+			case <-ctx.Done():
+				return 0, nil, ctx.Err()
+			}
+		}
+		c.last = t
+	}
+	return messageType, data, nil
+}
+
+// eventTime returns the time of the first log of the logs event.
+func eventTime(data []byte) (time.Time, bool) {
+	var event struct {
+		Logs []struct {
+			Time string `json:"time"`
+		} `json:"logs"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil || len(event.Logs) == 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, event.Logs[0].Time)
+	return t, err == nil
+}
+
+func (c *replayConn) Write(ctx context.Context, messageType websocket.MessageType, message []byte) error {
+	return nil
+}
+
+// Close interrupts the pending read.
+func (c *replayConn) Close(code websocket.StatusCode, reason string) error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *replayConn) Subprotocol() string {
+	return ""
+}
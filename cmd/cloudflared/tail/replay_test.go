@@ -0,0 +1,72 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const replayEvents = `{"type":"logs","logs":[{"time":"2024-01-01T00:00:00Z","message":"test1"}]}
+{"type":"logs","logs":[{"time":"2024-01-01T00:00:00.2Z","message":"test2"}]}
+{"type":"logs","logs":[{"time":"2024-01-01T00:00:00.4Z","message":"test3"}]}
+`
+
+func TestReplayConn_Speed(t *testing.T) {
+	for _, tt := range []struct {
+		speed float64
+		min   time.Duration
+		max   time.Duration
+	}{
+		{speed: 0, max: 100 * time.Millisecond},
+		{speed: 1, min: 400 * time.Millisecond, max: time.Second},
+		{speed: 4, min: 100 * time.Millisecond, max: 300 * time.Millisecond},
+	} {
+		conn := newReplayConn(management.NewReaderFromBytes([]byte(replayEvents)), tt.speed)
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			_, _, err := conn.Read(context.Background())
+			require.NoError(t, err)
+		}
+		elapsed := time.Since(start)
+		assert.GreaterOrEqual(t, elapsed, tt.min, "speed %v", tt.speed)
+		assert.Less(t, elapsed, tt.max, "speed %v", tt.speed)
+	}
+}
+
+func TestReplayConn_Close(t *testing.T) {
+	events := `{"type":"logs","logs":[{"time":"2024-01-01T00:00:00Z","message":"test1"}]}
+{"type":"logs","logs":[{"time":"2024-01-01T01:00:00Z","message":"test2"}]}
+`
+	conn := newReplayConn(management.NewReaderFromBytes([]byte(events)), 1)
+	_, _, err := conn.Read(context.Background())
+	require.NoError(t, err)
+	// The read of the second event waits for an hour unless the connection is closed
+	time.AfterFunc(10*time.Millisecond, func() { conn.Close(websocket.StatusNormalClosure, "") })
+	_, _, err = conn.Read(context.Background())
+	require.NotNil(t, management.AsClosed(err))
+	assert.Equal(t, websocket.StatusNormalClosure, management.AsClosed(err).Code)
+}
+
+func TestRun_ReplayFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.ndjson")
+	require.NoError(t, os.WriteFile(path, []byte(replayEvents), 0o600))
+
+	Init(cliutil.GetBuildInfo("", "test"))
+	var stdout bytes.Buffer
+	c := newTestContext(t, "--replay-file", path, "--replay-speed", "0", "--no-fields")
+	// The management service isn't connected to, so no token is required
+	require.NoError(t, run(c, nil, &stdout, make(chan os.Signal)))
+	assert.Equal(t, "2024-01-01T00:00:00Z debug cloudflared test1\n"+
+		"2024-01-01T00:00:00.2Z debug cloudflared test2\n"+
+		"2024-01-01T00:00:00.4Z debug cloudflared test3\n", stdout.String())
+}
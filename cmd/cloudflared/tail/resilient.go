@@ -0,0 +1,272 @@
+package tail
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Attempts to write a log to a network sink before it is dropped
+	sinkMaxAttempts = 3
+	sinkRetryDelay  = 100 * time.Millisecond
+	// Consecutive failures of a network sink before the circuit is opened and writes are halted
+	sinkFailureThreshold = 5
+	sinkMinCooldown      = 5 * time.Second
+	sinkMaxCooldown      = time.Minute
+)
+
+var (
+	errSinkClosed = errors.New("output is closed")
+)
+
+// dropPolicy decides which logs are dropped when a network sink can't keep up.
+type dropPolicy string
+
+const (
+	// Drop the incoming logs once the buffer is full
+	dropNewest dropPolicy = "newest"
+	// Drop the oldest buffered logs to make room for the incoming logs
+	dropOldest dropPolicy = "oldest"
+	// Drop all of the incoming logs while the sink is unhealthy, otherwise the incoming logs once the buffer is full
+	dropUnhealthy dropPolicy = "unhealthy"
+)
+
+func resilienceFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    "sink-buffer",
+			Usage:   "Number of logs buffered for each network output (kinesis, pubsub, kafka, splunk, datadog, nats, redis, vector, cloudwatch, azure-monitor, fluentd, newrelic, webhook, otlp) while it is slow or unavailable",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SINK_BUFFER"},
+			Value:   10000,
+		},
+		&cli.StringFlag{
+			Name:    "sink-drop-policy",
+			Usage:   "Logs to drop when a network output can't keep up: newest or oldest once the buffer is full, or all logs while the output is unhealthy",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SINK_DROP_POLICY"},
+			Value:   string(dropNewest),
+		},
+	}
+}
+
+// resilientSinkOptions are the options of the network sinks from the provided flags.
+func resilientSinkOptions(c *cli.Context) (int, dropPolicy, error) {
+	size := c.Int("sink-buffer")
+	if size <= 0 {
+		return 0, "", errors.New("--sink-buffer must be greater than 0")
+	}
+	policy := dropPolicy(c.String("sink-drop-policy"))
+	switch policy {
+	case dropNewest, dropOldest, dropUnhealthy:
+	default:
+		return 0, "", fmt.Errorf("invalid --sink-drop-policy value provided, please make sure it is one of: %s, %s, %s", dropNewest, dropOldest, dropUnhealthy)
+	}
+	return size, policy, nil
+}
+
+// resilientSink buffers the logs for a network sink so that a slow or unavailable sink doesn't stall the stream.
+// Failed writes are retried, and once the sink fails consistently the circuit is opened to halt writes until the
+// sink has cooled down. Changes in the health of the sink are reported to the logger.
+type resilientSink struct {
+	name   string
+	sink   logSink
+	size   int
+	policy dropPolicy
+	log    *zerolog.Logger
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []*management.Log
+	closed   bool
+	dropped  uint64
+	failures int
+	// The circuit is open while the sink is unhealthy
+	open      bool
+	openUntil time.Time
+	// Time the circuit stays open after the sink becomes unhealthy, doubling while the sink stays unhealthy
+	minCooldown time.Duration
+	cooldown    time.Duration
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+func newResilientSink(name string, sink logSink, size int, policy dropPolicy, log *zerolog.Logger) *resilientSink {
+	s := &resilientSink{
+		name:        name,
+		sink:        sink,
+		size:        size,
+		policy:      policy,
+		minCooldown: sinkMinCooldown,
+		log:         log,
+		closing:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go s.deliverLoop()
+	return s
+}
+
+func (s *resilientSink) Write(l *management.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSinkClosed
+	}
+	if s.open && s.policy == dropUnhealthy {
+		s.dropped++
+		return nil
+	}
+	if len(s.queue) >= s.size {
+		if s.policy != dropOldest {
+			s.dropped++
+			return nil
+		}
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.dropped++
+	}
+	s.queue = append(s.queue, l)
+	s.cond.Signal()
+	return nil
+}
+
+// Close writes the buffered logs unless the sink is unhealthy and then closes the sink.
+func (s *resilientSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errSinkClosed
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	close(s.closing)
+	<-s.done
+	if s.dropped > 0 {
+		s.log.Warn().Msgf("output %s dropped %d logs", s.name, s.dropped)
+	}
+	return s.sink.Close()
+}
+
+// next waits for the next buffered log; false is returned once the sink is closed and there are no more logs.
+func (s *resilientSink) next() (*management.Log, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) == 0 && !s.closed {
+		s.cond.Wait()
+	}
+	if len(s.queue) == 0 {
+		return nil, false
+	}
+	l := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	return l, true
+}
+
+func (s *resilientSink) deliverLoop() {
+	defer close(s.done)
+	for {
+		l, ok := s.next()
+		if !ok {
+			return
+		}
+		s.deliver(l)
+	}
+}
+
+// deliver writes the log to the sink, retrying the write until the attempts are exhausted. While the circuit is open
+// the write waits for the sink to cool down.
+func (s *resilientSink) deliver(l *management.Log) {
+	for attempt := 1; ; attempt++ {
+		if wait := s.openFor(time.Now()); wait > 0 {
+			if !s.sleep(wait) {
+				// The remaining logs aren't written to an unhealthy sink when closing
+				s.drop()
+				return
+			}
+		}
+		err := s.sink.Write(l)
+		if err == nil {
+			s.success()
+			return
+		}
+		s.failure(err, time.Now())
+		if attempt >= sinkMaxAttempts {
+			s.drop()
+			return
+		}
+		if !s.sleep(time.Duration(attempt) * sinkRetryDelay) {
+			s.drop()
+			return
+		}
+	}
+}
+
+// sleep waits for the duration; false is returned if the sink is closed before.
+func (s *resilientSink) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.closing:
+		return false
+	}
+}
+
+// openFor returns the time left for the sink to cool down if the circuit is open.
+func (s *resilientSink) openFor(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.open {
+		return 0
+	}
+	return s.openUntil.Sub(now)
+}
+
+func (s *resilientSink) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped++
+}
+
+func (s *resilientSink) success() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open {
+		s.log.Info().Msgf("output %s recovered (%d logs dropped so far)", s.name, s.dropped)
+	}
+	s.open = false
+	s.failures = 0
+}
+
+func (s *resilientSink) failure(err error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures++
+	if s.open {
+		// The sink is still unhealthy after cooling down
+		s.cooldown *= 2
+		if s.cooldown > sinkMaxCooldown {
+			s.cooldown = sinkMaxCooldown
+		}
+		s.openUntil = now.Add(s.cooldown)
+		return
+	}
+	if s.failures >= sinkFailureThreshold {
+		s.open = true
+		s.cooldown = s.minCooldown
+		s.openUntil = now.Add(s.cooldown)
+		s.log.Warn().Err(err).Msgf("output %s is unhealthy after %d consecutive failures; retrying in %s", s.name, s.failures, s.cooldown)
+		return
+	}
+	s.log.Debug().Err(err).Msgf("unable to write log to output %s", s.name)
+}
@@ -0,0 +1,128 @@
+package tail
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// blockingSink blocks the writes until it is released
+type blockingSink struct {
+	recordingSink
+	release chan struct{}
+	once    sync.Once
+}
+
+func (s *blockingSink) Write(l *management.Log) error {
+	<-s.release
+	return s.recordingSink.Write(l)
+}
+
+func (s *blockingSink) unblock() {
+	s.once.Do(func() { close(s.release) })
+}
+
+// failingSink fails the writes while failing is set
+type failingSink struct {
+	recordingSink
+	failing atomic.Bool
+	writes  atomic.Int32
+}
+
+func (s *failingSink) Write(l *management.Log) error {
+	s.writes.Add(1)
+	if s.failing.Load() {
+		return errors.New("sink is down")
+	}
+	return s.recordingSink.Write(l)
+}
+
+func (s *resilientSink) isOpen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.open
+}
+
+func TestResilientSink_Write(t *testing.T) {
+	inner := &recordingSink{}
+	sink := newResilientSink("test", inner, 10, dropNewest, &noopLogger)
+	for _, message := range []string{"test1", "test2", "test3"} {
+		require.NoError(t, sink.Write(&management.Log{Message: message}))
+	}
+	require.NoError(t, sink.Close())
+	assert.Equal(t, []string{"test1", "test2", "test3"}, inner.messages())
+	assert.ErrorIs(t, sink.Write(&management.Log{}), errSinkClosed)
+}
+
+func TestResilientSink_DropPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy   dropPolicy
+		expected []string
+	}{
+		{policy: dropNewest, expected: []string{"test1", "test2", "test3"}},
+		{policy: dropOldest, expected: []string{"test1", "test4", "test5"}},
+	} {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			inner := &blockingSink{release: make(chan struct{})}
+			sink := newResilientSink("test", inner, 2, tt.policy, &noopLogger)
+			// The first log is being written while the other logs are buffered
+			require.NoError(t, sink.Write(&management.Log{Message: "test1"}))
+			require.Eventually(t, func() bool {
+				sink.mu.Lock()
+				defer sink.mu.Unlock()
+				return len(sink.queue) == 0
+			}, time.Second, time.Millisecond)
+			for _, message := range []string{"test2", "test3", "test4", "test5"} {
+				require.NoError(t, sink.Write(&management.Log{Message: message}))
+			}
+			inner.unblock()
+			require.NoError(t, sink.Close())
+			assert.Equal(t, tt.expected, inner.messages())
+			assert.Equal(t, uint64(2), sink.dropped)
+		})
+	}
+}
+
+func TestResilientSink_CircuitBreaker(t *testing.T) {
+	inner := &failingSink{}
+	inner.failing.Store(true)
+	sink := newResilientSink("test", inner, 100, dropUnhealthy, &noopLogger)
+	sink.mu.Lock()
+	sink.minCooldown = 50 * time.Millisecond
+	sink.mu.Unlock()
+
+	// Each log is attempted a few times before it is dropped, until the circuit opens
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sink.Write(&management.Log{Message: "failed"}))
+	}
+	require.Eventually(t, sink.isOpen, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int32(sinkFailureThreshold), inner.writes.Load())
+	// Logs are dropped while the circuit is open
+	require.NoError(t, sink.Write(&management.Log{Message: "dropped"}))
+
+	// The sink is written to again once it has cooled down and recovered
+	inner.failing.Store(false)
+	require.Eventually(t, func() bool { return !sink.isOpen() }, 5*time.Second, time.Millisecond)
+	require.NoError(t, sink.Write(&management.Log{Message: "recovered"}))
+	require.NoError(t, sink.Close())
+	assert.Equal(t, []string{"failed", "recovered"}, inner.messages())
+}
+
+func TestResilientSinkOptions(t *testing.T) {
+	size, policy, err := resilientSinkOptions(newTestContext(t))
+	require.NoError(t, err)
+	assert.Equal(t, 10000, size)
+	assert.Equal(t, dropNewest, policy)
+
+	_, _, err = resilientSinkOptions(newTestContext(t, "--sink-buffer", "0"))
+	assert.Error(t, err)
+	_, _, err = resilientSinkOptions(newTestContext(t, "--sink-drop-policy", "block"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,272 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// Multipliers of the units of the --rotate-size, in bytes
+var byteSizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+func rotateFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "rotate-path",
+			Usage:   "Path of the file that the logs are written to as newline delimited JSON when using --output file-rotate, with the rotated files named <path>.1 (the most recent) to <path>.<rotate-count>",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ROTATE_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    "rotate-size",
+			Usage:   "Size that the --rotate-path file is rotated at (e.g. 512KB, 100MB or 1GB), 0 to only rotate it every --rotate-interval",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ROTATE_SIZE"},
+			Value:   "100MB",
+		},
+		&cli.IntFlag{
+			Name:    "rotate-count",
+			Usage:   "Number of the rotated files that are kept, the oldest being removed",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ROTATE_COUNT"},
+			Value:   5,
+		},
+		&cli.DurationFlag{
+			Name:    "rotate-interval",
+			Usage:   "Also rotate the --rotate-path file once it has been written to for the interval (e.g. 24h), at the next log",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ROTATE_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "rotate-signal",
+			Usage:   "Shell command that is run after each rotation (e.g. systemctl reload rsyslog), with TUNNEL_ROTATED_FILE set to the path of the rotated file",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ROTATE_SIGNAL"},
+		},
+	}
+}
+
+// parseByteSize parses a size with an optional unit of B, KB, MB or GB (in multiples of 1024).
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	end := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(s)
+	}
+	number := s[:end]
+	multiplier, ok := byteSizeUnits[strings.ToUpper(strings.TrimSpace(s[end:]))]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid size %q, please provide a number of bytes with an optional unit of B, KB, MB or GB", s)
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size * multiplier, nil
+}
+
+// rotatingFileWriter writes to the file at the path, rotating it once it reaches the max size or has been written to
+// for the interval. The rotated files are renamed to path.1 to path.count, path.1 being the most recent, and the
+// oldest is removed. The rotations are checked before each write, so a write is never split across files.
+type rotatingFileWriter struct {
+	path     string
+	maxSize  int64
+	interval time.Duration
+	count    int
+	// Called with the path of the rotated file after each rotation
+	rotated func(path string)
+	now     func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func newRotatingFileWriter(path string, maxSize int64, interval time.Duration, count int, rotated func(string)) *rotatingFileWriter {
+	return &rotatingFileWriter{
+		path:     path,
+		maxSize:  maxSize,
+		interval: interval,
+		count:    count,
+		rotated:  rotated,
+		now:      time.Now,
+	}
+}
+
+// open opens the file to append to it, continuing from the size of the existing file.
+func (w *rotatingFileWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size, w.openedAt = f, info.Size(), w.now()
+	return nil
+}
+
+// shouldRotate returns true if writing the bytes would exceed the max size, or the interval passed since the file was
+// opened. The files that weren't written to aren't rotated.
+func (w *rotatingFileWriter) shouldRotate(n int) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.maxSize > 0 && w.size+int64(n) > w.maxSize {
+		return true
+	}
+	return w.interval > 0 && w.now().Sub(w.openedAt) >= w.interval
+}
+
+// rotate closes the file and shifts the rotated files, removing the oldest.
+func (w *rotatingFileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	if err := os.Remove(w.rotatedPath(w.count)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := w.count - 1; i >= 1; i-- {
+		if err := os.Rename(w.rotatedPath(i), w.rotatedPath(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(w.path, w.rotatedPath(1)); err != nil {
+		return err
+	}
+	if w.rotated != nil {
+		w.rotated(w.rotatedPath(1))
+	}
+	return nil
+}
+
+func (w *rotatingFileWriter) rotatedPath(i int) string {
+	return w.path + "." + strconv.Itoa(i)
+}
+
+func (w *rotatingFileWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, fmt.Errorf("unable to rotate %s: %w", w.path, err)
+		}
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingFileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotatingFileSink writes the logs as newline delimited JSON to the rotatingFileWriter. The --rotate-signal commands
+// still running are killed once the sink is closed.
+type rotatingFileSink struct {
+	writer *rotatingFileWriter
+	log    *zerolog.Logger
+	cancel context.CancelFunc
+}
+
+func newRotatingFileSink(c *cli.Context, log *zerolog.Logger) (*rotatingFileSink, error) {
+	path := expandedString(c, "rotate-path")
+	if path == "" {
+		return nil, errors.New("--rotate-path is required when using --output file-rotate")
+	}
+	maxSize, err := parseByteSize(c.String("rotate-size"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --rotate-size: %w", err)
+	}
+	interval := c.Duration("rotate-interval")
+	if interval < 0 {
+		return nil, errors.New("--rotate-interval must not be negative")
+	}
+	if maxSize == 0 && interval == 0 {
+		return nil, errors.New("--output file-rotate requires a --rotate-size or a --rotate-interval to rotate the file")
+	}
+	count := c.Int("rotate-count")
+	if count < 1 {
+		return nil, errors.New("--rotate-count must keep at least 1 rotated file")
+	}
+	ctx, cancel := context.WithCancel(c.Context)
+	var rotated func(string)
+	if command := c.String("rotate-signal"); command != "" {
+		rotated = func(path string) { runRotateSignal(ctx, command, path, log) }
+	}
+	writer := newRotatingFileWriter(path, maxSize, interval, count, rotated)
+	// The file is opened upfront so that an invalid path is reported before streaming
+	if err := writer.open(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &rotatingFileSink{writer: writer, log: log, cancel: cancel}, nil
+}
+
+func (s *rotatingFileSink) Write(l *management.Log) error {
+	printJSON(s.writer, l, s.log)
+	return nil
+}
+
+func (s *rotatingFileSink) Close() error {
+	defer s.cancel()
+	return s.writer.Close()
+}
+
+// rotateSignalCommand returns the shell command that is run after the file was rotated to the path, which is killed
+// once the context is cancelled.
+func rotateSignalCommand(ctx context.Context, command, path string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(safeEnvironment(os.Environ()), "TUNNEL_ROTATED_FILE="+path)
+	// The output of the command is kept apart from the logs written to stdout
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// runRotateSignal runs the --rotate-signal in the background so that the stream isn't held up.
+func runRotateSignal(ctx context.Context, command, path string, log *zerolog.Logger) {
+	cmd := rotateSignalCommand(ctx, command, path)
+	go func() {
+		if err := cmd.Run(); err != nil {
+			log.Err(err).Msg("unable to run the --rotate-signal")
+		}
+	}()
+}
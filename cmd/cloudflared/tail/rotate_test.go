@@ -0,0 +1,157 @@
+package tail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected int64
+	}{
+		{value: "0", expected: 0},
+		{value: "512", expected: 512},
+		{value: "10B", expected: 10},
+		{value: "512KB", expected: 512 << 10},
+		{value: "100MB", expected: 100 << 20},
+		{value: "100 mb", expected: 100 << 20},
+		{value: "1GB", expected: 1 << 30},
+	} {
+		size, err := parseByteSize(test.value)
+		require.NoError(t, err, test.value)
+		assert.Equal(t, test.expected, size, test.value)
+	}
+	for _, value := range []string{"", "MB", "1.5GB", "10TB", "-1MB", "99999999999GB"} {
+		_, err := parseByteSize(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRotatingFileWriter_Size(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.log")
+	var rotated []string
+	w := newRotatingFileWriter(path, 10, 0, 2, func(p string) { rotated = append(rotated, p) })
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := w.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	// Each write would have exceeded the size, so each line is in its own file and the oldest was removed
+	read := func(p string) string {
+		data, err := os.ReadFile(p)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "fourth\n", read(path))
+	assert.Equal(t, "third\n", read(path+".1"))
+	assert.Equal(t, "second\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3")
+	assert.Equal(t, []string{path + ".1", path + ".1", path + ".1"}, rotated)
+}
+
+func TestRotatingFileWriter_Interval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.log")
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := newRotatingFileWriter(path, 0, time.Hour, 5, nil)
+	w.now = func() time.Time { return now }
+	_, err := w.Write([]byte("first\n"))
+	require.NoError(t, err)
+	now = now.Add(30 * time.Minute)
+	_, err = w.Write([]byte("second\n"))
+	require.NoError(t, err)
+	assert.NoFileExists(t, path+".1")
+	now = now.Add(30 * time.Minute)
+	_, err = w.Write([]byte("third\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	data, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(data))
+}
+
+func TestRotatingFileWriter_ExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.log")
+	require.NoError(t, os.WriteFile(path, []byte("previous run\n"), 0o640))
+	w := newRotatingFileWriter(path, 20, 0, 1, nil)
+	// The size of the existing file counts towards the rotation
+	_, err := w.Write([]byte("next run\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	data, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "previous run\n", string(data))
+}
+
+func TestRotatingFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.log")
+	sink, err := newOutputSink(newTestContext(t, "--rotate-path", path, "--rotate-size", "1KB"), "file-rotate", nil, nil, &noopLogger)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(&management.Log{Message: "test1"}))
+	require.NoError(t, sink.Write(&management.Log{Message: "test2"}))
+	require.NoError(t, sink.Close())
+	assert.Equal(t, []string{"test1", "test2"}, readJSONMessages(t, path))
+}
+
+func TestNewRotatingFileSink_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.log")
+	for _, args := range [][]string{
+		{},
+		{"--rotate-path", path, "--rotate-size", "big"},
+		{"--rotate-path", path, "--rotate-size", "0"},
+		{"--rotate-path", path, "--rotate-count", "0"},
+		{"--rotate-path", path, "--rotate-interval", "-1h"},
+		{"--rotate-path", filepath.Join(path, "missing", "tail.log")},
+	} {
+		_, err := newRotatingFileSink(newTestContext(t, args...), &noopLogger)
+		assert.Error(t, err, strings.Join(args, " "))
+	}
+}
+
+func TestRotateSignalCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command is run by sh")
+	}
+	cmd := rotateSignalCommand(context.Background(), `printf %s "$TUNNEL_ROTATED_FILE"`, "/var/log/tail.log.1")
+	cmd.Stdout = nil
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "/var/log/tail.log.1", string(output))
+}
+
+func TestRotateSignalCommand_KilledOnCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command is run by sh")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := rotateSignalCommand(ctx, "sleep 60", "/var/log/tail.log.1")
+	require.NoError(t, cmd.Start())
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		// The command was killed rather than exiting by itself
+		assert.Error(t, err)
+		assert.False(t, cmd.ProcessState.Success())
+	case <-time.After(10 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("the --rotate-signal command wasn't killed once the context was cancelled")
+	}
+}
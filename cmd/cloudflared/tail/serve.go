@@ -0,0 +1,182 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Logs kept for the clients that connect after they were received, e.g. to scrub through a replay
+	serveHistorySize = 10000
+	// Logs buffered for each client before the logs are dropped for the slow client
+	serveClientBuffer = 1024
+	// Time to wait for the clients to disconnect when the sink is closed
+	serveShutdownTimeout = 5 * time.Second
+)
+
+func serveFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "serve",
+			Usage:   "Serve the logs as server-sent events at http://ADDR/events on top of --output, e.g. :8080",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SERVE"},
+		},
+	}
+}
+
+// broadcaster sends the events to all of the subscribers, keeping the most recent events for the new subscribers.
+type broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]struct{}
+	history     [][]byte
+	historySize int
+	closed      bool
+}
+
+func newBroadcaster(historySize int) *broadcaster {
+	return &broadcaster{subscribers: make(map[chan []byte]struct{}), historySize: historySize}
+}
+
+// publish sends the event to the subscribers. The event is dropped for the subscribers that aren't keeping up.
+func (b *broadcaster) publish(event []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	if len(b.history) == b.historySize {
+		b.history = b.history[1:]
+	}
+	b.history = append(b.history, event)
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// subscribe returns the channel of the events published from now on, the events published before, and the function
+// that unsubscribes. The channel is closed once the broadcaster is closed.
+func (b *broadcaster) subscribe() (<-chan []byte, [][]byte, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := make(chan []byte, serveClientBuffer)
+	if b.closed {
+		close(events)
+		return events, nil, func() {}
+	}
+	b.subscribers[events] = struct{}{}
+	history := append([][]byte(nil), b.history...)
+	return events, history, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[events]; ok {
+			delete(b.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// close closes the channels of all of the subscribers.
+func (b *broadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for events := range b.subscribers {
+		delete(b.subscribers, events)
+		close(events)
+	}
+}
+
+// serveSink serves the logs as server-sent events, one JSON encoded log per event.
+type serveSink struct {
+	broadcaster *broadcaster
+	server      *http.Server
+	addr        net.Addr
+	log         *zerolog.Logger
+}
+
+// newServeSink starts serving the logs on the address.
+func newServeSink(addr string, log *zerolog.Logger) (*serveSink, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serve the logs on %s: %w", addr, err)
+	}
+	s := &serveSink{
+		broadcaster: newBroadcaster(serveHistorySize),
+		addr:        listener.Addr(),
+		log:         log,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.handleEvents)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Err(err).Msg("unable to serve the logs")
+		}
+	}()
+	log.Info().Msgf("serving the logs at http://%s/events", s.addr)
+	return s, nil
+}
+
+func (s *serveSink) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	events, history, unsubscribe := s.broadcaster.subscribe()
+	defer unsubscribe()
+	for _, event := range history {
+		writeServerSentEvent(w, event)
+	}
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			writeServerSentEvent(w, event)
+			flusher.Flush()
+		}
+	}
+}
+
+// writeServerSentEvent writes the event as the data of a server-sent event. The JSON encoded logs don't contain
+// newlines, so the data is a single line.
+func writeServerSentEvent(w http.ResponseWriter, event []byte) {
+	_, _ = fmt.Fprintf(w, "data: %s\n\n", event)
+}
+
+func (s *serveSink) Write(l *management.Log) error {
+	event, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	s.broadcaster.publish(event)
+	return nil
+}
+
+// Close disconnects the clients and stops serving the logs.
+func (s *serveSink) Close() error {
+	s.broadcaster.close()
+	ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,68 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := newBroadcaster(2)
+	b.publish([]byte("1"))
+	b.publish([]byte("2"))
+	b.publish([]byte("3"))
+	events, history, unsubscribe := b.subscribe()
+	// Only the most recent events are kept for the new subscribers
+	assert.Equal(t, [][]byte{[]byte("2"), []byte("3")}, history)
+	b.publish([]byte("4"))
+	assert.Equal(t, []byte("4"), <-events)
+	unsubscribe()
+	_, ok := <-events
+	assert.False(t, ok)
+
+	events, _, _ = b.subscribe()
+	b.close()
+	_, ok = <-events
+	assert.False(t, ok)
+	// Subscribing once closed returns a closed channel
+	events, _, _ = b.subscribe()
+	_, ok = <-events
+	assert.False(t, ok)
+}
+
+func TestServeSink(t *testing.T) {
+	sink, err := newServeSink("127.0.0.1:0", &noopLogger)
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, sink.Write(&management.Log{Message: "before"}))
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, fmt.Sprintf("http://%s/events", sink.addr), nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The logs written before the client connected are sent first
+	lines := bufio.NewScanner(resp.Body)
+	require.True(t, lines.Scan())
+	assert.Equal(t, `data: {"message":"before"}`, lines.Text())
+	require.True(t, lines.Scan())
+	assert.Empty(t, lines.Text())
+
+	require.NoError(t, sink.Write(&management.Log{Message: "after"}))
+	require.True(t, lines.Scan())
+	assert.Contains(t, lines.Text(), `"message":"after"`)
+
+	// The clients are disconnected once the sink is closed
+	require.NoError(t, sink.Close())
+	for lines.Scan() {
+	}
+}
@@ -0,0 +1,85 @@
+package tail
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"nhooyr.io/websocket"
+)
+
+// Who ended the management session
+const (
+	closedByServer = "server"
+	closedByClient = "client"
+	closedByError  = "error"
+)
+
+// sessionEnd describes how and why the management session ended.
+type sessionEnd struct {
+	// Close code of the connection, if the connection was closed
+	Code     websocket.StatusCode `json:"code,omitempty"`
+	Reason   string               `json:"reason,omitempty"`
+	ClosedBy string               `json:"closed_by"`
+}
+
+// abnormal returns true if the session ended because of an error or an abnormal closure from the server.
+func (e *sessionEnd) abnormal() bool {
+	switch e.ClosedBy {
+	case closedByError:
+		return true
+	case closedByServer:
+		return e.Code != 0 && e.Code != websocket.StatusNormalClosure
+	default:
+		return false
+	}
+}
+
+func (e *sessionEnd) String() string {
+	msg := "management session closed by " + e.ClosedBy
+	if e.Code != 0 {
+		msg += fmt.Sprintf(" (%d)", e.Code)
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// sessionSummary is written to the --summary file when the session ends.
+type sessionSummary struct {
+	Close *sessionEnd `json:"close"`
+	// Included with --latency-stats
+	Latency *latencySummary `json:"latency,omitempty"`
+}
+
+// reportSessionEnd logs how the session ended. Normal closures are only logged at info level unless printReason is
+// set, in which case the close reason is always written to w. Abnormal closures are reported as errors.
+func reportSessionEnd(w io.Writer, end *sessionEnd, printReason bool, errs *errorReporter) {
+	if end == nil {
+		return
+	}
+	if printReason {
+		fmt.Fprintln(w, end.String())
+		return
+	}
+	if end.abnormal() {
+		code := codeStream
+		if end.Code != 0 {
+			code = int(end.Code)
+		}
+		errs.emit(cliError{Message: end.String(), Code: code, Recoverable: true})
+		return
+	}
+	errs.log.Info().Msg(end.String())
+}
+
+// writeSessionSummary writes the summary of the session to the file as JSON.
+func writeSessionSummary(path string, summary *sessionSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
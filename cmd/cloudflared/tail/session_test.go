@@ -0,0 +1,68 @@
+package tail
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+func TestReportSessionEnd(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		end         *sessionEnd
+		printReason bool
+		level       zerolog.Level
+		expected    string
+	}{
+		{
+			name:     "normal closure logged at info",
+			end:      &sessionEnd{Code: websocket.StatusNormalClosure, ClosedBy: closedByServer},
+			level:    zerolog.InfoLevel,
+			expected: `{"level":"info","message":"management session closed by server (1000)"}`,
+		},
+		{
+			name:  "normal closure hidden at warn",
+			end:   &sessionEnd{Code: websocket.StatusNormalClosure, ClosedBy: closedByServer},
+			level: zerolog.WarnLevel,
+		},
+		{
+			name:     "abnormal closure logged at error",
+			end:      &sessionEnd{Code: websocket.StatusPolicyViolation, Reason: "token expired", ClosedBy: closedByServer},
+			level:    zerolog.WarnLevel,
+			expected: `{"level":"error","message":"management session closed by server (1008): token expired"}`,
+		},
+		{
+			name:        "close reason printed",
+			end:         &sessionEnd{Code: websocket.StatusNormalClosure, Reason: "received interrupt", ClosedBy: closedByClient},
+			printReason: true,
+			level:       zerolog.ErrorLevel,
+			expected:    "management session closed by client (1000): received interrupt",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, logs bytes.Buffer
+			log := zerolog.New(&logs).Level(tt.level)
+			reportSessionEnd(&out, tt.end, tt.printReason, &errorReporter{log: &log})
+			assert.Equal(t, tt.expected, string(bytes.TrimSpace(append(out.Bytes(), logs.Bytes()...))))
+		})
+	}
+}
+
+func TestWriteSessionSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.json")
+	end := &sessionEnd{Code: websocket.StatusGoingAway, Reason: "tunnel stopped", ClosedBy: closedByServer}
+	require.NoError(t, writeSessionSummary(path, &sessionSummary{Close: end}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var summary sessionSummary
+	require.NoError(t, json.Unmarshal(data, &summary))
+	assert.Equal(t, end, summary.Close)
+}
@@ -0,0 +1,474 @@
+package tail
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-colorable"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+var (
+	errInvalidOutput = errors.New("invalid --output value provided, please make sure it is one of: default, text, json, ndjson, raw, file:PATH, file-rotate, kinesis, pubsub, kafka, splunk, datadog, nats, redis, vector, journald, cloudwatch, azure-monitor, fluentd, newrelic, mock")
+)
+
+// logSink is a destination for the logs received from the management connection.
+type logSink interface {
+	// Write outputs the log to the sink.
+	Write(log *management.Log) error
+	// Close flushes any buffered logs and releases the resources of the sink.
+	Close() error
+}
+
+// stdoutOutputs are the --output values written to stdout, of which only one can be requested.
+var stdoutOutputs = []string{"default", "text", "json", "ndjson", "raw"}
+
+// outputs returns the requested --output values, defaulting to the default output.
+func outputs(c *cli.Context) []string {
+	values := c.StringSlice("output")
+	if len(values) == 0 {
+		return []string{"default"}
+	}
+	return values
+}
+
+// newLogSink creates the sinks for each of the requested --output along with any additional --sink. Each of the
+// sinks is written to independently once there are multiple.
+func newLogSink(c *cli.Context, stdout io.Writer, skew *clockSkew, log *zerolog.Logger) (logSink, error) {
+	var sinks multiSink
+	names := outputs(c)
+	stdoutOutput := ""
+	for _, output := range names {
+		if !slices.Contains(stdoutOutputs, output) {
+			continue
+		}
+		if stdoutOutput != "" {
+			return nil, fmt.Errorf("--output %s and --output %s can't both be written to stdout", stdoutOutput, output)
+		}
+		stdoutOutput = output
+	}
+	if c.String("aggregate") != "" {
+		// The aggregate replaces the outputs
+		sink, err := newAggregateSink(c)
+		if err != nil {
+			return nil, err
+		}
+		sinks, names = multiSink{sink}, []string{"aggregate"}
+	} else {
+		if stdoutOutput == "" && (c.IsSet("output-file") || c.IsSet("split-by-level") || c.Bool("split-by-event")) {
+			return nil, errors.New("--output-file, --split-by-level and --split-by-event require the default or json --output")
+		}
+		for _, output := range names {
+			sink, err := newOutputSink(c, output, stdout, skew, log)
+			if err != nil {
+				_ = sinks.Close()
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		}
+	}
+	for _, v := range expandedStringSlice(c, "sink") {
+		sink, err := newAdditionalSink(c, v, log)
+		if err != nil {
+			_ = sinks.Close()
+			return nil, err
+		}
+		sinks, names = append(sinks, sink), append(names, v)
+	}
+	if addr := c.String("serve"); addr != "" {
+		sink, err := newServeSink(addr, log)
+		if err != nil {
+			_ = sinks.Close()
+			return nil, err
+		}
+		sinks, names = append(sinks, sink), append(names, "serve")
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return newFanoutSink(sinks, names, log), nil
+}
+
+// newOutputSink creates the sink for the --output value. The relative times of the text outputs are corrected by the
+// skew, if provided.
+func newOutputSink(c *cli.Context, output string, stdout io.Writer, skew *clockSkew, log *zerolog.Logger) (logSink, error) {
+	kind, target, _ := strings.Cut(output, ":")
+	switch kind {
+	case "kinesis":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newKinesisSink(c, log) })
+	case "pubsub":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newPubSubSink(c, log) })
+	case "kafka":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newKafkaSink(c, log) })
+	case "splunk":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newSplunkSink(c, log) })
+	case "datadog":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newDatadogSink(c, log) })
+	case "nats":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newNatsSink(c, log) })
+	case "redis":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newRedisSink(c) })
+	case "vector":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newVectorSink(c, log) })
+	case "cloudwatch":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newCloudwatchSink(c, log) })
+	case "azure-monitor":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newAzureMonitorSink(c, log) })
+	case "fluentd":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newFluentdSink(c, log) })
+	case "newrelic":
+		return newNetworkSink(c, output, log, func() (logSink, error) { return newNewRelicSink(c, log) })
+	case "journald":
+		// The journal is a local socket, so the logs aren't buffered like the network outputs
+		return newJournaldSink()
+	case "file":
+		if target == "" {
+			return nil, errors.New("--output file requires the path of the file, as file:PATH")
+		}
+		// The file is written as newline delimited JSON
+		return newFileSink("output", func(*management.Log) string { return target }, "json", lineFormat{}, log)
+	case "file-rotate":
+		return newRotatingFileSink(c, log)
+	case "mock":
+		return newMockSink(c, log)
+	}
+	switch output {
+	case "text":
+		output = "default"
+	case "ndjson":
+		output = "json"
+	}
+	format, err := newLineFormat(c)
+	if err != nil {
+		return nil, err
+	}
+	format.skew = skew
+	overwrite, err := overwriteFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	if c.IsSet("output-file") && c.IsSet("split-by-level") {
+		return nil, errors.New("--output-file and --split-by-level are mutually exclusive")
+	}
+	var files *fileSink
+	if path := expandedString(c, "split-by-level"); path != "" {
+		files, err = newLevelFileSink(path, output, format, log)
+	} else if c.Bool("split-by-event") {
+		files, err = newEventFileSink(expandedString(c, "output-file"), output, format, log)
+	} else if path := expandedString(c, "output-file"); path != "" {
+		files, err = newFileSink("output-file", func(*management.Log) string { return path }, output, format, log)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if files != nil {
+		files.overwrite = overwrite
+		return files, nil
+	}
+	f, isFile := stdout.(*os.File)
+	highlighter, err := newHighlighter(c, isFile && term.IsTerminal(int(f.Fd())))
+	if err != nil {
+		return nil, err
+	}
+	out := stdout
+	if isFile {
+		format.hyperlinks = hyperlinksEnabled(c, f)
+		if highlighter != nil {
+			// Allows the colors to be rendered on windows
+			out = colorable.NewColorable(f)
+		}
+	}
+	switch output {
+	case "default", "":
+		return &stdoutSink{out: out, smart: c.Bool("smart"), format: format, highlighter: highlighter, log: log}, nil
+	case "json":
+		return &stdoutSink{out: out, json: true, highlighter: highlighter, log: log}, nil
+	case "raw":
+		// The undecoded events are written to stdout by the streamer
+		return discardSink{}, nil
+	default:
+		return nil, errInvalidOutput
+	}
+}
+
+// newAdditionalSink creates a sink from a --sink value in the form of kind:target.
+func newAdditionalSink(c *cli.Context, value string, log *zerolog.Logger) (logSink, error) {
+	kind, target, _ := strings.Cut(value, ":")
+	switch kind {
+	case "webhook":
+		return newNetworkSink(c, kind, log, func() (logSink, error) { return newWebhookSink(c, target, log) })
+	case "otlp":
+		return newNetworkSink(c, kind, log, func() (logSink, error) { return newOTLPSink(c, target, log) })
+	default:
+		return nil, fmt.Errorf("invalid --sink value %q provided, please make sure it is one of: webhook:URL, otlp:ENDPOINT", value)
+	}
+}
+
+// newNetworkSink creates a sink that sends the logs over the network, buffering the logs and retrying the writes
+// so that an outage of the sink doesn't stall the stream.
+func newNetworkSink(c *cli.Context, name string, log *zerolog.Logger, create func() (logSink, error)) (logSink, error) {
+	size, policy, err := resilientSinkOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := create()
+	if err != nil {
+		return nil, err
+	}
+	return newResilientSink(name, sink, size, policy, log), nil
+}
+
+// sinkFlags are the flags that configure each of the outputs.
+func sinkFlags() []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "sink",
+			Usage:   "Additional destination for the logs on top of --output (webhook:URL, otlp:ENDPOINT)",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SINK"},
+		},
+	}
+	flags = append(flags, serveFlags()...)
+	flags = append(flags, highlightFlags()...)
+	flags = append(flags, hyperlinkFlags()...)
+	flags = append(flags, aggregateFlags()...)
+	flags = append(flags, resilienceFlags()...)
+	flags = append(flags, kinesisFlags()...)
+	flags = append(flags, pubsubFlags()...)
+	flags = append(flags, kafkaFlags()...)
+	flags = append(flags, splunkFlags()...)
+	flags = append(flags, datadogFlags()...)
+	flags = append(flags, natsFlags()...)
+	flags = append(flags, redisFlags()...)
+	flags = append(flags, vectorFlags()...)
+	flags = append(flags, cloudwatchFlags()...)
+	flags = append(flags, azureMonitorFlags()...)
+	flags = append(flags, fluentdFlags()...)
+	flags = append(flags, newRelicFlags()...)
+	flags = append(flags, rotateFlags()...)
+	flags = append(flags, mockFlags()...)
+	flags = append(flags, webhookFlags()...)
+	flags = append(flags, otlpFlags()...)
+	return flags
+}
+
+// tunnelKey identifies the tunnel of the log for outputs that keep the logs of a tunnel in order, preferring the
+// requested tunnel id and falling back to the connector that emitted the log.
+func tunnelKey(tunnelID string, l *management.Log) string {
+	if tunnelID != "" {
+		return tunnelID
+	}
+	if l.ConnectorID != "" {
+		return l.ConnectorID
+	}
+	return "cloudflared"
+}
+
+// stdoutSink prints the logs to stdout (or the provided output).
+type stdoutSink struct {
+	out         io.Writer
+	json        bool
+	smart       bool
+	format      lineFormat
+	highlighter *highlighter
+	log         *zerolog.Logger
+}
+
+func (s *stdoutSink) Write(l *management.Log) error {
+	if s.highlighter == nil {
+		s.print(s.out, l)
+		return nil
+	}
+	var buf bytes.Buffer
+	s.print(&buf, l)
+	line := buf.Bytes()
+	if !s.json {
+		line = s.highlighter.highlight(line)
+	} else if s.highlighter.match(line) >= 0 {
+		output, err := json.Marshal(&highlightedLog{Log: l, Highlighted: true})
+		if err != nil {
+			return err
+		}
+		line = append(output, '\n')
+	}
+	_, err := s.out.Write(line)
+	return err
+}
+
+func (s *stdoutSink) print(w io.Writer, l *management.Log) {
+	if s.json {
+		printJSON(w, l, s.log)
+	} else if s.smart {
+		printSmart(w, l, s.format, s.log)
+	} else {
+		printLine(w, l, s.format, s.log)
+	}
+}
+
+func (s *stdoutSink) Close() error {
+	return nil
+}
+
+// discardSink drops all of the logs.
+type discardSink struct{}
+
+func (discardSink) Write(*management.Log) error { return nil }
+
+func (discardSink) Close() error { return nil }
+
+// multiSink writes the logs to each of the sinks.
+type multiSink []logSink
+
+func (m multiSink) Write(l *management.Log) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(l); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Logs buffered for each of the sinks of a fan-out, so that a sink that is briefly slower doesn't hold up the others
+const fanoutBuffer = 1000
+
+// fanoutSink writes the logs to each of the sinks from a separate goroutine, so that the sinks are written to
+// independently. A sink that fails to write a log doesn't affect the other sinks; the error is logged with the name
+// of the sink instead.
+type fanoutSink struct {
+	sinks multiSink
+	logs  []chan *management.Log
+	wg    sync.WaitGroup
+}
+
+func newFanoutSink(sinks multiSink, names []string, log *zerolog.Logger) *fanoutSink {
+	s := &fanoutSink{sinks: sinks, logs: make([]chan *management.Log, len(sinks))}
+	for i, sink := range sinks {
+		logs := make(chan *management.Log, fanoutBuffer)
+		s.logs[i] = logs
+		s.wg.Add(1)
+		go func(sink logSink, name string) {
+			defer s.wg.Done()
+			for l := range logs {
+				if err := sink.Write(l); err != nil {
+					log.Err(err).Str("output", name).Msg("unable to write log to output")
+				}
+			}
+		}(sink, names[i])
+	}
+	return s
+}
+
+// Write queues the log for each of the sinks, waiting for a sink only once its buffer is full. The logs are shared
+// by the sinks, which must not modify them.
+func (s *fanoutSink) Write(l *management.Log) error {
+	for _, logs := range s.logs {
+		logs <- l
+	}
+	return nil
+}
+
+// Close waits for the queued logs to be written before closing each of the sinks.
+func (s *fanoutSink) Close() error {
+	for _, logs := range s.logs {
+		close(logs)
+	}
+	s.wg.Wait()
+	return s.sinks.Close()
+}
+
+// batchSink collects logs and sends them in batches once the batch is full or the flush interval elapses.
+type batchSink struct {
+	send     func(logs []*management.Log) error
+	size     int
+	interval time.Duration
+	log      *zerolog.Logger
+
+	mu    sync.Mutex
+	batch []*management.Log
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newBatchSink(size int, interval time.Duration, send func(logs []*management.Log) error, log *zerolog.Logger) *batchSink {
+	s := &batchSink{
+		send:     send,
+		size:     size,
+		interval: interval,
+		log:      log,
+		batch:    make([]*management.Log, 0, size),
+		done:     make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.flushLoop()
+	return s
+}
+
+func (s *batchSink) Write(l *management.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batch = append(s.batch, l)
+	if len(s.batch) >= s.size {
+		return s.flush()
+	}
+	return nil
+}
+
+// Close stops the periodic flushing and sends the remaining logs.
+func (s *batchSink) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flush()
+}
+
+func (s *batchSink) flushLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if err := s.flush(); err != nil {
+				s.log.Err(err).Msg("unable to send batch of logs")
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// flush sends the current batch; it must be called while holding the lock.
+func (s *batchSink) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	logs := s.batch
+	s.batch = make([]*management.Log, 0, s.size)
+	return s.send(logs)
+}
@@ -0,0 +1,120 @@
+package tail
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]*management.Log
+}
+
+func (r *batchRecorder) send(logs []*management.Log) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, logs)
+	return nil
+}
+
+func (r *batchRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.batches)
+}
+
+func TestBatchSink_FlushOnSize(t *testing.T) {
+	recorder := &batchRecorder{}
+	sink := newBatchSink(2, time.Hour, recorder.send, &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "1"}))
+	assert.Equal(t, 0, recorder.count())
+	require.NoError(t, sink.Write(&management.Log{Message: "2"}))
+	assert.Equal(t, 1, recorder.count())
+	require.NoError(t, sink.Write(&management.Log{Message: "3"}))
+	require.NoError(t, sink.Close())
+	require.Equal(t, 2, recorder.count())
+	assert.Len(t, recorder.batches[0], 2)
+	assert.Len(t, recorder.batches[1], 1)
+}
+
+func TestBatchSink_FlushOnInterval(t *testing.T) {
+	recorder := &batchRecorder{}
+	sink := newBatchSink(100, 10*time.Millisecond, recorder.send, &noopLogger)
+	defer sink.Close()
+	require.NoError(t, sink.Write(&management.Log{Message: "1"}))
+	assert.Eventually(t, func() bool { return recorder.count() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestTunnelKey(t *testing.T) {
+	assert.Equal(t, "cloudflared", tunnelKey("", &management.Log{}))
+	assert.Equal(t, "connector", tunnelKey("", &management.Log{ConnectorID: "connector"}))
+	assert.Equal(t, "tunnel", tunnelKey("tunnel", &management.Log{ConnectorID: "connector"}))
+}
+
+func TestNewLogSink_MultipleOutputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.ndjson")
+	var stdout bytes.Buffer
+	sink, err := newLogSink(newTestContext(t, "--output", "text", "--output", "file:"+path), &stdout, nil, &noopLogger)
+	require.NoError(t, err)
+	require.IsType(t, &fanoutSink{}, sink)
+	require.NoError(t, sink.Write(&management.Log{Time: testLogTime, Level: management.Info, Message: "test"}))
+	require.NoError(t, sink.Close())
+
+	assert.Contains(t, stdout.String(), "test")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"time":"2023-01-01T00:00:00Z","level":"info","message":"test"}`, strings.TrimSpace(string(data)))
+}
+
+func TestNewLogSink_InvalidOutputs(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "two outputs to stdout",
+			args: []string{"--output", "default", "--output", "json"},
+		},
+		{
+			name: "file without path",
+			args: []string{"--output", "file"},
+		},
+		{
+			name: "output file without an output to stdout",
+			args: []string{"--output", "file:tail.log", "--output-file", "tail.log"},
+		},
+		{
+			name: "unknown output",
+			args: []string{"--output", "default", "--output", "unknown"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newLogSink(newTestContext(t, test.args...), &bytes.Buffer{}, nil, &noopLogger)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFanoutSink(t *testing.T) {
+	first, second, failing := &recordingSink{}, &recordingSink{}, &failingSink{}
+	failing.failing.Store(true)
+	sink := newFanoutSink(multiSink{first, failing, second}, []string{"first", "failing", "second"}, &noopLogger)
+	for _, message := range []string{"1", "2", "3"} {
+		assert.NoError(t, sink.Write(&management.Log{Message: message}))
+	}
+	require.NoError(t, sink.Close())
+	// The failing sink doesn't affect the others
+	assert.Equal(t, []string{"1", "2", "3"}, first.messages())
+	assert.Equal(t, []string{"1", "2", "3"}, second.messages())
+	assert.Equal(t, int32(3), failing.writes.Load())
+}
@@ -0,0 +1,59 @@
+package tail
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Weight of each measurement in the moving average of the clock skew
+	skewWeight = 0.2
+	// Change of the clock skew that is logged again
+	skewReportThreshold = time.Second
+)
+
+// clockSkew estimates how far the local clock is ahead of the clock of the server, from the time the events were
+// sent by the server, as an exponentially weighted moving average. The estimate includes the latency of the events.
+type clockSkew struct {
+	// The estimate in nanoseconds, read by the sinks while it is updated by the reader
+	skew     atomic.Int64
+	measured atomic.Bool
+
+	// Only accessed by the reader
+	reported time.Duration
+	log      *zerolog.Logger
+}
+
+func newClockSkew(log *zerolog.Logger) *clockSkew {
+	return &clockSkew{log: log}
+}
+
+// observe updates the estimate with an event sent by the server at the time and received now. The events of the
+// servers that don't provide the time are ignored.
+func (s *clockSkew) observe(sent, now time.Time) {
+	if sent.IsZero() {
+		return
+	}
+	sample := now.Sub(sent)
+	skew := sample
+	if s.measured.Load() {
+		previous := time.Duration(s.skew.Load())
+		skew = previous + time.Duration(skewWeight*float64(sample-previous))
+	}
+	s.skew.Store(int64(skew))
+	first := !s.measured.Swap(true)
+	if first || (skew-s.reported).Abs() >= skewReportThreshold {
+		s.reported = skew
+		s.log.Debug().Msgf("clock skew with server: %s", skew.Round(time.Millisecond))
+	}
+}
+
+// offset returns the estimated skew, zero until the server provided the time of an event.
+func (s *clockSkew) offset() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(s.skew.Load())
+}
@@ -0,0 +1,42 @@
+package tail
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestClockSkew(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	skew := newClockSkew(&noopLogger)
+	assert.Zero(t, skew.offset())
+	// The events without the time of the server are ignored
+	skew.observe(time.Time{}, now)
+	assert.Zero(t, skew.offset())
+
+	// The first measurement is the estimate, which then moves towards the following measurements
+	skew.observe(now.Add(-10*time.Second), now)
+	assert.Equal(t, 10*time.Second, skew.offset())
+	skew.observe(now.Add(-20*time.Second), now)
+	assert.Equal(t, 12*time.Second, skew.offset())
+	skew.observe(now.Add(2*time.Second), now)
+	assert.Equal(t, 9200*time.Millisecond, skew.offset())
+
+	var unset *clockSkew
+	assert.Zero(t, unset.offset())
+}
+
+func TestLineFormat_FormatTimeSkew(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	skew := newClockSkew(&noopLogger)
+	// The clock of the server is a minute behind
+	skew.observe(now.Add(-time.Minute), now)
+	format := lineFormat{timeFormat: timeFormatRelative, skew: skew}
+	assert.Equal(t, "5s ago", format.formatTime(&management.Log{Time: "2023-01-01T11:58:55Z"}, now))
+	// The other formats provide the time of the server
+	format.timeFormat = timeFormatAbsolute
+	assert.Equal(t, "2023-01-01T11:58:55Z", format.formatTime(&management.Log{Time: "2023-01-01T11:58:55Z"}, now))
+}
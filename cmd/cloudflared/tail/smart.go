@@ -0,0 +1,143 @@
+package tail
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// logSchema recognizes the fields of a kind of log emitted by cloudflared and summarizes it.
+type logSchema struct {
+	event management.LogEventType
+	// Fields that must all be present in the log for the schema to match
+	fields  []string
+	summary func(l *management.Log) string
+}
+
+// Ordered from the most specific to the least specific schema of each event type
+var logSchemas = []logSchema{
+	{
+		// Registered tunnel connection (connection/observer.go)
+		event:  management.Cloudflared,
+		fields: []string{"connection", "connIndex", "location", "ip", "protocol"},
+		summary: func(l *management.Log) string {
+			return fmt.Sprintf("[conn %s] %s to %s (%s via %s)",
+				field(l, "connIndex"), l.Message, field(l, "location"), field(l, "ip"), field(l, "protocol"))
+		},
+	},
+	{
+		// Connection with the edge, e.g. unregistered or retrying (connection/control.go)
+		event:  management.Cloudflared,
+		fields: []string{"connIndex", "ip"},
+		summary: func(l *management.Log) string {
+			return fmt.Sprintf("[conn %s] %s (%s)", field(l, "connIndex"), l.Message, field(l, "ip"))
+		},
+	},
+	{
+		// Request from the eyeball (proxy/logger.go)
+		event:  management.HTTP,
+		fields: []string{"host", "path", "originService"},
+		summary: func(l *management.Log) string {
+			return fmt.Sprintf("%s%s -> %s", rayPrefix(l), l.Message, field(l, "originService"))
+		},
+	},
+	{
+		// Response from the origin (proxy/logger.go)
+		event:  management.HTTP,
+		fields: []string{"content-length", "originService"},
+		summary: func(l *management.Log) string {
+			return fmt.Sprintf("%s%s <- %s (%s bytes)", rayPrefix(l), l.Message, field(l, "originService"), field(l, "content-length"))
+		},
+	},
+	{
+		event:  management.HTTP,
+		fields: []string{"originService"},
+		summary: func(l *management.Log) string {
+			// Request errors are logged without a message
+			summary := strings.TrimSpace(rayPrefix(l) + l.Message)
+			if summary != "" {
+				summary += " "
+			}
+			return fmt.Sprintf("%s(%s)", summary, field(l, "originService"))
+		},
+	},
+	{
+		// Private network flow (proxy/logger.go)
+		event:  management.TCP,
+		fields: []string{"flowID", "destAddr"},
+		summary: func(l *management.Log) string {
+			return fmt.Sprintf("[flow %s] %s -> %s", field(l, "flowID"), l.Message, field(l, "destAddr"))
+		},
+	},
+	{
+		// UDP session over QUIC (datagramsession/manager.go, connection/quic.go)
+		event:  management.UDP,
+		fields: []string{"sessionID"},
+		summary: func(l *management.Log) string {
+			return fmt.Sprintf("[session %s] %s", field(l, "sessionID"), l.Message)
+		},
+	},
+}
+
+// matches returns true if the log is of the event type and has all of the fields of the schema.
+func (s *logSchema) matches(l *management.Log) bool {
+	if l.Event != s.event {
+		return false
+	}
+	for _, f := range s.fields {
+		if _, ok := l.Fields[f]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// field returns the value of the field formatted for the summary.
+func field(l *management.Log, name string) string {
+	v := l.Fields[name]
+	if v == nil {
+		return ""
+	}
+	return management.FormatField(v)
+}
+
+func rayPrefix(l *management.Log) string {
+	if ray := field(l, "cfRay"); ray != "" {
+		return fmt.Sprintf("[ray %s] ", ray)
+	}
+	return ""
+}
+
+// printSmart prints a concise summary of the log if its fields match one of the known schemas, otherwise the log is
+// printed as with printLine.
+func printSmart(w io.Writer, log *management.Log, format lineFormat, logger *zerolog.Logger) {
+	for i := range logSchemas {
+		schema := &logSchemas[i]
+		if !schema.matches(log) {
+			continue
+		}
+		var b strings.Builder
+		b.WriteString(format.formatTime(log, time.Now()))
+		b.WriteByte(' ')
+		if format.showConnector {
+			b.WriteString(log.ConnectorID)
+			b.WriteByte(' ')
+		}
+		summary := schema.summary(log)
+		if format.hyperlinks {
+			summary = linkURLs(summary)
+		}
+		fmt.Fprintf(&b, "%s %s %s", log.Level, log.Event, summary)
+		if err := field(log, "error"); err != "" {
+			fmt.Fprintf(&b, " error=%q", err)
+		}
+		fmt.Fprintln(w, b.String())
+		return
+	}
+	printLine(w, log, format, logger)
+}
@@ -0,0 +1,94 @@
+package tail
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestPrintSmart(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		log      management.Log
+		expected string
+	}{
+		{
+			name: "registered connection",
+			log: management.Log{
+				Time:    "2023-01-01T00:00:00Z",
+				Level:   management.Info,
+				Event:   management.Cloudflared,
+				Message: "Registered tunnel connection",
+				Fields: map[string]interface{}{
+					"connection": "a1b2", "connIndex": float64(1), "location": "lax01", "ip": "198.41.200.13", "protocol": "quic",
+				},
+			},
+			expected: "2023-01-01T00:00:00Z info cloudflared [conn 1] Registered tunnel connection to lax01 (198.41.200.13 via quic)\n",
+		},
+		{
+			name: "http request",
+			log: management.Log{
+				Time:    "2023-01-01T00:00:00Z",
+				Level:   management.Debug,
+				Event:   management.HTTP,
+				Message: "GET https://example.com/ HTTP/1.1",
+				Fields: map[string]interface{}{
+					"cfRay": "7f1a-LAX", "host": "example.com", "path": "/", "originService": "http://localhost:8080", "ingressRule": float64(0),
+				},
+			},
+			expected: "2023-01-01T00:00:00Z debug http [ray 7f1a-LAX] GET https://example.com/ HTTP/1.1 -> http://localhost:8080\n",
+		},
+		{
+			name: "http response",
+			log: management.Log{
+				Time:    "2023-01-01T00:00:00Z",
+				Level:   management.Debug,
+				Event:   management.HTTP,
+				Message: "200 OK",
+				Fields:  map[string]interface{}{"content-length": float64(1024), "originService": "http://localhost:8080"},
+			},
+			expected: "2023-01-01T00:00:00Z debug http 200 OK <- http://localhost:8080 (1024 bytes)\n",
+		},
+		{
+			name: "http error",
+			log: management.Log{
+				Time:   "2023-01-01T00:00:00Z",
+				Level:  management.Error,
+				Event:  management.HTTP,
+				Fields: map[string]interface{}{"originService": "http://localhost:8080", "error": "connection refused"},
+			},
+			expected: "2023-01-01T00:00:00Z error http (http://localhost:8080) error=\"connection refused\"\n",
+		},
+		{
+			name: "udp session",
+			log: management.Log{
+				Time:    "2023-01-01T00:00:00Z",
+				Level:   management.Debug,
+				Event:   management.UDP,
+				Message: "Session terminated",
+				Fields:  map[string]interface{}{"sessionID": "c3d4"},
+			},
+			expected: "2023-01-01T00:00:00Z debug udp [session c3d4] Session terminated\n",
+		},
+		{
+			name: "unknown schema",
+			log: management.Log{
+				Time:    "2023-01-01T00:00:00Z",
+				Level:   management.Info,
+				Event:   management.Cloudflared,
+				Message: "Starting tunnel",
+				Fields:  map[string]interface{}{"tunnelID": "e5f6"},
+			},
+			expected: "2023-01-01T00:00:00Z info cloudflared Starting tunnel {\"tunnelID\":\"e5f6\"}\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			printSmart(&out, &test.log, lineFormat{}, &noopLogger)
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	splunkMaxAttempts = 5
+	splunkBaseBackoff = 500 * time.Millisecond
+	splunkMaxBackoff  = 30 * time.Second
+)
+
+func splunkFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "splunk-url",
+			Usage:   "URL of the Splunk HTTP Event Collector when using --output splunk, e.g. https://splunk:8088/services/collector",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SPLUNK_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "splunk-token",
+			Usage:   "Token of the Splunk HTTP Event Collector when using --output splunk",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SPLUNK_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "splunk-index",
+			Usage:   "Splunk index of the logs when using --output splunk",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SPLUNK_INDEX"},
+			Value:   "main",
+		},
+		&cli.StringFlag{
+			Name:    "splunk-sourcetype",
+			Usage:   "Splunk sourcetype of the logs when using --output splunk",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SPLUNK_SOURCETYPE"},
+			Value:   "cloudflared",
+		},
+		&cli.IntFlag{
+			Name:    "splunk-batch-size",
+			Usage:   "Maximum number of logs sent to Splunk in each request",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SPLUNK_BATCH_SIZE"},
+			Value:   100,
+		},
+		&cli.DurationFlag{
+			Name:    "splunk-flush-interval",
+			Usage:   "Send the logs to Splunk after this much time has passed, even if the batch isn't full",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SPLUNK_FLUSH_INTERVAL"},
+			Value:   time.Second,
+		},
+		&cli.BoolFlag{
+			Name:    "splunk-skip-verify",
+			Usage:   "Don't verify the TLS certificate of the Splunk HTTP Event Collector",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SPLUNK_SKIP_VERIFY"},
+		},
+	}
+}
+
+// splunkEvent is a log in the JSON format of the Splunk HTTP Event Collector.
+type splunkEvent struct {
+	// Seconds since the epoch, with the fraction of the second
+	Time       float64         `json:"time,omitempty"`
+	Event      *management.Log `json:"event"`
+	SourceType string          `json:"sourcetype,omitempty"`
+	Index      string          `json:"index,omitempty"`
+}
+
+// splunkSink POSTs the logs to the Splunk HTTP Event Collector in batches.
+type splunkSink struct {
+	*batchSink
+	url        string
+	token      string
+	index      string
+	sourceType string
+	client     *http.Client
+	log        *zerolog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newSplunkSink(c *cli.Context, log *zerolog.Logger) (*splunkSink, error) {
+	rawURL := expandedString(c, "splunk-url")
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid --splunk-url %q, please provide the http(s) url of the HTTP Event Collector", rawURL)
+	}
+	token := c.String("splunk-token")
+	if token == "" {
+		return nil, errors.New("--splunk-token is required when using --output splunk")
+	}
+	size := c.Int("splunk-batch-size")
+	if size <= 0 {
+		return nil, errors.New("--splunk-batch-size must be greater than 0")
+	}
+	interval := c.Duration("splunk-flush-interval")
+	if interval <= 0 {
+		return nil, errors.New("--splunk-flush-interval must be greater than 0")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Bool("splunk-skip-verify") {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	return newSplunkSinkWithClient(u.String(), token, c.String("splunk-index"), c.String("splunk-sourcetype"), size, interval, client, log), nil
+}
+
+func newSplunkSinkWithClient(
+	url, token, index, sourceType string,
+	size int,
+	interval time.Duration,
+	client *http.Client,
+	log *zerolog.Logger,
+) *splunkSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &splunkSink{
+		url:        url,
+		token:      token,
+		index:      index,
+		sourceType: sourceType,
+		client:     client,
+		log:        log,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	s.batchSink = newBatchSink(size, interval, s.send, log)
+	return s
+}
+
+// Close sends the remaining logs.
+func (s *splunkSink) Close() error {
+	defer s.cancel()
+	return s.batchSink.Close()
+}
+
+// encode encodes the logs as the concatenated events of a request to the HTTP Event Collector.
+func (s *splunkSink) encode(logs []*management.Log) []byte {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, l := range logs {
+		event := splunkEvent{Event: l, SourceType: s.sourceType, Index: s.index}
+		if t, err := time.Parse(time.RFC3339Nano, l.Time); err == nil {
+			event.Time = float64(t.UnixNano()) / float64(time.Second)
+		}
+		if err := enc.Encode(event); err != nil {
+			s.log.Debug().Msgf("unable to parse event to json %+v", l)
+		}
+	}
+	return body.Bytes()
+}
+
+// send POSTs the logs to the HTTP Event Collector, retrying with an exponential backoff when the request fails or the
+// collector responds with a retryable status. The logs are dropped once the attempts are exhausted.
+func (s *splunkSink) send(logs []*management.Log) error {
+	body := s.encode(logs)
+	if len(body) == 0 {
+		return nil
+	}
+	backoff := splunkBaseBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.post(body)
+		if err == nil {
+			return nil
+		}
+		var permanent *splunkPermanentError
+		if errors.As(err, &permanent) || attempt >= splunkMaxAttempts {
+			return fmt.Errorf("dropped %d logs: %w", len(logs), err)
+		}
+		s.log.Debug().Err(err).Msgf("retrying splunk delivery in %s", backoff)
+		select {
+		case <-s.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, splunkMaxBackoff)
+	}
+}
+
+// splunkPermanentError is returned when the collector rejects the request and retrying won't help, e.g. an invalid
+// token or index.
+type splunkPermanentError struct {
+	status int
+	body   []byte
+}
+
+func (e *splunkPermanentError) Error() string {
+	return fmt.Sprintf("splunk returned http status %d: %s", e.status, e.body)
+}
+
+func (s *splunkSink) post(body []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("splunk returned http status %d: %s", resp.StatusCode, respBody)
+	default:
+		return &splunkPermanentError{status: resp.StatusCode, body: respBody}
+	}
+}
@@ -0,0 +1,123 @@
+package tail
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestNewSplunkSink(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		args      []string
+		expectErr bool
+	}{
+		{
+			name: "url and token",
+			args: []string{"--splunk-url", "https://splunk:8088/services/collector", "--splunk-token", "token"},
+		},
+		{
+			name: "skip verify",
+			args: []string{"--splunk-url", "https://splunk:8088/services/collector", "--splunk-token", "token", "--splunk-skip-verify"},
+		},
+		{
+			name:      "missing url",
+			args:      []string{"--splunk-token", "token"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid url",
+			args:      []string{"--splunk-url", "splunk:8088", "--splunk-token", "token"},
+			expectErr: true,
+		},
+		{
+			name:      "missing token",
+			args:      []string{"--splunk-url", "https://splunk:8088/services/collector"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid batch size",
+			args:      []string{"--splunk-url", "https://splunk:8088/services/collector", "--splunk-token", "token", "--splunk-batch-size", "0"},
+			expectErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink, err := newSplunkSink(newTestContext(t, test.args...), &noopLogger)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, sink.Close())
+		})
+	}
+}
+
+func TestSplunkSink_Events(t *testing.T) {
+	events := make(chan []splunkEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Splunk token", r.Header.Get("Authorization"))
+		var batch []splunkEvent
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var event splunkEvent
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+			batch = append(batch, event)
+		}
+		events <- batch
+	}))
+	defer server.Close()
+
+	sink := newSplunkSinkWithClient(server.URL, "token", "main", "cloudflared", 2, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Time: "2023-03-01T10:00:00.5Z", Message: "first"}))
+	require.NoError(t, sink.Write(&management.Log{Message: "second"}))
+
+	batch := <-events
+	require.Len(t, batch, 2)
+	assert.Equal(t, float64(1677664800.5), batch[0].Time)
+	assert.Equal(t, "first", batch[0].Event.Message)
+	assert.Equal(t, "cloudflared", batch[0].SourceType)
+	assert.Equal(t, "main", batch[0].Index)
+	// The time is omitted for the collector to use the time it received the log
+	assert.Zero(t, batch[1].Time)
+	assert.Equal(t, "second", batch[1].Event.Message)
+	require.NoError(t, sink.Close())
+}
+
+func TestSplunkSink_Retry(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	sink := newSplunkSinkWithClient(server.URL, "token", "main", "cloudflared", 100, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test"}))
+	require.NoError(t, sink.Close())
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestSplunkSink_NoRetryOnClientError(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	sink := newSplunkSinkWithClient(server.URL, "token", "main", "cloudflared", 100, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test"}))
+	assert.ErrorContains(t, sink.Close(), "dropped 1 logs")
+	assert.Equal(t, int32(1), attempts.Load())
+}
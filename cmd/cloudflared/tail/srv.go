@@ -0,0 +1,47 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// lookupSRVFunc looks up the SRV records of the name, as implemented by net.DefaultResolver.LookupSRV.
+type lookupSRVFunc func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+// resolveSRV returns the host:port of the target of the SRV record of the name with the highest priority.
+func resolveSRV(ctx context.Context, lookup lookupSRVFunc, name string) (string, error) {
+	// The name is looked up as provided, e.g. _cloudflared-mgmt._tcp.example.com
+	_, records, err := lookup(ctx, "", "", name)
+	if err != nil {
+		return "", err
+	}
+	// The records are sorted by priority and randomized by weight
+	if len(records) == 0 {
+		return "", errors.New("no SRV records found")
+	}
+	target := strings.TrimSuffix(records[0].Target, ".")
+	return net.JoinHostPort(target, strconv.Itoa(int(records[0].Port))), nil
+}
+
+// srvDialer returns the dialFunc that discovers the host:port of the management service from the SRV record of the
+// management hostname before each dial, so that the changes of the record are used by the following connections.
+// The management hostname is dialed as a plain hostname if the SRV lookup fails.
+func srvDialer(dial dialFunc, lookup lookupSRVFunc, log *zerolog.Logger) dialFunc {
+	return func(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (managementConn, error) {
+		hostport, err := resolveSRV(ctx, lookup, u.Hostname())
+		if err != nil {
+			log.Debug().Err(err).Msgf("unable to look up the SRV record of %s, connecting to it as a hostname", u.Hostname())
+			return dial(ctx, u, header, subprotocols)
+		}
+		log.Debug().Msgf("discovered management service %s from the SRV record of %s", hostport, u.Hostname())
+		u.Host = hostport
+		return dial(ctx, u, header, subprotocols)
+	}
+}
@@ -0,0 +1,53 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSRVDialer(t *testing.T) {
+	var lookups []string
+	records := []*net.SRV{{Target: "mgmt1.example.com.", Port: 8443}}
+	lookup := func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		lookups = append(lookups, name)
+		if name == "management.example.com" {
+			return "", nil, errors.New("no such host")
+		}
+		return "", records, nil
+	}
+	var dialed []string
+	dial := func(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (managementConn, error) {
+		dialed = append(dialed, u.Host)
+		return nil, nil
+	}
+	srvDial := srvDialer(dial, lookup, &noopLogger)
+
+	u := url.URL{Scheme: "wss", Host: "_cloudflared-mgmt._tcp.example.com", Path: "/logs"}
+	_, err := srvDial(context.Background(), u, http.Header{}, nil)
+	require.NoError(t, err)
+	// The record is looked up again for each connection
+	records = []*net.SRV{{Target: "mgmt2.example.com.", Port: 443}}
+	_, err = srvDial(context.Background(), u, http.Header{}, nil)
+	require.NoError(t, err)
+	// The name is dialed as a hostname when the lookup fails
+	_, err = srvDial(context.Background(), url.URL{Scheme: "wss", Host: "management.example.com", Path: "/logs"}, http.Header{}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"_cloudflared-mgmt._tcp.example.com", "_cloudflared-mgmt._tcp.example.com", "management.example.com"}, lookups)
+	assert.Equal(t, []string{"mgmt1.example.com:8443", "mgmt2.example.com:443", "management.example.com"}, dialed)
+}
+
+func TestResolveSRV_NoRecords(t *testing.T) {
+	lookup := func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, nil
+	}
+	_, err := resolveSRV(context.Background(), lookup, "_cloudflared-mgmt._tcp.example.com")
+	assert.Error(t, err)
+}
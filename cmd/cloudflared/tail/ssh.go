@@ -0,0 +1,142 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	sshDefaultPort = "22"
+	sshDialTimeout = 30 * time.Second
+)
+
+func sshFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "ssh-bastion",
+			Usage:   "Connect to the management service through the SSH bastion host (user@host[:port]), for when the management service isn't reachable directly",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SSH_BASTION"},
+		},
+		&cli.StringFlag{
+			Name:    "ssh-key",
+			Usage:   "Private key file that authenticates with the --ssh-bastion",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SSH_KEY"},
+		},
+		&cli.BoolFlag{
+			Name:    "ssh-insecure",
+			Usage:   "Don't verify the host key of the --ssh-bastion against ~/.ssh/known_hosts",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SSH_INSECURE"},
+		},
+	}
+}
+
+// netDialFunc opens the network connections to the management service, like net.Dialer.DialContext.
+type netDialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// parseBastion returns the user and the address of the --ssh-bastion, on the default SSH port if it has none.
+func parseBastion(bastion string) (string, string, error) {
+	user, host, ok := strings.Cut(bastion, "@")
+	if !ok || user == "" || host == "" {
+		return "", "", fmt.Errorf("invalid --ssh-bastion %q, please provide it as user@host[:port]", bastion)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), sshDefaultPort)
+	}
+	return user, host, nil
+}
+
+// sshHostKeyCallback verifies the host keys against the known hosts file, unless --ssh-insecure is set.
+func sshHostKeyCallback(c *cli.Context, knownHostsPath string, log *zerolog.Logger) (ssh.HostKeyCallback, error) {
+	if c.Bool("ssh-insecure") {
+		log.Warn().Msg("the host key of the --ssh-bastion isn't verified with --ssh-insecure")
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the known hosts to verify the --ssh-bastion, use --ssh-insecure to skip the verification: %w", err)
+	}
+	return callback, nil
+}
+
+// sshClientConfig creates the config that authenticates with the --ssh-key to the user of the bastion.
+func sshClientConfig(c *cli.Context, user, knownHostsPath string, log *zerolog.Logger) (*ssh.ClientConfig, error) {
+	keyPath := expandedString(c, "ssh-key")
+	if keyPath == "" {
+		return nil, errors.New("--ssh-key is required to authenticate with the --ssh-bastion")
+	}
+	keyPath, err := homedir.Expand(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the --ssh-key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		var missingPassphrase *ssh.PassphraseMissingError
+		if errors.As(err, &missingPassphrase) {
+			return nil, errors.New("the --ssh-key is protected by a passphrase, please provide a key without one")
+		}
+		return nil, fmt.Errorf("unable to parse the --ssh-key: %w", err)
+	}
+	hostKeyCallback, err := sshHostKeyCallback(c, knownHostsPath, log)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}, nil
+}
+
+// dialSSHBastion connects to the --ssh-bastion, or returns nil if none is provided. The connections to the
+// management service are then forwarded by the bastion with the DialContext of the client.
+func dialSSHBastion(ctx context.Context, c *cli.Context, log *zerolog.Logger) (*ssh.Client, error) {
+	bastion := c.String("ssh-bastion")
+	if bastion == "" {
+		return nil, nil
+	}
+	user, addr, err := parseBastion(bastion)
+	if err != nil {
+		return nil, err
+	}
+	home, err := homedir.Dir()
+	if err != nil && !c.Bool("ssh-insecure") {
+		return nil, fmt.Errorf("unable to find the known hosts to verify the --ssh-bastion: %w", err)
+	}
+	config, err := sshClientConfig(c, user, filepath.Join(home, ".ssh", "known_hosts"), log)
+	if err != nil {
+		return nil, err
+	}
+	return dialSSH(ctx, addr, config)
+}
+
+// dialSSH connects to the SSH server with the config, until the context is done.
+func dialSSH(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
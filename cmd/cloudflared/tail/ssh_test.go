@@ -0,0 +1,192 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestParseBastion(t *testing.T) {
+	for _, test := range []struct {
+		bastion string
+		user    string
+		addr    string
+		invalid bool
+	}{
+		{bastion: "admin@bastion.example.com", user: "admin", addr: "bastion.example.com:22"},
+		{bastion: "admin@bastion.example.com:2222", user: "admin", addr: "bastion.example.com:2222"},
+		{bastion: "admin@[2001:db8::1]:2222", user: "admin", addr: "[2001:db8::1]:2222"},
+		{bastion: "admin@2001:db8::1", user: "admin", addr: "[2001:db8::1]:22"},
+		{bastion: "bastion.example.com", invalid: true},
+		{bastion: "@bastion.example.com", invalid: true},
+		{bastion: "admin@", invalid: true},
+	} {
+		user, addr, err := parseBastion(test.bastion)
+		if test.invalid {
+			assert.Error(t, err, test.bastion)
+			continue
+		}
+		require.NoError(t, err, test.bastion)
+		assert.Equal(t, test.user, user)
+		assert.Equal(t, test.addr, addr)
+	}
+}
+
+// startSSHServer starts an SSH server that authenticates the client key and forwards the direct-tcpip channels, and
+// returns its address and its host key.
+func startSSHServer(t *testing.T, clientKey ssh.PublicKey) (string, ssh.PublicKey) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "admin" && bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+	return listener.Addr().String(), hostKey.PublicKey()
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if newChannel.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+		forwarded, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+		if err != nil {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			forwarded.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			defer forwarded.Close()
+			go io.Copy(forwarded, channel)
+			_, _ = io.Copy(channel, forwarded)
+		}()
+	}
+}
+
+// writeSSHKey writes a new private key to a file, returning its path and its public key.
+func writeSSHKey(t *testing.T) (string, ssh.PublicKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return path, sshPub
+}
+
+func writeKnownHosts(t *testing.T, addr string, key ssh.PublicKey) string {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)
+	require.NoError(t, os.WriteFile(path, []byte(line+"\n"), 0o600))
+	return path
+}
+
+func TestSSHBastion_Forward(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "forwarded")
+	}))
+	defer origin.Close()
+	keyPath, clientKey := writeSSHKey(t)
+	addr, hostKey := startSSHServer(t, clientKey)
+
+	config, err := sshClientConfig(newTestContext(t, "--ssh-key", keyPath), "admin", writeKnownHosts(t, addr, hostKey), &noopLogger)
+	require.NoError(t, err)
+	client, err := dialSSH(context.Background(), addr, config)
+	require.NoError(t, err)
+	defer client.Close()
+
+	// The requests to the management service are forwarded by the bastion
+	resp, err := managementClient("", nil, client.DialContext).Get(origin.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "forwarded", string(body))
+}
+
+func TestSSHBastion_HostKey(t *testing.T) {
+	keyPath, clientKey := writeSSHKey(t)
+	addr, _ := startSSHServer(t, clientKey)
+	// The known host key is of another host
+	_, otherKey := writeSSHKey(t)
+	knownHosts := writeKnownHosts(t, addr, otherKey)
+
+	config, err := sshClientConfig(newTestContext(t, "--ssh-key", keyPath), "admin", knownHosts, &noopLogger)
+	require.NoError(t, err)
+	_, err = dialSSH(context.Background(), addr, config)
+	var keyErr *knownhosts.KeyError
+	assert.ErrorAs(t, err, &keyErr)
+
+	// The host key isn't verified with --ssh-insecure
+	config, err = sshClientConfig(newTestContext(t, "--ssh-key", keyPath, "--ssh-insecure"), "admin", knownHosts, &noopLogger)
+	require.NoError(t, err)
+	client, err := dialSSH(context.Background(), addr, config)
+	require.NoError(t, err)
+	client.Close()
+}
+
+func TestSSHClientConfig_Invalid(t *testing.T) {
+	_, err := sshClientConfig(newTestContext(t), "admin", "", &noopLogger)
+	assert.ErrorContains(t, err, "--ssh-key is required")
+	_, err = sshClientConfig(newTestContext(t, "--ssh-key", filepath.Join(t.TempDir(), "missing")), "admin", "", &noopLogger)
+	assert.ErrorContains(t, err, "unable to read the --ssh-key")
+	keyPath, _ := writeSSHKey(t)
+	_, err = sshClientConfig(newTestContext(t, "--ssh-key", keyPath), "admin", filepath.Join(t.TempDir(), "missing"), &noopLogger)
+	assert.ErrorContains(t, err, "--ssh-insecure")
+}
@@ -0,0 +1,373 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	// Time to wait for the server to acknowledge the closure of the connection when shutting down
+	closeTimeout = time.Second
+	// Logs read from the connection that are waiting to be written to the sink
+	streamBufferSize = 1024
+	// Attempts to write a client event to the connection before the transient write errors are returned
+	writeAttempts   = 3
+	writeRetryDelay = 100 * time.Millisecond
+)
+
+// logStreamer reads the log events from the management connection and writes them to the sink.
+type logStreamer struct {
+	conn       managementConn
+	sink       logSink
+	processors []logProcessor
+	// When provided, the undecoded server events are written to raw, one per line
+	raw io.Writer
+	// Time to wait for the buffered logs to be written to the sink when shutting down
+	drainTimeout time.Duration
+	// How often the stats of the stream are logged, if set
+	statsInterval time.Duration
+	// Consecutive events that can't be read that are skipped before the stream ends, if set
+	maxReadErrors int
+	// When provided, the nonstandard levels of the logs are normalized when the events are decoded
+	levels *levelNormalizer
+	// When provided, the commands received update the filters and are acknowledged to console. The commands are read
+	// by the caller so that they outlive the session.
+	commands    <-chan string
+	interactive *interactiveFilters
+	console     io.Writer
+	// When provided, the config is reloaded once a signal is received. The signals are received by the caller so that
+	// they outlive the session.
+	reloads  <-chan os.Signal
+	reloader *configReloader
+	// When provided, the session ends once a connection is received, which is replaced as renewed
+	renewals <-chan managementConn
+	renewed  managementConn
+	// When provided, the logs received again after a reconnect are skipped
+	dedup *deduplicator
+	// When provided, the clock skew with the server is estimated from the logs events
+	skew *clockSkew
+	log  *zerolog.Logger
+
+	// Logs received from the server and the events the server reported as dropped
+	received      atomic.Uint64
+	serverDropped atomic.Uint64
+	// Batches of logs that the server reported the size and latency of, and their totals
+	batches      atomic.Uint64
+	batchedLogs  atomic.Uint64
+	batchLatency atomic.Int64
+
+	// The last client event acknowledged by the server, only accessed by the reader
+	lastAck uint64
+}
+
+// run streams the logs until the context is cancelled, a signal is received, the connection is closed, or a renewed
+// connection is received, which is kept in renewed for the following session. All of the
+// goroutines started by run share a single context and have exited once run returns. How the session ended is
+// returned.
+func (s *logStreamer) run(ctx context.Context, signals <-chan os.Signal) *sessionEnd {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	logs := make(chan *management.Log, streamBufferSize)
+	readerDone := make(chan struct{})
+	var readerEnd *sessionEnd
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(readerDone)
+		defer close(logs)
+		readerEnd = s.readEvents(ctx, s.conn, logs)
+	}()
+	if s.statsInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.statsLoop(ctx)
+		}()
+	}
+	stopWriter := make(chan struct{})
+	writerDone := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(writerDone)
+		s.writeLogs(logs, stopWriter)
+	}()
+
+	commands := s.commands
+
+	cancelled := &sessionEnd{Code: websocket.StatusNormalClosure, Reason: "stream cancelled", ClosedBy: closedByClient}
+	var end *sessionEnd
+	for end == nil {
+		select {
+		case <-ctx.Done():
+			end = cancelled
+		case <-readerDone:
+			end = readerEnd
+			if end == nil {
+				end = cancelled
+			}
+		case sig := <-signals:
+			end = &sessionEnd{Code: websocket.StatusNormalClosure, Reason: "received " + sig.String(), ClosedBy: closedByClient}
+		case line, ok := <-commands:
+			if !ok {
+				// The input is exhausted, the stream continues with the current filters
+				commands = nil
+				continue
+			}
+			if s.runCommand(ctx, line) {
+				end = &sessionEnd{Code: websocket.StatusNormalClosure, Reason: "quit", ClosedBy: closedByClient}
+			}
+		case <-s.reloads:
+			if err := s.reloader.reload(ctx, s.conn); err != nil {
+				s.log.Err(err).Msg("unable to reload the config file, the current options are kept")
+			}
+		case conn := <-s.renewals:
+			s.renewed = conn
+			end = &sessionEnd{Code: websocket.StatusNormalClosure, Reason: "renewed", ClosedBy: closedByClient}
+		}
+	}
+	s.log.Debug().Msg("closing management connection")
+	// Cleanly close the connection by sending a close message and then
+	// waiting (with timeout) for the server to close the connection. Closing
+	// the connection also interrupts the reader.
+	s.conn.Close(websocket.StatusNormalClosure, "")
+	select {
+	case <-readerDone:
+	case <-time.After(closeTimeout):
+	}
+	// No more logs are accepted once the connection is closed; the logs that were already received are drained to
+	// the sink.
+	cancel()
+	<-readerDone
+	select {
+	case <-writerDone:
+	case <-time.After(s.drainTimeout):
+		s.log.Warn().Msgf("unable to write %d logs to output within the drain timeout of %s", len(logs), s.drainTimeout)
+		close(stopWriter)
+	}
+	wg.Wait()
+	return end
+}
+
+// runCommand applies the interactive command, sending the updated filters to the server, and returns true if the
+// session should end.
+func (s *logStreamer) runCommand(ctx context.Context, line string) bool {
+	update, quit, err := s.interactive.apply(line)
+	if err != nil {
+		fmt.Fprintln(s.console, err)
+		return false
+	}
+	if quit {
+		return true
+	}
+	if update != nil {
+		err := management.WriteEventWithRetry(s.conn, ctx, &management.EventUpdateFilters{
+			ClientEvent: management.ClientEvent{Type: management.UpdateFilters},
+			Filters:     update,
+		}, writeAttempts, writeRetryDelay)
+		if err != nil {
+			fmt.Fprintf(s.console, "unable to update the filters of the server: %v\n", err)
+		}
+	}
+	fmt.Fprintln(s.console, s.interactive)
+	return false
+}
+
+// writeLogs writes the logs to the sink until there are no more logs or the writer is stopped.
+func (s *logStreamer) writeLogs(logs <-chan *management.Log, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case l, ok := <-logs:
+			if !ok {
+				return
+			}
+			if err := s.sink.Write(l); err != nil {
+				s.log.Err(err).Msg("unable to write log to output")
+			}
+		}
+	}
+}
+
+// readEvents reads the server events from the management connection until the context is cancelled or the
+// connection is closed. The logs received are buffered to be written to the sink. How the stream ended is returned,
+// or nil if the context was cancelled.
+func (s *logStreamer) readEvents(ctx context.Context, reader management.MessageReader, logs chan<- *management.Log) *sessionEnd {
+	// Cancelling the context of a pending read causes the connection to be closed with a policy violation rather
+	// than a normal closure, so pending reads are instead interrupted by closing the connection.
+	readCtx := context.WithoutCancel(ctx)
+	readErrors := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+			event, raw, err := management.ReadServerEventRaw(reader, readCtx)
+			if s.raw != nil && raw != nil {
+				s.writeRaw(raw)
+				// Events that can't be decoded are still captured in raw mode
+				if err != nil {
+					s.log.Debug().Err(err).Msg("unable to decode event from server")
+					continue
+				}
+			}
+			if err != nil {
+				// If the client (or the server) already closed the connection, don't continue to
+				// attempt to read from the client.
+				if closeErr := management.AsClosed(err); closeErr != nil {
+					return &sessionEnd{Code: closeErr.Code, Reason: closeErr.Reason, ClosedBy: closedByServer}
+				}
+				// Reads are interrupted by closing the connection when shutting down
+				if ctx.Err() != nil {
+					return nil
+				}
+				// There are no more events to replay
+				if errors.Is(err, io.EOF) {
+					return &sessionEnd{Reason: "no more events", ClosedBy: closedByServer}
+				}
+				// Occasional events that can't be decoded are skipped, but a persistent error still ends the stream
+				if readErrors < s.maxReadErrors {
+					readErrors++
+					s.log.Debug().Err(err).Msgf("skipping event that can't be read from server (%d/%d)", readErrors, s.maxReadErrors)
+					continue
+				}
+				return &sessionEnd{Reason: fmt.Sprintf("unable to read event from server: %v", err), ClosedBy: closedByError}
+			}
+			readErrors = 0
+			s.checkAck(event.AckSeq)
+			switch event.Type {
+			case management.Logs:
+				eventLog, ok := s.decodeLogs(event, raw)
+				if !ok {
+					s.log.Error().Msgf("invalid logs event")
+					continue
+				}
+				if s.skew != nil {
+					s.skew.observe(eventLog.ServerTimestamp, time.Now())
+				}
+				if eventLog.DroppedCount > 0 {
+					s.serverDropped.Add(eventLog.DroppedCount)
+					s.log.Warn().Msgf("⚠ %d events dropped by server", eventLog.DroppedCount)
+				}
+				s.received.Add(uint64(len(eventLog.Logs)))
+				if eventLog.BatchSize > 0 {
+					s.batches.Add(1)
+					s.batchedLogs.Add(uint64(eventLog.BatchSize))
+					s.batchLatency.Add(int64(eventLog.BatchLatency))
+				}
+				// Output all the logs received to the sink
+				for _, l := range eventLog.Logs {
+					// Malformed logs are skipped rather than output garbled
+					if err := management.ValidateServerLog(l); err != nil {
+						s.log.Debug().Err(err).Msgf("skipping malformed log from server: %+v", l)
+						continue
+					}
+					if s.dedup != nil && s.dedup.duplicate(l) {
+						continue
+					}
+					if !process(s.processors, l) {
+						continue
+					}
+					select {
+					case logs <- l:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+			case management.StreamStopped:
+				// The server closes the connection once it provided the maximum number of log events
+				if stopped, ok := management.IntoServerControlEvent[management.EventStreamStopped](event, management.StreamStopped); ok {
+					s.log.Info().Msgf("server stopped streaming after %d log events", stopped.Events)
+				}
+			case management.UnknownServerEventType:
+				fallthrough
+			default:
+				s.log.Debug().Msgf("unexpected log event type: %s", event.Type)
+			}
+		}
+	}
+}
+
+// checkAck warns if the server acknowledged the client events out of order or skipped the acknowledgement of some
+// of them. Servers that don't acknowledge the client events don't set the ack.
+func (s *logStreamer) checkAck(ack uint64) {
+	if ack == 0 {
+		return
+	}
+	switch {
+	case ack <= s.lastAck:
+		s.log.Warn().Msgf("⚠ client event %d acknowledged by server out of order after client event %d", ack, s.lastAck)
+	case ack > s.lastAck+1:
+		s.log.Warn().Msgf("⚠ acknowledgement of client events %d to %d skipped by server", s.lastAck+1, ack-1)
+	}
+	s.lastAck = max(s.lastAck, ack)
+}
+
+// decodeLogs decodes the logs event, normalizing the levels of the logs if requested.
+func (s *logStreamer) decodeLogs(event *management.ServerEvent, raw []byte) (*management.EventLog, bool) {
+	if s.levels == nil {
+		return management.IntoServerEvent(event, management.Logs)
+	}
+	eventLog, err := s.levels.decode(raw)
+	if err != nil {
+		s.log.Debug().Err(err).Msg("unable to decode logs event")
+		return nil, false
+	}
+	return eventLog, true
+}
+
+// statsLoop logs the stats of the stream periodically until the context is cancelled.
+func (s *logStreamer) statsLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.logStats()
+		}
+	}
+}
+
+func (s *logStreamer) logStats() {
+	event := s.log.Info()
+	if metered, ok := s.conn.(*meteredConn); ok {
+		stats := metered.stats
+		event = event.
+			Int64("compressed_bytes", stats.compressed.Load()).
+			Int64("uncompressed_bytes", stats.uncompressed.Load()).
+			Str("compression_ratio", strconv.FormatFloat(stats.CompressionRatio(), 'f', 2, 64))
+	}
+	// The servers that don't report the batches don't provide the averages
+	if batches := s.batches.Load(); batches > 0 {
+		event = event.
+			Str("average_batch_size", strconv.FormatFloat(float64(s.batchedLogs.Load())/float64(batches), 'f', 1, 64)).
+			Dur("average_batch_latency", time.Duration(s.batchLatency.Load()/int64(batches)))
+	}
+	event.Msgf("stats: %d logs received, %d events dropped by server", s.received.Load(), s.serverDropped.Load())
+}
+
+func (s *logStreamer) writeRaw(raw []byte) {
+	line := make([]byte, 0, len(raw)+1)
+	line = append(line, raw...)
+	line = append(line, '\n')
+	if _, err := s.raw.Write(line); err != nil {
+		s.log.Err(err).Msg("unable to write raw event to output")
+	}
+}
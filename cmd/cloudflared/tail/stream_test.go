@@ -0,0 +1,379 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/internal/test"
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// recordingSink captures the logs written to it
+type recordingSink struct {
+	mu   sync.Mutex
+	logs []*management.Log
+}
+
+func (s *recordingSink) Write(l *management.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, l)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func (s *recordingSink) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var messages []string
+	for _, l := range s.logs {
+		messages = append(messages, l.Message)
+	}
+	return messages
+}
+
+// testLogTime is the time of the test logs, which the logs are required to have to be output
+const testLogTime = "2023-01-01T00:00:00Z"
+
+func writeLogs(t *testing.T, server *websocket.Conn, logs ...*management.Log) {
+	for _, l := range logs {
+		if l.Time == "" {
+			l.Time = testLogTime
+		}
+	}
+	err := management.WriteEvent(server, context.Background(), &management.EventLog{
+		ServerEvent: management.ServerEvent{Type: management.Logs},
+		Logs:        logs,
+	})
+	require.NoError(t, err)
+}
+
+func TestLogStreamer_ServerClosed(t *testing.T) {
+	defer leaktest.Check(t)()
+	client, server := test.WSPipe(nil, nil)
+	sink := &recordingSink{}
+	streamer := &logStreamer{conn: client, sink: sink, drainTimeout: time.Second, log: &noopLogger}
+	go func() {
+		writeLogs(t, server, &management.Log{Message: "test1"}, &management.Log{Message: "test2"})
+		server.Close(websocket.StatusGoingAway, "tunnel stopped")
+	}()
+	end := streamer.run(context.Background(), make(chan os.Signal))
+	assert.Equal(t, []string{"test1", "test2"}, sink.messages())
+	assert.Equal(t, &sessionEnd{Code: websocket.StatusGoingAway, Reason: "tunnel stopped", ClosedBy: closedByServer}, end)
+}
+
+func TestLogStreamer_Signal(t *testing.T) {
+	defer leaktest.Check(t)()
+	client, server := test.WSPipe(nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The server reads until the client closes the connection
+	server.CloseRead(ctx)
+	sink := &recordingSink{}
+	streamer := &logStreamer{conn: client, sink: sink, drainTimeout: time.Second, log: &noopLogger}
+	signals := make(chan os.Signal, 1)
+	go func() {
+		writeLogs(t, server, &management.Log{Message: "test1"})
+		assert.Eventually(t, func() bool { return len(sink.messages()) == 1 }, time.Second, time.Millisecond)
+		signals <- syscall.SIGINT
+	}()
+	end := streamer.run(ctx, signals)
+	assert.Equal(t, []string{"test1"}, sink.messages())
+	assert.Equal(t, &sessionEnd{Code: websocket.StatusNormalClosure, Reason: "received interrupt", ClosedBy: closedByClient}, end)
+	server.Close(websocket.StatusNormalClosure, "")
+}
+
+func TestLogStreamer_ContextCancelled(t *testing.T) {
+	defer leaktest.Check(t)()
+	client, server := test.WSPipe(nil, nil)
+	server.CloseRead(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	streamer := &logStreamer{conn: client, sink: &recordingSink{}, drainTimeout: time.Second, log: &noopLogger}
+	go cancel()
+	end := streamer.run(ctx, make(chan os.Signal))
+	assert.Equal(t, closedByClient, end.ClosedBy)
+	server.Close(websocket.StatusNormalClosure, "")
+}
+
+func TestLogStreamer_Raw(t *testing.T) {
+	defer leaktest.Check(t)()
+	client, server := test.WSPipe(nil, nil)
+	sink := &recordingSink{}
+	var raw bytes.Buffer
+	streamer := &logStreamer{conn: client, sink: sink, raw: &raw, drainTimeout: time.Second, log: &noopLogger}
+	payloads := []string{
+		`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1"}]}`,
+		`{"type":"unknown"}`,
+		`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test2"}]}`,
+	}
+	go func() {
+		for _, payload := range payloads {
+			assert.NoError(t, server.Write(context.Background(), websocket.MessageText, []byte(payload)))
+		}
+		server.Close(websocket.StatusNormalClosure, "")
+	}()
+	streamer.run(context.Background(), make(chan os.Signal))
+	// All of the events are captured as received, including the ones that can't be decoded
+	assert.Equal(t, strings.Join(payloads, "\n")+"\n", raw.String())
+	assert.Equal(t, []string{"test1", "test2"}, sink.messages())
+}
+
+// slowSink takes the delay to write each log
+type slowSink struct {
+	recordingSink
+	delay time.Duration
+}
+
+func (s *slowSink) Write(l *management.Log) error {
+	time.Sleep(s.delay)
+	return s.recordingSink.Write(l)
+}
+
+func TestLogStreamer_Drain(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		drainTimeout time.Duration
+		drained      bool
+	}{
+		{name: "drained", drainTimeout: 5 * time.Second, drained: true},
+		{name: "timeout", drainTimeout: 50 * time.Millisecond, drained: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer leaktest.Check(t)()
+			client, server := test.WSPipe(nil, nil)
+			sink := &slowSink{delay: 5 * time.Millisecond}
+			streamer := &logStreamer{conn: client, sink: sink, drainTimeout: tt.drainTimeout, log: &noopLogger}
+			var logs []*management.Log
+			for i := 0; i < 50; i++ {
+				logs = append(logs, &management.Log{Message: "test"})
+			}
+			go func() {
+				writeLogs(t, server, logs...)
+				server.Close(websocket.StatusNormalClosure, "")
+			}()
+			streamer.run(context.Background(), make(chan os.Signal))
+			if tt.drained {
+				assert.Len(t, sink.messages(), len(logs))
+			} else {
+				assert.Less(t, len(sink.messages()), len(logs))
+			}
+		})
+	}
+}
+
+func TestLogStreamer_ReadEvents(t *testing.T) {
+	data := []byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1","level":"debug"},{"time":"2023-01-01T00:00:00Z","message":"test2","level":"error"}]}
+{"type":"unknown"}
+{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test3","level":"info"}]}
+`)
+	streamer := &logStreamer{
+		processors: []logProcessor{func(l *management.Log) bool { return l.Level != management.Info }},
+		log:        &noopLogger,
+	}
+	logs := make(chan *management.Log, 10)
+	// Invalid events stop the reader
+	end := streamer.readEvents(context.Background(), management.NewReaderFromBytes(data), logs)
+	close(logs)
+	assert.Equal(t, closedByError, end.ClosedBy)
+	var messages []string
+	for l := range logs {
+		messages = append(messages, l.Message)
+	}
+	assert.Equal(t, []string{"test1", "test2"}, messages)
+}
+
+func TestLogStreamer_ResumeOnError(t *testing.T) {
+	data := []byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1"}]}
+{"type":"unknown"}
+{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test2"}]}
+{"type":"unknown"}
+{"type":"unknown"}
+{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test3"}]}
+`)
+	for _, tt := range []struct {
+		name          string
+		maxReadErrors int
+		messages      []string
+		end           *sessionEnd
+	}{
+		{
+			name:     "disabled",
+			messages: []string{"test1"},
+			end:      &sessionEnd{Reason: "unable to read event from server: invalid server message type was provided: unknown", ClosedBy: closedByError},
+		},
+		{
+			name:          "consecutive errors exceeded",
+			maxReadErrors: 1,
+			messages:      []string{"test1", "test2"},
+			end:           &sessionEnd{Reason: "unable to read event from server: invalid server message type was provided: unknown", ClosedBy: closedByError},
+		},
+		{
+			name:          "resumed",
+			maxReadErrors: 2,
+			messages:      []string{"test1", "test2", "test3"},
+			end:           &sessionEnd{Reason: "no more events", ClosedBy: closedByServer},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			streamer := &logStreamer{maxReadErrors: tt.maxReadErrors, log: &noopLogger}
+			logs := make(chan *management.Log, 10)
+			end := streamer.readEvents(context.Background(), management.NewReaderFromBytes(data), logs)
+			close(logs)
+			assert.Equal(t, tt.end, end)
+			var messages []string
+			for l := range logs {
+				messages = append(messages, l.Message)
+			}
+			assert.Equal(t, tt.messages, messages)
+		})
+	}
+}
+
+func TestLogStreamer_ReadEventsRaw(t *testing.T) {
+	data := []byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1"}]}
+{"type":"unknown"}
+{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test2"}]}
+`)
+	var raw bytes.Buffer
+	streamer := &logStreamer{raw: &raw, log: &noopLogger}
+	logs := make(chan *management.Log, 10)
+	// Invalid events are skipped in raw mode and the reader stops once all of the events are replayed
+	end := streamer.readEvents(context.Background(), management.NewReaderFromBytes(data), logs)
+	close(logs)
+	assert.Equal(t, &sessionEnd{Reason: "no more events", ClosedBy: closedByServer}, end)
+	assert.Equal(t, string(data), raw.String())
+	assert.Len(t, logs, 2)
+}
+
+func TestLogStreamer_ServerDropped(t *testing.T) {
+	data := []byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1"}],"truncated":true,"dropped_count":42}
+{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test2"},{"time":"2023-01-01T00:00:00Z","message":"test3"}],"truncated":true,"dropped_count":3}
+`)
+	var out bytes.Buffer
+	log := zerolog.New(&out)
+	streamer := &logStreamer{log: &log}
+	logs := make(chan *management.Log, 10)
+	streamer.readEvents(context.Background(), management.NewReaderFromBytes(data), logs)
+	assert.Equal(t, uint64(3), streamer.received.Load())
+	assert.Equal(t, uint64(45), streamer.serverDropped.Load())
+	assert.Contains(t, out.String(), "⚠ 42 events dropped by server")
+	assert.Contains(t, out.String(), "⚠ 3 events dropped by server")
+}
+
+func TestLogStreamer_Acks(t *testing.T) {
+	data := []byte(`{"type":"logs","logs":[],"ack_seq":1}
+{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1"}]}
+{"type":"logs","logs":[],"ack_seq":2}
+{"type":"logs","logs":[],"ack_seq":5}
+{"type":"logs","logs":[],"ack_seq":4}
+`)
+	var out bytes.Buffer
+	log := zerolog.New(&out)
+	streamer := &logStreamer{log: &log}
+	logs := make(chan *management.Log, 10)
+	streamer.readEvents(context.Background(), management.NewReaderFromBytes(data), logs)
+	assert.Equal(t, uint64(5), streamer.lastAck)
+	assert.Equal(t, uint64(1), streamer.received.Load())
+	assert.Contains(t, out.String(), "⚠ acknowledgement of client events 3 to 4 skipped by server")
+	assert.Contains(t, out.String(), "⚠ client event 4 acknowledged by server out of order after client event 5")
+	assert.Equal(t, 2, strings.Count(out.String(), "⚠"))
+}
+
+func TestLogStreamer_Stats(t *testing.T) {
+	var out bytes.Buffer
+	log := zerolog.New(&out)
+	streamer := &logStreamer{statsInterval: 10 * time.Millisecond, log: &log}
+	streamer.received.Store(5)
+	streamer.serverDropped.Store(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	streamer.statsLoop(ctx)
+	assert.Contains(t, out.String(), "stats: 5 logs received, 2 events dropped by server")
+	assert.NotContains(t, out.String(), "average_batch_size")
+}
+
+func TestLogStreamer_BatchStats(t *testing.T) {
+	var out bytes.Buffer
+	log := zerolog.New(&out)
+	streamer := &logStreamer{log: &log}
+	data := []byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1"}],"batch_size":1,"batch_latency":1000000}
+{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test2"},{"time":"2023-01-01T00:00:00Z","message":"test3"}],"batch_size":2,"batch_latency":3000000}
+{"type":"logs","logs":[]}
+`)
+	logs := make(chan *management.Log, 10)
+	streamer.readEvents(context.Background(), management.NewReaderFromBytes(data), logs)
+	streamer.logStats()
+	// The events without a batch, like the acknowledgements, aren't averaged
+	assert.Contains(t, out.String(), `"average_batch_size":"1.5"`)
+	assert.Contains(t, out.String(), `"average_batch_latency":2`)
+}
+
+func TestLogStreamer_Interactive(t *testing.T) {
+	defer leaktest.Check(t)()
+	client, server := test.WSPipe(nil, nil)
+	defer server.Close(websocket.StatusNormalClosure, "")
+	filters := newInteractiveFilters(nil)
+	var console bytes.Buffer
+	streamer := &logStreamer{
+		conn:         client,
+		sink:         &recordingSink{},
+		processors:   []logProcessor{filters.processor()},
+		drainTimeout: time.Second,
+		commands:     readCommands(context.Background(), strings.NewReader("level error\nunknown\ngrep foo\nquit\n")),
+		interactive:  filters,
+		console:      &console,
+		log:          &noopLogger,
+	}
+	events := make(chan *management.ClientEvent, 1)
+	go func() {
+		defer close(events)
+		event, err := management.ReadClientEvent(server, context.Background())
+		if err == nil {
+			events <- event
+		}
+		// Read until the client closes the connection
+		server.CloseRead(context.Background())
+	}()
+	end := streamer.run(context.Background(), make(chan os.Signal))
+	assert.Equal(t, &sessionEnd{Code: websocket.StatusNormalClosure, Reason: "quit", ClosedBy: closedByClient}, end)
+
+	// Only the level is updated on the server
+	event := <-events
+	require.NotNil(t, event)
+	update, ok := management.IntoClientEvent[management.EventUpdateFilters](event, management.UpdateFilters)
+	require.True(t, ok)
+	assert.Equal(t, management.Error, *update.Filters.Level)
+	assert.Equal(t, `filters: level=error events=all grep=""
+unknown command "unknown", `+interactiveUsage+`
+filters: level=error events=all grep="foo"
+`, console.String())
+}
+
+func TestLogStreamer_SkipMalformedLogs(t *testing.T) {
+	data := []byte(`{"type":"logs","logs":[{"message":"no time"},{"time":"yesterday","message":"invalid time"},{"time":"2023-01-01T00:00:00Z"},{"time":"2023-01-01T00:00:00Z","message":"test1"}]}
+`)
+	streamer := &logStreamer{log: &noopLogger}
+	logs := make(chan *management.Log, 10)
+	streamer.readEvents(context.Background(), management.NewReaderFromBytes(data), logs)
+	close(logs)
+	var messages []string
+	for l := range logs {
+		messages = append(messages, l.Message)
+	}
+	assert.Equal(t, []string{"test1"}, messages)
+}
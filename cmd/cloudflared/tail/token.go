@@ -0,0 +1,237 @@
+package tail
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/time/rate"
+	"nhooyr.io/websocket"
+)
+
+// Time between the attempts to refresh the management token until it expires
+const tokenRefreshRetry = 10 * time.Second
+
+// errReconnectRateLimit stops the stream once the reconnects exceed the --max-reconnects-per-minute, e.g. when the
+// refreshed tokens expire right away or the new connections are rejected.
+var errReconnectRateLimit = errors.New("reconnect rate limit exceeded")
+
+func tokenFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:    "token-expiry-grace",
+			Usage:   "Refresh the management token from the --token-refresh-url this long before it expires and reconnect with it, so that the session outlives the token",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_TOKEN_EXPIRY_GRACE"},
+		},
+		&cli.StringFlag{
+			Name:    "token-refresh-url",
+			Usage:   "URL that the management token is refreshed from with --token-expiry-grace; the current token is POSTed as a bearer token and the new one is expected as {\"token\":\"...\"}",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_TOKEN_REFRESH_URL"},
+		},
+		&cli.UintFlag{
+			Name:    "max-reconnects-per-minute",
+			Usage:   "Stop streaming once the attempts to reconnect with a refreshed token exceed this many per minute; 0 disables the limit",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_MAX_RECONNECTS_PER_MINUTE"},
+			Value:   10,
+		},
+	}
+}
+
+// tokenExpiry returns the time of the exp claim of the JWT. The signature of the token isn't verified, the claims are
+// only used to schedule the refresh of the token.
+func tokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("malformed jwt")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed jwt: %w", err)
+	}
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("malformed jwt: %w", err)
+	}
+	if claims.Exp == nil {
+		return time.Time{}, errors.New("the jwt has no exp claim")
+	}
+	return time.Unix(int64(*claims.Exp), 0), nil
+}
+
+// reconnectFunc opens a new management connection with the token and starts streaming the logs.
+type reconnectFunc func(ctx context.Context, token string) (managementConn, error)
+
+// tokenRefresher refreshes the management token before it expires and reconnects with the new token.
+type tokenRefresher struct {
+	url       string
+	grace     time.Duration
+	client    *http.Client
+	reconnect reconnectFunc
+	// Bounds the attempts to reconnect, so that the reconnects failing right away don't spin
+	limiter *rate.Limiter
+	log     *zerolog.Logger
+}
+
+// reconnectLimiter returns the token bucket allowing the reconnects per minute, with a burst of as many reconnects.
+func reconnectLimiter(perMinute uint) *rate.Limiter {
+	if perMinute == 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(float64(perMinute)/time.Minute.Seconds()), int(perMinute))
+}
+
+// newTokenRefresher creates the tokenRefresher from the flags, or returns nil if the token isn't refreshed.
+func newTokenRefresher(c *cli.Context, reconnect reconnectFunc, log *zerolog.Logger) (*tokenRefresher, error) {
+	grace := c.Duration("token-expiry-grace")
+	if grace <= 0 {
+		return nil, nil
+	}
+	refreshURL := c.String("token-refresh-url")
+	if refreshURL == "" {
+		return nil, errors.New("--token-expiry-grace requires the --token-refresh-url to refresh the token from")
+	}
+	return &tokenRefresher{
+		url:       refreshURL,
+		grace:     grace,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		reconnect: reconnect,
+		limiter:   reconnectLimiter(c.Uint("max-reconnects-per-minute")),
+		log:       log,
+	}, nil
+}
+
+// refresh requests a new token with the current token.
+func (r *tokenRefresher) refresh(ctx context.Context, token string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("User-Agent", buildInfo.UserAgent())
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token refresh returned http response code %d", resp.StatusCode)
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("unable to decode the refreshed token: %w", err)
+	}
+	if body.Token == "" {
+		return "", errors.New("no token in the token refresh response")
+	}
+	return body.Token, nil
+}
+
+// renew waits until the grace period before the token expires, and then refreshes the token and reconnects with it
+// until it succeeds or the token expires. The new connection and its token are returned, or nil if the context is
+// cancelled or the token expired. errReconnectRateLimit is returned once the attempts exceed the limit.
+func (r *tokenRefresher) renew(ctx context.Context, token string, expiry time.Time) (managementConn, string, error) {
+	wait := time.NewTimer(time.Until(expiry.Add(-r.grace)))
+	defer wait.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, "", nil
+		case <-wait.C:
+		}
+		if r.limiter != nil && !r.limiter.Allow() {
+			return nil, "", errReconnectRateLimit
+		}
+		conn, newToken, err := r.reconnectWithNewToken(ctx, token)
+		if err == nil {
+			return conn, newToken, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", nil
+		}
+		if time.Now().Add(tokenRefreshRetry).After(expiry) {
+			r.log.Error().Err(err).Msg("unable to refresh the management token before it expires")
+			return nil, "", nil
+		}
+		r.log.Warn().Err(err).Msgf("unable to refresh the management token, retrying in %s", tokenRefreshRetry)
+		wait.Reset(tokenRefreshRetry)
+	}
+}
+
+func (r *tokenRefresher) reconnectWithNewToken(ctx context.Context, token string) (managementConn, string, error) {
+	newToken, err := r.refresh(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+	conn, err := r.reconnect(ctx, newToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to reconnect with the refreshed token: %w", err)
+	}
+	return conn, newToken, nil
+}
+
+// stream runs the sessions of the streamer, renewing the connection with a refreshed token before the token of each
+// session expires. The new session starts streaming before the previous one is closed, so that no logs are missed
+// (the logs received from both of the sessions are only output once). How the last session ended is returned, and
+// errReconnectRateLimit if the stream was stopped once the reconnects exceeded the limit.
+func (r *tokenRefresher) stream(ctx context.Context, streamer *logStreamer, token string, signals <-chan os.Signal) (*sessionEnd, error) {
+	streamer.dedup = newDeduplicator(dedupSize, dedupTTL)
+	for {
+		expiry, err := tokenExpiry(token)
+		if err != nil {
+			r.log.Warn().Err(err).Msg("unable to schedule the refresh of the management token")
+			return streamer.run(ctx, signals), nil
+		}
+		sessionCtx, stopSession := context.WithCancel(ctx)
+		renewCtx, stopRenew := context.WithCancel(sessionCtx)
+		renewals := make(chan managementConn)
+		renewDone := make(chan string, 1)
+		var renewErr error
+		go func() {
+			conn, newToken, err := r.renew(renewCtx, token, expiry)
+			if err != nil {
+				// The session is stopped rather than left to end with the token
+				renewErr = err
+				stopSession()
+			}
+			if conn != nil {
+				select {
+				case renewals <- conn:
+				case <-renewCtx.Done():
+					// The session ended before the renewed connection was used
+					conn.Close(websocket.StatusNormalClosure, "")
+					newToken = ""
+				}
+			}
+			renewDone <- newToken
+		}()
+		streamer.renewals = renewals
+		end := streamer.run(sessionCtx, signals)
+		stopRenew()
+		newToken := <-renewDone
+		stopSession()
+		if renewErr != nil {
+			return end, renewErr
+		}
+		if streamer.renewed == nil {
+			return end, nil
+		}
+		r.log.Info().Msg("reconnected with the refreshed management token")
+		streamer.conn = streamer.renewed
+		streamer.renewed = nil
+		streamer.lastAck = 0
+		streamer.dedup.reconnected()
+		token = newToken
+	}
+}
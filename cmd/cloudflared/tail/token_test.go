@@ -0,0 +1,152 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/internal/test"
+	"github.com/cloudflare/cloudflared/management"
+)
+
+// testToken returns an unsigned JWT with the claims.
+func testToken(claims string) string {
+	return "eyJhbGciOiJFUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	expiry, err := tokenExpiry(testToken(`{"tun":{"id":"1"},"exp":1700000000}`))
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 0), expiry)
+
+	for _, token := range []string{"", "abc", "a.!!.c", testToken("not json"), testToken(`{"tun":{"id":"1"}}`)} {
+		_, err := tokenExpiry(token)
+		assert.Error(t, err, token)
+	}
+}
+
+func TestNewTokenRefresher(t *testing.T) {
+	refresher, err := newTokenRefresher(newTestContext(t), nil, &noopLogger)
+	require.NoError(t, err)
+	assert.Nil(t, refresher)
+	_, err = newTokenRefresher(newTestContext(t, "--token-expiry-grace", "5m"), nil, &noopLogger)
+	assert.ErrorContains(t, err, "requires the --token-refresh-url")
+}
+
+func TestTokenRefresher_Refresh(t *testing.T) {
+	Init(cliutil.GetBuildInfo("", "test"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer old" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"token":"new"}`)
+	}))
+	defer server.Close()
+	refresher := &tokenRefresher{url: server.URL, client: server.Client(), log: &noopLogger}
+	token, err := refresher.refresh(context.Background(), "old")
+	require.NoError(t, err)
+	assert.Equal(t, "new", token)
+	_, err = refresher.refresh(context.Background(), "expired")
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestTokenRefresher_Stream(t *testing.T) {
+	defer leaktest.Check(t)()
+	Init(cliutil.GetBuildInfo("", "test"))
+	// The token expires within the grace period, so it is refreshed right away
+	oldToken := testToken(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Minute).Unix()))
+	newToken := testToken(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix()))
+	refreshServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"token":%q}`, newToken)
+	}))
+	defer refreshServer.Close()
+
+	client, server := test.WSPipe(nil, nil)
+	go server.CloseRead(context.Background())
+	renewed := &mockConn{
+		MessageReader: management.NewReaderFromBytes([]byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"renewed"}]}`)),
+		MessageWriter: management.NewWriterToBuffer(&bytes.Buffer{}),
+		closed:        make(chan websocket.StatusCode, 1),
+	}
+	var reconnectedWith string
+	refresher := &tokenRefresher{
+		url:    refreshServer.URL,
+		grace:  5 * time.Minute,
+		client: refreshServer.Client(),
+		reconnect: func(ctx context.Context, token string) (managementConn, error) {
+			reconnectedWith = token
+			return renewed, nil
+		},
+		log: &noopLogger,
+	}
+	sink := &recordingSink{}
+	streamer := &logStreamer{conn: client, sink: sink, drainTimeout: time.Second, log: &noopLogger}
+	end, err := refresher.stream(context.Background(), streamer, oldToken, make(chan os.Signal))
+
+	require.NoError(t, err)
+
+	assert.Equal(t, newToken, reconnectedWith)
+	assert.Equal(t, &sessionEnd{Reason: "no more events", ClosedBy: closedByServer}, end)
+	assert.Equal(t, []string{"renewed"}, sink.messages())
+	assert.Equal(t, websocket.StatusNormalClosure, <-renewed.closed)
+}
+
+func TestTokenRefresher_ReconnectRateLimit(t *testing.T) {
+	defer leaktest.Check(t)()
+	Init(cliutil.GetBuildInfo("", "test"))
+	// The refreshed tokens expire within the grace period as well, so they are refreshed again right away
+	token := testToken(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Minute).Unix()))
+	refreshServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"token":%q}`, token)
+	}))
+	defer refreshServer.Close()
+
+	client, server := test.WSPipe(nil, nil)
+	go server.CloseRead(context.Background())
+	reconnects := 0
+	refresher := &tokenRefresher{
+		url:    refreshServer.URL,
+		grace:  5 * time.Minute,
+		client: refreshServer.Client(),
+		reconnect: func(ctx context.Context, token string) (managementConn, error) {
+			reconnects++
+			renewed, server := test.WSPipe(nil, nil)
+			go server.CloseRead(context.Background())
+			return renewed, nil
+		},
+		limiter: reconnectLimiter(2),
+		log:     &noopLogger,
+	}
+	streamer := &logStreamer{conn: client, sink: &recordingSink{}, drainTimeout: time.Second, log: &noopLogger}
+	end, err := refresher.stream(context.Background(), streamer, token, make(chan os.Signal))
+
+	assert.ErrorIs(t, err, errReconnectRateLimit)
+	assert.Equal(t, 2, reconnects)
+	assert.Equal(t, closedByClient, end.ClosedBy)
+}
+
+func TestReconnectLimiter(t *testing.T) {
+	limiter := reconnectLimiter(3)
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.Allow())
+	}
+	assert.False(t, limiter.Allow())
+	// The reconnects aren't limited with 0
+	limiter = reconnectLimiter(0)
+	for i := 0; i < 100; i++ {
+		assert.True(t, limiter.Allow())
+	}
+}
@@ -0,0 +1,178 @@
+package tail
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	vectorDialTimeout  = 10 * time.Second
+	vectorWriteTimeout = 10 * time.Second
+	vectorBaseBackoff  = 500 * time.Millisecond
+	vectorMaxBackoff   = 30 * time.Second
+)
+
+func vectorFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "vector-addr",
+			Usage:   "Address (host:port) of the Vector socket source (mode: tcp, framing.method: length_delimited, decoding.codec: json) to send the logs to when using --output vector",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_VECTOR_ADDR"},
+		},
+	}
+}
+
+// vectorEvent is a log in the schema of a Vector log event, with the message and timestamp in the keys of the
+// default log schema of Vector.
+type vectorEvent struct {
+	Message     string                 `json:"message"`
+	Timestamp   string                 `json:"timestamp,omitempty"`
+	Level       string                 `json:"level"`
+	Event       string                 `json:"event"`
+	ConnectorID string                 `json:"connector_id,omitempty"`
+	Method      string                 `json:"method,omitempty"`
+	Path        string                 `json:"path,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	ConnID      string                 `json:"conn_id,omitempty"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	SourceType  string                 `json:"source_type"`
+}
+
+func newVectorEvent(l *management.Log) vectorEvent {
+	return vectorEvent{
+		Message:     l.Message,
+		Timestamp:   l.Time,
+		Level:       l.Level.String(),
+		Event:       l.Event.String(),
+		ConnectorID: l.ConnectorID,
+		Method:      l.Method,
+		Path:        l.Path,
+		Tags:        l.Tags,
+		ConnID:      l.ConnID,
+		Fields:      l.Fields,
+		SourceType:  "cloudflared",
+	}
+}
+
+// vectorSink sends the logs to a Vector socket source over TCP, each as a JSON object prefixed by its length as 4
+// bytes in big endian. The connection is dialed again once it is lost, waiting with an exponential backoff between
+// each of the failed attempts.
+type vectorSink struct {
+	addr string
+	dial func(addr string) (net.Conn, error)
+	log  *zerolog.Logger
+
+	mu   sync.Mutex
+	conn net.Conn
+	// The connection isn't dialed again until then, after the failed attempts
+	retryAt time.Time
+	backoff time.Duration
+	now     func() time.Time
+	closed  bool
+}
+
+func newVectorSink(c *cli.Context, log *zerolog.Logger) (*vectorSink, error) {
+	addr := expandedString(c, "vector-addr")
+	if addr == "" {
+		return nil, errors.New("--vector-addr is required when using --output vector")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid --vector-addr %q, please provide the host:port of the Vector socket source", addr)
+	}
+	dial := func(addr string) (net.Conn, error) {
+		return net.DialTimeout("tcp", addr, vectorDialTimeout)
+	}
+	// The connection is dialed when the first log is sent
+	return newVectorSinkWithDialer(addr, dial, log), nil
+}
+
+func newVectorSinkWithDialer(addr string, dial func(addr string) (net.Conn, error), log *zerolog.Logger) *vectorSink {
+	return &vectorSink{addr: addr, dial: dial, log: log, now: time.Now}
+}
+
+// encodeVectorFrame encodes the log as a length delimited frame.
+func encodeVectorFrame(l *management.Log) ([]byte, error) {
+	event, err := json.Marshal(newVectorEvent(l))
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, 4, 4+len(event))
+	binary.BigEndian.PutUint32(frame, uint32(len(event)))
+	return append(frame, event...), nil
+}
+
+func (s *vectorSink) Write(l *management.Log) error {
+	frame, err := encodeVectorFrame(l)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSinkClosed
+	}
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(vectorWriteTimeout))
+	if _, err := conn.Write(frame); err != nil {
+		// A partially written frame can't be resumed, so the connection is dialed again for the next log
+		s.disconnect()
+		return fmt.Errorf("unable to send log to vector: %w", err)
+	}
+	return nil
+}
+
+// connect returns the connection, dialing it if it was lost and the backoff has passed.
+func (s *vectorSink) connect() (net.Conn, error) {
+	if s.conn != nil {
+		return s.conn, nil
+	}
+	now := s.now()
+	if now.Before(s.retryAt) {
+		return nil, fmt.Errorf("unable to connect to vector at %s, retrying in %s", s.addr, s.retryAt.Sub(now).Round(time.Millisecond))
+	}
+	conn, err := s.dial(s.addr)
+	if err != nil {
+		if s.backoff == 0 {
+			s.backoff = vectorBaseBackoff
+		} else {
+			s.backoff = min(s.backoff*2, vectorMaxBackoff)
+		}
+		s.retryAt = now.Add(s.backoff)
+		return nil, fmt.Errorf("unable to connect to vector at %s: %w", s.addr, err)
+	}
+	if s.backoff > 0 {
+		s.log.Info().Msgf("reconnected to vector at %s", s.addr)
+	}
+	s.conn, s.backoff, s.retryAt = conn, 0, time.Time{}
+	return conn, nil
+}
+
+func (s *vectorSink) disconnect() {
+	_ = s.conn.Close()
+	s.conn = nil
+}
+
+func (s *vectorSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,122 @@
+package tail
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestNewVectorSink(t *testing.T) {
+	_, err := newVectorSink(newTestContext(t, "--vector-addr", "localhost:9000"), &noopLogger)
+	assert.NoError(t, err)
+	_, err = newVectorSink(newTestContext(t), &noopLogger)
+	assert.ErrorContains(t, err, "--vector-addr is required")
+	_, err = newVectorSink(newTestContext(t, "--vector-addr", "localhost"), &noopLogger)
+	assert.ErrorContains(t, err, "invalid --vector-addr")
+}
+
+// readVectorFrame reads a length delimited frame of a log event.
+func readVectorFrame(t *testing.T, r io.Reader) map[string]interface{} {
+	var length uint32
+	require.NoError(t, binary.Read(r, binary.BigEndian, &length))
+	data := make([]byte, length)
+	_, err := io.ReadFull(r, data)
+	require.NoError(t, err)
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &event))
+	return event
+}
+
+func TestVectorSink(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	sink := newVectorSinkWithDialer("vector:9000", func(addr string) (net.Conn, error) {
+		assert.Equal(t, "vector:9000", addr)
+		return client, nil
+	}, &noopLogger)
+	defer sink.Close()
+
+	l := &management.Log{
+		Time:        "2023-01-01T00:00:00Z",
+		Level:       management.Error,
+		Event:       management.HTTP,
+		Message:     "request failed",
+		ConnectorID: "connector",
+		Method:      "GET",
+		Path:        "/api",
+		Tags:        []string{"origin"},
+		Fields:      map[string]interface{}{"status": float64(502)},
+	}
+	go func() {
+		assert.NoError(t, sink.Write(l))
+	}()
+	assert.Equal(t, map[string]interface{}{
+		"message":      "request failed",
+		"timestamp":    "2023-01-01T00:00:00Z",
+		"level":        "error",
+		"event":        "http",
+		"connector_id": "connector",
+		"method":       "GET",
+		"path":         "/api",
+		"tags":         []interface{}{"origin"},
+		"fields":       map[string]interface{}{"status": float64(502)},
+		"source_type":  "cloudflared",
+	}, readVectorFrame(t, server))
+}
+
+func TestVectorSink_Reconnect(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	dials := 0
+	var dialErr error
+	conns := make(chan net.Conn, 1)
+	sink := newVectorSinkWithDialer("vector:9000", func(string) (net.Conn, error) {
+		dials++
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		client, server := net.Pipe()
+		conns <- server
+		return client, nil
+	}, &noopLogger)
+	sink.now = func() time.Time { return now }
+	defer sink.Close()
+	l := &management.Log{Time: "2023-01-01T00:00:00Z", Message: "test"}
+
+	// The connection isn't dialed again until the backoff has passed, which doubles after each failed attempt
+	dialErr = errors.New("connection refused")
+	assert.ErrorContains(t, sink.Write(l), "connection refused")
+	assert.ErrorContains(t, sink.Write(l), "retrying in 500ms")
+	assert.Equal(t, 1, dials)
+	now = now.Add(vectorBaseBackoff)
+	assert.ErrorContains(t, sink.Write(l), "connection refused")
+	assert.ErrorContains(t, sink.Write(l), "retrying in 1s")
+	assert.Equal(t, 2, dials)
+
+	dialErr = nil
+	now = now.Add(2 * vectorBaseBackoff)
+	go func() {
+		assert.NoError(t, sink.Write(l))
+	}()
+	server := <-conns
+	assert.Equal(t, "test", readVectorFrame(t, server)["message"])
+
+	// The connection is dialed again once it is lost
+	server.Close()
+	assert.Error(t, sink.Write(l))
+	go func() {
+		assert.NoError(t, sink.Write(l))
+	}()
+	server = <-conns
+	defer server.Close()
+	assert.Equal(t, "test", readVectorFrame(t, server)["message"])
+	assert.Equal(t, 4, dials)
+}
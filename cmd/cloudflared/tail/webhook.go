@@ -0,0 +1,282 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+const (
+	webhookMaxBatch = 50
+	// Batches waiting to be delivered; once full, new batches are dropped rather than blocking the stream
+	webhookQueueSize    = 16
+	webhookMaxAttempts  = 5
+	webhookBaseBackoff  = 500 * time.Millisecond
+	webhookMaxBackoff   = 30 * time.Second
+	webhookCloseTimeout = 5 * time.Second
+)
+
+func webhookFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "webhook-match",
+			Usage:   "Only send the logs with a message matching one of these regular expressions to the webhook sink",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_WEBHOOK_MATCH"},
+		},
+		&cli.StringFlag{
+			Name:    "webhook-template",
+			Usage:   "Go template used to render the webhook payload from the batch of logs (.Logs); defaults to a JSON object with the logs",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_WEBHOOK_TEMPLATE"},
+		},
+		&cli.DurationFlag{
+			Name:    "webhook-batch-interval",
+			Usage:   "Send the matching logs to the webhook after this much time has passed",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_WEBHOOK_BATCH_INTERVAL"},
+			Value:   time.Second,
+		},
+	}
+}
+
+// webhookPayload is the data provided to the webhook template.
+type webhookPayload struct {
+	Logs []*management.Log `json:"logs"`
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// webhookSink POSTs the matching logs to a webhook in batches. Delivery happens in the background so that a slow or
+// failing webhook doesn't block the stream of logs.
+type webhookSink struct {
+	*batchSink
+	url      string
+	matchers []*regexp.Regexp
+	template *template.Template
+	client   *http.Client
+	log      *zerolog.Logger
+
+	queue   chan []*management.Log
+	ctx     context.Context
+	cancel  context.CancelFunc
+	senders sync.WaitGroup
+}
+
+func newWebhookSink(c *cli.Context, rawURL string, log *zerolog.Logger) (*webhookSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %q, please provide an http(s) url", rawURL)
+	}
+	var matchers []*regexp.Regexp
+	for _, m := range c.StringSlice("webhook-match") {
+		re, err := regexp.Compile(m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --webhook-match expression %q: %w", m, err)
+		}
+		matchers = append(matchers, re)
+	}
+	var tmpl *template.Template
+	if text := c.String("webhook-template"); text != "" {
+		tmpl, err = template.New("webhook").Funcs(webhookTemplateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --webhook-template: %w", err)
+		}
+	}
+	interval := c.Duration("webhook-batch-interval")
+	if interval <= 0 {
+		return nil, errors.New("--webhook-batch-interval must be greater than 0")
+	}
+	return newWebhookSinkWithClient(u.String(), matchers, tmpl, interval, &http.Client{Timeout: 10 * time.Second}, log), nil
+}
+
+func newWebhookSinkWithClient(
+	url string,
+	matchers []*regexp.Regexp,
+	tmpl *template.Template,
+	interval time.Duration,
+	client *http.Client,
+	log *zerolog.Logger,
+) *webhookSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &webhookSink{
+		url:      url,
+		matchers: matchers,
+		template: tmpl,
+		client:   client,
+		log:      log,
+		queue:    make(chan []*management.Log, webhookQueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	s.batchSink = newBatchSink(webhookMaxBatch, interval, s.enqueue, log)
+	s.senders.Add(1)
+	go s.deliverLoop()
+	return s
+}
+
+// matches returns true if the log should be sent to the webhook. All logs are matched when no expressions are
+// provided.
+func (s *webhookSink) matches(l *management.Log) bool {
+	if len(s.matchers) == 0 {
+		return true
+	}
+	for _, re := range s.matchers {
+		if re.MatchString(l.Message) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *webhookSink) Write(l *management.Log) error {
+	if !s.matches(l) {
+		return nil
+	}
+	return s.batchSink.Write(l)
+}
+
+// Close delivers the remaining logs, waiting up to the close timeout before abandoning any pending retries.
+func (s *webhookSink) Close() error {
+	err := s.batchSink.Close()
+	close(s.queue)
+	done := make(chan struct{})
+	go func() {
+		s.senders.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(webhookCloseTimeout):
+		s.cancel()
+		<-done
+		err = errors.New("timed out delivering logs to webhook")
+	}
+	s.cancel()
+	return err
+}
+
+func (s *webhookSink) enqueue(logs []*management.Log) error {
+	select {
+	case s.queue <- logs:
+		return nil
+	default:
+		return fmt.Errorf("webhook delivery is falling behind, dropped %d logs", len(logs))
+	}
+}
+
+func (s *webhookSink) deliverLoop() {
+	defer s.senders.Done()
+	for logs := range s.queue {
+		if err := s.deliver(logs); err != nil {
+			s.log.Err(err).Msgf("unable to deliver %d logs to webhook", len(logs))
+		}
+	}
+}
+
+func (s *webhookSink) render(logs []*management.Log) ([]byte, string, error) {
+	payload := webhookPayload{Logs: logs}
+	if s.template == nil {
+		body, err := json.Marshal(payload)
+		return body, "application/json", err
+	}
+	var buf bytes.Buffer
+	if err := s.template.Execute(&buf, payload); err != nil {
+		return nil, "", err
+	}
+	// Templates are expected to render JSON for incoming webhooks (Slack, PagerDuty, etc.)
+	contentType := "text/plain"
+	if json.Valid(buf.Bytes()) {
+		contentType = "application/json"
+	}
+	return buf.Bytes(), contentType, nil
+}
+
+// deliver POSTs the logs to the webhook, retrying with an exponential backoff when the request fails or the webhook
+// responds with a retryable status.
+func (s *webhookSink) deliver(logs []*management.Log) error {
+	body, contentType, err := s.render(logs)
+	if err != nil {
+		return fmt.Errorf("unable to render webhook payload: %w", err)
+	}
+	backoff := webhookBaseBackoff
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := s.post(body, contentType)
+		if err == nil {
+			return nil
+		}
+		var permanent *webhookPermanentError
+		if errors.As(err, &permanent) || attempt >= webhookMaxAttempts {
+			return err
+		}
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		if wait > webhookMaxBackoff {
+			wait = webhookMaxBackoff
+		}
+		s.log.Debug().Err(err).Msgf("retrying webhook delivery in %s", wait)
+		select {
+		case <-s.ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// webhookPermanentError is returned when the webhook rejects the request and retrying won't help.
+type webhookPermanentError struct {
+	status int
+	body   []byte
+}
+
+func (e *webhookPermanentError) Error() string {
+	return fmt.Sprintf("webhook returned http status %d: %s", e.status, e.body)
+}
+
+// post sends a single request to the webhook and returns the time to wait before retrying if requested by the
+// webhook.
+func (s *webhookSink) post(body []byte, contentType string) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return retryAfter, fmt.Errorf("webhook returned http status %d: %s", resp.StatusCode, respBody)
+	default:
+		return 0, &webhookPermanentError{status: resp.StatusCode, body: respBody}
+	}
+}
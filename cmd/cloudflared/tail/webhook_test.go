@@ -0,0 +1,126 @@
+package tail
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/management"
+)
+
+func TestWebhookSink_Match(t *testing.T) {
+	payloads := make(chan webhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var payload webhookPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads <- payload
+	}))
+	defer server.Close()
+
+	matchers := []*regexp.Regexp{regexp.MustCompile("^connection lost"), regexp.MustCompile("panic")}
+	sink := newWebhookSinkWithClient(server.URL, matchers, nil, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "connection lost to edge"}))
+	require.NoError(t, sink.Write(&management.Log{Message: "request served"}))
+	require.NoError(t, sink.Write(&management.Log{Message: "recovered from panic"}))
+	require.NoError(t, sink.Close())
+
+	payload := <-payloads
+	require.Len(t, payload.Logs, 2)
+	assert.Equal(t, "connection lost to edge", payload.Logs[0].Message)
+	assert.Equal(t, "recovered from panic", payload.Logs[1].Message)
+}
+
+func TestWebhookSink_Template(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies <- string(body)
+	}))
+	defer server.Close()
+
+	tmpl := template.Must(template.New("webhook").Funcs(webhookTemplateFuncs).Parse(
+		`{"text": {{ json (printf "%d logs: %s" (len .Logs) (index .Logs 0).Message) }}}`))
+	sink := newWebhookSinkWithClient(server.URL, nil, tmpl, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: `tunnel "a" down`}))
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, `{"text": "1 logs: tunnel \"a\" down"}`, <-bodies)
+}
+
+func TestWebhookSink_Retry(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	sink := newWebhookSinkWithClient(server.URL, nil, nil, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test"}))
+	require.NoError(t, sink.Close())
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestWebhookSink_NoRetryOnClientError(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := newWebhookSinkWithClient(server.URL, nil, nil, time.Hour, server.Client(), &noopLogger)
+	require.NoError(t, sink.Write(&management.Log{Message: "test"}))
+	require.NoError(t, sink.Close())
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestWebhookSink_DoesNotBlockStream(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sink := newWebhookSinkWithClient(server.URL, nil, nil, time.Hour, server.Client(), &noopLogger)
+	// The first batch is being delivered and the following batches fill the queue
+	var err error
+	for i := 0; i < (webhookQueueSize+2)*webhookMaxBatch; i++ {
+		if err = sink.Write(&management.Log{Message: "test"}); err != nil {
+			break
+		}
+	}
+	assert.ErrorContains(t, err, "falling behind")
+	// Abandon the pending deliveries
+	sink.cancel()
+	_ = sink.Close()
+}
+
+func TestNewAdditionalSink(t *testing.T) {
+	c := newTestContext(t, "--webhook-match", "[")
+	_, err := newAdditionalSink(c, "webhook:https://example.com/hook", &noopLogger)
+	assert.ErrorContains(t, err, "--webhook-match")
+
+	c = newTestContext(t)
+	_, err = newAdditionalSink(c, "webhook:example.com", &noopLogger)
+	assert.ErrorContains(t, err, "invalid webhook url")
+	_, err = newAdditionalSink(c, "email:ops@example.com", &noopLogger)
+	assert.ErrorContains(t, err, "invalid --sink value")
+
+	sink, err := newAdditionalSink(c, "webhook:https://example.com/hook", &noopLogger)
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+}
@@ -39,6 +39,7 @@ import (
 	"github.com/cloudflare/cloudflared/supervisor"
 	"github.com/cloudflare/cloudflared/tlsconfig"
 	"github.com/cloudflare/cloudflared/tunneldns"
+	"github.com/cloudflare/cloudflared/tunnelstate"
 	"github.com/cloudflare/cloudflared/validation"
 )
 
@@ -427,6 +428,23 @@ func StartServer(
 			logger.ManagementLogger.Log,
 			logger.ManagementLogger,
 		)
+		mgmt.MaxIdleDuration = c.Duration("management-session-max-idle")
+		mgmt.IdleCheckInterval = c.Duration("management-session-idle-check-interval")
+		mgmt.HealthCheckPaths = c.StringSlice("management-health-check-path")
+		if c.Bool("management-adaptive-batching") {
+			mgmt.BatchTuning = management.AdaptiveBatchTuning
+		}
+		// The recent logs are kept to replay them to the sessions that request them with --since or --tail-last, from
+		// the level of the logs of the tunnel
+		ringLevel, err := zerolog.ParseLevel(c.String(logger.LogLevelFlag))
+		if err != nil {
+			ringLevel = zerolog.InfoLevel
+		}
+		logger.ManagementLogger.SetRing(c.Int("management-log-ring-size"), c.Duration("management-log-ring-ttl"), ringLevel)
+		// The tunnel connections are tracked for the internal events of the management sessions
+		connTracker := tunnelstate.NewConnTracker(log)
+		observer.RegisterSink(connTracker)
+		mgmt.OpenConns = func() int { return int(connTracker.CountActiveConns()) }
 		internalRules = []ingress.Rule{ingress.NewManagementRule(mgmt)}
 	}
 	orchestrator, err := orchestration.NewOrchestrator(ctx, orchestratorConfig, tunnelConfig.Tags, internalRules, tunnelConfig.Log)
@@ -964,6 +982,47 @@ func configureProxyFlags(shouldHide bool) []cli.Flag {
 			Hidden:  true,
 			Value:   "management.argotunnel.com",
 		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "management-session-max-idle",
+			Usage:   "Evicts the management streaming session once its client hasn't sent a message (or answered a ping) for this long, e.g. because it stopped reading the logs. 0 disables the eviction.",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SESSION_MAX_IDLE"},
+			Hidden:  true,
+			Value:   management.DefaultMaxIdleDuration,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "management-session-idle-check-interval",
+			Usage:   "Interval of the checks for the management streaming sessions to evict with --management-session-max-idle",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_SESSION_IDLE_CHECK_INTERVAL"},
+			Hidden:  true,
+			Value:   management.DefaultIdleCheckInterval,
+		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    "management-health-check-path",
+			Usage:   "Path of the health check requests of which the logs aren't provided to the management streaming sessions that exclude the health checks, along with those of the probes of the load balancers. Can be specified multiple times.",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_HEALTH_CHECK_PATH"},
+			Hidden:  true,
+			Value:   cli.NewStringSlice(management.HealthCheckPath),
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    "management-adaptive-batching",
+			Usage:   "Adapts the number of logs in each message of the management streaming sessions to how fast their clients read them, rather than sending each log in its own message",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_ADAPTIVE_BATCHING"},
+			Hidden:  true,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "management-log-ring-size",
+			Usage:   "Number of the recent logs kept to replay them to the management streaming sessions that request them. The logs of the --loglevel or above are kept once the first session requested them, except for the logs with the headers of the HTTP requests, which costs a copy of each log. 0 disables the replay.",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_LOG_RING_SIZE"},
+			Hidden:  true,
+			Value:   management.DefaultLogRingSize,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "management-log-ring-ttl",
+			Usage:   "Time that the recent logs are kept for with --management-log-ring-size",
+			EnvVars: []string{"TUNNEL_MANAGEMENT_LOG_RING_TTL"},
+			Hidden:  true,
+			Value:   management.DefaultLogRingTTL,
+		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:    "service-op-ip",
 			Usage:   "Fallback IP for service operations run by the management service.",
@@ -0,0 +1,104 @@
+package management
+
+import (
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Reasons that the streaming sessions are closed, as reported to the AuditLogger
+	auditReasonStopStreaming = "client stopped streaming"
+	auditReasonDisconnected  = "connection closed"
+	auditReasonPreempted     = "another session of the actor started streaming"
+	auditReasonWriteError    = "unable to write the log events to the client"
+	auditReasonPollComplete  = "poll request completed"
+)
+
+// Session describes a streaming session of an actor, as reported to the AuditLogger.
+type Session struct {
+	// Unique identifier of the session
+	ID string
+	// Actor who started the session, and if it is a member of the Cloudflare support
+	ActorID string
+	Support bool
+	// Version of cloudflared reported by the client, empty for the clients that predate it
+	ClientVersion string
+	// Filters of the log events that the session provides
+	Filters *StreamingFilters
+}
+
+// AuditLogger records the lifecycle of the streaming sessions of the ManagementService: the sessions that start
+// streaming, the updates of their filters and the sessions that stop streaming along with the reason. The methods are
+// called from the goroutines serving the sessions and must not block.
+type AuditLogger interface {
+	SessionCreated(s *Session)
+	SessionUpdated(s *Session, oldFilters, newFilters *StreamingFilters)
+	SessionClosed(s *Session, reason string)
+}
+
+// zerologAuditLogger writes the lifecycle events of the streaming sessions to the cloudflared logger.
+type zerologAuditLogger struct {
+	log *zerolog.Logger
+}
+
+// NewAuditLogger returns the default AuditLogger of the ManagementService, which writes the lifecycle events of the
+// streaming sessions to the logger.
+func NewAuditLogger(log *zerolog.Logger) AuditLogger {
+	return &zerologAuditLogger{log: log}
+}
+
+func (a *zerologAuditLogger) event(name string, s *Session) *zerolog.Event {
+	// The event key is used for the types of the log events of the management logger, so the audit events use their
+	// own key
+	return a.log.Info().
+		Str("audit", name).
+		Str("session_id", s.ID).
+		Str("actor_id", s.ActorID).
+		Bool("support", s.Support).
+		Str("client_version", s.ClientVersion)
+}
+
+func (a *zerologAuditLogger) SessionCreated(s *Session) {
+	a.event("session_created", s).
+		Interface("filters", s.Filters).
+		Msg("Management streaming session started")
+}
+
+func (a *zerologAuditLogger) SessionUpdated(s *Session, oldFilters, newFilters *StreamingFilters) {
+	a.event("session_updated", s).
+		Interface("old_filters", oldFilters).
+		Interface("new_filters", newFilters).
+		Msg("Management streaming session filters updated")
+}
+
+func (a *zerologAuditLogger) SessionClosed(s *Session, reason string) {
+	a.event("session_closed", s).
+		Str("reason", reason).
+		Msg("Management streaming session closed")
+}
+
+// auditCreated reports that the session started streaming. Each session that started streaming is reported closed
+// once, until it starts streaming again.
+func (m *ManagementService) auditCreated(session *session) {
+	if m.Audit == nil {
+		return
+	}
+	session.audited.Store(true)
+	m.Audit.SessionCreated(session.auditSession())
+}
+
+// auditUpdated reports that the filters of the session were replaced while it is streaming.
+func (m *ManagementService) auditUpdated(session *session, oldFilters *StreamingFilters) {
+	if m.Audit == nil || !session.audited.Load() {
+		return
+	}
+	s := session.auditSession()
+	m.Audit.SessionUpdated(s, oldFilters, s.Filters)
+}
+
+// auditClosed reports that the session stopped streaming for the reason, unless it was already reported.
+func (m *ManagementService) auditClosed(session *session, reason string) {
+	if m.Audit == nil || !session.audited.CompareAndSwap(true, false) {
+		return
+	}
+	m.Audit.SessionClosed(session.auditSession(), reason)
+}
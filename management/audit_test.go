@@ -0,0 +1,163 @@
+package management
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/internal/test"
+)
+
+type auditRecord struct {
+	event      string
+	session    *Session
+	oldFilters *StreamingFilters
+	newFilters *StreamingFilters
+	reason     string
+}
+
+// recordingAuditLogger keeps the lifecycle events of the streaming sessions.
+type recordingAuditLogger struct {
+	mu      sync.Mutex
+	records []auditRecord
+}
+
+func (a *recordingAuditLogger) record(r auditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, r)
+}
+
+func (a *recordingAuditLogger) Records() []auditRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]auditRecord(nil), a.records...)
+}
+
+func (a *recordingAuditLogger) SessionCreated(s *Session) {
+	a.record(auditRecord{event: "created", session: s})
+}
+
+func (a *recordingAuditLogger) SessionUpdated(s *Session, oldFilters, newFilters *StreamingFilters) {
+	a.record(auditRecord{event: "updated", session: s, oldFilters: oldFilters, newFilters: newFilters})
+}
+
+func (a *recordingAuditLogger) SessionClosed(s *Session, reason string) {
+	a.record(auditRecord{event: "closed", session: s, reason: reason})
+}
+
+func TestZerologAuditLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log := zerolog.New(&buf)
+	audit := NewAuditLogger(&log)
+	level := Warn
+	s := &Session{
+		ID:            "session",
+		ActorID:       "actor",
+		ClientVersion: "2024.6.0",
+		Filters:       &StreamingFilters{Level: &level},
+	}
+
+	audit.SessionCreated(s)
+	audit.SessionUpdated(s, s.Filters, &StreamingFilters{Events: []LogEventType{HTTP}})
+	audit.SessionClosed(s, reasonMaxEvents)
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 3)
+	var events []map[string]interface{}
+	for _, line := range lines {
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &event))
+		assert.Equal(t, "info", event["level"])
+		assert.Equal(t, "session", event["session_id"])
+		assert.Equal(t, "actor", event["actor_id"])
+		assert.Equal(t, false, event["support"])
+		assert.Equal(t, "2024.6.0", event["client_version"])
+		events = append(events, event)
+	}
+	assert.Equal(t, "session_created", events[0]["audit"])
+	assert.Equal(t, map[string]interface{}{"level": "warn"}, events[0]["filters"])
+	assert.Equal(t, "session_updated", events[1]["audit"])
+	assert.Equal(t, map[string]interface{}{"level": "warn"}, events[1]["old_filters"])
+	assert.Equal(t, map[string]interface{}{"events": []interface{}{"http"}}, events[1]["new_filters"])
+	assert.Equal(t, "session_closed", events[2]["audit"])
+	assert.Equal(t, reasonMaxEvents, events[2]["reason"])
+}
+
+func TestAudit_Lifecycle(t *testing.T) {
+	audit := &recordingAuditLogger{}
+	m := ManagementService{
+		log:    &noopLogger,
+		logger: NewLogger(),
+		Audit:  audit,
+	}
+	session := newSession(logWindow, actor{ID: "actor"}, func() {})
+	session.clientVersion = "2024.6.0"
+
+	// The filters are only reported while the session is streaming
+	m.auditUpdated(session, session.currentFilters())
+	assert.Empty(t, audit.Records())
+
+	m.auditCreated(session)
+	old := session.currentFilters()
+	session.Filters(NewStreamingFilters(WithMaxEvents(5)))
+	m.auditUpdated(session, old)
+	m.auditClosed(session, auditReasonStopStreaming)
+	// The session is only reported closed once
+	m.auditClosed(session, auditReasonDisconnected)
+
+	records := audit.Records()
+	require.Len(t, records, 3)
+	assert.Equal(t, "created", records[0].event)
+	assert.Equal(t, session.id, records[0].session.ID)
+	assert.Equal(t, "actor", records[0].session.ActorID)
+	assert.Equal(t, "2024.6.0", records[0].session.ClientVersion)
+	assert.Equal(t, "updated", records[1].event)
+	assert.Same(t, old, records[1].oldFilters)
+	assert.Equal(t, uint64(5), records[1].newFilters.MaxEvents)
+	assert.Equal(t, "closed", records[2].event)
+	assert.Equal(t, auditReasonStopStreaming, records[2].reason)
+}
+
+func TestAudit_Disabled(t *testing.T) {
+	m := ManagementService{
+		log:    &noopLogger,
+		logger: NewLogger(),
+	}
+	session := newSession(logWindow, actor{}, func() {})
+	m.auditCreated(session)
+	m.auditClosed(session, auditReasonDisconnected)
+	assert.False(t, session.audited.Load())
+}
+
+func TestAudit_EvictIdle(t *testing.T) {
+	audit := &recordingAuditLogger{}
+	logger := NewLogger()
+	m := ManagementService{
+		log:    &noopLogger,
+		logger: logger,
+		Audit:  audit,
+	}
+	client, server := test.WSPipe(nil, nil)
+	defer client.Close(websocket.StatusInternalError, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(logWindow, actor{}, cancel)
+	session.MaxIdleDuration = time.Minute
+	m.auditCreated(session)
+	logger.Listen(session)
+
+	go client.Read(context.Background())
+	assert.True(t, m.evictIdle(server, session, session.LastMessageAt().Add(2*time.Minute)))
+	records := audit.Records()
+	require.Len(t, records, 2)
+	assert.Equal(t, "closed", records[1].event)
+	assert.Equal(t, reasonSessionIdle, records[1].reason)
+	assert.Error(t, ctx.Err())
+}
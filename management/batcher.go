@@ -0,0 +1,89 @@
+package management
+
+import (
+	"math"
+	"time"
+)
+
+// BatchTuning configures the AdaptiveBatcher of the streaming sessions. With none of the gains, the batches stay at
+// MinBatch.
+type BatchTuning struct {
+	// Fewest and most live log events sent to the client in each logs event
+	MinBatch int
+	MaxBatch int
+	// Time that the client is expected to take to read a batch, which the batch size is adjusted towards
+	TargetReadTime time.Duration
+	// Proportional, integral and derivative gains of the controller of the batch size
+	Kp float64
+	Ki float64
+	Kd float64
+}
+
+var (
+	// DefaultBatchTuning sends each live log event in its own logs event, like the sessions did before their batches
+	// were adapted to the clients.
+	DefaultBatchTuning = BatchTuning{MinBatch: 1, MaxBatch: 1000}
+	// AdaptiveBatchTuning adapts the batches to the time that the clients take to read them.
+	AdaptiveBatchTuning = BatchTuning{
+		MinBatch:       1,
+		MaxBatch:       1000,
+		TargetReadTime: 20 * time.Millisecond,
+		Kp:             0.5,
+		Ki:             0.1,
+		Kd:             0.2,
+	}
+)
+
+const (
+	// Bounds of the normalized error of a read, so that a single stalled read doesn't jump to the MaxBatch
+	maxBatchError = 4
+	minBatchError = -1
+	// Bound of the accumulated error of the controller, so that it recovers quickly once the client changes pace
+	maxBatchIntegral = 10
+)
+
+// AdaptiveBatcher adjusts the number of live log events that a streaming session sends in each logs event to the pace
+// of its client. The time that the client takes to read each batch is approximated by the time that the write of the
+// batch takes to be acknowledged by the connection, which is held up once the client stops reading. The slow clients
+// get larger batches for fewer frames, and the fast clients smaller batches for a lower latency.
+//
+// The batch size is controlled by a PID-like controller of the error of the read time relative to the
+// TargetReadTime, scaling the batch size so that it adjusts quickly from MinBatch to MaxBatch. The AdaptiveBatcher
+// isn't safe for concurrent use; each session streams from a single goroutine.
+type AdaptiveBatcher struct {
+	tuning   BatchTuning
+	size     float64
+	integral float64
+	lastErr  float64
+}
+
+// NewAdaptiveBatcher creates the batcher of a streaming session, starting at the MinBatch. The MinBatch is at least 1
+// and the MaxBatch at least the MinBatch.
+func NewAdaptiveBatcher(tuning BatchTuning) *AdaptiveBatcher {
+	tuning.MinBatch = max(tuning.MinBatch, 1)
+	tuning.MaxBatch = max(tuning.MaxBatch, tuning.MinBatch)
+	return &AdaptiveBatcher{tuning: tuning, size: float64(tuning.MinBatch)}
+}
+
+// Size returns the most live log events to send in the next batch.
+func (b *AdaptiveBatcher) Size() int {
+	return int(math.Round(b.size))
+}
+
+// Observe adjusts the batch size after the client took the time to read the last batch.
+func (b *AdaptiveBatcher) Observe(readTime time.Duration) {
+	if b.tuning.TargetReadTime <= 0 {
+		return
+	}
+	err := float64(readTime-b.tuning.TargetReadTime) / float64(b.tuning.TargetReadTime)
+	err = min(max(err, minBatchError), maxBatchError)
+	b.integral = min(max(b.integral+err, -maxBatchIntegral), maxBatchIntegral)
+	derivative := err - b.lastErr
+	b.lastErr = err
+
+	output := b.tuning.Kp*err + b.tuning.Ki*b.integral + b.tuning.Kd*derivative
+	// The output scales the batch size, doubling it at most, so that the size adjusts at the same pace throughout
+	// the range
+	b.size *= math.Exp2(min(max(output, -1), 1))
+	b.size = min(max(b.size, float64(b.tuning.MinBatch)), float64(b.tuning.MaxBatch))
+}
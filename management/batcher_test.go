@@ -0,0 +1,68 @@
+package management
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveBatcher_DefaultTuning(t *testing.T) {
+	b := NewAdaptiveBatcher(DefaultBatchTuning)
+	// Each live log event is sent in its own batch, however slow the client is
+	for i := 0; i < 10; i++ {
+		b.Observe(time.Second)
+		assert.Equal(t, 1, b.Size())
+	}
+	assert.Equal(t, 1, NewAdaptiveBatcher(BatchTuning{}).Size())
+}
+
+func TestAdaptiveBatcher_SlowClient(t *testing.T) {
+	b := NewAdaptiveBatcher(AdaptiveBatchTuning)
+	assert.Equal(t, 1, b.Size())
+	previous := b.Size()
+	for i := 0; i < 20; i++ {
+		b.Observe(time.Second)
+		assert.GreaterOrEqual(t, b.Size(), previous)
+		previous = b.Size()
+	}
+	assert.Equal(t, AdaptiveBatchTuning.MaxBatch, b.Size())
+}
+
+func TestAdaptiveBatcher_FastClient(t *testing.T) {
+	b := NewAdaptiveBatcher(AdaptiveBatchTuning)
+	for i := 0; i < 20; i++ {
+		b.Observe(time.Second)
+	}
+	// The batches shrink back once the client reads them faster than the target
+	for i := 0; i < 30; i++ {
+		b.Observe(time.Millisecond)
+	}
+	assert.Equal(t, AdaptiveBatchTuning.MinBatch, b.Size())
+}
+
+func TestAdaptiveBatcher_Steady(t *testing.T) {
+	b := NewAdaptiveBatcher(AdaptiveBatchTuning)
+	for i := 0; i < 5; i++ {
+		b.Observe(100 * time.Millisecond)
+	}
+	size := b.Size()
+	assert.Greater(t, size, 1)
+	// The size settles once the client reads the batches in the target time
+	for i := 0; i < 5; i++ {
+		b.Observe(AdaptiveBatchTuning.TargetReadTime)
+	}
+	for i := 0; i < 5; i++ {
+		b.Observe(AdaptiveBatchTuning.TargetReadTime)
+		settled := b.Size()
+		b.Observe(AdaptiveBatchTuning.TargetReadTime)
+		assert.InDelta(t, settled, b.Size(), float64(settled)*0.25)
+	}
+}
+
+func TestNewAdaptiveBatcher_Bounds(t *testing.T) {
+	b := NewAdaptiveBatcher(BatchTuning{MinBatch: 10, MaxBatch: 5, TargetReadTime: time.Millisecond, Kp: 1})
+	assert.Equal(t, 10, b.Size())
+	b.Observe(time.Second)
+	assert.Equal(t, 10, b.Size())
+}
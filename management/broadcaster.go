@@ -0,0 +1,63 @@
+package management
+
+import (
+	"sync"
+)
+
+// broadcaster fans out the log events to the registered sessions. The sessions that are full drop the log events
+// instead of holding up the broadcast. The zero value is ready to use.
+type broadcaster struct {
+	// The sessions in the order they were registered
+	sessions []*session
+	mu       sync.RWMutex
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{}
+}
+
+// Register adds the session to the sessions that receive the log events.
+func (b *broadcaster) Register(session *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sessions = append(b.sessions, session)
+}
+
+// Unregister removes the session with the id from the sessions that receive the log events.
+func (b *broadcaster) Unregister(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, session := range b.sessions {
+		if session.id == id {
+			b.sessions = append(b.sessions[:i], b.sessions[i+1:]...)
+			return
+		}
+	}
+}
+
+// Broadcast inserts the log event to each of the sessions that it matches the filters of.
+func (b *broadcaster) Broadcast(log *Log) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, session := range b.sessions {
+		session.Insert(log)
+	}
+}
+
+// Len returns the number of registered sessions.
+func (b *broadcaster) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.sessions)
+}
+
+// each calls the function for the registered sessions until it returns false.
+func (b *broadcaster) each(f func(*session) bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, session := range b.sessions {
+		if !f(session) {
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package management
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Validate that the full sessions drop the log events without holding up the other sessions
+func TestBroadcaster_Broadcast(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var b broadcaster
+	full := newSession(1, actor{}, cancel)
+	session := newSession(logWindow, actor{}, cancel)
+	b.Register(full)
+	b.Register(session)
+
+	for i := 0; i < 3; i++ {
+		b.Broadcast(&Log{Message: "hello"})
+	}
+	assert.Len(t, full.listener, 1)
+	assert.Equal(t, uint64(2), full.Dropped())
+	assert.Len(t, session.listener, 3)
+	assert.Zero(t, session.Dropped())
+
+	b.Unregister(full.id)
+	assert.Equal(t, 1, b.Len())
+	b.Broadcast(&Log{Message: "hello"})
+	assert.Zero(t, full.Dropped())
+	assert.Len(t, session.listener, 4)
+
+	// Unregistering an unknown session is a no-op
+	b.Unregister("unknown")
+	assert.Equal(t, 1, b.Len())
+}
+
+func TestBroadcaster_Concurrent(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := newBroadcaster()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			session := newSession(logWindow, actor{}, cancel)
+			b.Register(session)
+			b.Unregister(session.id)
+		}()
+		go func() {
+			defer wg.Done()
+			b.Broadcast(&Log{Message: "hello"})
+		}()
+	}
+	wg.Wait()
+	require.Zero(t, b.Len())
+}
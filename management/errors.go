@@ -0,0 +1,78 @@
+package management
+
+import (
+	"fmt"
+	"io"
+
+	"nhooyr.io/websocket"
+)
+
+// ValidationError is a reason that the management service refused a request, with the code and message provided in
+// the HTTP error response.
+type ValidationError struct {
+	Code    int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("management request failed validation: (%d) %s", e.Code, e.Message)
+}
+
+// ReadErrorResponse reads the reasons that the management service refused a request from the body of the HTTP error
+// response. An error is returned if the body isn't a response of the management service; no reasons are returned if
+// the response isn't a failure or has no errors.
+func ReadErrorResponse(body io.Reader) ([]*ValidationError, error) {
+	var resp managementErrorResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Success {
+		return nil, nil
+	}
+	verrs := make([]*ValidationError, 0, len(resp.Errors))
+	for _, e := range resp.Errors {
+		verrs = append(verrs, &ValidationError{Code: e.Code, Message: e.Message})
+	}
+	return verrs, nil
+}
+
+// ProtocolError is returned when a message received from the management connection isn't a valid event.
+type ProtocolError struct {
+	// The message that isn't a valid event
+	Message []byte
+	Err     error
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// MalformedEventError is returned when an event received from the management connection is valid, but the logs of
+// the event aren't (see ValidateServerLog).
+type MalformedEventError struct {
+	// The message of the malformed event
+	Message []byte
+	Err     error
+}
+
+func (e *MalformedEventError) Error() string {
+	return fmt.Sprintf("malformed event from server: %v", e.Err)
+}
+
+func (e *MalformedEventError) Unwrap() error {
+	return e.Err
+}
+
+// ClosedError is returned when the management connection is closed, with the status code and the reason that the
+// connection was closed for. It unwraps to the websocket.CloseError.
+type ClosedError struct {
+	websocket.CloseError
+}
+
+func (e *ClosedError) Unwrap() error {
+	return e.CloseError
+}
@@ -0,0 +1,50 @@
+package management
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+
+	"github.com/cloudflare/cloudflared/internal/test"
+)
+
+func TestReadErrorResponse(t *testing.T) {
+	reasons, err := ReadErrorResponse(strings.NewReader(`{"success":false,"errors":[{"code":1001,"message":"missing access_token query parameter"}]}`))
+	require.NoError(t, err)
+	require.Equal(t, []*ValidationError{{Code: 1001, Message: "missing access_token query parameter"}}, reasons)
+	require.EqualError(t, reasons[0], "management request failed validation: (1001) missing access_token query parameter")
+
+	reasons, err = ReadErrorResponse(strings.NewReader(`{"success":true}`))
+	require.NoError(t, err)
+	require.Empty(t, reasons)
+
+	_, err = ReadErrorResponse(strings.NewReader("bad gateway"))
+	require.Error(t, err)
+}
+
+func TestReadServerEvent_ProtocolError(t *testing.T) {
+	for _, message := range []string{`{"type":"unknown"}`, `{}`, `not json`} {
+		_, err := ReadServerEvent(NewReaderFromBytes([]byte(message)), context.Background())
+		var protocolErr *ProtocolError
+		require.True(t, errors.As(err, &protocolErr), message)
+		require.Equal(t, []byte(message), protocolErr.Message)
+	}
+}
+
+func TestReadServerEvent_ClosedError(t *testing.T) {
+	client, server := test.WSPipe(nil, nil)
+	go func() {
+		server.Close(websocket.StatusGoingAway, "shutting down")
+	}()
+	_, err := ReadServerEvent(client, context.Background())
+	var closedErr *ClosedError
+	require.True(t, errors.As(err, &closedErr))
+	require.Equal(t, websocket.StatusGoingAway, closedErr.Code)
+	require.Equal(t, "shutting down", closedErr.Reason)
+	// The closure is still a websocket.CloseError
+	require.Equal(t, &closedErr.CloseError, AsClosed(err))
+}
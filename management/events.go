@@ -2,9 +2,16 @@ package management
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/rs/zerolog"
@@ -25,14 +32,20 @@ const (
 	UnknownClientEventType ClientEventType = ""
 	StartStreaming         ClientEventType = "start_streaming"
 	StopStreaming          ClientEventType = "stop_streaming"
+	Ping                   ClientEventType = "ping"
+	UpdateFilters          ClientEventType = "update_filters"
 
 	UnknownServerEventType ServerEventType = ""
 	Logs                   ServerEventType = "logs"
+	Pong                   ServerEventType = "pong"
+	StreamStopped          ServerEventType = "stop_streaming"
 )
 
 // ServerEvent is the base struct that informs, based of the Type field, which Event type was provided from the server.
 type ServerEvent struct {
 	Type ServerEventType `json:"type,omitempty"`
+	// The Seq of the client event that the server event acknowledges, zero if it doesn't acknowledge a client event
+	AckSeq uint64 `json:"ack_seq,omitempty"`
 	// The raw json message is provided to allow better deserialization once the type is known
 	event jsoniter.RawMessage
 }
@@ -40,6 +53,8 @@ type ServerEvent struct {
 // ClientEvent is the base struct that informs, based of the Type field, which Event type was provided from the client.
 type ClientEvent struct {
 	Type ClientEventType `json:"type,omitempty"`
+	// Numbers the client events of a connection in the order they were written, see Sequence
+	Seq uint64 `json:"seq,omitempty"`
 	// The raw json message is provided to allow better deserialization once the type is known
 	event jsoniter.RawMessage
 }
@@ -49,12 +64,39 @@ type ClientEvent struct {
 type EventStartStreaming struct {
 	ClientEvent
 	Filters *StreamingFilters `json:"filters,omitempty"`
+	// Version of cloudflared of the client, which the server uses to only send the events that the client
+	// understands (see ParseVersion). The clients that don't provide it predate it.
+	ClientVersion string `json:"client_version,omitempty"`
 }
 
 type StreamingFilters struct {
 	Events   []LogEventType `json:"events,omitempty"`
 	Level    *LogLevel      `json:"level,omitempty"`
 	Sampling float64        `json:"sampling,omitempty"`
+	// Only provide the log events with a message containing the search term
+	SearchTerm string `json:"search,omitempty"`
+	// Maximum number of log events per second to provide
+	MaxRate uint `json:"max_rate,omitempty"`
+	// Only provide the HTTP log events of requests with the method (case insensitive)
+	Method string `json:"method,omitempty"`
+	// Only provide the HTTP log events of requests with a path matching the pattern (see MatchPath); the other log
+	// events are provided regardless of the pattern
+	PathPattern string `json:"path_pattern,omitempty"`
+	// Only provide the log events with a tag containing one of the tag filters (or equal to it)
+	TagFilters []string `json:"tags,omitempty"`
+	// Only provide the log events of the connection with the ID
+	ConnID string `json:"conn_id,omitempty"`
+	// Stop streaming once this many log events were provided, as announced by an EventStreamStopped before the
+	// connection is closed
+	MaxEvents uint64 `json:"max_events,omitempty"`
+	// Don't provide the HTTP log events of the health check requests of Cloudflare (see IsHealthCheck)
+	ExcludeHealthChecks bool `json:"exclude_health_checks,omitempty"`
+	// Provide the Internal log events with the diagnostics of cloudflared, which aren't provided otherwise
+	IncludeInternalEvents bool `json:"include_internal_events,omitempty"`
+	// Replay the recent log events kept by the server since the time, and only the last LastN of them if provided,
+	// before the live log events (see Logger.SetRing)
+	Since *time.Time `json:"since,omitempty"`
+	LastN uint       `json:"last_n,omitempty"`
 }
 
 // EventStopStreaming signifies that the client wishes to halt receiving log events.
@@ -62,10 +104,48 @@ type EventStopStreaming struct {
 	ClientEvent
 }
 
+// EventUpdateFilters replaces the filters of the active streaming session without restarting it.
+type EventUpdateFilters struct {
+	ClientEvent
+	Filters *StreamingFilters `json:"filters,omitempty"`
+}
+
+// EventPing is an application-level ping that the server answers with an EventPong with the same ID. Unlike the
+// websocket pings, it allows the client to measure the round-trip time through the management service.
+type EventPing struct {
+	ClientEvent
+	ID uint64 `json:"id"`
+}
+
 // EventLog is the event that the server sends to the client with the log events.
 type EventLog struct {
 	ServerEvent
 	Logs []*Log `json:"logs"`
+	// Truncated is set when log events were dropped by the server before this event because the client
+	// wasn't reading them fast enough.
+	Truncated    bool   `json:"truncated,omitempty"`
+	DroppedCount uint64 `json:"dropped_count,omitempty"`
+	// Time that the server sent the event, which allows the client to estimate the clock skew with the server. It
+	// is zero for the events that only acknowledge a client event, and with the servers that don't provide it.
+	ServerTimestamp time.Time `json:"server_timestamp"`
+	// Number of log events of the batch, and the time (in nanoseconds) from when the first of them was queued by the
+	// server until the batch was sent, which allow the batching of the server to be tuned
+	BatchSize    int           `json:"batch_size,omitempty"`
+	BatchLatency time.Duration `json:"batch_latency,omitempty"`
+}
+
+// EventPong is the event that the server sends to the client in response to an EventPing.
+type EventPong struct {
+	ServerEvent
+	ID uint64 `json:"id"`
+}
+
+// EventStreamStopped is the event that the server sends to the client before closing the connection once the
+// streaming session provided the MaxEvents of its filters.
+type EventStreamStopped struct {
+	ServerEvent
+	// Log events provided by the streaming session
+	Events uint64 `json:"events"`
 }
 
 // LogEventType is the way that logging messages are able to be filtered.
@@ -80,6 +160,12 @@ const (
 	HTTP
 	TCP
 	UDP
+	// Internal events are the diagnostics of cloudflared itself, like its memory stats, that are only provided to the
+	// sessions with the IncludeInternalEvents filter
+	Internal
+
+	// UnknownLogEventType is returned when the event type isn't one of the known event types
+	UnknownLogEventType LogEventType = -1
 )
 
 func ParseLogEventType(s string) (LogEventType, bool) {
@@ -92,8 +178,10 @@ func ParseLogEventType(s string) (LogEventType, bool) {
 		return TCP, true
 	case "udp":
 		return UDP, true
+	case "internal":
+		return Internal, true
 	}
-	return -1, false
+	return UnknownLogEventType, false
 }
 
 func (l LogEventType) String() string {
@@ -106,8 +194,10 @@ func (l LogEventType) String() string {
 		return "tcp"
 	case UDP:
 		return "udp"
+	case Internal:
+		return "internal"
 	default:
-		return ""
+		return "unknown"
 	}
 }
 
@@ -127,6 +217,28 @@ func (e *LogEventType) UnmarshalJSON(data []byte) error {
 	return errors.New("unable to unmarshal LogEventType")
 }
 
+// MarshalBinary encodes the event type as a single byte of its value.
+func (l LogEventType) MarshalBinary() ([]byte, error) {
+	return l.AppendBinary(make([]byte, 0, 1))
+}
+
+// AppendBinary appends the single byte of MarshalBinary to b, which doesn't allocate when b has the capacity.
+func (l LogEventType) AppendBinary(b []byte) ([]byte, error) {
+	return append(b, byte(l)), nil
+}
+
+func (e *LogEventType) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return fmt.Errorf("unable to unmarshal LogEventType: expected 1 byte, got %d", len(data))
+	}
+	event := LogEventType(int8(data[0]))
+	if _, ok := ParseLogEventType(event.String()); !ok {
+		return fmt.Errorf("unable to unmarshal LogEventType: unknown value %d", event)
+	}
+	*e = event
+	return nil
+}
+
 // LogLevel corresponds to the zerolog logging levels
 // "panic", "fatal", and "trace" are exempt from this list as they are rarely used and, at least
 // the the first two are limited to failure conditions that lead to cloudflared shutting down.
@@ -137,6 +249,9 @@ const (
 	Info  LogLevel = 1
 	Warn  LogLevel = 2
 	Error LogLevel = 3
+
+	// UnknownLogLevel is returned when the level isn't one of the known levels
+	UnknownLogLevel LogLevel = -1
 )
 
 func ParseLogLevel(l string) (LogLevel, bool) {
@@ -150,7 +265,30 @@ func ParseLogLevel(l string) (LogLevel, bool) {
 	case "error":
 		return Error, true
 	}
-	return -1, false
+	return UnknownLogLevel, false
+}
+
+// LevelSynonyms are the nonstandard level names emitted by other loggers and the levels they are normalized to by
+// NormalizeLogLevel.
+var LevelSynonyms = map[string]LogLevel{
+	"trace":    Debug,
+	"warning":  Warn,
+	"err":      Error,
+	"critical": Error,
+	"fatal":    Error,
+	"panic":    Error,
+}
+
+// NormalizeLogLevel parses the level like ParseLogLevel, but case insensitively and falling back to the synonyms.
+func NormalizeLogLevel(l string, synonyms map[string]LogLevel) (LogLevel, bool) {
+	l = strings.ToLower(strings.TrimSpace(l))
+	if level, ok := ParseLogLevel(l); ok {
+		return level, true
+	}
+	if level, ok := synonyms[l]; ok {
+		return level, true
+	}
+	return UnknownLogLevel, false
 }
 
 func (l LogLevel) String() string {
@@ -164,7 +302,7 @@ func (l LogLevel) String() string {
 	case Error:
 		return "error"
 	default:
-		return ""
+		return "unknown"
 	}
 }
 
@@ -184,6 +322,28 @@ func (l *LogLevel) UnmarshalJSON(data []byte) error {
 	return fmt.Errorf("unable to unmarshal LogLevel")
 }
 
+// MarshalBinary encodes the level as a single byte of its value.
+func (l LogLevel) MarshalBinary() ([]byte, error) {
+	return l.AppendBinary(make([]byte, 0, 1))
+}
+
+// AppendBinary appends the single byte of MarshalBinary to b, which doesn't allocate when b has the capacity.
+func (l LogLevel) AppendBinary(b []byte) ([]byte, error) {
+	return append(b, byte(l)), nil
+}
+
+func (l *LogLevel) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return fmt.Errorf("unable to unmarshal LogLevel: expected 1 byte, got %d", len(data))
+	}
+	level := LogLevel(int8(data[0]))
+	if _, ok := ParseLogLevel(level.String()); !ok {
+		return fmt.Errorf("unable to unmarshal LogLevel: unknown value %d", level)
+	}
+	*l = level
+	return nil
+}
+
 const (
 	// TimeKey aligns with the zerolog.TimeFieldName
 	TimeKey = "time"
@@ -195,19 +355,128 @@ const (
 	EventTypeKey = "event"
 	// FieldsKey is a custom JSON key to match and store every other key for a zerolog event
 	FieldsKey = "fields"
+	// MethodKey is the custom JSON key of the method of the HTTP request of an HTTP log event, which is otherwise read
+	// from the request line of the message of the log event with the PathKey
+	MethodKey = "method"
+	// PathKey is the JSON key of the URL path of the HTTP request of the HTTP log event of the request
+	PathKey = "path"
+	// TagsKey is the custom JSON key of the operational labels of the log event, e.g. of the deployment
+	TagsKey = "tags"
+	// ConnIDKey is the custom JSON key of the ID of the connection of the tunnel that the log event is about
+	ConnIDKey = "conn_id"
+	// ConnIndexKey is the JSON key of the index of the connection of the tunnel of a log event, which is its ConnID
+	ConnIndexKey = "connIndex"
+	// LBProbeKey is the JSON key of the field of the HTTP log events of the probes of the load balancers of Cloudflare
+	LBProbeKey = "lbProbe"
+	// HeadersKey is the JSON key of the headers of the HTTP request of a Debug log event, which aren't kept in the
+	// ring of the recent log events since they may contain credentials
+	HeadersKey = "headers"
 )
 
 // Log is the basic structure of the events that are sent to the client.
 type Log struct {
-	Time    string                 `json:"time,omitempty"`
-	Level   LogLevel               `json:"level,omitempty"`
-	Message string                 `json:"message,omitempty"`
-	Event   LogEventType           `json:"event,omitempty"`
-	Fields  map[string]interface{} `json:"fields,omitempty"`
+	Time        string                 `json:"time,omitempty"`
+	Level       LogLevel               `json:"level,omitempty"`
+	Message     string                 `json:"message,omitempty"`
+	Event       LogEventType           `json:"event,omitempty"`
+	Method      string                 `json:"method,omitempty"`
+	Path        string                 `json:"path,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	ConnID      string                 `json:"conn_id,omitempty"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	ConnectorID string                 `json:"connector_id,omitempty"`
+	// The system metrics of cloudflared provided by the Internal log events: the number of goroutines, the bytes of
+	// the allocated heap objects, the active tunnel connections and the active management sessions
+	GoroutineCount int   `json:"goroutine_count,omitempty"`
+	HeapBytes      int64 `json:"heap_bytes,omitempty"`
+	OpenConns      int   `json:"open_conns,omitempty"`
+	SessionCount   int   `json:"session_count,omitempty"`
+	// Position of the ring of the Logger once the log event was added to it, or 0 if it wasn't
+	seq uint64
+}
+
+// DeduplicationKey returns a stable key of the connector, time, level and message of the log, which identifies the log
+// when it is received again, e.g. when the server replays the logs after a reconnect. The key is an MD5 hash, which is
+// only used for its speed.
+func (l *Log) DeduplicationKey() string {
+	h := md5.New()
+	for _, part := range []string{l.ConnectorID, l.Time, l.Level.String(), l.Message} {
+		h.Write([]byte(part))
+		// Separates the parts so that their boundaries are part of the key
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ValidateServerLog checks that the log received from the server has the fields required to output it: a time in the
+// RFC3339 format, a known level, and either a message or fields. An error describing each of the invalid fields is
+// returned.
+func ValidateServerLog(log *Log) error {
+	if log == nil {
+		return errors.New("missing log")
+	}
+	var errs []error
+	if log.Time == "" {
+		errs = append(errs, errors.New("missing log time"))
+	} else if _, err := time.Parse(time.RFC3339, log.Time); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log time: %q", log.Time))
+	}
+	if _, ok := ParseLogLevel(log.Level.String()); !ok {
+		errs = append(errs, fmt.Errorf("invalid log level: %d", log.Level))
+	}
+	// Logs of errors can be sent without a message, e.g. zerolog's Err(err).Send()
+	if log.Message == "" && len(log.Fields) == 0 {
+		errs = append(errs, errors.New("missing log message"))
+	}
+	return errors.Join(errs...)
+}
+
+// TypedFields returns the fields of the log formatted as strings. JSON numbers are decoded as float64, so the
+// numbers are formatted without an exponent and integers without a fraction, e.g. 1234000 rather than 1.234e+06.
+// Objects and arrays are formatted as JSON.
+func (l *Log) TypedFields() map[string]string {
+	if l.Fields == nil {
+		return nil
+	}
+	fields := make(map[string]string, len(l.Fields))
+	for k, v := range l.Fields {
+		fields[k] = FormatField(v)
+	}
+	return fields
+}
+
+// FormatField formats the value of a log field as with TypedFields.
+func FormatField(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		// Sorts the keys of the objects for a consistent output
+		data, err := sortedJSON.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
 }
 
 // IntoClientEvent unmarshals the provided ClientEvent into the proper type.
-func IntoClientEvent[T EventStartStreaming | EventStopStreaming](e *ClientEvent, eventType ClientEventType) (*T, bool) {
+func IntoClientEvent[T EventStartStreaming | EventStopStreaming | EventUpdateFilters | EventPing](e *ClientEvent, eventType ClientEventType) (*T, bool) {
 	if e.Type != eventType {
 		return nil, false
 	}
@@ -221,6 +490,16 @@ func IntoClientEvent[T EventStartStreaming | EventStopStreaming](e *ClientEvent,
 
 // IntoServerEvent unmarshals the provided ServerEvent into the proper type.
 func IntoServerEvent[T EventLog](e *ServerEvent, eventType ServerEventType) (*T, bool) {
+	return intoServerEvent[T](e, eventType)
+}
+
+// IntoServerControlEvent unmarshals the provided ServerEvent into the proper type of the events that control the
+// streaming session rather than provide the logs.
+func IntoServerControlEvent[T EventPong | EventStreamStopped](e *ServerEvent, eventType ServerEventType) (*T, bool) {
+	return intoServerEvent[T](e, eventType)
+}
+
+func intoServerEvent[T any](e *ServerEvent, eventType ServerEventType) (*T, bool) {
 	if e.Type != eventType {
 		return nil, false
 	}
@@ -232,29 +511,53 @@ func IntoServerEvent[T EventLog](e *ServerEvent, eventType ServerEventType) (*T,
 	return event, true
 }
 
-// ReadEvent will read a message from the websocket connection and parse it into a valid ServerEvent.
-func ReadServerEvent(c *websocket.Conn, ctx context.Context) (*ServerEvent, error) {
-	message, err := readMessage(c, ctx)
+// ReadEvent will read a message from the websocket connection and parse it into a valid ServerEvent. A ClosedError is
+// returned if the connection is closed, a ProtocolError if the message isn't a valid ServerEvent, and a
+// MalformedEventError if the logs of the event aren't valid.
+func ReadServerEvent(c MessageReader, ctx context.Context) (*ServerEvent, error) {
+	event, message, err := ReadServerEventRaw(c, ctx)
 	if err != nil {
 		return nil, err
 	}
+	if event.Type == Logs {
+		var eventLog EventLog
+		if err := json.Unmarshal(message, &eventLog); err != nil {
+			return nil, &MalformedEventError{Message: message, Err: err}
+		}
+		for _, log := range eventLog.Logs {
+			if err := ValidateServerLog(log); err != nil {
+				return nil, &MalformedEventError{Message: message, Err: err}
+			}
+		}
+	}
+	return event, nil
+}
+
+// ReadServerEventRaw will read a message from the websocket connection and parse it into a valid ServerEvent.
+// The undecoded payload of the message is also returned, even if it is not a valid ServerEvent; it is only nil if
+// the message itself could not be read from the connection.
+func ReadServerEventRaw(c MessageReader, ctx context.Context) (*ServerEvent, []byte, error) {
+	message, err := readMessage(c, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 	event := ServerEvent{}
 	if err := json.Unmarshal(message, &event); err != nil {
-		return nil, err
+		return nil, message, &ProtocolError{Message: message, Err: err}
 	}
 	switch event.Type {
-	case Logs:
+	case Logs, Pong, StreamStopped:
 		event.event = message
-		return &event, nil
+		return &event, message, nil
 	case UnknownServerEventType:
-		return nil, errInvalidMessageType
+		return nil, message, &ProtocolError{Message: message, Err: errInvalidMessageType}
 	default:
-		return nil, fmt.Errorf("invalid server message type was provided: %s", event.Type)
+		return nil, message, &ProtocolError{Message: message, Err: fmt.Errorf("invalid server message type was provided: %s", event.Type)}
 	}
 }
 
 // ReadEvent will read a message from the websocket connection and parse it into a valid ClientEvent.
-func ReadClientEvent(c *websocket.Conn, ctx context.Context) (*ClientEvent, error) {
+func ReadClientEvent(c MessageReader, ctx context.Context) (*ClientEvent, error) {
 	message, err := readMessage(c, ctx)
 	if err != nil {
 		return nil, err
@@ -264,7 +567,7 @@ func ReadClientEvent(c *websocket.Conn, ctx context.Context) (*ClientEvent, erro
 		return nil, err
 	}
 	switch event.Type {
-	case StartStreaming, StopStreaming:
+	case StartStreaming, StopStreaming, UpdateFilters, Ping:
 		event.event = message
 		return &event, nil
 	case UnknownClientEventType:
@@ -275,26 +578,89 @@ func ReadClientEvent(c *websocket.Conn, ctx context.Context) (*ClientEvent, erro
 }
 
 // readMessage will read a message from the websocket connection and return the payload.
-func readMessage(c *websocket.Conn, ctx context.Context) ([]byte, error) {
-	messageType, reader, err := c.Reader(ctx)
+func readMessage(c MessageReader, ctx context.Context) ([]byte, error) {
+	messageType, message, err := c.Read(ctx)
 	if err != nil {
+		var closeErr websocket.CloseError
+		if errors.As(err, &closeErr) {
+			return nil, &ClosedError{CloseError: closeErr}
+		}
 		return nil, err
 	}
 	if messageType != websocket.MessageText {
-		return nil, errInvalidMessageType
+		return nil, &ProtocolError{Message: message, Err: errInvalidMessageType}
 	}
-	return io.ReadAll(reader)
+	return message, nil
 }
 
-// WriteEvent will write a Event type message to the websocket connection.
-func WriteEvent(c *websocket.Conn, ctx context.Context, event any) error {
-	payload, err := json.Marshal(event)
+// WriteEvent will write a Event type message to the websocket connection. Client events written to a connection that
+// embeds a Sequence are numbered with the next Seq of the connection.
+func WriteEvent(c MessageWriter, ctx context.Context, event any) error {
+	payload, err := encodeEvent(c, event)
 	if err != nil {
 		return err
 	}
 	return c.Write(ctx, websocket.MessageText, payload)
 }
 
+// WriteEventWithRetry writes the event like WriteEvent, retrying the transient write errors up to maxAttempts times
+// in total with an exponential backoff from baseDelay plus jitter. The errors of a closed connection or a cancelled
+// context are returned without retrying. The event is numbered once, so that each attempt writes the same event.
+func WriteEventWithRetry(c MessageWriter, ctx context.Context, event any, maxAttempts int, baseDelay time.Duration) error {
+	payload, err := encodeEvent(c, event)
+	if err != nil {
+		return err
+	}
+	delay := baseDelay
+	for attempt := 1; ; attempt++ {
+		err = c.Write(ctx, websocket.MessageText, payload)
+		if err == nil || attempt >= maxAttempts || permanentWriteError(ctx, err) {
+			return err
+		}
+		// Up to half of the delay is added so that the clients don't retry in step
+		wait := delay
+		if delay > 0 {
+			wait += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// permanentWriteError returns true if writing to the connection again can't succeed. The timeouts of the writes are
+// transient unless the context of the writes is done.
+func permanentWriteError(ctx context.Context, err error) bool {
+	return ctx.Err() != nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, net.ErrClosed) ||
+		AsClosed(err) != nil
+}
+
+// encodeEvent numbers the client event if the connection embeds a Sequence and encodes it.
+func encodeEvent(c MessageWriter, event any) ([]byte, error) {
+	if seq, ok := c.(sequencer); ok {
+		if e, ok := event.(sequencedEvent); ok {
+			e.setSeq(seq.NextSeq())
+		}
+	}
+	return json.Marshal(event)
+}
+
+// sequencedEvent is implemented by the pointers to the client events.
+type sequencedEvent interface {
+	setSeq(seq uint64)
+}
+
+func (e *ClientEvent) setSeq(seq uint64) {
+	e.Seq = seq
+}
+
 // IsClosed returns true if the websocket error is a websocket.CloseError; returns false if not a
 // websocket.CloseError
 func IsClosed(err error, log *zerolog.Logger) bool {
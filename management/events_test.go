@@ -1,8 +1,15 @@
 package management
 
 import (
+	"bytes"
 	"context"
+	stdjson "encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
 	"testing"
+	"testing/quick"
 	"time"
 
 	"github.com/stretchr/testify/require"
@@ -77,6 +84,13 @@ func TestIntoClientEvent_StartStreaming(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "client version",
+			expected: EventStartStreaming{
+				ClientEvent:   ClientEvent{Type: StartStreaming},
+				ClientVersion: "2024.6.0",
+			},
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			data, err := json.Marshal(test.expected)
@@ -110,6 +124,28 @@ func TestIntoClientEvent_StopStreaming(t *testing.T) {
 	require.Equal(t, EventStopStreaming{ClientEvent: ClientEvent{Type: StopStreaming}}, *ce)
 }
 
+func TestIntoClientEvent_UpdateFilters(t *testing.T) {
+	event := ClientEvent{
+		Type:  UpdateFilters,
+		event: []byte(`{"type": "update_filters", "filters": {"level": "warn", "events": ["http"]}}`),
+	}
+	ce, ok := IntoClientEvent[EventUpdateFilters](&event, UpdateFilters)
+	require.True(t, ok)
+	require.Equal(t, UpdateFilters, ce.Type)
+	require.Equal(t, Warn, *ce.Filters.Level)
+	require.Equal(t, []LogEventType{HTTP}, ce.Filters.Events)
+}
+
+func TestIntoClientEvent_Ping(t *testing.T) {
+	event := ClientEvent{
+		Type:  Ping,
+		event: []byte(`{"type": "ping", "id": 7}`),
+	}
+	ce, ok := IntoClientEvent[EventPing](&event, Ping)
+	require.True(t, ok)
+	require.Equal(t, EventPing{ClientEvent: ClientEvent{Type: Ping}, ID: 7}, *ce)
+}
+
 func TestIntoClientEvent_Invalid(t *testing.T) {
 	event := ClientEvent{
 		Type:  UnknownClientEventType,
@@ -129,6 +165,16 @@ func TestIntoServerEvent_Logs(t *testing.T) {
 	require.Equal(t, EventLog{ServerEvent: ServerEvent{Type: Logs}}, *ce)
 }
 
+func TestIntoServerControlEvent_Pong(t *testing.T) {
+	event := ServerEvent{
+		Type:  Pong,
+		event: []byte(`{"type": "pong", "id": 7}`),
+	}
+	ce, ok := IntoServerControlEvent[EventPong](&event, Pong)
+	require.True(t, ok)
+	require.Equal(t, EventPong{ServerEvent: ServerEvent{Type: Pong}, ID: 7}, *ce)
+}
+
 func TestIntoServerEvent_Invalid(t *testing.T) {
 	event := ServerEvent{
 		Type:  UnknownServerEventType,
@@ -196,6 +242,88 @@ func TestReadServerEvent_InvalidMessageType(t *testing.T) {
 	client.Close(websocket.StatusInternalError, "")
 }
 
+func TestReadServerEvent_MalformedLogs(t *testing.T) {
+	message := `{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1"},{"message":"test2"}]}`
+	_, err := ReadServerEvent(NewReaderFromBytes([]byte(message)), context.Background())
+	var malformed *MalformedEventError
+	require.ErrorAs(t, err, &malformed)
+	require.Equal(t, message, string(malformed.Message))
+	require.EqualError(t, err, "malformed event from server: missing log time")
+
+	// The levels that can't be decoded are malformed too
+	_, err = ReadServerEvent(NewReaderFromBytes([]byte(`{"type":"logs","logs":[{"level":null}]}`)), context.Background())
+	require.ErrorAs(t, err, &malformed)
+}
+
+func TestValidateServerLog(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		log  *Log
+		errs []string
+	}{
+		{
+			name: "valid",
+			log:  &Log{Time: "2023-01-01T00:00:00.123Z", Level: Info, Message: "test"},
+		},
+		{
+			name: "fields without a message",
+			log:  &Log{Time: "2023-01-01T00:00:00Z", Level: Error, Fields: map[string]interface{}{"error": "failed"}},
+		},
+		{
+			name: "nil",
+			errs: []string{"missing log"},
+		},
+		{
+			name: "empty",
+			log:  &Log{},
+			errs: []string{"missing log time", "missing log message"},
+		},
+		{
+			name: "invalid time and level",
+			log:  &Log{Time: "yesterday", Level: LogLevel(42), Message: "test"},
+			errs: []string{`invalid log time: "yesterday"`, "invalid log level: 42"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateServerLog(tt.log)
+			if len(tt.errs) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			for _, e := range tt.errs {
+				require.ErrorContains(t, err, e)
+			}
+		})
+	}
+}
+
+func TestReadServerEventRaw(t *testing.T) {
+	payloads := []string{
+		`{"type":"logs","logs":[{"message":"test"}]}`,
+		`{"type":"unknown"}`,
+	}
+	client, server := test.WSPipe(nil, nil)
+	server.CloseRead(context.Background())
+	defer func() {
+		server.Close(websocket.StatusInternalError, "")
+	}()
+	go func() {
+		for _, payload := range payloads {
+			err := server.Write(context.Background(), websocket.MessageText, []byte(payload))
+			require.NoError(t, err)
+		}
+	}()
+	event, raw, err := ReadServerEventRaw(client, context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Logs, event.Type)
+	require.Equal(t, payloads[0], string(raw))
+	// The raw payload is provided even when it isn't a valid event
+	_, raw, err = ReadServerEventRaw(client, context.Background())
+	require.Error(t, err)
+	require.Equal(t, payloads[1], string(raw))
+	client.Close(websocket.StatusInternalError, "")
+}
+
 func TestReadClientEvent(t *testing.T) {
 	sentEvent := EventStartStreaming{
 		ClientEvent: ClientEvent{Type: StartStreaming},
@@ -245,3 +373,518 @@ func TestReadClientEvent_InvalidMessageType(t *testing.T) {
 	require.ErrorIs(t, err, errInvalidMessageType)
 	server.Close(websocket.StatusInternalError, "")
 }
+
+// randomLog wraps a Log to generate random values for testing/quick.
+type randomLog struct {
+	*Log
+}
+
+func (randomLog) Generate(r *rand.Rand, size int) reflect.Value {
+	l := &Log{
+		Time:        time.Unix(r.Int63n(1<<33), r.Int63n(int64(time.Second))).UTC().Format(time.RFC3339Nano),
+		Level:       LogLevel(r.Intn(int(Error) + 1)),
+		Message:     randomString(r, size),
+		Event:       LogEventType(r.Intn(int(UDP) + 1)),
+		ConnectorID: randomString(r, size),
+	}
+	if r.Intn(4) != 0 {
+		l.Fields = make(map[string]interface{})
+		for i := 0; i < r.Intn(size+1); i++ {
+			l.Fields[randomString(r, size)] = randomFieldValue(r, size, 2)
+		}
+	}
+	return reflect.ValueOf(randomLog{l})
+}
+
+func randomString(r *rand.Rand, size int) string {
+	v, _ := quick.Value(reflect.TypeOf(""), r)
+	runes := []rune(v.String())
+	if len(runes) > size {
+		runes = runes[:size]
+	}
+	return string(runes)
+}
+
+// randomFieldValue generates any of the values that a zerolog field can hold once encoded to JSON.
+func randomFieldValue(r *rand.Rand, size int, depth int) interface{} {
+	kinds := 6
+	if depth == 0 {
+		// Only scalar values at the maximum depth
+		kinds = 4
+	}
+	switch r.Intn(kinds) {
+	case 0:
+		return nil
+	case 1:
+		return r.Intn(2) == 0
+	case 2:
+		return r.NormFloat64() * 1e6
+	case 3:
+		return randomString(r, size)
+	case 4:
+		values := make([]interface{}, r.Intn(4))
+		for i := range values {
+			values[i] = randomFieldValue(r, size, depth-1)
+		}
+		return values
+	default:
+		values := make(map[string]interface{})
+		for i := 0; i < r.Intn(4); i++ {
+			values[randomString(r, size)] = randomFieldValue(r, size, depth-1)
+		}
+		return values
+	}
+}
+
+func TestLogEventType_String(t *testing.T) {
+	for _, tt := range []struct {
+		event    LogEventType
+		expected string
+	}{
+		{Cloudflared, "cloudflared"},
+		{HTTP, "http"},
+		{TCP, "tcp"},
+		{UDP, "udp"},
+		{Internal, "internal"},
+		{UnknownLogEventType, "unknown"},
+		{LogEventType(42), "unknown"},
+	} {
+		require.Equal(t, tt.expected, tt.event.String())
+		// Formatting the event uses the name rather than the number
+		require.Equal(t, tt.expected, fmt.Sprintf("%v", tt.event))
+		if tt.expected != "unknown" {
+			parsed, ok := ParseLogEventType(tt.expected)
+			require.True(t, ok)
+			require.Equal(t, tt.event, parsed)
+		}
+	}
+	event, ok := ParseLogEventType("dns")
+	require.False(t, ok)
+	require.Equal(t, UnknownLogEventType, event)
+}
+
+func TestLogLevel_String(t *testing.T) {
+	for _, tt := range []struct {
+		level    LogLevel
+		expected string
+	}{
+		{Debug, "debug"},
+		{Info, "info"},
+		{Warn, "warn"},
+		{Error, "error"},
+		{UnknownLogLevel, "unknown"},
+		{LogLevel(42), "unknown"},
+	} {
+		require.Equal(t, tt.expected, tt.level.String())
+		require.Equal(t, tt.expected, fmt.Sprintf("%v", tt.level))
+		if tt.expected != "unknown" {
+			parsed, ok := ParseLogLevel(tt.expected)
+			require.True(t, ok)
+			require.Equal(t, tt.level, parsed)
+		}
+	}
+	level, ok := ParseLogLevel("trace")
+	require.False(t, ok)
+	require.Equal(t, UnknownLogLevel, level)
+}
+
+func TestLogEventType_Binary(t *testing.T) {
+	for _, event := range []LogEventType{Cloudflared, HTTP, TCP, UDP, Internal} {
+		data, err := event.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, []byte{byte(event)}, data)
+		var decoded LogEventType
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		require.Equal(t, event, decoded)
+	}
+	var decoded LogEventType
+	require.Error(t, decoded.UnmarshalBinary(nil))
+	require.Error(t, decoded.UnmarshalBinary([]byte{0, 1}))
+	require.Error(t, decoded.UnmarshalBinary([]byte{42}))
+	require.Error(t, decoded.UnmarshalBinary([]byte{0xff}))
+}
+
+func TestLogLevel_Binary(t *testing.T) {
+	for _, level := range []LogLevel{Debug, Info, Warn, Error} {
+		data, err := level.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, []byte{byte(level)}, data)
+		var decoded LogLevel
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		require.Equal(t, level, decoded)
+	}
+	var decoded LogLevel
+	require.Error(t, decoded.UnmarshalBinary(nil))
+	require.Error(t, decoded.UnmarshalBinary([]byte{1, 2}))
+	require.Error(t, decoded.UnmarshalBinary([]byte{42}))
+	// The unknown level is encoded as 0xff
+	data, err := UnknownLogLevel.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xff}, data)
+	require.Error(t, decoded.UnmarshalBinary(data))
+}
+
+func BenchmarkLogLevelMarshalJSON(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := Warn.MarshalJSON(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLogLevelAppendBinary(b *testing.B) {
+	buf := make([]byte, 0, 1)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		var err error
+		if buf, err = Warn.AppendBinary(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLogLevelUnmarshalJSON(b *testing.B) {
+	data, err := Warn.MarshalJSON()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var level LogLevel
+		if err := level.UnmarshalJSON(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLogLevelUnmarshalBinary(b *testing.B) {
+	data := []byte{byte(Warn)}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		var level LogLevel
+		if err := level.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLogEventTypeMarshalJSON(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := HTTP.MarshalJSON(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLogEventTypeAppendBinary(b *testing.B) {
+	buf := make([]byte, 0, 1)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		var err error
+		if buf, err = HTTP.AppendBinary(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The event types parse only from their names, any other input is unknown
+func FuzzParseLogEventType(f *testing.F) {
+	for _, event := range []LogEventType{Cloudflared, HTTP, TCP, UDP, Internal} {
+		f.Add(event.String())
+	}
+	f.Add("")
+	f.Add("unknown")
+	f.Add("HTTP")
+	f.Add("http\x00")
+	f.Fuzz(func(t *testing.T, s string) {
+		event, ok := ParseLogEventType(s)
+		if !ok {
+			require.Equal(t, UnknownLogEventType, event)
+			return
+		}
+		require.Equal(t, s, event.String())
+	})
+}
+
+// The levels parse only from their names, any other input is unknown
+func FuzzParseLogLevel(f *testing.F) {
+	for _, level := range []LogLevel{Debug, Info, Warn, Error} {
+		f.Add(level.String())
+	}
+	f.Add("")
+	f.Add("unknown")
+	f.Add("WARN")
+	f.Add("ınfo")
+	f.Fuzz(func(t *testing.T, s string) {
+		level, ok := ParseLogLevel(s)
+		if !ok {
+			require.Equal(t, UnknownLogLevel, level)
+			return
+		}
+		require.Equal(t, s, level.String())
+	})
+}
+
+func TestNormalizeLogLevel(t *testing.T) {
+	for _, tt := range []struct {
+		level    string
+		expected LogLevel
+		ok       bool
+	}{
+		{"debug", Debug, true},
+		{"INFO", Info, true},
+		{" warn ", Warn, true},
+		{"error", Error, true},
+		{"trace", Debug, true},
+		{"warning", Warn, true},
+		{"Warning", Warn, true},
+		{"err", Error, true},
+		{"critical", Error, true},
+		{"fatal", Error, true},
+		{"panic", Error, true},
+		{"verbose", UnknownLogLevel, false},
+	} {
+		t.Run(tt.level, func(t *testing.T) {
+			level, ok := NormalizeLogLevel(tt.level, LevelSynonyms)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.expected, level)
+		})
+	}
+}
+
+// Validate that the Log wire format is stable across JSON round-trips
+func TestLog_JSONRoundTrip(t *testing.T) {
+	roundTrip := func(l randomLog) bool {
+		first, err := json.Marshal(l.Log)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		var decoded Log
+		if err := json.Unmarshal(first, &decoded); err != nil {
+			t.Log(err)
+			return false
+		}
+		second, err := json.Marshal(&decoded)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		// The order of the fields isn't stable, so the encodings are compared once decoded
+		var firstValue, secondValue interface{}
+		if err := stdjson.Unmarshal(first, &firstValue); err != nil {
+			t.Log(err)
+			return false
+		}
+		if err := stdjson.Unmarshal(second, &secondValue); err != nil {
+			t.Log(err)
+			return false
+		}
+		if !reflect.DeepEqual(firstValue, secondValue) {
+			t.Logf("round-trip changed the encoding:\n%s\n%s", first, second)
+			return false
+		}
+		// The decoded log is identical after another round-trip
+		var again Log
+		if err := json.Unmarshal(second, &again); err != nil {
+			t.Log(err)
+			return false
+		}
+		return reflect.DeepEqual(decoded, again)
+	}
+	require.NoError(t, quick.Check(roundTrip, &quick.Config{MaxCount: 500}))
+}
+
+func TestReadEvent_PingPong(t *testing.T) {
+	ctx := context.Background()
+	clientEvent, err := ReadClientEvent(NewReaderFromBytes([]byte(`{"type":"ping","id":1}`)), ctx)
+	require.NoError(t, err)
+	ping, ok := IntoClientEvent[EventPing](clientEvent, Ping)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), ping.ID)
+
+	serverEvent, err := ReadServerEvent(NewReaderFromBytes([]byte(`{"type":"pong","id":1}`)), ctx)
+	require.NoError(t, err)
+	pong, ok := IntoServerControlEvent[EventPong](serverEvent, Pong)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), pong.ID)
+}
+
+// sequencedWriter numbers the client events written to w.
+type sequencedWriter struct {
+	MessageWriter
+	Sequence
+}
+
+func TestWriteEvent_Seq(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	w := &sequencedWriter{MessageWriter: NewWriterToBuffer(&buf)}
+	require.NoError(t, WriteEvent(w, ctx, &EventStartStreaming{ClientEvent: ClientEvent{Type: StartStreaming}}))
+	require.NoError(t, WriteEvent(w, ctx, &EventPing{ClientEvent: ClientEvent{Type: Ping}}))
+	// Server events aren't numbered
+	require.NoError(t, WriteEvent(w, ctx, &EventPong{ServerEvent: ServerEvent{Type: Pong, AckSeq: 2}}))
+	require.NoError(t, WriteEvent(w, ctx, &EventStopStreaming{ClientEvent: ClientEvent{Type: StopStreaming}}))
+
+	r := NewReaderFromBytes(buf.Bytes())
+	event, err := ReadClientEvent(r, ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), event.Seq)
+	event, err = ReadClientEvent(r, ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), event.Seq)
+	pong, err := ReadServerEvent(r, ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), pong.AckSeq)
+	event, err = ReadClientEvent(r, ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), event.Seq)
+
+	// Writers without a sequence don't number the events
+	buf.Reset()
+	require.NoError(t, WriteEvent(NewWriterToBuffer(&buf), ctx, &EventPing{ClientEvent: ClientEvent{Type: Ping}}))
+	require.JSONEq(t, `{"type":"ping","id":0}`, buf.String())
+}
+
+// flakyWriter fails the first writes with the error before writing to the MessageWriter.
+type flakyWriter struct {
+	MessageWriter
+	Sequence
+	failures int
+	err      error
+	writes   int
+}
+
+func (w *flakyWriter) Write(ctx context.Context, messageType websocket.MessageType, message []byte) error {
+	w.writes++
+	if w.writes <= w.failures {
+		return w.err
+	}
+	return w.MessageWriter.Write(ctx, messageType, message)
+}
+
+func TestWriteEventWithRetry(t *testing.T) {
+	ctx := context.Background()
+	timeout := fmt.Errorf("failed to write frame: %w", context.DeadlineExceeded)
+	for _, tt := range []struct {
+		name        string
+		failures    int
+		err         error
+		maxAttempts int
+		writes      int
+		expectErr   bool
+	}{
+		{
+			name:        "first attempt",
+			maxAttempts: 3,
+			writes:      1,
+		},
+		{
+			name:        "transient errors",
+			failures:    2,
+			err:         timeout,
+			maxAttempts: 3,
+			writes:      3,
+		},
+		{
+			name:        "attempts exhausted",
+			failures:    3,
+			err:         timeout,
+			maxAttempts: 3,
+			writes:      3,
+			expectErr:   true,
+		},
+		{
+			name:        "closed connection",
+			failures:    1,
+			err:         websocket.CloseError{Code: websocket.StatusGoingAway},
+			maxAttempts: 3,
+			writes:      1,
+			expectErr:   true,
+		},
+		{
+			name:        "closed network connection",
+			failures:    1,
+			err:         fmt.Errorf("failed to write frame: %w", net.ErrClosed),
+			maxAttempts: 3,
+			writes:      1,
+			expectErr:   true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &flakyWriter{MessageWriter: NewWriterToBuffer(&buf), failures: tt.failures, err: tt.err}
+			err := WriteEventWithRetry(w, ctx, &EventPing{ClientEvent: ClientEvent{Type: Ping}}, tt.maxAttempts, time.Millisecond)
+			require.Equal(t, tt.writes, w.writes)
+			if tt.expectErr {
+				require.ErrorIs(t, err, tt.err)
+				require.Empty(t, buf.String())
+				return
+			}
+			require.NoError(t, err)
+			// The event is numbered once for all of the attempts
+			require.JSONEq(t, `{"type":"ping","seq":1,"id":0}`, buf.String())
+		})
+	}
+}
+
+func TestWriteEventWithRetry_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &flakyWriter{MessageWriter: NewWriterToBuffer(&bytes.Buffer{}), failures: 1, err: fmt.Errorf("failed to write frame: %w", context.DeadlineExceeded)}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	// The backoff is interrupted once the context is cancelled
+	err := WriteEventWithRetry(w, ctx, &EventPing{ClientEvent: ClientEvent{Type: Ping}}, 3, time.Hour)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, w.writes)
+}
+
+func TestLog_TypedFields(t *testing.T) {
+	log := &Log{Fields: map[string]interface{}{
+		"string":  "value",
+		"int":     float64(1234000),
+		"float":   1.5,
+		"large":   1e21,
+		"bool":    true,
+		"null":    nil,
+		"object":  map[string]interface{}{"b": float64(2), "a": "1"},
+		"array":   []interface{}{float64(1), "2"},
+		"integer": 42,
+	}}
+	require.Equal(t, map[string]string{
+		"string":  "value",
+		"int":     "1234000",
+		"float":   "1.5",
+		"large":   "1000000000000000000000",
+		"bool":    "true",
+		"null":    "null",
+		"object":  `{"a":"1","b":2}`,
+		"array":   `[1,"2"]`,
+		"integer": "42",
+	}, log.TypedFields())
+}
+
+func TestLog_DeduplicationKey(t *testing.T) {
+	l := &Log{Time: "2023-01-01T00:00:00Z", Level: Info, Message: "test", ConnectorID: "connector"}
+	// The key only depends on the connector, time, level and message
+	withFields := *l
+	withFields.Fields = map[string]interface{}{"a": "b"}
+	require.Equal(t, l.DeduplicationKey(), withFields.DeduplicationKey())
+	require.Len(t, l.DeduplicationKey(), 32)
+
+	for _, other := range []*Log{
+		{Time: "2023-01-01T00:00:01Z", Level: Info, Message: "test", ConnectorID: "connector"},
+		{Time: "2023-01-01T00:00:00Z", Level: Warn, Message: "test", ConnectorID: "connector"},
+		{Time: "2023-01-01T00:00:00Z", Level: Info, Message: "other", ConnectorID: "connector"},
+		{Time: "2023-01-01T00:00:00Z", Level: Info, Message: "test", ConnectorID: "other"},
+		// The boundaries of the parts are part of the key
+		{Time: "2023-01-01T00:00:00Z", Level: Info, Message: "", ConnectorID: "connectortest"},
+	} {
+		require.NotEqual(t, l.DeduplicationKey(), other.DeduplicationKey(), "%+v", other)
+	}
+}
@@ -0,0 +1,206 @@
+package management
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// HealthCheckPath is the default path of the health check requests of Cloudflare.
+const HealthCheckPath = "/__cloudflare__/healthcheck"
+
+// FilterOption configures the StreamingFilters created by NewStreamingFilters.
+type FilterOption func(f *StreamingFilters)
+
+// NewStreamingFilters creates the StreamingFilters from the provided options.
+func NewStreamingFilters(opts ...FilterOption) *StreamingFilters {
+	f := &StreamingFilters{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// WithLevel only provides the log events at or above the level.
+func WithLevel(level LogLevel) FilterOption {
+	return func(f *StreamingFilters) {
+		f.Level = &level
+	}
+}
+
+// WithEvents only provides the log events of the event types.
+func WithEvents(events ...LogEventType) FilterOption {
+	return func(f *StreamingFilters) {
+		f.Events = append(f.Events, events...)
+	}
+}
+
+// WithSampling provides approximately the percentage (0.0 .. 1.0) of the log events.
+func WithSampling(sampling float64) FilterOption {
+	return func(f *StreamingFilters) {
+		f.Sampling = sampling
+	}
+}
+
+// WithSearchTerm only provides the log events with a message containing the search term.
+func WithSearchTerm(term string) FilterOption {
+	return func(f *StreamingFilters) {
+		f.SearchTerm = term
+	}
+}
+
+// WithMaxRate limits the log events provided to the rate per second.
+func WithMaxRate(rate uint) FilterOption {
+	return func(f *StreamingFilters) {
+		f.MaxRate = rate
+	}
+}
+
+// WithMethod only provides the HTTP log events of requests with the method.
+func WithMethod(method string) FilterOption {
+	return func(f *StreamingFilters) {
+		f.Method = method
+	}
+}
+
+// WithPathPattern only provides the HTTP log events of requests with a path matching the pattern (see MatchPath).
+func WithPathPattern(pattern string) FilterOption {
+	return func(f *StreamingFilters) {
+		f.PathPattern = pattern
+	}
+}
+
+// WithTags only provides the log events with a tag that contains (or equals) one of the tags.
+func WithTags(tags ...string) FilterOption {
+	return func(f *StreamingFilters) {
+		f.TagFilters = tags
+	}
+}
+
+// WithConnID only provides the log events of the connection with the ID.
+func WithConnID(id string) FilterOption {
+	return func(f *StreamingFilters) {
+		f.ConnID = id
+	}
+}
+
+// WithMaxEvents stops streaming once the number of log events were provided.
+func WithMaxEvents(n uint64) FilterOption {
+	return func(f *StreamingFilters) {
+		f.MaxEvents = n
+	}
+}
+
+// WithInternalEvents provides the Internal log events with the diagnostics of cloudflared.
+func WithInternalEvents() FilterOption {
+	return func(f *StreamingFilters) {
+		f.IncludeInternalEvents = true
+	}
+}
+
+// WithSince replays the recent log events since the time before the live log events.
+func WithSince(since time.Time) FilterOption {
+	return func(f *StreamingFilters) {
+		f.Since = &since
+	}
+}
+
+// WithLastN replays the last n of the recent log events before the live log events.
+func WithLastN(n uint) FilterOption {
+	return func(f *StreamingFilters) {
+		f.LastN = n
+	}
+}
+
+// WithoutHealthChecks doesn't provide the HTTP log events of the health check requests of Cloudflare.
+func WithoutHealthChecks() FilterOption {
+	return func(f *StreamingFilters) {
+		f.ExcludeHealthChecks = true
+	}
+}
+
+// ValidateFilters checks the StreamingFilters for values that are out of range or contradict each other. An error
+// describing each of the invalid filters is returned.
+func ValidateFilters(f *StreamingFilters) error {
+	if f == nil {
+		return nil
+	}
+	var errs []error
+	if f.Level != nil {
+		if _, ok := ParseLogLevel(f.Level.String()); !ok {
+			errs = append(errs, fmt.Errorf("invalid level filter: %d", *f.Level))
+		}
+	}
+	seen := make(map[LogEventType]bool, len(f.Events))
+	for _, e := range f.Events {
+		if _, ok := ParseLogEventType(e.String()); !ok {
+			errs = append(errs, fmt.Errorf("invalid event filter: %d", e))
+			continue
+		}
+		if seen[e] {
+			errs = append(errs, fmt.Errorf("duplicate event filter: %s", e))
+		}
+		seen[e] = true
+	}
+	if f.Sampling < 0 || f.Sampling > 1 {
+		errs = append(errs, fmt.Errorf("invalid sampling filter: %g is not in the range (0.0 .. 1.0)", f.Sampling))
+	}
+	if f.PathPattern != "" {
+		for _, segment := range strings.Split(f.PathPattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				errs = append(errs, fmt.Errorf("invalid path pattern filter: %q", f.PathPattern))
+				break
+			}
+		}
+	}
+	for _, tag := range f.TagFilters {
+		if tag == "" {
+			errs = append(errs, errors.New("empty tag filter"))
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MatchPath reports whether the URL path matches the pattern. The segments of the pattern are matched against the
+// segments of the path with path.Match, e.g. * matches any segment, and a ** segment matches any number of segments.
+// A malformed pattern doesn't match any path.
+func MatchPath(pattern, p string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// IsHealthCheck reports whether the log event is about a health check request of Cloudflare: a probe of the load
+// balancers, or a request to one of the paths of the health checks.
+func IsHealthCheck(log *Log, paths []string) bool {
+	if log.Event != HTTP {
+		return false
+	}
+	if probe, _ := log.Fields[LBProbeKey].(bool); probe {
+		return true
+	}
+	return slices.Contains(paths, log.Path)
+}
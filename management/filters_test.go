@@ -0,0 +1,157 @@
+package management
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStreamingFilters(t *testing.T) {
+	assert.Equal(t, &StreamingFilters{}, NewStreamingFilters())
+
+	level := Warn
+	filters := NewStreamingFilters(
+		WithLevel(Warn),
+		WithEvents(HTTP, TCP),
+		WithEvents(UDP),
+		WithSampling(0.5),
+		WithSearchTerm("origin"),
+		WithMaxRate(100),
+		WithMethod("GET"),
+		WithPathPattern("/api/*"),
+	)
+	assert.Equal(t, &StreamingFilters{
+		Level:       &level,
+		Events:      []LogEventType{HTTP, TCP, UDP},
+		Sampling:    0.5,
+		SearchTerm:  "origin",
+		MaxRate:     100,
+		Method:      "GET",
+		PathPattern: "/api/*",
+	}, filters)
+}
+
+func TestValidateFilters(t *testing.T) {
+	invalidLevel := LogLevel(10)
+	for _, test := range []struct {
+		name    string
+		filters *StreamingFilters
+		errs    []string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:    "valid",
+			filters: NewStreamingFilters(WithLevel(Info), WithEvents(HTTP, TCP), WithSampling(0.5)),
+		},
+		{
+			name:    "invalid level",
+			filters: &StreamingFilters{Level: &invalidLevel},
+			errs:    []string{"invalid level filter: 10"},
+		},
+		{
+			name:    "invalid and duplicate events",
+			filters: NewStreamingFilters(WithEvents(HTTP, LogEventType(9), HTTP)),
+			errs:    []string{"invalid event filter: 9", "duplicate event filter: http"},
+		},
+		{
+			name:    "invalid path pattern",
+			filters: NewStreamingFilters(WithPathPattern("/api/[")),
+			errs:    []string{`invalid path pattern filter: "/api/["`},
+		},
+		{
+			name:    "invalid sampling",
+			filters: NewStreamingFilters(WithSampling(1.5)),
+			errs:    []string{"invalid sampling filter: 1.5 is not in the range (0.0 .. 1.0)"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateFilters(test.filters)
+			if len(test.errs) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, e := range test.errs {
+				assert.ErrorContains(t, err, e)
+			}
+		})
+	}
+}
+
+func benchmarkFilters() *StreamingFilters {
+	return NewStreamingFilters(
+		WithLevel(Debug),
+		WithEvents(Cloudflared, HTTP, TCP, UDP),
+		WithSampling(0.5),
+		WithSearchTerm("origin"),
+		WithMaxRate(100),
+		WithMethod("GET"),
+		WithPathPattern("/api/*"),
+	)
+}
+
+func BenchmarkStreamingFiltersMarshal(b *testing.B) {
+	filters := benchmarkFilters()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := json.Marshal(filters); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStreamingFiltersUnmarshal(b *testing.B) {
+	data, err := json.Marshal(benchmarkFilters())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var filters StreamingFilters
+		if err := json.Unmarshal(data, &filters); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		path    string
+		matched bool
+	}{
+		{"/api/v2/users", "/api/v2/users", true},
+		{"/api/*/users", "/api/v2/users", true},
+		{"/api/*", "/api/v2/users", false},
+		{"/api/**", "/api/v2/users", true},
+		{"/api/**", "/api", true},
+		{"/api/**", "/static/app.js", false},
+		{"/**/users", "/api/v2/users", true},
+		{"/**/users", "/users", true},
+		{"/**/users", "/api/v2/users/1", false},
+		{"**", "/anything/at/all", true},
+		{"/api/v[12]/*", "/api/v2/users", true},
+		{"/api/[", "/api/[", false},
+	} {
+		assert.Equal(t, test.matched, MatchPath(test.pattern, test.path), "%s %s", test.pattern, test.path)
+	}
+}
+
+func TestIsHealthCheck(t *testing.T) {
+	for _, test := range []struct {
+		log         *Log
+		healthCheck bool
+	}{
+		{&Log{Event: HTTP, Path: HealthCheckPath}, true},
+		{&Log{Event: HTTP, Path: "/health"}, true},
+		{&Log{Event: HTTP, Path: "/", Fields: map[string]interface{}{LBProbeKey: true}}, true},
+		{&Log{Event: HTTP, Path: "/", Fields: map[string]interface{}{LBProbeKey: false}}, false},
+		{&Log{Event: HTTP, Path: "/api"}, false},
+		{&Log{Event: Cloudflared, Path: HealthCheckPath}, false},
+	} {
+		assert.Equal(t, test.healthCheck, IsHealthCheck(test.log, []string{HealthCheckPath, "/health"}), "%+v", test.log)
+	}
+}
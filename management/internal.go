@@ -0,0 +1,30 @@
+package management
+
+import (
+	"runtime"
+
+	"github.com/rs/zerolog"
+)
+
+// runtimeStatsEvent returns the Internal log event with the system metrics of cloudflared, along with its garbage
+// collection stats in the fields.
+func runtimeStatsEvent(openConns, sessionCount int) (*Log, error) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	log, err := NewLogFromZerolog(func(e *zerolog.Event) {
+		e.Int(EventTypeKey, int(Internal)).
+			Uint64("heap_sys", stats.HeapSys).
+			Uint64("heap_objects", stats.HeapObjects).
+			Uint32("num_gc", stats.NumGC).
+			Uint64("gc_pause_total_ns", stats.PauseTotalNs).
+			Float64("gc_cpu_fraction", stats.GCCPUFraction)
+	}, zerolog.InfoLevel, "runtime stats")
+	if err != nil {
+		return nil, err
+	}
+	log.GoroutineCount = runtime.NumGoroutine()
+	log.HeapBytes = int64(stats.HeapAlloc)
+	log.OpenConns = openConns
+	log.SessionCount = sessionCount
+	return log, nil
+}
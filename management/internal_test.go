@@ -0,0 +1,27 @@
+package management
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeStatsEvent(t *testing.T) {
+	log, err := runtimeStatsEvent(4, 1)
+	require.NoError(t, err)
+	require.Equal(t, Internal, log.Event)
+	require.Equal(t, Info, log.Level)
+	require.Equal(t, "runtime stats", log.Message)
+	require.NotEmpty(t, log.Time)
+	require.Greater(t, log.GoroutineCount, 0)
+	require.Greater(t, log.HeapBytes, int64(0))
+	require.Equal(t, 4, log.OpenConns)
+	require.Equal(t, 1, log.SessionCount)
+	require.Contains(t, log.Fields, "num_gc")
+	require.Contains(t, log.Fields, "gc_cpu_fraction")
+
+	// The metrics are provided to the client with the log
+	data, err := json.Marshal(log)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"open_conns":4,"session_count":1`)
+}
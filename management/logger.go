@@ -1,8 +1,11 @@
 package management
 
 import (
+	"bytes"
 	"os"
-	"sync"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -11,10 +14,19 @@ import (
 
 var json = jsoniter.ConfigFastest
 
+// headersField is the key of the HeadersKey field of a zerolog event
+var headersField = []byte(`"` + HeadersKey + `":`)
+
+// sortedJSON is used where the output needs to be consistent, e.g. for display
+var sortedJSON = jsoniter.Config{SortMapKeys: true}.Froze()
+
 // Logger manages the number of management streaming log sessions
 type Logger struct {
-	sessions []*session
-	mu       sync.RWMutex
+	broadcaster broadcaster
+	// Keeps the recent log events to replay them to the streaming sessions, if set
+	ring atomic.Pointer[logRing]
+	// Indicates if a session requested to replay the recent log events, before which the ring doesn't keep them
+	replayRequested atomic.Bool
 
 	// Unique logger that isn't a io.Writer of the list of zerolog writers. This helps prevent management log
 	// statements from creating infinite recursion to export messages to a session and allows basic debugging and
@@ -44,61 +56,81 @@ type LoggerListener interface {
 }
 
 func (l *Logger) ActiveSession(actor actor) *session {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	for _, session := range l.sessions {
+	var active *session
+	l.broadcaster.each(func(session *session) bool {
 		if session.actor.ID == actor.ID && session.active.Load() {
-			return session
+			active = session
+			return false
 		}
-	}
-	return nil
+		return true
+	})
+	return active
 }
 
 func (l *Logger) ActiveSessions() int {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
 	count := 0
-	for _, session := range l.sessions {
+	l.broadcaster.each(func(session *session) bool {
 		if session.active.Load() {
 			count += 1
 		}
-	}
+		return true
+	})
 	return count
 }
 
+// SetRing keeps the size most recent log events of the level or above for up to the TTL, which are replayed to the
+// sessions with the Since or LastN filters when they start listening. The log events are only kept once the first of
+// these sessions started listening, so that the tunnels that don't replay them don't pay for it, and aren't kept when
+// the size is 0.
+func (l *Logger) SetRing(size int, ttl time.Duration, level zerolog.Level) {
+	if size <= 0 {
+		l.ring.Store(nil)
+		return
+	}
+	l.ring.Store(newLogRing(size, ttl, level))
+}
+
+// Listen registers the session to receive the log events, along with the recent log events that it replays. The log
+// events added to the ring before the session replays them may also be provided live, which the session discards.
 func (l *Logger) Listen(session *session) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	session.active.Store(true)
-	l.sessions = append(l.sessions, session)
+	l.broadcaster.Register(session)
+	if ring := l.ring.Load(); ring != nil && session.replays() {
+		l.replayRequested.Store(true)
+		session.replayFrom(ring, ring.position(), time.Now())
+	}
 }
 
 func (l *Logger) Remove(session *session) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	index := -1
-	for i, v := range l.sessions {
-		if v == session {
-			index = i
-			break
-		}
-	}
-	if index == -1 {
-		// Not found
-		return
-	}
-	copy(l.sessions[index:], l.sessions[index+1:])
-	l.sessions = l.sessions[:len(l.sessions)-1]
+	l.broadcaster.Unregister(session.id)
 }
 
 // Write will write the log event to all sessions that have available capacity. For those that are full, the message
 // will be dropped.
 // This function is the interface that zerolog expects to call when a log event is to be written out.
 func (l *Logger) Write(p []byte) (int, error) {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	// return early if no active sessions
-	if len(l.sessions) == 0 {
+	return l.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel writes the log event of the level, which is only kept in the ring if it's at the level of the ring or
+// above. The log events written without a level are kept.
+func (l *Logger) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	// return early if no active sessions, and the recent log events aren't kept
+	ring := l.ring.Load()
+	if ring != nil && (!l.replayRequested.Load() || level < ring.level) {
+		ring = nil
+	}
+	if l.broadcaster.Len() == 0 && ring == nil {
+		return len(p), nil
+	}
+	// The log event is added to the ring before the broadcast, so that the sessions that start listening after it
+	// was added replay it if they weren't provided it live. The log events with the headers of the HTTP requests
+	// aren't kept.
+	var seq uint64
+	if ring != nil && !bytes.Contains(p, headersField) {
+		seq = ring.add(p, time.Now())
+	}
+	if l.broadcaster.Len() == 0 {
 		return len(p), nil
 	}
 	event, err := parseZerologEvent(p)
@@ -107,14 +139,23 @@ func (l *Logger) Write(p []byte) (int, error) {
 		l.Log.Debug().Msg("unable to parse log event")
 		return len(p), nil
 	}
-	for _, session := range l.sessions {
-		session.Insert(event)
-	}
+	event.seq = seq
+	l.broadcaster.Broadcast(event)
 	return len(p), nil
 }
 
-func (l *Logger) WriteLevel(level zerolog.Level, p []byte) (n int, err error) {
-	return l.Write(p)
+// NewLogFromZerolog creates the Log of a zerolog event of the level with the message and the fields added by fields,
+// which are extracted the same way as for the log events written to the Logger. The fields of a zerolog.Event can't be
+// read back once added, so the event is written to a buffer and parsed like the written log events.
+func NewLogFromZerolog(fields func(e *zerolog.Event), level zerolog.Level, msg string) (*Log, error) {
+	var buf bytes.Buffer
+	log := zerolog.New(&buf).With().Timestamp().Logger()
+	e := log.WithLevel(level)
+	if fields != nil {
+		fields(e)
+	}
+	e.Msg(msg)
+	return parseZerologEvent(buf.Bytes())
 }
 
 func parseZerologEvent(p []byte) (*Log, error) {
@@ -166,6 +207,28 @@ func parseZerologEvent(p []byte) (*Log, error) {
 		Event:   logEvent,
 		Message: logMessage,
 	}
+	// The HTTP request details are promoted to top level keys so that they can be filtered on. The log event of the
+	// request has the path, and the method in its request line, rather than the method field.
+	if method, ok := fields[MethodKey].(string); ok {
+		event.Method = method
+		delete(fields, MethodKey)
+	}
+	if path, ok := fields[PathKey].(string); ok {
+		event.Path = path
+		delete(fields, PathKey)
+		if event.Method == "" && logEvent == HTTP {
+			event.Method = requestLineMethod(logMessage)
+		}
+	}
+	// The tags are promoted as well when all of them are strings
+	if tags, ok := stringSlice(fields[TagsKey]); ok {
+		event.Tags = tags
+		delete(fields, TagsKey)
+	}
+	// The index of the connection is kept in the Fields as well
+	if connIndex, ok := fields[ConnIndexKey].(float64); ok {
+		event.ConnID = strconv.Itoa(int(connIndex))
+	}
 	// Remove the keys that have top level keys on Log
 	delete(fields, TimeKey)
 	delete(fields, LevelKey)
@@ -175,3 +238,30 @@ func parseZerologEvent(p []byte) (*Log, error) {
 	event.Fields = fields
 	return &event, nil
 }
+
+// requestLineMethod returns the method of the message if it's a request line, e.g. "GET https://example.com/ HTTP/1.1",
+// or an empty string otherwise.
+func requestLineMethod(message string) string {
+	parts := strings.Split(message, " ")
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/") {
+		return ""
+	}
+	return parts[0]
+}
+
+// stringSlice returns the strings of the decoded JSON array, or false if it isn't an array of strings.
+func stringSlice(v interface{}) ([]string, bool) {
+	values, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		strs = append(strs, str)
+	}
+	return strs, true
+}
@@ -3,6 +3,7 @@ package management
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -41,6 +42,111 @@ func TestLoggerWrite_OneSession(t *testing.T) {
 	}
 }
 
+// Validate that the sessions replay the recent events kept by the logger
+func TestLoggerWrite_Ring(t *testing.T) {
+	logger := NewLogger()
+	logger.SetRing(2, time.Minute, zerolog.InfoLevel)
+	zlog := zerolog.New(logger).With().Timestamp().Logger().Level(zerolog.DebugLevel)
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The events aren't kept until a session requested to replay them
+	zlog.Info().Msg("before")
+	first := newSession(logWindow, actor{ID: actorID}, cancel)
+	first.Filters(NewStreamingFilters(WithLastN(10)))
+	logger.Listen(first)
+	assert.Empty(t, first.takeReplay())
+	logger.Remove(first)
+
+	// The events are then kept without any sessions, from the level of the ring
+	zlog.Info().Msg("first")
+	zlog.Info().Msg("second")
+	zlog.Debug().Msg("debug")
+	zlog.Info().Msg("third")
+	session := newSession(logWindow, actor{ID: actorID}, cancel)
+	session.Filters(NewStreamingFilters(WithLastN(10)))
+	logger.Listen(session)
+	defer logger.Remove(session)
+	zlog.Info().Msg("live")
+	assert.Equal(t, []string{"second", "third"}, messages(session.takeReplay()))
+	require.Len(t, session.listener, 1)
+	assert.Equal(t, "live", (<-session.listener).Message)
+
+	// The sessions without the Since or LastN filters don't replay the events
+	other := newSession(logWindow, actor{ID: "other"}, cancel)
+	logger.Listen(other)
+	defer logger.Remove(other)
+	assert.Empty(t, other.takeReplay())
+
+	logger.SetRing(0, 0, zerolog.InfoLevel)
+	assert.Nil(t, logger.ring.Load())
+}
+
+// Validate that the events with the headers of the HTTP requests aren't kept by the logger
+func TestLoggerWrite_RingHeaders(t *testing.T) {
+	logger := NewLogger()
+	logger.SetRing(10, time.Minute, zerolog.DebugLevel)
+	logger.replayRequested.Store(true)
+	zlog := zerolog.New(logger).With().Timestamp().Logger().Level(zerolog.DebugLevel)
+	zlog.Debug().Interface(HeadersKey, map[string][]string{"Authorization": {"secret"}}).Msg("GET / HTTP/1.1")
+	zlog.Info().Msg("kept")
+	ring := logger.ring.Load()
+	assert.Equal(t, []string{"kept"}, messages(ring.before(ring.position(), time.Time{}, time.Now())))
+}
+
+// Validate that the events provided live while the session replays them are only provided once
+func TestLoggerWrite_RingReplayedLive(t *testing.T) {
+	logger := NewLogger()
+	logger.SetRing(10, time.Minute, zerolog.DebugLevel)
+	logger.replayRequested.Store(true)
+	zlog := zerolog.New(logger).With().Timestamp().Logger().Level(zerolog.InfoLevel)
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session := newSession(logWindow, actor{ID: actorID}, cancel)
+	session.Filters(NewStreamingFilters(WithLastN(10)))
+	// The event is added once the session is registered, but before it replays the ring
+	logger.broadcaster.Register(session)
+	defer logger.Remove(session)
+	zlog.Info().Msg("replayed")
+	ring := logger.ring.Load()
+	session.replayFrom(ring, ring.position(), time.Now())
+	zlog.Info().Msg("live")
+	assert.Equal(t, []string{"replayed"}, messages(session.takeReplay()))
+	require.Len(t, session.listener, 2)
+	logs, _ := session.drain(logWindow)
+	assert.Equal(t, []string{"live"}, messages(logs))
+}
+
+func BenchmarkLoggerWrite_NoSessions(b *testing.B) {
+	event := []byte(`{"level":"debug","event":1,"connIndex":0,"time":"2023-01-01T00:00:00Z","message":"GET https://example.com/ HTTP/1.1"}`)
+	for _, bm := range []struct {
+		name  string
+		setup func(logger *Logger)
+	}{
+		// The ring isn't set, as for the tunnels before the ring was added
+		{name: "baseline", setup: func(*Logger) {}},
+		{name: "ring", setup: func(logger *Logger) { logger.SetRing(DefaultLogRingSize, DefaultLogRingTTL, zerolog.InfoLevel) }},
+		{name: "ring requested", setup: func(logger *Logger) {
+			logger.SetRing(DefaultLogRingSize, DefaultLogRingTTL, zerolog.InfoLevel)
+			logger.replayRequested.Store(true)
+		}},
+		{name: "ring requested at debug", setup: func(logger *Logger) {
+			logger.SetRing(DefaultLogRingSize, DefaultLogRingTTL, zerolog.DebugLevel)
+			logger.replayRequested.Store(true)
+		}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			logger := NewLogger()
+			bm.setup(logger)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = logger.WriteLevel(zerolog.DebugLevel, event)
+			}
+		})
+	}
+}
+
 // Validate all sessions receive the same event
 func TestLoggerWrite_MultipleSessions(t *testing.T) {
 	logger := NewLogger()
@@ -150,3 +256,82 @@ func TestParseZerologEvent_Fields(t *testing.T) {
 	require.NotContains(t, event.Fields, MessageKey)
 	require.NotContains(t, event.Fields, TimeKey)
 }
+
+// Validate the HTTP request details are promoted out of the Fields
+func TestParseZerologEvent_HTTPRequest(t *testing.T) {
+	writer := mockWriter{}
+	zlog := zerolog.New(&writer).With().Timestamp().Logger().Level(zerolog.InfoLevel)
+	zlog.Info().Int(EventTypeKey, int(HTTP)).Str(PathKey, "/api").Str("host", "example.com").Msg("GET https://example.com/api HTTP/1.1")
+	require.NoError(t, writer.err)
+	event := writer.event
+	require.Equal(t, "GET", event.Method)
+	require.Equal(t, "/api", event.Path)
+	require.Equal(t, map[string]interface{}{"host": "example.com"}, event.Fields)
+
+	// The method is only read from the message of the HTTP log events that are request lines
+	zlog.Info().Int(EventTypeKey, int(HTTP)).Str(PathKey, "/api").Msg("request failed")
+	require.NoError(t, writer.err)
+	require.Empty(t, writer.event.Method)
+	require.Equal(t, "/api", writer.event.Path)
+	zlog.Info().Str(PathKey, "/api").Msg("GET https://example.com/api HTTP/1.1")
+	require.NoError(t, writer.err)
+	require.Empty(t, writer.event.Method)
+}
+
+// Validate the tags are promoted out of the Fields when they are strings
+func TestParseZerologEvent_Tags(t *testing.T) {
+	writer := mockWriter{}
+	zlog := zerolog.New(&writer).With().Timestamp().Logger().Level(zerolog.InfoLevel)
+	zlog.Info().Strs(TagsKey, []string{"customer-a", "eu"}).Msg("connected")
+	require.NoError(t, writer.err)
+	require.Equal(t, []string{"customer-a", "eu"}, writer.event.Tags)
+	require.NotContains(t, writer.event.Fields, TagsKey)
+
+	zlog.Info().Ints(TagsKey, []int{1, 2}).Msg("connected")
+	require.NoError(t, writer.err)
+	require.Empty(t, writer.event.Tags)
+	require.Contains(t, writer.event.Fields, TagsKey)
+}
+
+// Validate the connection ID is the index of the connection of the tunnel
+func TestParseZerologEvent_ConnID(t *testing.T) {
+	writer := mockWriter{}
+	zlog := zerolog.New(&writer).With().Timestamp().Logger().Level(zerolog.InfoLevel)
+	zlog.Info().Uint8(ConnIndexKey, 2).Msg("request")
+	require.NoError(t, writer.err)
+	require.Equal(t, "2", writer.event.ConnID)
+	require.Equal(t, map[string]interface{}{ConnIndexKey: float64(2)}, writer.event.Fields)
+
+	zlog.Info().Msg("connected")
+	require.NoError(t, writer.err)
+	require.Empty(t, writer.event.ConnID)
+}
+
+// Validate the log of a zerolog event has the same fields extracted as the written log events
+func TestNewLogFromZerolog(t *testing.T) {
+	log, err := NewLogFromZerolog(func(e *zerolog.Event) {
+		e.Int(EventTypeKey, int(HTTP)).
+			Str(MethodKey, "GET").
+			Str(PathKey, "/api").
+			Uint8(ConnIndexKey, 1).
+			Strs(TagsKey, []string{"eu"}).
+			Int("status", 502)
+	}, zerolog.WarnLevel, "request failed")
+	require.NoError(t, err)
+	require.NotEmpty(t, log.Time)
+	require.Equal(t, Warn, log.Level)
+	require.Equal(t, HTTP, log.Event)
+	require.Equal(t, "request failed", log.Message)
+	require.Equal(t, "GET", log.Method)
+	require.Equal(t, "/api", log.Path)
+	require.Equal(t, "1", log.ConnID)
+	require.Equal(t, []string{"eu"}, log.Tags)
+	require.Equal(t, map[string]interface{}{ConnIndexKey: float64(1), "status": float64(502)}, log.Fields)
+
+	// The events without fields are cloudflared events
+	log, err = NewLogFromZerolog(nil, zerolog.InfoLevel, "connected")
+	require.NoError(t, err)
+	require.Equal(t, Info, log.Level)
+	require.Equal(t, Cloudflared, log.Event)
+	require.Empty(t, log.Fields)
+}
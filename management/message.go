@@ -0,0 +1,95 @@
+package management
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"nhooyr.io/websocket"
+)
+
+// MessageReader reads the messages of a management connection. It is implemented by *websocket.Conn.
+type MessageReader interface {
+	Read(ctx context.Context) (websocket.MessageType, []byte, error)
+}
+
+// MessageWriter writes the messages of a management connection. It is implemented by *websocket.Conn.
+type MessageWriter interface {
+	Write(ctx context.Context, messageType websocket.MessageType, message []byte) error
+}
+
+// Sequence numbers the client events written with WriteEvent to a MessageWriter that embeds it. The sequence starts
+// at 1 so that a zero Seq identifies a client that doesn't number its events.
+type Sequence struct {
+	last atomic.Uint64
+}
+
+// NextSeq returns the sequence number of the next client event.
+func (s *Sequence) NextSeq() uint64 {
+	return s.last.Add(1)
+}
+
+// sequencer is implemented by the MessageWriters that number the client events.
+type sequencer interface {
+	NextSeq() uint64
+}
+
+// bytesReader replays pre-encoded messages.
+type bytesReader struct {
+	mu       sync.Mutex
+	messages [][]byte
+}
+
+// NewReaderFromBytes creates a MessageReader that replays the newline delimited messages of data (as written by
+// cloudflared tail --output raw) as text messages. Empty lines are skipped. Once all of the messages are read, io.EOF
+// is returned.
+func NewReaderFromBytes(data []byte) MessageReader {
+	r := &bytesReader{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) == 0 {
+			continue
+		}
+		r.messages = append(r.messages, line)
+	}
+	return r
+}
+
+func (r *bytesReader) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.messages) == 0 {
+		return 0, nil, io.EOF
+	}
+	message := r.messages[0]
+	r.messages = r.messages[1:]
+	return websocket.MessageText, message, nil
+}
+
+// bufferWriter captures the written messages.
+type bufferWriter struct {
+	mu  sync.Mutex
+	buf *bytes.Buffer
+}
+
+// NewWriterToBuffer creates a MessageWriter that captures the written messages to buf, one message per line, in the
+// same format that NewReaderFromBytes replays.
+func NewWriterToBuffer(buf *bytes.Buffer) MessageWriter {
+	return &bufferWriter{buf: buf}
+}
+
+func (w *bufferWriter) Write(ctx context.Context, messageType websocket.MessageType, message []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(message)
+	w.buf.WriteByte('\n')
+	return nil
+}
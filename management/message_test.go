@@ -0,0 +1,56 @@
+package management
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReaderFromBytes(t *testing.T) {
+	data := []byte(`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test1"}]}` + "\n\n" +
+		`{"type":"logs","logs":[{"time":"2023-01-01T00:00:00Z","message":"test2"}]}` + "\r\n")
+	reader := NewReaderFromBytes(data)
+	for _, expected := range []string{"test1", "test2"} {
+		event, err := ReadServerEvent(reader, context.Background())
+		require.NoError(t, err)
+		logs, ok := IntoServerEvent(event, Logs)
+		require.True(t, ok)
+		require.Len(t, logs.Logs, 1)
+		require.Equal(t, expected, logs.Logs[0].Message)
+	}
+	_, err := ReadServerEvent(reader, context.Background())
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestNewReaderFromBytes_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ReadServerEvent(NewReaderFromBytes([]byte(`{"type":"logs"}`)), ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewWriterToBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriterToBuffer(&buf)
+	require.NoError(t, WriteEvent(writer, context.Background(), &EventStartStreaming{
+		ClientEvent: ClientEvent{Type: StartStreaming},
+		Filters:     NewStreamingFilters(WithLevel(Warn)),
+	}))
+	require.NoError(t, WriteEvent(writer, context.Background(), &EventStopStreaming{
+		ClientEvent: ClientEvent{Type: StopStreaming},
+	}))
+
+	// The captured events can be replayed
+	reader := NewReaderFromBytes(buf.Bytes())
+	event, err := ReadClientEvent(reader, context.Background())
+	require.NoError(t, err)
+	start, ok := IntoClientEvent[EventStartStreaming](event, StartStreaming)
+	require.True(t, ok)
+	require.Equal(t, Warn, *start.Filters.Level)
+	event, err = ReadClientEvent(reader, context.Background())
+	require.NoError(t, err)
+	require.Equal(t, StopStreaming, event.Type)
+}
@@ -18,7 +18,9 @@ const (
 )
 
 var (
-	errMissingAccessToken = managementError{Code: 1001, Message: "missing access_token query parameter"}
+	errMissingAccessToken       = managementError{Code: 1001, Message: "missing access_token query parameter"}
+	errInvalidPollRequest       = managementError{Code: 1002, Message: "expected start streaming event in the poll request"}
+	errPollSessionLimitExceeded = managementError{Code: 1003, Message: reasonSessionLimitExceeded}
 )
 
 // HTTP middleware setting the parsed access_token claims in the request context
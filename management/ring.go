@@ -0,0 +1,85 @@
+package management
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Default number of the recent log events kept to replay them to the streaming sessions
+	DefaultLogRingSize = 10000
+	// Default time that the recent log events are kept for
+	DefaultLogRingTTL = 5 * time.Minute
+)
+
+// ringEntry is the zerolog event added to the ring with the sequence number, at the time.
+type ringEntry struct {
+	seq  uint64
+	at   time.Time
+	data []byte
+}
+
+// logRing keeps the recent log events in a circular array, overwriting the oldest once full. The writers reserve the
+// sequence numbers of the log events with an atomic counter and the entries are replaced atomically, so the log events
+// are added and read without a lock. The log events older than the TTL are expired when read, even if the ring isn't
+// full. The zerolog events are kept as written and only parsed when replayed, so that the events aren't parsed when
+// there are no sessions.
+type logRing struct {
+	entries []atomic.Pointer[ringEntry]
+	// Sequence number of the next log event added
+	next atomic.Uint64
+	ttl  time.Duration
+	// Level from which the Logger keeps the log events
+	level zerolog.Level
+}
+
+func newLogRing(size int, ttl time.Duration, level zerolog.Level) *logRing {
+	return &logRing{
+		entries: make([]atomic.Pointer[ringEntry], size),
+		ttl:     ttl,
+		level:   level,
+	}
+}
+
+// add adds a copy of the zerolog event to the ring at the time, and returns the position of the ring once it was added.
+func (r *logRing) add(p []byte, now time.Time) uint64 {
+	seq := r.next.Add(1) - 1
+	r.entries[seq%uint64(len(r.entries))].Store(&ringEntry{seq: seq, at: now, data: bytes.Clone(p)})
+	return seq + 1
+}
+
+// position returns the sequence number of the next log event added to the ring.
+func (r *logRing) position() uint64 {
+	return r.next.Load()
+}
+
+// before returns the log events added before the position, at or after the time since and within the TTL, oldest
+// first. The zerolog events that can't be parsed are skipped.
+func (r *logRing) before(pos uint64, since, now time.Time) []*Log {
+	size := uint64(len(r.entries))
+	start := uint64(0)
+	if pos > size {
+		start = pos - size
+	}
+	var logs []*Log
+	for seq := start; seq < pos; seq++ {
+		e := r.entries[seq%size].Load()
+		// The entry isn't there yet if its log event is still being added, or was overwritten since
+		if e == nil || e.seq != seq {
+			continue
+		}
+		if now.Sub(e.at) > r.ttl || e.at.Before(since) {
+			continue
+		}
+		log, err := parseZerologEvent(e.data)
+		if err != nil {
+			continue
+		}
+		log.seq = seq + 1
+		logs = append(logs, log)
+	}
+	return logs
+}
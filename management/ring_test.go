@@ -0,0 +1,83 @@
+package management
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// zerologEvent returns the zerolog event of the message, as written to the Logger.
+func zerologEvent(message string) []byte {
+	return []byte(`{"level":"info","message":"` + message + `"}`)
+}
+
+func messages(logs []*Log) []string {
+	var messages []string
+	for _, l := range logs {
+		messages = append(messages, l.Message)
+	}
+	return messages
+}
+
+func TestLogRing_Wraparound(t *testing.T) {
+	now := time.Now()
+	ring := newLogRing(3, time.Minute, zerolog.DebugLevel)
+	assert.Empty(t, ring.before(ring.position(), time.Time{}, now))
+	for i := 0; i < 5; i++ {
+		ring.add(zerologEvent(strconv.Itoa(i)), now)
+	}
+	assert.Equal(t, uint64(5), ring.position())
+	// The oldest log events are overwritten once the ring is full
+	assert.Equal(t, []string{"2", "3", "4"}, messages(ring.before(ring.position(), time.Time{}, now)))
+	// The log events added after the position aren't returned
+	assert.Equal(t, []string{"2", "3"}, messages(ring.before(4, time.Time{}, now)))
+}
+
+func TestLogRing_Parse(t *testing.T) {
+	now := time.Now()
+	ring := newLogRing(3, time.Minute, zerolog.DebugLevel)
+	// The zerolog event is copied since zerolog reuses its buffer
+	p := zerologEvent("first")
+	assert.Equal(t, uint64(1), ring.add(p, now))
+	copy(p, "invalid")
+	assert.Equal(t, uint64(2), ring.add(p, now))
+	// The events are parsed when read, skipping the invalid ones, and stamped with the position once added
+	logs := ring.before(ring.position(), time.Time{}, now)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "first", logs[0].Message)
+	assert.Equal(t, Info, logs[0].Level)
+	assert.Equal(t, uint64(1), logs[0].seq)
+}
+
+func TestLogRing_Expiry(t *testing.T) {
+	now := time.Now()
+	ring := newLogRing(10, time.Minute, zerolog.DebugLevel)
+	ring.add(zerologEvent("expired"), now.Add(-2*time.Minute))
+	ring.add(zerologEvent("old"), now.Add(-30*time.Second))
+	ring.add(zerologEvent("recent"), now.Add(-time.Second))
+	assert.Equal(t, []string{"old", "recent"}, messages(ring.before(ring.position(), time.Time{}, now)))
+	assert.Equal(t, []string{"recent"}, messages(ring.before(ring.position(), now.Add(-10*time.Second), now)))
+}
+
+func TestLogRing_ConcurrentAdd(t *testing.T) {
+	now := time.Now()
+	ring := newLogRing(100, time.Minute, zerolog.DebugLevel)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				ring.add(zerologEvent("test"), now)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, uint64(500), ring.position())
+	assert.Len(t, ring.before(ring.position(), time.Time{}, now), 100)
+}
@@ -0,0 +1,25 @@
+package management
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// The JSON Schema of the StreamingFilters, which is kept in sync with the struct by the tests
+//
+//go:embed filters_schema.json
+var streamingFiltersSchema []byte
+
+// StreamingFiltersJSONSchema returns the JSON Schema (draft-07) document of the StreamingFilters, which documents the
+// filters that the clients can provide. It is served by the management service at /schema/filters.
+func StreamingFiltersJSONSchema() []byte {
+	schema := make([]byte, len(streamingFiltersSchema))
+	copy(schema, streamingFiltersSchema)
+	return schema
+}
+
+func filtersSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(200)
+	_, _ = w.Write(streamingFiltersSchema)
+}
@@ -0,0 +1,117 @@
+package management
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaProperty struct {
+	Type  string          `json:"type"`
+	Enum  []string        `json:"enum"`
+	Items *schemaProperty `json:"items"`
+}
+
+type schemaDocument struct {
+	Schema     string                    `json:"$schema"`
+	Type       string                    `json:"type"`
+	Properties map[string]schemaProperty `json:"properties"`
+}
+
+func parseFiltersSchema(t *testing.T, data []byte) schemaDocument {
+	var schema schemaDocument
+	require.NoError(t, json.Unmarshal(data, &schema))
+	return schema
+}
+
+// schemaType returns the JSON Schema type of the values of the field.
+func schemaType(t reflect.Type) string {
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(LogLevel(0)), reflect.TypeOf(LogEventType(0)):
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaType(t.Elem())
+	case reflect.Slice:
+		return "array"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "integer"
+	}
+}
+
+// The schema documents each of the fields of the StreamingFilters, and only those
+func TestStreamingFiltersJSONSchema_Fields(t *testing.T) {
+	schema := parseFiltersSchema(t, StreamingFiltersJSONSchema())
+	assert.Equal(t, "http://json-schema.org/draft-07/schema#", schema.Schema)
+	assert.Equal(t, "object", schema.Type)
+
+	filters := reflect.TypeOf(StreamingFilters{})
+	var fields []string
+	for i := 0; i < filters.NumField(); i++ {
+		field := filters.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		fields = append(fields, name)
+		property, ok := schema.Properties[name]
+		if !assert.True(t, ok, "the schema doesn't document %s", name) {
+			continue
+		}
+		assert.Equal(t, schemaType(field.Type), property.Type, name)
+	}
+	var properties []string
+	for name := range schema.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(fields)
+	sort.Strings(properties)
+	assert.Equal(t, fields, properties)
+}
+
+// The enums of the schema are the values that the filters parse
+func TestStreamingFiltersJSONSchema_Enums(t *testing.T) {
+	schema := parseFiltersSchema(t, StreamingFiltersJSONSchema())
+	for _, level := range schema.Properties["level"].Enum {
+		_, ok := ParseLogLevel(level)
+		assert.True(t, ok, level)
+	}
+	assert.Len(t, schema.Properties["level"].Enum, 4)
+	for _, event := range schema.Properties["events"].Items.Enum {
+		_, ok := ParseLogEventType(event)
+		assert.True(t, ok, event)
+	}
+	assert.Len(t, schema.Properties["events"].Items.Enum, int(Internal)+1)
+}
+
+func TestStreamingFiltersJSONSchema_Copy(t *testing.T) {
+	schema := StreamingFiltersJSONSchema()
+	schema[0] = 'x'
+	assert.Equal(t, byte('{'), StreamingFiltersJSONSchema()[0])
+}
+
+func TestFiltersSchemaRoute(t *testing.T) {
+	mgmt := New("management.argotunnel.com", false, "1.1.1.1:80", uuid.Nil, "", &noopLogger, nil)
+	req := httptest.NewRequest("GET", managementHostname+"/schema/filters?access_token="+validToken, nil)
+	recorder := httptest.NewRecorder()
+	mgmt.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/schema+json", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, StreamingFiltersJSONSchema(), body)
+}
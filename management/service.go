@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,6 +30,26 @@ const (
 	// There is a limited idle time while not actively serving a session for a request before dropping the connection.
 	StatusIdleLimitExceeded websocket.StatusCode = 4003
 	reasonIdleLimitExceeded                      = "session was idle for too long"
+	// The filters provided by the client to start streaming are invalid.
+	StatusInvalidFilters websocket.StatusCode = 4004
+	// A streaming session is evicted once the client stops reading the log events without closing the connection.
+	reasonSessionIdle = "client stopped reading the streaming session"
+	// A streaming session is closed once it provided the MaxEvents of its filters.
+	reasonMaxEvents = "provided the maximum number of log events"
+	// Default time since the last message of a client after which its streaming session is evicted
+	DefaultMaxIdleDuration = 60 * time.Second
+	// Default interval of the checks for the streaming sessions to evict
+	DefaultIdleCheckInterval = 10 * time.Second
+	// Default interval of the Internal log events of the streaming sessions that include them
+	DefaultInternalEventsInterval = 30 * time.Second
+	// Close reasons are limited to 123 bytes by the websocket protocol
+	maxCloseReasonLength = 123
+	// Longest time a poll request waits for logs before responding without any
+	maxPollWait = 10 * time.Second
+	// Most logs provided in the response to a poll request
+	maxPollBatch = 1000
+	// Most of the buffered logs provided in each logs event when a streaming session starts
+	maxFlushBatch = 100
 )
 
 var (
@@ -45,6 +66,21 @@ var (
 type ManagementService struct {
 	// The management tunnel hostname
 	Hostname string
+	// Time since the last message of a client after which its streaming session is evicted, disabled when 0
+	MaxIdleDuration time.Duration
+	// Interval of the checks for the streaming sessions to evict
+	IdleCheckInterval time.Duration
+	// Interval of the Internal log events of the streaming sessions that include them
+	InternalEventsInterval time.Duration
+	// Returns the active tunnel connections for the Internal log events, which aren't provided when nil
+	OpenConns func() int
+	// Tuning of the AdaptiveBatcher of the live log events of each streaming session
+	BatchTuning BatchTuning
+	// Records the lifecycle of the streaming sessions, which isn't recorded when nil
+	Audit AuditLogger
+	// Paths of the health check requests of Cloudflare, of which the HTTP log events aren't provided to the streaming
+	// sessions with the ExcludeHealthChecks filter along with those of the probes of the load balancers
+	HealthCheckPaths []string
 
 	// Host details related configurations
 	serviceIP string
@@ -73,13 +109,19 @@ func New(managementHostname string,
 	logger LoggerListener,
 ) *ManagementService {
 	s := &ManagementService{
-		Hostname:       managementHostname,
-		log:            log,
-		logger:         logger,
-		serviceIP:      serviceIP,
-		clientID:       clientID,
-		label:          label,
-		metricsHandler: promhttp.Handler(),
+		Hostname:               managementHostname,
+		MaxIdleDuration:        DefaultMaxIdleDuration,
+		IdleCheckInterval:      DefaultIdleCheckInterval,
+		InternalEventsInterval: DefaultInternalEventsInterval,
+		BatchTuning:            DefaultBatchTuning,
+		Audit:                  NewAuditLogger(log),
+		HealthCheckPaths:       []string{HealthCheckPath},
+		log:                    log,
+		logger:                 logger,
+		serviceIP:              serviceIP,
+		clientID:               clientID,
+		label:                  label,
+		metricsHandler:         promhttp.Handler(),
 	}
 	r := chi.NewRouter()
 	r.Use(ValidateAccessTokenQueryMiddleware)
@@ -88,7 +130,9 @@ func New(managementHostname string,
 	r.With(corsHandler).Get("/ping", ping)
 	r.With(corsHandler).Head("/ping", ping)
 	r.Get("/logs", s.logs)
+	r.Post("/logs/poll", s.pollLogs)
 	r.With(corsHandler).Get("/host_details", s.getHostDetails)
+	r.With(corsHandler).Get("/schema/filters", filtersSchema)
 
 	// Diagnostic management services
 	if enableDiagServices {
@@ -184,32 +228,176 @@ func (m *ManagementService) readEvents(c *websocket.Conn, ctx context.Context, e
 
 // streamLogs will begin the process of reading from the Session listener and write the log events to the client.
 func (m *ManagementService) streamLogs(c *websocket.Conn, ctx context.Context, session *session) {
+	// The log events buffered while the session wasn't streaming are provided before the live log events
+	sent, err := m.flushBuffer(c, ctx, session)
+	if err != nil {
+		m.stopWriteError(c, session, err)
+		return
+	}
+	// The live log events are batched according to the pace of the client
+	batcher := NewAdaptiveBatcher(m.BatchTuning)
 	for session.Active() {
+		maxEvents := session.MaxEvents()
+		if maxEvents > 0 && sent >= maxEvents {
+			m.stopMaxEvents(c, ctx, session, sent)
+			return
+		}
 		select {
 		case <-ctx.Done():
 			session.Stop()
 			return
 		case event := <-session.listener:
-			err := WriteEvent(c, ctx, &EventLog{
-				ServerEvent: ServerEvent{Type: Logs},
-				Logs:        []*Log{event},
-			})
-			if err != nil {
-				// If the client (or the server) already closed the connection, don't attempt to close it again
-				if !IsClosed(err, m.log) {
-					m.log.Err(err).Send()
-					m.log.Err(c.Close(websocket.StatusInternalError, err.Error())).Send()
-				}
-				// Any errors when writing the messages to the client will stop streaming and close the connection
-				session.Stop()
+			logs, queuedAt := []*Log{event}, session.dequeued()
+			if session.replayed(event) {
+				continue
+			}
+			// The batch only includes the log events already buffered, so that it isn't held up waiting for more
+			limit := uint64(batcher.Size())
+			if maxEvents > 0 {
+				limit = min(limit, maxEvents-sent)
+			}
+			if limit > 1 {
+				buffered, _ := session.drain(int(limit) - 1)
+				logs = append(logs, buffered...)
+			}
+			start := time.Now()
+			if err := m.writeLogs(c, ctx, session, logs, queuedAt); err != nil {
+				m.stopWriteError(c, session, err)
 				return
 			}
+			batcher.Observe(time.Since(start))
+			sent += uint64(len(logs))
 		default:
 			// No messages to send
 		}
 	}
 }
 
+// flushBuffer writes the recent log events replayed by the session and then the log events buffered by the session in
+// the order they were received, in batches of up to maxFlushBatch log events, and returns the number of log events
+// written. The MaxEvents of the session is respected. It must only be called from the goroutine streaming the session,
+// before the live log events are streamed.
+func (m *ManagementService) flushBuffer(c *websocket.Conn, ctx context.Context, session *session) (uint64, error) {
+	var sent uint64
+	limit := func() int {
+		limit := uint64(maxFlushBatch)
+		if maxEvents := session.MaxEvents(); maxEvents > 0 {
+			limit = min(limit, maxEvents-min(sent, maxEvents))
+		}
+		return int(limit)
+	}
+	// The replayed log events weren't queued by the listener, so the latency of their batches isn't known
+	replay := session.takeReplay()
+	for len(replay) > 0 {
+		n := min(limit(), len(replay))
+		if n == 0 {
+			return sent, nil
+		}
+		if err := m.writeLogs(c, ctx, session, replay[:n], time.Time{}); err != nil {
+			return sent, err
+		}
+		replay = replay[n:]
+		sent += uint64(n)
+	}
+	for {
+		logs, queuedAt := session.drain(limit())
+		if len(logs) == 0 {
+			return sent, nil
+		}
+		if err := m.writeLogs(c, ctx, session, logs, queuedAt); err != nil {
+			return sent, err
+		}
+		sent += uint64(len(logs))
+	}
+}
+
+// writeLogs writes the log events of the session to the client in a single logs event, the first of which was queued
+// at the time.
+func (m *ManagementService) writeLogs(c *websocket.Conn, ctx context.Context, session *session, events []*Log, queuedAt time.Time) error {
+	logs := make([]*Log, 0, len(events))
+	for _, event := range events {
+		// The log event is shared between sessions so a copy is made to tag it with the connector id
+		log := *event
+		log.ConnectorID = m.clientID.String()
+		logs = append(logs, &log)
+	}
+	dropped := session.Dropped()
+	now := time.Now()
+	return WriteEvent(c, ctx, &EventLog{
+		ServerEvent:     ServerEvent{Type: Logs},
+		Logs:            logs,
+		Truncated:       dropped > 0,
+		DroppedCount:    dropped,
+		ServerTimestamp: now,
+		BatchSize:       len(logs),
+		BatchLatency:    batchLatency(queuedAt, now),
+	})
+}
+
+// batchLatency returns the time since the first log event of the batch was queued, or zero if it isn't known.
+func batchLatency(queuedAt, now time.Time) time.Duration {
+	if queuedAt.IsZero() {
+		return 0
+	}
+	return now.Sub(queuedAt)
+}
+
+// stopWriteError stops streaming and closes the connection once the log events can't be written to the client.
+func (m *ManagementService) stopWriteError(c *websocket.Conn, session *session, err error) {
+	// If the client (or the server) already closed the connection, don't attempt to close it again
+	if !IsClosed(err, m.log) {
+		m.log.Err(err).Send()
+		m.log.Err(c.Close(websocket.StatusInternalError, err.Error())).Send()
+	}
+	session.Stop()
+	m.auditClosed(session, auditReasonWriteError)
+}
+
+// evictIdle closes the connection of the streaming session if the client stopped reading, so that the writes to the
+// connection don't block. Returns true if the session was evicted.
+func (m *ManagementService) evictIdle(c *websocket.Conn, session *session, now time.Time) bool {
+	if !session.Idle(now) {
+		return false
+	}
+	m.log.Warn().Msgf("Evicting the management streaming session since no message was received from the client since %s", session.LastMessageAt().Format(time.RFC3339))
+	session.Stop()
+	m.logger.Remove(session)
+	m.auditClosed(session, reasonSessionIdle)
+	m.log.Err(c.Close(websocket.StatusGoingAway, reasonSessionIdle)).Send()
+	session.cancel()
+	return true
+}
+
+// stopMaxEvents stops the streaming session once it provided the MaxEvents of its filters, informing the client
+// before closing the connection.
+func (m *ManagementService) stopMaxEvents(c *websocket.Conn, ctx context.Context, session *session, sent uint64) {
+	m.log.Debug().Msgf("Stopping the management streaming session after %d log events", sent)
+	session.Stop()
+	m.logger.Remove(session)
+	m.auditClosed(session, reasonMaxEvents)
+	// The older clients are only informed by the close reason
+	if session.compat.streamStopped {
+		err := WriteEvent(c, ctx, &EventStreamStopped{
+			ServerEvent: ServerEvent{Type: StreamStopped},
+			Events:      sent,
+		})
+		if err != nil {
+			m.log.Debug().Err(err).Msg("unable to inform the client that streaming stopped")
+		}
+	}
+	m.log.Err(c.Close(websocket.StatusNormalClosure, reasonMaxEvents)).Send()
+	session.cancel()
+}
+
+// closeReason truncates the error to fit in the reason of a close message.
+func closeReason(err error) string {
+	reason := strings.ReplaceAll(err.Error(), "\n", "; ")
+	if len(reason) > maxCloseReasonLength {
+		reason = reason[:maxCloseReasonLength]
+	}
+	return reason
+}
+
 // canStartStream will check the conditions of the request and return if the session can begin streaming.
 func (m *ManagementService) canStartStream(session *session) bool {
 	m.streamingMut.Lock()
@@ -223,6 +411,7 @@ func (m *ManagementService) canStartStream(session *session) bool {
 				Msgf("Another management session request for the same actor was requested; the other session will be disconnected to handle the new request.")
 			existingSession.Stop()
 			m.logger.Remove(existingSession)
+			m.auditClosed(existingSession, auditReasonPreempted)
 			existingSession.cancel()
 		} else {
 			m.log.Warn().
@@ -281,7 +470,26 @@ func (m *ManagementService) logs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	session := newSession(logWindow, claims.Actor, cancel)
+	session.MaxIdleDuration = m.MaxIdleDuration
+	session.healthCheckPaths = m.HealthCheckPaths
 	defer m.logger.Remove(session)
+	defer m.auditClosed(session, auditReasonDisconnected)
+
+	// Evict the streaming session once the client stops reading
+	idleCheckInterval := m.IdleCheckInterval
+	if idleCheckInterval <= 0 {
+		idleCheckInterval = DefaultIdleCheckInterval
+	}
+	idleCheck := time.NewTicker(idleCheckInterval)
+	defer idleCheck.Stop()
+
+	// Provide the diagnostics of cloudflared to the streaming session if it includes them
+	internalEventsInterval := m.InternalEventsInterval
+	if internalEventsInterval <= 0 {
+		internalEventsInterval = DefaultInternalEventsInterval
+	}
+	internalEvents := time.NewTicker(internalEventsInterval)
+	defer internalEvents.Stop()
 
 	for {
 		select {
@@ -290,6 +498,7 @@ func (m *ManagementService) logs(w http.ResponseWriter, r *http.Request) {
 			c.Close(websocket.StatusNormalClosure, "context closed")
 			return
 		case event := <-events:
+			session.Touch(time.Now())
 			switch event.Type {
 			case StartStreaming:
 				idle.Stop()
@@ -300,21 +509,61 @@ func (m *ManagementService) logs(w http.ResponseWriter, r *http.Request) {
 					m.log.Err(c.Close(StatusInvalidCommand, reasonInvalidCommand)).Send()
 					return
 				}
+				if err := ValidateFilters(startEvent.Filters); err != nil {
+					m.log.Warn().Err(err).Msg("invalid filters provided to start streaming")
+					m.log.Err(c.Close(StatusInvalidFilters, closeReason(err))).Send()
+					return
+				}
 				// Make sure the session can start
 				if !m.canStartStream(session) {
 					m.log.Err(c.Close(StatusSessionLimitExceeded, reasonSessionLimitExceeded)).Send()
 					return
 				}
 				session.Filters(startEvent.Filters)
+				session.compat = newClientCompat(startEvent.ClientVersion)
+				session.clientVersion = startEvent.ClientVersion
+				m.auditCreated(session)
 				m.logger.Listen(session)
 				m.log.Debug().Msgf("Streaming logs")
 				go m.streamLogs(c, ctx, session)
-				continue
 			case StopStreaming:
 				idle.Reset(idleTimeout)
 				// Stop the current session for the current actor who requested it
 				session.Stop()
 				m.logger.Remove(session)
+				m.auditClosed(session, auditReasonStopStreaming)
+			case UpdateFilters:
+				updateEvent, ok := IntoClientEvent[EventUpdateFilters](event, UpdateFilters)
+				if !ok {
+					m.log.Warn().Msgf("invalid update_filters event received")
+					m.log.Err(c.Close(StatusInvalidCommand, reasonInvalidCommand)).Send()
+					return
+				}
+				if err := ValidateFilters(updateEvent.Filters); err != nil {
+					m.log.Warn().Err(err).Msg("invalid filters provided to update streaming")
+					m.log.Err(c.Close(StatusInvalidFilters, closeReason(err))).Send()
+					return
+				}
+				// The filters apply to the following log events of the session, whether it is streaming or not
+				oldFilters := session.currentFilters()
+				session.Filters(updateEvent.Filters)
+				m.auditUpdated(session, oldFilters)
+				m.log.Debug().Msgf("Updated streaming filters")
+			case Ping:
+				pingEvent, ok := IntoClientEvent[EventPing](event, Ping)
+				if !ok {
+					m.log.Debug().Msgf("invalid ping event received")
+					continue
+				}
+				// The pong acknowledges the ping itself
+				err := WriteEvent(c, ctx, &EventPong{
+					ServerEvent: ServerEvent{Type: Pong, AckSeq: pingEvent.Seq},
+					ID:          pingEvent.ID,
+				})
+				if err != nil {
+					m.log.Debug().Err(err).Msg("unable to respond to ping")
+				}
+				continue
 			case UnknownClientEventType:
 				fallthrough
 			default:
@@ -326,11 +575,147 @@ func (m *ManagementService) logs(w http.ResponseWriter, r *http.Request) {
 				}
 				return
 			}
+			// Acknowledge the processed event for the clients that number their events. The acknowledgement is an
+			// empty logs event so that it is written in the order that the events were processed, unlike the logs
+			// events of the streaming session.
+			if event.Seq > 0 {
+				err := WriteEvent(c, ctx, &EventLog{
+					ServerEvent: ServerEvent{Type: Logs, AckSeq: event.Seq},
+					Logs:        []*Log{},
+				})
+				if err != nil {
+					m.log.Debug().Err(err).Msg("unable to acknowledge client event")
+				}
+			}
 		case <-ping.C:
-			go c.Ping(ctx)
+			go func() {
+				// The pong is received from a client that still reads the connection
+				if err := c.Ping(ctx); err == nil {
+					session.Touch(time.Now())
+				}
+			}()
+		case now := <-idleCheck.C:
+			if m.evictIdle(c, session, now) {
+				return
+			}
+		case <-internalEvents.C:
+			if !session.Active() || !session.IncludeInternalEvents() {
+				continue
+			}
+			openConns := 0
+			if m.OpenConns != nil {
+				openConns = m.OpenConns()
+			}
+			log, err := runtimeStatsEvent(openConns, m.logger.ActiveSessions())
+			if err != nil {
+				m.log.Debug().Err(err).Msg("unable to create the runtime stats event")
+				continue
+			}
+			session.Insert(log)
 		case <-idle.C:
 			c.Close(StatusIdleLimitExceeded, reasonIdleLimitExceeded)
 			return
 		}
 	}
 }
+
+// Management Polling Logs handler for clients that are unable to use websockets. The request provides the
+// start_streaming event and the response provides the logs received until the first logs arrive or the poll wait
+// expires; logs emitted between the poll requests are not provided.
+func (m *ManagementService) pollLogs(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(accessClaimsCtxKey).(*managementTokenClaims)
+	if !ok || claims == nil {
+		// Typically should never happen as it is provided in the context from the middleware
+		writeHTTPErrorResponse(w, errMissingAccessToken)
+		return
+	}
+	var startEvent EventStartStreaming
+	if err := json.NewDecoder(r.Body).Decode(&startEvent); err != nil || startEvent.Type != StartStreaming {
+		writeHTTPErrorResponse(w, errInvalidPollRequest)
+		return
+	}
+	if err := ValidateFilters(startEvent.Filters); err != nil {
+		writeHTTPErrorResponse(w, managementError{Code: errInvalidPollRequest.Code, Message: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), maxPollWait)
+	defer cancel()
+	session := newSession(logWindow, claims.Actor, cancel)
+	session.healthCheckPaths = m.HealthCheckPaths
+	if !m.canStartStream(session) {
+		writeHTTPErrorResponse(w, errPollSessionLimitExceeded)
+		return
+	}
+	session.Filters(startEvent.Filters)
+	session.clientVersion = startEvent.ClientVersion
+	m.auditCreated(session)
+	m.logger.Listen(session)
+	logs, queuedAt := m.collectLogs(ctx, session)
+	session.Stop()
+	m.logger.Remove(session)
+	m.auditClosed(session, auditReasonPollComplete)
+	dropped := session.Dropped()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	now := time.Now()
+	err := json.NewEncoder(w).Encode(&EventLog{
+		ServerEvent:     ServerEvent{Type: Logs},
+		Logs:            logs,
+		Truncated:       dropped > 0,
+		DroppedCount:    dropped,
+		ServerTimestamp: now,
+		BatchSize:       len(logs),
+		BatchLatency:    batchLatency(queuedAt, now),
+	})
+	if err != nil {
+		m.log.Debug().Err(err).Msg("unable to respond to poll request")
+	}
+}
+
+// collectLogs waits for the first log of the session and then collects the logs that are already buffered, returning
+// them with the time that the first of them was queued. The recent log events replayed by the session are collected
+// first, without waiting.
+func (m *ManagementService) collectLogs(ctx context.Context, session *session) ([]*Log, time.Time) {
+	logs := make([]*Log, 0)
+	var firstQueuedAt time.Time
+	tag := func(event *Log) {
+		// The log event is shared between sessions so a copy is made to tag it with the connector id
+		log := *event
+		log.ConnectorID = m.clientID.String()
+		logs = append(logs, &log)
+	}
+	collect := func(event *Log) {
+		queuedAt := session.dequeued()
+		if session.replayed(event) {
+			return
+		}
+		if len(logs) == 0 {
+			firstQueuedAt = queuedAt
+		}
+		tag(event)
+	}
+	replay := session.takeReplay()
+	for _, event := range replay[:min(len(replay), maxPollBatch)] {
+		tag(event)
+	}
+	// The log events that were replayed are discarded, so the first log may not be the first received
+	for len(logs) == 0 {
+		select {
+		case <-ctx.Done():
+			return logs, firstQueuedAt
+		case event := <-session.listener:
+			collect(event)
+		}
+	}
+	for len(logs) < maxPollBatch {
+		select {
+		case event := <-session.listener:
+			collect(event)
+		default:
+			return logs, firstQueuedAt
+		}
+	}
+	return logs, firstQueuedAt
+}
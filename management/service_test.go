@@ -2,9 +2,11 @@ package management
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -142,3 +144,286 @@ func TestCanStartStream_ExistingSessionSameActor(t *testing.T) {
 	assert.Equal(t, 0, m.logger.ActiveSessions())
 	assert.False(t, session1.Active())
 }
+
+func TestStreamLogs_ConnectorID(t *testing.T) {
+	connectorID := uuid.New()
+	m := ManagementService{
+		log:      &noopLogger,
+		clientID: connectorID,
+	}
+	client, server := test.WSPipe(nil, nil)
+	server.CloseRead(context.Background())
+	defer func() {
+		server.Close(websocket.StatusInternalError, "")
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(logWindow, actor{}, cancel)
+	session.active.Store(true)
+	log := &Log{Time: "2023-01-01T00:00:00Z", Message: "test", Event: HTTP, Level: Info}
+	session.listener <- log
+	session.dropped.Store(3)
+	go m.streamLogs(server, ctx, session)
+
+	event, err := ReadServerEvent(client, context.Background())
+	require.NoError(t, err)
+	logs, ok := IntoServerEvent(event, Logs)
+	require.True(t, ok)
+	require.Len(t, logs.Logs, 1)
+	assert.Equal(t, connectorID.String(), logs.Logs[0].ConnectorID)
+	assert.Equal(t, "test", logs.Logs[0].Message)
+	// The events dropped before the log are reported with it
+	assert.True(t, logs.Truncated)
+	assert.Equal(t, uint64(3), logs.DroppedCount)
+	// The original log shared between sessions is left untouched
+	assert.Empty(t, log.ConnectorID)
+	session.Stop()
+	client.Close(websocket.StatusInternalError, "")
+}
+
+func TestEvictIdle(t *testing.T) {
+	logger := NewLogger()
+	m := ManagementService{
+		log:    &noopLogger,
+		logger: logger,
+	}
+	client, server := test.WSPipe(nil, nil)
+	defer client.Close(websocket.StatusInternalError, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(logWindow, actor{}, cancel)
+	session.MaxIdleDuration = time.Minute
+	session.active.Store(true)
+	logger.Listen(session)
+	now := session.LastMessageAt()
+
+	assert.False(t, m.evictIdle(server, session, now.Add(time.Minute)))
+	assert.Equal(t, 1, logger.ActiveSessions())
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		// The client reads the close frame once the session is evicted
+		_, _, err := client.Read(context.Background())
+		assert.Equal(t, websocket.StatusGoingAway, websocket.CloseStatus(err))
+	}()
+	assert.True(t, m.evictIdle(server, session, now.Add(2*time.Minute)))
+	<-closed
+	assert.False(t, session.Active())
+	assert.Equal(t, 0, logger.ActiveSessions())
+	// The context of the session is cancelled
+	assert.Error(t, ctx.Err())
+}
+
+func TestStreamLogs_MaxEvents(t *testing.T) {
+	logger := NewLogger()
+	m := ManagementService{
+		log:    &noopLogger,
+		logger: logger,
+	}
+	client, server := test.WSPipe(nil, nil)
+	defer client.Close(websocket.StatusInternalError, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(logWindow, actor{}, cancel)
+	session.Filters(NewStreamingFilters(WithMaxEvents(2)))
+	session.compat = newClientCompat("2024.6.0")
+	session.active.Store(true)
+	logger.Listen(session)
+	for _, message := range []string{"test1", "test2", "test3"} {
+		session.listener <- &Log{Time: "2023-01-01T00:00:00Z", Message: message}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.streamLogs(server, ctx, session)
+	}()
+
+	// The buffered log events are provided together, up to the MaxEvents
+	event, err := ReadServerEvent(client, context.Background())
+	require.NoError(t, err)
+	logs, ok := IntoServerEvent(event, Logs)
+	require.True(t, ok)
+	require.Len(t, logs.Logs, 2)
+	assert.Equal(t, "test1", logs.Logs[0].Message)
+	assert.Equal(t, "test2", logs.Logs[1].Message)
+	assert.False(t, logs.ServerTimestamp.IsZero())
+	event, err = ReadServerEvent(client, context.Background())
+	require.NoError(t, err)
+	stopped, ok := IntoServerControlEvent[EventStreamStopped](event, StreamStopped)
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), stopped.Events)
+	// The connection is closed without providing the other log events
+	_, err = ReadServerEvent(client, context.Background())
+	assert.Equal(t, websocket.StatusNormalClosure, websocket.CloseStatus(err))
+	<-done
+	assert.False(t, session.Active())
+	assert.Equal(t, 0, logger.ActiveSessions())
+	assert.Error(t, ctx.Err())
+}
+
+// The older clients that don't understand the EventStreamStopped are only informed by the close reason
+func TestStreamLogs_MaxEventsLegacyClient(t *testing.T) {
+	logger := NewLogger()
+	m := ManagementService{
+		log:    &noopLogger,
+		logger: logger,
+	}
+	client, server := test.WSPipe(nil, nil)
+	defer client.Close(websocket.StatusInternalError, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(logWindow, actor{}, cancel)
+	session.Filters(NewStreamingFilters(WithMaxEvents(1)))
+	session.compat = newClientCompat("")
+	session.active.Store(true)
+	logger.Listen(session)
+	session.listener <- &Log{Time: "2023-01-01T00:00:00Z", Message: "test1"}
+	go m.streamLogs(server, ctx, session)
+
+	event, err := ReadServerEvent(client, context.Background())
+	require.NoError(t, err)
+	_, ok := IntoServerEvent(event, Logs)
+	require.True(t, ok)
+	_, err = ReadServerEvent(client, context.Background())
+	assert.Equal(t, websocket.StatusNormalClosure, websocket.CloseStatus(err))
+}
+
+func TestFlushBuffer(t *testing.T) {
+	connectorID := uuid.New()
+	m := ManagementService{
+		log:      &noopLogger,
+		clientID: connectorID,
+	}
+	client, server := test.WSPipe(nil, nil)
+	defer client.Close(websocket.StatusInternalError, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(2*maxFlushBatch, actor{}, cancel)
+	var expected []string
+	for i := 0; i < maxFlushBatch+1; i++ {
+		expected = append(expected, strconv.Itoa(i))
+		session.listener <- &Log{Time: "2023-01-01T00:00:00Z", Message: expected[i]}
+	}
+	type flushed struct {
+		sent uint64
+		err  error
+	}
+	done := make(chan flushed, 1)
+	go func() {
+		sent, err := m.flushBuffer(server, ctx, session)
+		done <- flushed{sent: sent, err: err}
+	}()
+
+	// The buffered log events are provided in order, in batches
+	var messages []string
+	for _, size := range []int{maxFlushBatch, 1} {
+		event, err := ReadServerEvent(client, context.Background())
+		require.NoError(t, err)
+		logs, ok := IntoServerEvent(event, Logs)
+		require.True(t, ok)
+		require.Len(t, logs.Logs, size)
+		assert.Equal(t, size, logs.BatchSize)
+		for _, l := range logs.Logs {
+			assert.Equal(t, connectorID.String(), l.ConnectorID)
+			messages = append(messages, l.Message)
+		}
+	}
+	result := <-done
+	require.NoError(t, result.err)
+	assert.Equal(t, uint64(maxFlushBatch+1), result.sent)
+	assert.Equal(t, expected, messages)
+	assert.Empty(t, session.listener)
+}
+
+func TestFlushBuffer_Replay(t *testing.T) {
+	m := ManagementService{
+		log:      &noopLogger,
+		clientID: uuid.New(),
+	}
+	client, server := test.WSPipe(nil, nil)
+	defer client.Close(websocket.StatusInternalError, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(logWindow, actor{}, cancel)
+	session.Filters(NewStreamingFilters(WithLastN(2), WithMaxEvents(3)))
+	session.replay = []*Log{{Time: "2023-01-01T00:00:00Z", Message: "replay1"}, {Time: "2023-01-01T00:00:00Z", Message: "replay2"}}
+	session.Insert(&Log{Time: "2023-01-01T00:00:00Z", Message: "live1"})
+	session.Insert(&Log{Time: "2023-01-01T00:00:00Z", Message: "live2"})
+	done := make(chan uint64, 1)
+	go func() {
+		sent, err := m.flushBuffer(server, ctx, session)
+		assert.NoError(t, err)
+		done <- sent
+	}()
+
+	// The replayed log events are provided before the buffered log events, up to the MaxEvents
+	var received []string
+	for len(received) < 3 {
+		event, err := ReadServerEvent(client, context.Background())
+		require.NoError(t, err)
+		logs, ok := IntoServerEvent(event, Logs)
+		require.True(t, ok)
+		received = append(received, messages(logs.Logs)...)
+	}
+	assert.Equal(t, uint64(3), <-done)
+	assert.Equal(t, []string{"replay1", "replay2", "live1"}, received)
+}
+
+func TestBatchLatency(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 50*time.Millisecond, batchLatency(now.Add(-50*time.Millisecond), now))
+	// The latency isn't known for the log events that weren't queued by the session
+	assert.Zero(t, batchLatency(time.Time{}, now))
+}
+
+func TestCloseReason(t *testing.T) {
+	err := ValidateFilters(NewStreamingFilters(WithEvents(HTTP, HTTP), WithSampling(2)))
+	assert.Equal(t, "duplicate event filter: http; invalid sampling filter: 2 is not in the range (0.0 .. 1.0)", closeReason(err))
+	assert.Len(t, closeReason(errors.New(strings.Repeat("a", 200))), maxCloseReasonLength)
+}
+
+func TestCollectLogs(t *testing.T) {
+	connectorID := uuid.New()
+	m := ManagementService{
+		log:      &noopLogger,
+		clientID: connectorID,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(logWindow, actor{}, cancel)
+	before := time.Now()
+	session.Insert(&Log{Message: "test1"})
+	session.Insert(&Log{Message: "test2"})
+	logs, queuedAt := m.collectLogs(ctx, session)
+	require.Len(t, logs, 2)
+	assert.Equal(t, "test1", logs[0].Message)
+	assert.Equal(t, connectorID.String(), logs[1].ConnectorID)
+	// The time that the first log was queued is provided
+	assert.False(t, queuedAt.Before(before))
+	assert.Empty(t, session.queuedAt)
+
+	// No logs are provided once the poll expires
+	cancel()
+	logs, queuedAt = m.collectLogs(ctx, session)
+	assert.Empty(t, logs)
+	assert.True(t, queuedAt.IsZero())
+}
+
+func TestPollLogs_InvalidRequest(t *testing.T) {
+	mgmt := New("management.argotunnel.com", false, "1.1.1.1:80", uuid.Nil, "", &noopLogger, &Logger{Log: &noopLogger})
+	for _, body := range []string{
+		`{"type":"stop_streaming"}`,
+		`{"type":"start_streaming","filters":{"sampling":2}}`,
+	} {
+		req := httptest.NewRequest("POST", managementHostname+"/logs/poll?access_token="+validToken, strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		mgmt.ServeHTTP(recorder, req)
+		resp := recorder.Result()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		var errResp managementErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+		require.Len(t, errResp.Errors, 1)
+		assert.Equal(t, errInvalidPollRequest.Code, errResp.Errors[0].Code)
+	}
+}
@@ -3,7 +3,12 @@ package management
 import (
 	"context"
 	"math/rand"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 const (
@@ -15,6 +20,8 @@ const (
 
 // session captures a streaming logs session for a connection of an actor.
 type session struct {
+	// Unique identifier of the session, used to unregister it from the broadcaster
+	id string
 	// Indicates if the session is streaming or not. Modifying this will affect the active session.
 	active atomic.Bool
 	// Allows the session to control the context of the underlying connection to close it out when done. Mostly
@@ -24,26 +31,76 @@ type session struct {
 	actor actor
 	// Buffered channel that holds the recent log events
 	listener chan *Log
+	// Guards the filters, sampler and limiter, which can be replaced while the session is streaming
+	mu sync.RWMutex
 	// Types of log events that this session will provide through the listener
 	filters *StreamingFilters
 	// Sampling of the log events this session will send (runs after all other filters if available)
 	sampler *sampler
+	// Limits the rate of the log events this session will send (runs after sampling if available)
+	limiter *rateLimiter
+	// Guards the times that the log events in the listener were queued, which are in the order of the listener
+	queueMu  sync.Mutex
+	queuedAt []time.Time
+	// Log events discarded because the listener was full since they were last reported to the client
+	dropped atomic.Uint64
+	// Guards the recent log events that the session replays before the log events of the listener
+	replayMu sync.Mutex
+	replay   []*Log
+	// Position of the ring until which the log events were replayed, after which the log events are provided live
+	replayedTo atomic.Uint64
+	// Time (in unix nanoseconds) that the last message of the client, or the pong of a ping, was received
+	lastMessageAt atomic.Int64
+	// Time since the last message of the client after which the streaming session is evicted, disabled when 0
+	MaxIdleDuration time.Duration
+	// Paths of the health check requests that aren't provided with the ExcludeHealthChecks filter
+	healthCheckPaths []string
+	// What the client understands of the server events, and the version that it reported, set before the session
+	// starts streaming
+	compat        clientCompat
+	clientVersion string
+	// Indicates if the session started streaming and wasn't reported closed to the AuditLogger since
+	audited atomic.Bool
 }
 
 // NewSession creates a new session.
 func newSession(size int, actor actor, cancel context.CancelFunc) *session {
 	s := &session{
+		id:       uuid.NewString(),
 		active:   atomic.Bool{},
 		cancel:   cancel,
 		actor:    actor,
 		listener: make(chan *Log, size),
 		filters:  &StreamingFilters{},
+
+		healthCheckPaths: []string{HealthCheckPath},
 	}
+	s.Touch(time.Now())
 	return s
 }
 
-// Filters assigns the StreamingFilters to the session
+// Touch records that a message of the client was received at the time.
+func (s *session) Touch(now time.Time) {
+	s.lastMessageAt.Store(now.UnixNano())
+}
+
+// LastMessageAt returns the time that the last message of the client was received.
+func (s *session) LastMessageAt() time.Time {
+	return time.Unix(0, s.lastMessageAt.Load())
+}
+
+// Idle returns if the session is streaming but the client hasn't sent a message for longer than the
+// MaxIdleDuration, e.g. because the client stopped reading the log events without closing the connection.
+func (s *session) Idle(now time.Time) bool {
+	return s.MaxIdleDuration > 0 && s.Active() && now.Sub(s.LastMessageAt()) > s.MaxIdleDuration
+}
+
+// Filters assigns the StreamingFilters to the session, replacing the previous filters
 func (s *session) Filters(filters *StreamingFilters) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sampler = nil
+	s.limiter = nil
 	if filters != nil {
 		s.filters = filters
 		sampling := filters.Sampling
@@ -60,33 +117,203 @@ func (s *session) Filters(filters *StreamingFilters) {
 				p: int(sampling * 100),
 			}
 		}
+		if filters.MaxRate > 0 {
+			s.limiter = &rateLimiter{rate: filters.MaxRate}
+		}
 	} else {
 		s.filters = &StreamingFilters{}
 	}
 }
 
-// Insert attempts to insert the log to the session. If the log event matches the provided session filters, it
-// will be applied to the listener.
-func (s *session) Insert(log *Log) {
+// currentFilters returns the StreamingFilters of the session, which are replaced rather than modified.
+func (s *session) currentFilters() *StreamingFilters {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filters
+}
+
+// auditSession describes the session for the AuditLogger.
+func (s *session) auditSession() *Session {
+	return &Session{
+		ID:            s.id,
+		ActorID:       s.actor.ID,
+		Support:       s.actor.Support,
+		ClientVersion: s.clientVersion,
+		Filters:       s.currentFilters(),
+	}
+}
+
+// MaxEvents returns the log events that the session provides before it stops streaming, unlimited when 0.
+func (s *session) MaxEvents() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filters.MaxEvents
+}
+
+// IncludeInternalEvents returns if the session provides the Internal log events.
+func (s *session) IncludeInternalEvents() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filters.IncludeInternalEvents
+}
+
+// replays returns if the session replays the recent log events before the live log events.
+func (s *session) replays() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filters.Since != nil || s.filters.LastN > 0
+}
+
+// replayFrom keeps the log events of the ring added before the position that match the filters of the session, to
+// replay them before the log events of the listener. Only the last LastN are kept if provided.
+func (s *session) replayFrom(ring *logRing, pos uint64, now time.Time) {
+	s.mu.RLock()
+	var since time.Time
+	if s.filters.Since != nil {
+		since = *s.filters.Since
+	}
+	lastN := s.filters.LastN
+	var replay []*Log
+	for _, log := range ring.before(pos, since, now) {
+		if s.matches(log) {
+			replay = append(replay, log)
+		}
+	}
+	s.mu.RUnlock()
+	if lastN > 0 && uint(len(replay)) > lastN {
+		replay = replay[uint(len(replay))-lastN:]
+	}
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+	s.replay = replay
+	s.replayedTo.Store(pos)
+}
+
+// replayed returns if the log event received from the listener was added to the ring before the position that the
+// session replayed the log events of, so that it is discarded rather than provided twice.
+func (s *session) replayed(log *Log) bool {
+	return log.seq != 0 && log.seq <= s.replayedTo.Load()
+}
+
+// takeReplay returns the log events that the session replays, which are only returned once.
+func (s *session) takeReplay() []*Log {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+	replay := s.replay
+	s.replay = nil
+	return replay
+}
+
+// matches returns if the log event matches the filters of the session. The filters must be read locked.
+func (s *session) matches(log *Log) bool {
+	// Internal events are only provided when requested
+	if log.Event == Internal && !s.filters.IncludeInternalEvents {
+		return false
+	}
 	// Level filters are optional
 	if s.filters.Level != nil {
 		if *s.filters.Level > log.Level {
-			return
+			return false
 		}
 	}
 	// Event filters are optional
 	if len(s.filters.Events) != 0 && !contains(s.filters.Events, log.Event) {
+		return false
+	}
+	// Method filters are optional
+	if s.filters.Method != "" && !strings.EqualFold(log.Method, s.filters.Method) {
+		return false
+	}
+	// Path filters are optional and only apply to the HTTP log events
+	if s.filters.PathPattern != "" && log.Event == HTTP && !MatchPath(s.filters.PathPattern, log.Path) {
+		return false
+	}
+	// Connection filters are optional
+	if s.filters.ConnID != "" && log.ConnID != s.filters.ConnID {
+		return false
+	}
+	// Health check filters are optional
+	if s.filters.ExcludeHealthChecks && IsHealthCheck(log, s.healthCheckPaths) {
+		return false
+	}
+	// Tag filters are optional
+	if len(s.filters.TagFilters) != 0 && !matchesTags(log.Tags, s.filters.TagFilters) {
+		return false
+	}
+	// Search term filters are optional
+	if s.filters.SearchTerm != "" && !strings.Contains(log.Message, s.filters.SearchTerm) {
+		return false
+	}
+	return true
+}
+
+// Insert attempts to insert the log to the session. If the log event matches the provided session filters, it
+// will be applied to the listener.
+func (s *session) Insert(log *Log) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.matches(log) {
 		return
 	}
 	// Sampling is also optional
 	if s.sampler != nil && !s.sampler.Sample() {
 		return
 	}
+	// Rate limiting is also optional
+	if s.limiter != nil && !s.limiter.Allow(time.Now()) {
+		return
+	}
+	// The time is queued along with the log so that both are in the same order
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
 	select {
 	case s.listener <- log:
+		s.queuedAt = append(s.queuedAt, time.Now())
 	default:
 		// buffer is full, discard
+		s.dropped.Add(1)
+	}
+}
+
+// dequeued returns the time that the log event received from the listener was queued, or zero if it wasn't queued by
+// Insert. It must be called once for each log event received from the listener.
+func (s *session) dequeued() time.Time {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if len(s.queuedAt) == 0 {
+		return time.Time{}
+	}
+	queuedAt := s.queuedAt[0]
+	s.queuedAt = s.queuedAt[1:]
+	return queuedAt
+}
+
+// drain returns up to n of the log events buffered by the listener, in the order they were received, without waiting
+// for more, along with the time that the first of them was queued. The log events that were replayed are discarded.
+func (s *session) drain(n int) ([]*Log, time.Time) {
+	var logs []*Log
+	var firstQueuedAt time.Time
+	for len(logs) < n {
+		select {
+		case log := <-s.listener:
+			queuedAt := s.dequeued()
+			if s.replayed(log) {
+				continue
+			}
+			if len(logs) == 0 {
+				firstQueuedAt = queuedAt
+			}
+			logs = append(logs, log)
+		default:
+			return logs, firstQueuedAt
+		}
 	}
+	return logs, firstQueuedAt
+}
+
+// Dropped returns the number of log events discarded since the last call because the listener was full.
+func (s *session) Dropped() uint64 {
+	return s.dropped.Swap(0)
 }
 
 // Active returns if the session is active
@@ -99,6 +326,18 @@ func (s *session) Stop() {
 	s.active.Store(false)
 }
 
+// matchesTags returns true if one of the tags contains one of the tag filters.
+func matchesTags(tags, filters []string) bool {
+	for _, tag := range tags {
+		for _, filter := range filters {
+			if strings.Contains(tag, filter) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func contains(array []LogEventType, t LogEventType) bool {
 	for _, v := range array {
 		if v == t {
@@ -118,3 +357,27 @@ func (s *sampler) Sample() bool {
 	return rand.Intn(100) <= s.p
 
 }
+
+// rateLimiter allows up to rate events in each one second window.
+type rateLimiter struct {
+	rate uint
+
+	mu     sync.Mutex
+	window time.Time
+	count  uint
+}
+
+// Allow returns true if the event is within the rate, false if the event should be dropped.
+func (r *rateLimiter) Allow(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.window) >= time.Second {
+		r.window = now
+		r.count = 0
+	}
+	if r.count >= r.rate {
+		return false
+	}
+	r.count++
+	return true
+}
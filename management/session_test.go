@@ -2,9 +2,11 @@ package management
 
 import (
 	"context"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,6 +24,25 @@ func TestSession_ActiveControl(t *testing.T) {
 	assert.False(t, session.Active())
 }
 
+func TestSession_Idle(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(4, actor{}, cancel)
+	now := session.LastMessageAt()
+	session.MaxIdleDuration = time.Minute
+	// Only the streaming sessions are idle
+	assert.False(t, session.Idle(now.Add(2*time.Minute)))
+	session.active.Store(true)
+	assert.False(t, session.Idle(now.Add(time.Minute)))
+	assert.True(t, session.Idle(now.Add(2*time.Minute)))
+	// A message of the client resets the idle duration
+	session.Touch(now.Add(90 * time.Second))
+	assert.False(t, session.Idle(now.Add(2*time.Minute)))
+	// The eviction is disabled without a duration
+	session.MaxIdleDuration = 0
+	assert.False(t, session.Idle(now.Add(time.Hour)))
+}
+
 // Validate that the session filters events
 func TestSession_Insert(t *testing.T) {
 	_, cancel := context.WithCancel(context.Background())
@@ -88,6 +109,27 @@ func TestSession_Insert(t *testing.T) {
 			},
 			expectLog: true,
 		},
+		{
+			name: "search term",
+			filters: StreamingFilters{
+				SearchTerm: "es",
+			},
+			expectLog: true,
+		},
+		{
+			name: "filtered out search term",
+			filters: StreamingFilters{
+				SearchTerm: "tunnel",
+			},
+			expectLog: false,
+		},
+		{
+			name: "max rate",
+			filters: StreamingFilters{
+				MaxRate: 1,
+			},
+			expectLog: true,
+		},
 		{
 			name: "filter and event",
 			filters: StreamingFilters{
@@ -96,6 +138,26 @@ func TestSession_Insert(t *testing.T) {
 			},
 			expectLog: true,
 		},
+		{
+			name:      "method",
+			filters:   StreamingFilters{Method: "get"},
+			expectLog: true,
+		},
+		{
+			name:      "other method",
+			filters:   StreamingFilters{Method: "POST"},
+			expectLog: false,
+		},
+		{
+			name:      "path pattern",
+			filters:   StreamingFilters{PathPattern: "/api/*/users"},
+			expectLog: true,
+		},
+		{
+			name:      "other path pattern",
+			filters:   StreamingFilters{PathPattern: "/api/*"},
+			expectLog: false,
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			session := newSession(4, actor{}, cancel)
@@ -105,6 +167,8 @@ func TestSession_Insert(t *testing.T) {
 				Event:   HTTP,
 				Level:   Info,
 				Message: "test",
+				Method:  "GET",
+				Path:    "/api/v1/users",
 			}
 			session.Insert(&log)
 			select {
@@ -117,6 +181,128 @@ func TestSession_Insert(t *testing.T) {
 	}
 }
 
+// Validate that the path pattern only filters the HTTP log events
+func TestSession_InsertPathPattern(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(4, actor{}, cancel)
+	session.Filters(NewStreamingFilters(WithPathPattern("/api/**")))
+	session.Insert(&Log{Event: HTTP, Path: "/static/app.js", Message: "dropped"})
+	session.Insert(&Log{Event: HTTP, Path: "/api/v2/users", Message: "request"})
+	session.Insert(&Log{Event: Cloudflared, Message: "connected"})
+	require.Len(t, session.listener, 2)
+	require.Equal(t, "request", (<-session.listener).Message)
+	require.Equal(t, "connected", (<-session.listener).Message)
+}
+
+// Validate that the tag filters match the tags containing them
+func TestSession_InsertTags(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(4, actor{}, cancel)
+	session.Filters(NewStreamingFilters(WithTags("customer-a", "eu")))
+	session.Insert(&Log{Tags: []string{"customer-b"}, Message: "other customer"})
+	session.Insert(&Log{Message: "untagged"})
+	session.Insert(&Log{Tags: []string{"customer-a"}, Message: "exact"})
+	session.Insert(&Log{Tags: []string{"prod", "eu-west"}, Message: "substring"})
+	require.Len(t, session.listener, 2)
+	require.Equal(t, "exact", (<-session.listener).Message)
+	require.Equal(t, "substring", (<-session.listener).Message)
+}
+
+// Validate that the connection filter only matches the log events of the connection
+func TestSession_InsertConnID(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(4, actor{}, cancel)
+	session.Filters(NewStreamingFilters(WithConnID("1")))
+	session.Insert(&Log{ConnID: "0", Message: "other connection"})
+	session.Insert(&Log{Message: "no connection"})
+	session.Insert(&Log{ConnID: "1", Message: "connection"})
+	require.Len(t, session.listener, 1)
+	require.Equal(t, "connection", (<-session.listener).Message)
+}
+
+func TestSession_InsertExcludeHealthChecks(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(4, actor{}, cancel)
+	session.Filters(NewStreamingFilters(WithoutHealthChecks()))
+	session.healthCheckPaths = []string{HealthCheckPath, "/health"}
+	session.Insert(&Log{Event: HTTP, Path: HealthCheckPath, Message: "health check"})
+	session.Insert(&Log{Event: HTTP, Path: "/health", Message: "other health check"})
+	session.Insert(&Log{Event: HTTP, Path: "/", Fields: map[string]interface{}{LBProbeKey: true}, Message: "monitor"})
+	session.Insert(&Log{Event: HTTP, Path: "/", Message: "request"})
+	require.Len(t, session.listener, 1)
+	require.Equal(t, "request", (<-session.listener).Message)
+}
+
+func TestSession_InsertInternalEvents(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(4, actor{}, cancel)
+	// The internal events are only provided when included
+	session.Insert(&Log{Event: Internal, Message: "runtime stats"})
+	require.Len(t, session.listener, 0)
+	require.False(t, session.IncludeInternalEvents())
+
+	session.Filters(NewStreamingFilters(WithInternalEvents(), WithEvents(Internal)))
+	require.True(t, session.IncludeInternalEvents())
+	session.Insert(&Log{Event: Internal, Message: "runtime stats"})
+	session.Insert(&Log{Event: HTTP, Message: "request"})
+	require.Len(t, session.listener, 1)
+	require.Equal(t, "runtime stats", (<-session.listener).Message)
+}
+
+func TestSession_Replay(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Now()
+	ring := newLogRing(10, time.Minute, zerolog.DebugLevel)
+	for i := 0; i < 4; i++ {
+		ring.add(zerologEvent(strconv.Itoa(i)), now)
+		ring.add([]byte(`{"level":"debug","message":"debug"}`), now)
+	}
+	session := newSession(4, actor{}, cancel)
+	require.False(t, session.replays())
+
+	// The replayed log events match the filters of the session, and only the last N are kept
+	session.Filters(NewStreamingFilters(WithLevel(Info), WithLastN(3)))
+	require.True(t, session.replays())
+	session.replayFrom(ring, ring.position(), now)
+	assert.Equal(t, []string{"1", "2", "3"}, messages(session.takeReplay()))
+	// The log events are only replayed once
+	assert.Empty(t, session.takeReplay())
+	// Sampling doesn't apply to the replayed log events
+	session.Filters(NewStreamingFilters(WithSince(now.Add(-time.Second)), WithSampling(0.01), WithEvents(Cloudflared)))
+	session.replayFrom(ring, ring.position(), now)
+	assert.Len(t, session.takeReplay(), 8)
+}
+
+// Validate that the filters of the session can be replaced
+func TestSession_UpdateFilters(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(4, actor{}, cancel)
+	session.Filters(NewStreamingFilters(WithLevel(Warn), WithMaxRate(1)))
+	log := Log{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Event:   HTTP,
+		Level:   Info,
+		Message: "test",
+	}
+	session.Insert(&log)
+	require.Len(t, session.listener, 0)
+	// The rate limiter of the previous filters doesn't apply anymore
+	session.Filters(NewStreamingFilters(WithLevel(Info)))
+	session.Insert(&log)
+	session.Insert(&log)
+	require.Len(t, session.listener, 2)
+	session.Filters(NewStreamingFilters(WithEvents(TCP)))
+	session.Insert(&log)
+	require.Len(t, session.listener, 2)
+}
+
 // Validate that the session has a max amount of events to hold
 func TestSession_InsertOverflow(t *testing.T) {
 	_, cancel := context.WithCancel(context.Background())
@@ -144,4 +330,34 @@ func TestSession_InsertOverflow(t *testing.T) {
 	default:
 		// pass
 	}
+	// The discarded event is reported once
+	require.Equal(t, uint64(1), session.Dropped())
+	require.Equal(t, uint64(0), session.Dropped())
+}
+
+// Validate that the rate limiter allows the rate of events in each window
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter := &rateLimiter{rate: 2}
+	now := time.Now()
+	assert.True(t, limiter.Allow(now))
+	assert.True(t, limiter.Allow(now.Add(100*time.Millisecond)))
+	assert.False(t, limiter.Allow(now.Add(200*time.Millisecond)))
+	// The next window allows the events again
+	assert.True(t, limiter.Allow(now.Add(time.Second)))
+}
+
+// Validate that the times the log events were queued are dequeued in the order of the listener
+func TestSession_Dequeued(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newSession(1, actor{}, cancel)
+	before := time.Now()
+	session.Insert(&Log{Message: "first"})
+	// The log event dropped while the listener is full isn't queued
+	session.Insert(&Log{Message: "dropped"})
+	require.Len(t, session.queuedAt, 1)
+
+	require.Equal(t, "first", (<-session.listener).Message)
+	assert.False(t, session.dequeued().Before(before))
+	assert.True(t, session.dequeued().IsZero())
 }
@@ -0,0 +1,81 @@
+package management
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version is a calendar version of cloudflared (year.month.patch), as reported by the clients in the ClientVersion
+// of the EventStartStreaming.
+type Version struct {
+	Year  int
+	Month int
+	Patch int
+	// Commits of the build since the release, as described by git (e.g. 2024.5.0-12-gabcdef)
+	Commits int
+}
+
+// ParseVersion parses a version of cloudflared, along with the commits of the build since the release if described
+// by git. It returns false for the versions of the development builds (e.g. DEV).
+func ParseVersion(v string) (Version, bool) {
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) != 3 {
+		return Version{}, false
+	}
+	patch, describe, _ := strings.Cut(parts[2], "-")
+	commits := "0"
+	if describe != "" {
+		commits, _, _ = strings.Cut(describe, "-")
+	}
+	var numbers [4]int
+	for i, part := range []string{parts[0], parts[1], patch, commits} {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, false
+		}
+		numbers[i] = n
+	}
+	return Version{Year: numbers[0], Month: numbers[1], Patch: numbers[2], Commits: numbers[3]}, true
+}
+
+// Before returns true if the version was built before the other.
+func (v Version) Before(other Version) bool {
+	if v.Year != other.Year {
+		return v.Year < other.Year
+	}
+	if v.Month != other.Month {
+		return v.Month < other.Month
+	}
+	if v.Patch != other.Patch {
+		return v.Patch < other.Patch
+	}
+	return v.Commits < other.Commits
+}
+
+func (v Version) String() string {
+	s := strconv.Itoa(v.Year) + "." + strconv.Itoa(v.Month) + "." + strconv.Itoa(v.Patch)
+	if v.Commits > 0 {
+		s += "-" + strconv.Itoa(v.Commits)
+	}
+	return s
+}
+
+// clientCompat is what the client of a streaming session understands of the server events, so that the events that
+// the older clients can't parse aren't sent to them. The fields added to the existing server events since, such as the
+// AckSeq, the Seq of the replayed logs and the stats of the batches, are sent to every client: the older clients
+// decode the events with encoding/json, which ignores the unknown fields.
+type clientCompat struct {
+	// The client handles the EventStreamStopped before the connection is closed. The older clients only log the
+	// server events of unknown types as unexpected.
+	streamStopped bool
+}
+
+// newClientCompat returns what the client understands from the ClientVersion that it reported. The ClientVersion
+// was added along with the EventStreamStopped, so the clients that report any version, including the development
+// builds, understand it, while the clients that don't report a version predate both. The shims of the server events
+// added later compare the ParseVersion of the ClientVersion with the first release that understands them.
+func newClientCompat(clientVersion string) clientCompat {
+	return clientCompat{
+		streamStopped: clientVersion != "",
+	}
+}
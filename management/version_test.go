@@ -0,0 +1,46 @@
+package management
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, tt := range []struct {
+		version  string
+		expected Version
+		ok       bool
+	}{
+		{version: "2024.5.0", expected: Version{Year: 2024, Month: 5, Patch: 0}, ok: true},
+		{version: "2023.10.12", expected: Version{Year: 2023, Month: 10, Patch: 12}, ok: true},
+		{version: "2024.5.0-12-gabcdef", expected: Version{Year: 2024, Month: 5, Patch: 0, Commits: 12}, ok: true},
+		{version: "DEV"},
+		{version: ""},
+		{version: "2024.5"},
+		{version: "2024.5.x"},
+		{version: "2024.-1.0"},
+	} {
+		v, ok := ParseVersion(tt.version)
+		assert.Equal(t, tt.ok, ok, tt.version)
+		assert.Equal(t, tt.expected, v, tt.version)
+	}
+}
+
+func TestVersion_Before(t *testing.T) {
+	v := Version{Year: 2024, Month: 5, Patch: 0}
+	assert.True(t, v.Before(Version{Year: 2024, Month: 5, Patch: 1}))
+	assert.True(t, v.Before(Version{Year: 2024, Month: 5, Patch: 0, Commits: 1}))
+	assert.True(t, v.Before(Version{Year: 2025, Month: 1, Patch: 0}))
+	assert.False(t, v.Before(v))
+	assert.False(t, v.Before(Version{Year: 2023, Month: 12, Patch: 3}))
+	assert.Equal(t, "2024.5.0-12", Version{Year: 2024, Month: 5, Patch: 0, Commits: 12}.String())
+}
+
+func TestNewClientCompat(t *testing.T) {
+	// The clients that don't report their version predate the EventStreamStopped
+	assert.False(t, newClientCompat("").streamStopped)
+	assert.True(t, newClientCompat("2024.5.0-3-g0123456").streamStopped)
+	assert.True(t, newClientCompat("2024.6.0").streamStopped)
+	assert.True(t, newClientCompat("DEV").streamStopped)
+}
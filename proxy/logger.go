@@ -13,11 +13,11 @@ import (
 
 const (
 	logFieldCFRay         = "cfRay"
-	logFieldLBProbe       = "lbProbe"
+	logFieldLBProbe       = management.LBProbeKey
 	logFieldRule          = "ingressRule"
 	logFieldOriginService = "originService"
 	logFieldFlowID        = "flowID"
-	logFieldConnIndex     = "connIndex"
+	logFieldConnIndex     = management.ConnIndexKey
 	logFieldDestAddr      = "destAddr"
 )
 
@@ -58,7 +58,7 @@ func logHTTPRequest(logger *zerolog.Logger, r *http.Request) {
 	logger.Debug().
 		Str("host", r.Host).
 		Str("path", r.URL.Path).
-		Interface("headers", r.Header).
+		Interface(management.HeadersKey, r.Header).
 		Int64("content-length", r.ContentLength).
 		Msgf("%s %s %s", r.Method, r.URL, r.Proto)
 }